@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/johanhenriksson/remux/tmux"
+	"github.com/spf13/cobra"
+)
+
+var adoptName string
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt-session [session]",
+	Short: "Turn a tmux session started by hand into a workspace's session",
+	Long: `Adopt a tmux session you started yourself in a worktree or checkout. The
+checkout the session was started in is registered as a workspace like
+open --here, unless it is one already, and the session is renamed to the
+workspace's session name. Its env is updated like env apply, and a window is
+added for each named tab in .remux.yaml the session doesn't have a window
+for. Windows the session already has are left alone.
+
+Without a session name, the current tmux session is adopted.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runAdopt,
+}
+
+func init() {
+	adoptCmd.Flags().StringVar(&adoptName, "name", "", "name of the workspace if the checkout isn't one yet (default: its directory name)")
+	rootCmd.AddCommand(adoptCmd)
+}
+
+func runAdopt(cmd *cobra.Command, args []string) error {
+	var session string
+	if len(args) > 0 {
+		session = args[0]
+	} else {
+		if !tmux.InSession() {
+			return errors.New("not in a tmux session, pass the name of the session to adopt")
+		}
+		var err error
+		if session, err = tmux.CurrentSession(); err != nil {
+			return fmt.Errorf("failed to get the current session: %w", err)
+		}
+	}
+
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
+	adoption, err := st.AdoptSession(cmd.Context(), spaces.AdoptOptions{
+		Session:   session,
+		Name:      adoptName,
+		BasePort:  globalConfig().BasePort,
+		PortCount: globalConfig().Ports,
+		Limits:    globalConfig().Limits,
+	})
+	if err != nil {
+		return err
+	}
+
+	if adoption.Renamed {
+		fmt.Printf("Renamed session %s to %s\n", session, tmux.SessionName(adoption.Name))
+	}
+	if len(adoption.Env.Set) > 0 {
+		fmt.Printf("Set: %s\n", strings.Join(adoption.Env.Set, " "))
+	}
+	if len(adoption.Tabs) > 0 {
+		fmt.Printf("Added tabs: %s\n", strings.Join(adoption.Tabs, " "))
+	}
+	fmt.Printf("Adopted session into workspace %s\n", adoption.Name)
+	return nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var browsePrint bool
+
+var browseCmd = &cobra.Command{
+	Use:   "browse [name]",
+	Short: "Open a workspace's pull request or branch in the browser",
+	Long: `Open the web page of a workspace's branch on its forge: the open pull or
+merge request if there is one, the branch once it has been pushed, or the
+repository otherwise. Without a name, the current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runBrowse,
+}
+
+func init() {
+	browseCmd.Flags().BoolVarP(&browsePrint, "print", "p", false, "print the URL instead of opening it")
+	rootCmd.AddCommand(browseCmd)
+}
+
+func runBrowse(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+
+	url, err := space.BrowseURL(cmd.Context())
+	if err != nil {
+		return err
+	}
+	if browsePrint {
+		fmt.Println(url)
+		return nil
+	}
+	return openBrowser(url)
+}
+
+// spaceArg loads the state holding the space named by an optional argument,
+// or the space containing the current directory if no name is given.
+func spaceArg(args []string) (*spaces.State, string, error) {
+	if len(args) == 0 {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get current directory: %w", err)
+		}
+		if dest, entry, err := spaces.FindSpace(cwd); err == nil {
+			st, err := loadState(dest)
+			if err != nil {
+				return nil, "", err
+			}
+			return st, entry.Name, nil
+		}
+		if st, name := boundHere(cwd); name != "" {
+			return st, name, nil
+		}
+		st, err := loadState(filepath.Dir(cwd))
+		if err != nil {
+			return nil, "", err
+		}
+		return st, filepath.Base(cwd), nil
+	}
+
+	dest, err := getDestDir()
+	if err != nil {
+		return nil, "", err
+	}
+	st, err := loadState(dest)
+	if err != nil {
+		return nil, "", err
+	}
+	name, err := resolveSpaceName(st.Registry, args[0])
+	if err != nil {
+		return nil, "", err
+	}
+	return st, name, nil
+}
+
+// boundHere returns the state and name of the checkout bound with open --here
+// that contains dir, or an empty name if there is none.
+func boundHere(dir string) (*spaces.State, string) {
+	dest, err := getDestDir()
+	if err != nil {
+		return nil, ""
+	}
+	st, err := loadState(dest)
+	if err != nil {
+		return nil, ""
+	}
+	return st, st.BoundAt(dir)
+}
+
+// openBrowser opens url in the default browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open browser (%s): %w", url, err)
+	}
+	return cmd.Wait()
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check [name]",
+	Short: "Run a workspace's readiness checklist before opening a pull request",
+	Long: `Check that a workspace is ready for a pull request: its worktree is clean,
+its branch is rebased on its base branch, no added line contains a TODO or
+FIXME marker, and the test and lint commands from the check section of
+.remux.yaml pass. Prints pass or FAIL per check and exits with a non-zero
+code if any check failed. Without a name, the current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	results, err := st.Check(cmd.Context(), name)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Passed() {
+			fmt.Printf("pass\t%s\n", r.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL\t%s: %v\n", r.Name, r.Err)
+		if r.Output != "" {
+			fmt.Println("\t" + strings.ReplaceAll(r.Output, "\n", "\n\t"))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d", spaces.ErrChecksFailed, failed, len(results))
+	}
+	return nil
+}
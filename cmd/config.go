@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/git"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var configRepo bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect workspace configuration and manage flag defaults",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [path]",
+	Short: "Strictly check .remux.yaml and .remux.local.yaml",
+	Long: `Strictly check .remux.yaml and .remux.local.yaml for unknown keys, values of
+the wrong type and template expressions that don't compile.
+
+Defaults to the root of the current git repository.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runConfigValidate,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <command...> <flag>",
+	Short: "Print the default of a command's flag",
+	Long: `Print the value a flag of a command defaults to when it isn't given, e.g.
+remux config get new template. Defaults in the repository's .remux.yaml and
+.remux.local.yaml override those in the user's config.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runConfigGet,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <command...> <flag> <value>",
+	Short: "Set the default of a command's flag",
+	Long: `Set the value a flag of a command defaults to when it isn't given, e.g.
+remux config set new template review or remux config set stack new no-setup true.
+
+The default is kept in the user's config, ~/.config/remux/config.yaml, or with
+--repo in the .remux.local.yaml of the current checkout, where it overrides
+the user's.`,
+	Args: cobra.MinimumNArgs(3),
+	RunE: runConfigSet,
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <command...> <flag>",
+	Short: "Remove the default of a command's flag",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runConfigUnset,
+}
+
+func init() {
+	configSetCmd.Flags().BoolVar(&configRepo, "repo", false, "set the default in the current checkout's .remux.local.yaml")
+	configUnsetCmd.Flags().BoolVar(&configRepo, "repo", false, "remove the default from the current checkout's .remux.local.yaml")
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	command, flag, err := flagArg(args)
+	if err != nil {
+		return err
+	}
+	value, ok := flagDefaults().Get(command, flag.Name)
+	if !ok {
+		return fmt.Errorf("no default for --%s of %s", flag.Name, command)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	value := args[len(args)-1]
+	command, flag, err := flagArg(args[:len(args)-1])
+	if err != nil {
+		return err
+	}
+	if err := checkFlagValue(flag, value); err != nil {
+		return err
+	}
+
+	if configRepo {
+		root, err := git.FindRoot()
+		if err != nil {
+			return err
+		}
+		if err := config.SetLocalDefault(root, command, flag.Name, value); err != nil {
+			return err
+		}
+		// Personal defaults must not show up as changes to commit
+		return git.ExcludeLocally(root, config.LocalConfigFile)
+	}
+	g, err := config.LoadGlobal()
+	if err != nil {
+		return err
+	}
+	g.Defaults.Set(command, flag.Name, value)
+	return g.Save()
+}
+
+func runConfigUnset(cmd *cobra.Command, args []string) error {
+	command, flag, err := flagArg(args)
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	if configRepo {
+		root, err := git.FindRoot()
+		if err != nil {
+			return err
+		}
+		if removed, err = config.UnsetLocalDefault(root, command, flag.Name); err != nil {
+			return err
+		}
+	} else {
+		g, err := config.LoadGlobal()
+		if err != nil {
+			return err
+		}
+		if removed = g.Defaults.Unset(command, flag.Name); removed {
+			if err := g.Save(); err != nil {
+				return err
+			}
+		}
+	}
+	if !removed {
+		return fmt.Errorf("no default for --%s of %s", flag.Name, command)
+	}
+	return nil
+}
+
+// flagArg resolves the command path and flag name ending args, e.g.
+// "stack new base", to the command's name and the flag.
+func flagArg(args []string) (string, *pflag.Flag, error) {
+	path, name := args[:len(args)-1], strings.TrimLeft(args[len(args)-1], "-")
+	target, rest, err := rootCmd.Find(path)
+	if err != nil || len(rest) > 0 || target == rootCmd {
+		return "", nil, fmt.Errorf("unknown command %q", strings.Join(path, " "))
+	}
+	command := commandName(target)
+	flag := target.Flags().Lookup(name)
+	if flag == nil {
+		flag = target.InheritedFlags().Lookup(name)
+	}
+	if flag == nil {
+		return "", nil, fmt.Errorf("%s has no flag --%s", command, name)
+	}
+	return command, flag, nil
+}
+
+// checkFlagValue returns an error if value can't be given to flag.
+func checkFlagValue(flag *pflag.Flag, value string) error {
+	var err error
+	switch flag.Value.Type() {
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "int":
+		_, err = strconv.Atoi(value)
+	case "duration":
+		_, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q for --%s: %w", value, flag.Name, err)
+	}
+	return nil
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	} else if root, err := git.FindRoot(); err == nil {
+		path = root
+	} else {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		path = cwd
+	}
+
+	if err := config.Validate(path); err != nil {
+		return err
+	}
+
+	fmt.Println("Config OK")
+	return nil
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/johanhenriksson/remux/terminal"
+	"github.com/spf13/cobra"
+)
+
+var copyPrint bool
+
+var copyCmd = &cobra.Command{
+	Use:   "copy path|port|url [name]",
+	Short: "Copy a workspace's path, port or URL to the clipboard",
+	Long: `Copy a workspace's worktree path, port or forge URL (see browse) to the
+clipboard. Local sessions use pbcopy, wl-copy, xclip or xsel; over ssh, or
+when none is installed, the clipboard is set with an OSC 52 escape sequence,
+which also works through tmux. Without a name, the current workspace is used.`,
+	Args:      cobra.RangeArgs(1, 2),
+	ValidArgs: []string{"path", "port", "url"},
+	RunE:      runCopy,
+}
+
+func init() {
+	copyCmd.Flags().BoolVarP(&copyPrint, "print", "p", false, "also print the copied value")
+	rootCmd.AddCommand(copyCmd)
+}
+
+func runCopy(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args[1:])
+	if err != nil {
+		return err
+	}
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+
+	var value string
+	switch args[0] {
+	case "path":
+		value = space.Path
+	case "port":
+		value = strconv.Itoa(space.Port)
+	case "url":
+		value, err = space.BrowseURL(cmd.Context())
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown field %q (expected path, port or url)", args[0])
+	}
+
+	if err := terminal.Copy(value); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", args[0], err)
+	}
+	if copyPrint {
+		fmt.Println(value)
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/johanhenriksson/remux/tmux"
+	"github.com/spf13/cobra"
+)
+
+// daemonSession is the tmux session the daemon's control client attaches to.
+// It is killed when the daemon exits.
+const daemonSession = "remux-daemon"
+
+// idleCheckInterval is how often the daemon looks for idle sessions, at most.
+const idleCheckInterval = time.Minute
+
+var (
+	hibernateIdle time.Duration
+	maintainEvery time.Duration
+	proxyAddr     string
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Hold a persistent tmux connection and report session lifecycle events",
+	Long: `Hold a persistent tmux control-mode connection, route the tmux commands of
+other remux commands through it and print session start/stop events. With --hibernate-idle, workspaces
+whose session has had no attached client and no pane activity for that long
+are hibernated: their services are stopped and their session is killed,
+keeping the worktree. With --maintain-every, remux maintain runs that often.
+With --proxy, an HTTP reverse proxy listens on the given address and
+forwards http://<name>.localhost:<port> to the port of each workspace.`,
+	Args: cobra.NoArgs,
+	RunE: runDaemon,
+}
+
+func init() {
+	daemonCmd.Flags().DurationVar(&hibernateIdle, "hibernate-idle", 0, "hibernate workspaces whose session has been idle this long (default: never)")
+	daemonCmd.Flags().DurationVar(&maintainEvery, "maintain-every", 0, "run git maintenance and prune stale state this often (default: never)")
+	daemonCmd.Flags().StringVar(&proxyAddr, "proxy", "", "serve a reverse proxy routing <name>.localhost to each workspace on this address, e.g. localhost:8080 (default: off)")
+	rootCmd.AddCommand(daemonCmd)
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	// Before touching tmux, so a second daemon leaves the first one's session alone
+	ln, err := listenDaemon()
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	if !tmux.SessionExists(daemonSession) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get home directory: %w", err)
+		}
+		if err := tmux.NewSessionDetached(cmd.Context(), daemonSession, home, nil); err != nil {
+			return fmt.Errorf("failed to create daemon session: %w", err)
+		}
+	}
+
+	defer tmux.KillSession(daemonSession)
+
+	ctl, err := tmux.StartControl(daemonSession)
+	if err != nil {
+		return fmt.Errorf("failed to start tmux control client: %w", err)
+	}
+	// Deferred calls run in reverse, so commands stop using the client before it closes
+	defer ctl.Close()
+	tmux.UseControl(ctl)
+	defer tmux.UseControl(nil)
+	go func() {
+		if err := ctl.Serve(ln); err != nil {
+			logEvent("stopped serving tmux commands: %v", err)
+		}
+	}()
+
+	sessions, err := tmux.ListSessions()
+	if err != nil {
+		return err
+	}
+	logEvent("watching %d sessions", len(sessions))
+
+	if proxyAddr != "" {
+		stop, err := startProxy(cmd.Context(), proxyAddr)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	// A nil channel never fires, leaving idle detection off
+	var idleTicks <-chan time.Time
+	if hibernateIdle > 0 {
+		ticker := time.NewTicker(min(hibernateIdle, idleCheckInterval))
+		defer ticker.Stop()
+		idleTicks = ticker.C
+		logEvent("hibernating sessions idle for %s", hibernateIdle)
+	}
+
+	var maintainTicks <-chan time.Time
+	maintaining := make(chan struct{}, 1) // holds a token while maintenance runs
+	if maintainEvery > 0 {
+		ticker := time.NewTicker(maintainEvery)
+		defer ticker.Stop()
+		maintainTicks = ticker.C
+		logEvent("maintaining workspaces every %s", maintainEvery)
+	}
+
+	for {
+		select {
+		case ev, ok := <-ctl.Events():
+			if !ok {
+				return fmt.Errorf("tmux control client exited")
+			}
+			if ev.Name != "sessions-changed" {
+				continue
+			}
+			current, err := tmux.ListSessions()
+			if err != nil {
+				return err
+			}
+			for _, name := range current {
+				if !slices.Contains(sessions, name) {
+					logEvent("session started: %s", name)
+				}
+			}
+			for _, name := range sessions {
+				if !slices.Contains(current, name) {
+					logEvent("session stopped: %s", name)
+				}
+			}
+			sessions = current
+
+		case <-idleTicks:
+			hibernateIdleSpaces(cmd)
+
+		case <-maintainTicks:
+			// Maintenance can take minutes, which mustn't hold up tmux events
+			select {
+			case maintaining <- struct{}{}:
+				go func() {
+					defer func() { <-maintaining }()
+					maintainSpaces(cmd)
+				}()
+			default:
+				logEvent("skipping maintenance, the previous run is still going")
+			}
+
+		case <-sigs:
+			// Usually the machine shutting down, which takes the sessions with it
+			saveScrollback(sessions)
+			return nil
+		}
+	}
+}
+
+// daemonSocket returns the path of the socket the daemon serves tmux commands
+// on. Like the tmux server, it is per user.
+func daemonSocket() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("remux-%d", os.Getuid()), "daemon.sock")
+}
+
+// listenDaemon listens on the daemon socket, replacing one left behind by a
+// daemon that didn't exit cleanly.
+func listenDaemon() (net.Listener, error) {
+	path := daemonSocket()
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a remux daemon is already running on %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return ln, nil
+}
+
+// saveScrollback saves the scrollback of the running sessions of spaces that
+// enable scrollback.save. Failures are logged, since the daemon is exiting.
+func saveScrollback(sessions []string) {
+	dest, err := getDestDir()
+	if err != nil {
+		logEvent("failed to save scrollback: %v", err)
+		return
+	}
+	st, err := loadState(dest)
+	if err != nil {
+		logEvent("failed to save scrollback: %v", err)
+		return
+	}
+	for _, name := range sessions {
+		if st.Registry.Get(name) == nil {
+			continue
+		}
+		space, err := st.Space(name)
+		if err == nil {
+			err = space.SaveScrollback()
+		}
+		if err != nil {
+			logEvent("failed to save scrollback of %s: %v", name, err)
+		}
+	}
+}
+
+// hibernateIdleSpaces hibernates the spaces idle for longer than
+// --hibernate-idle. Failures are logged, so the daemon keeps running.
+func hibernateIdleSpaces(cmd *cobra.Command) {
+	dest, err := getDestDir()
+	if err != nil {
+		logEvent("failed to check idle sessions: %v", err)
+		return
+	}
+	// Reloaded on every check, since other commands change the registry
+	st, err := loadState(dest)
+	if err != nil {
+		logEvent("failed to check idle sessions: %v", err)
+		return
+	}
+	for _, name := range st.HibernateIdle(cmd.Context(), hibernateIdle) {
+		logEvent("hibernated idle session: %s", name)
+	}
+}
+
+// maintainSpaces runs maintenance as remux maintain does. Failures are
+// logged, so the daemon keeps running.
+func maintainSpaces(cmd *cobra.Command) {
+	dest, err := getDestDir()
+	if err != nil {
+		logEvent("failed to maintain workspaces: %v", err)
+		return
+	}
+	st, err := loadState(dest)
+	if err != nil {
+		logEvent("failed to maintain workspaces: %v", err)
+		return
+	}
+	result, err := st.Maintain(cmd.Context(), 0)
+	if err != nil {
+		logEvent("failed to maintain workspaces: %v", err)
+	}
+	logEvent("maintained %d repositories, removed stale state of %d workspaces", len(result.Repos), len(result.Stale))
+}
+
+// startProxy serves a spaces.Proxy on addr, reloading its routes whenever
+// the registry changes, so spaces are routed from when they are created until
+// they are dropped. The returned function stops the proxy.
+func startProxy(ctx context.Context, addr string) (func(), error) {
+	dest, err := getDestDir()
+	if err != nil {
+		return nil, err
+	}
+	proxy := spaces.NewProxy()
+	reload := func() {
+		st, err := loadState(dest)
+		if err != nil {
+			logEvent("failed to load proxy routes: %v", err)
+			return
+		}
+		proxy.SetRoutes(st.Routes())
+	}
+	reload()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start proxy: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	changes, err := registryStore(dest).Watch(ctx)
+	if err != nil {
+		cancel()
+		ln.Close()
+		return nil, err
+	}
+	go func() {
+		for range changes {
+			reload()
+		}
+	}()
+	server := &http.Server{Handler: proxy}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logEvent("proxy stopped: %v", err)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	logEvent("proxying http://<name>.localhost:%s to workspaces", port)
+	return func() {
+		cancel()
+		server.Close()
+	}, nil
+}
+
+// logEvent prints a timestamped daemon event.
+func logEvent(format string, args ...any) {
+	fmt.Printf("%s %s\n", time.Now().Format(time.TimeOnly), fmt.Sprintf(format, args...))
+}
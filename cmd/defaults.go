@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/spf13/cobra"
+)
+
+// applyDefaults sets the flags of cmd that weren't given on the command line
+// to their defaults in the config of the repository containing the current
+// directory, or else in the user's config.
+func applyDefaults(cmd *cobra.Command) error {
+	command := commandName(cmd)
+	for flag, value := range flagDefaults()[command] {
+		f := cmd.Flags().Lookup(flag)
+		if f == nil {
+			slog.Warn("ignoring default of unknown flag", "command", command, "flag", flag)
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(flag, value); err != nil {
+			return fmt.Errorf("defaults of %s: --%s: %w", command, flag, err)
+		}
+	}
+	return nil
+}
+
+// flagDefaults returns the flag defaults of the repository containing the
+// current directory over those of the user's config.
+func flagDefaults() config.Defaults {
+	defaults := globalConfig().Defaults
+	root := checkoutRoot()
+	if root == "" {
+		return defaults
+	}
+	cfg, err := config.Load(root)
+	if err != nil {
+		// The command reports a broken config if it uses it
+		slog.Debug("ignoring flag defaults of repository", "err", err)
+		return defaults
+	}
+	return cfg.Defaults.Over(defaults)
+}
+
+// checkoutRoot returns the root of the git checkout containing the current
+// directory, or "" if there is none. It looks for .git instead of running git,
+// since every command calls it.
+func checkoutRoot() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// commandName returns the path of cmd below the root command, e.g. "stack new".
+func commandName(cmd *cobra.Command) string {
+	return strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffFiles bool
+	diffStat  bool
+	diffPatch bool
+	diffFetch bool
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [name]",
+	Short: "Show a workspace's changes against its base branch",
+	Long: `Show the diffstat and patch of a workspace's changes since its branch
+diverged from its base branch, including uncommitted changes to tracked
+files. The base branch is the one the workspace was created from, the branch
+of the workspace it is stacked on, or the branch checked out in the main
+repository. Without a name, the current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDiff,
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffFiles, "files", false, "only list the changed files")
+	diffCmd.Flags().BoolVar(&diffStat, "stat", false, "only show the diffstat")
+	diffCmd.Flags().BoolVar(&diffPatch, "patch", false, "only show the patch")
+	diffCmd.MarkFlagsMutuallyExclusive("files", "stat", "patch")
+	diffCmd.Flags().BoolVarP(&diffFetch, "fetch", "f", false, "fetch the base branch's upstream first and diff against it")
+	rootCmd.AddCommand(diffCmd)
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	if diffFetch && readOnly {
+		return fmt.Errorf("%w: diff --fetch is not allowed with --read-only", spaces.ErrReadOnly)
+	}
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+
+	mode := spaces.DiffCombined
+	switch {
+	case diffFiles:
+		mode = spaces.DiffFiles
+	case diffStat:
+		mode = spaces.DiffStat
+	case diffPatch:
+		mode = spaces.DiffPatch
+	}
+	return st.Diff(cmd.Context(), name, os.Stdout, spaces.DiffOptions{Mode: mode, Fetch: diffFetch})
+}
@@ -1,38 +1,159 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/johanhenriksson/remux/registry"
 	"github.com/johanhenriksson/remux/spaces"
 	"github.com/spf13/cobra"
 )
 
-var forceFlag bool
+var (
+	forceFlag  bool
+	stopFlag   bool
+	stopGrace  time.Duration
+	dropTag    string
+	dropDryRun bool
+)
 
 var dropCmd = &cobra.Command{
-	Use:   "drop",
-	Short: "Remove the current workspace and clean up",
-	Args:  cobra.NoArgs,
-	RunE:  runDrop,
+	Use:   "drop [name]",
+	Short: "Remove a workspace and clean up",
+	Long: `Run the on_drop hooks of a workspace, remove its worktree, unregister it and
+kill its session. Without a name, the workspace containing the current
+directory is dropped; with one, the workspace is found in the registry, so
+it can be dropped from anywhere.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDrop,
 }
 
 func init() {
-	dropCmd.Flags().BoolVarP(&forceFlag, "force", "f", false, "force drop even with uncommitted changes")
+	dropCmd.Flags().BoolVarP(&forceFlag, "force", "f", false, "force drop even with uncommitted changes or another user's space")
+	dropCmd.Flags().BoolVar(&stopFlag, "stop", false, "stop processes still using the space's ports or tmux panes")
+	dropCmd.Flags().DurationVar(&stopGrace, "grace", spaces.DefaultStopGrace, "time stopped processes get to exit before they are killed")
+	dropCmd.Flags().StringVarP(&dropTag, "tag", "t", "", "drop all workspaces carrying the given tag")
+	dropCmd.Flags().BoolVarP(&dropDryRun, "dry-run", "n", false, "print what would be done without doing it")
 	rootCmd.AddCommand(dropCmd)
 }
 
 func runDrop(cmd *cobra.Command, args []string) error {
+	if dropTag != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("drop takes either a name or --tag, not both")
+		}
+		return dropTagged(cmd.Context(), dropTag)
+	}
+
+	st, path, name, err := dropTarget(args)
+	if err != nil {
+		return err
+	}
+	if dropDryRun {
+		plan, err := st.PlanDrop(cmd.Context(), path, dropOptions())
+		if err != nil {
+			return err
+		}
+		fmt.Print(plan)
+		return nil
+	}
+
+	if err := st.Drop(cmd.Context(), path, dropOptions()); err != nil {
+		return err
+	}
+	fmt.Printf("Removed space: %s\n", name)
+	return nil
+}
+
+// dropTarget returns the state, worktree path and name of the space to drop:
+// the registered space named by an optional argument, or the space at the
+// current directory.
+func dropTarget(args []string) (*spaces.State, string, string, error) {
+	if len(args) > 0 {
+		dest, err := getDestDir()
+		if err != nil {
+			return nil, "", "", err
+		}
+		st, err := loadState(dest)
+		if err != nil {
+			return nil, "", "", err
+		}
+		name, err := resolveSpaceName(st.Registry, args[0])
+		if err != nil {
+			return nil, "", "", err
+		}
+		return st, st.Registry.Get(name).Path, name, nil
+	}
+
 	cwd, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return nil, "", "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	// A bound checkout is registered in the dest dir rather than its parent
+	if st, name := boundHere(cwd); name != "" {
+		return st, st.Registry.Get(name).Path, name, nil
+	}
+	st, err := loadState(filepath.Dir(cwd))
+	if err != nil {
+		return nil, "", "", err
+	}
+	return st, cwd, filepath.Base(cwd), nil
+}
+
+// dropOptions returns the drop options given on the command line.
+func dropOptions() spaces.DropOptions {
+	return spaces.DropOptions{
+		Force: forceFlag,
+		Stop:  stopFlag,
+		Grace: stopGrace,
 	}
+}
 
-	if err := spaces.Drop(cwd, forceFlag); err != nil {
+// dropTagged drops every space carrying the given tag.
+func dropTagged(ctx context.Context, tag string) error {
+	dest, err := getDestDir()
+	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Removed space: %s\n", filepath.Base(cwd))
-	return nil
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
+
+	entries := st.Registry.Tagged(tag)
+	if len(entries) == 0 {
+		return fmt.Errorf("no spaces tagged %q", tag)
+	}
+
+	return dropEntries(ctx, st, entries)
+}
+
+// dropEntries drops the given spaces in order.
+// Failures are collected so one dirty space doesn't block the rest.
+func dropEntries(ctx context.Context, st *spaces.State, entries []registry.Entry) error {
+	return st.Batch(func() error {
+		var errs []error
+		for _, e := range entries {
+			if dropDryRun {
+				plan, err := st.PlanDrop(ctx, e.Path, dropOptions())
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+					continue
+				}
+				fmt.Printf("%s:\n%s", e.Name, plan)
+				continue
+			}
+			if err := st.Drop(ctx, e.Path, dropOptions()); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+				continue
+			}
+			fmt.Printf("Removed space: %s\n", e.Name)
+		}
+		return errors.Join(errs...)
+	})
 }
@@ -1,6 +1,7 @@
 package cmd_test
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -8,6 +9,8 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/johanhenriksson/remux/cmd"
+	"github.com/johanhenriksson/remux/registry"
 	"github.com/johanhenriksson/remux/spaces"
 )
 
@@ -49,7 +52,7 @@ var _ = Describe("Drop", func() {
 
 	Describe("spaces.Drop", func() {
 		It("removes a worktree successfully", func() {
-			err := spaces.Drop(worktreeDir)
+			err := spaces.Drop(context.Background(), worktreeDir, spaces.DropOptions{})
 
 			Expect(err).NotTo(HaveOccurred())
 
@@ -62,10 +65,10 @@ var _ = Describe("Drop", func() {
 		})
 
 		It("returns an error when not in a worktree", func() {
-			err := spaces.Drop(mainRepoDir)
+			err := spaces.Drop(context.Background(), mainRepoDir, spaces.DropOptions{})
 
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("not in a git worktree"))
+			Expect(err).To(MatchError(spaces.ErrNotWorktree))
 		})
 
 		It("returns an error when there are uncommitted changes", func() {
@@ -73,10 +76,10 @@ var _ = Describe("Drop", func() {
 			err := os.WriteFile(testFile, []byte("uncommitted"), 0644)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = spaces.Drop(worktreeDir)
+			err = spaces.Drop(context.Background(), worktreeDir, spaces.DropOptions{})
 
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("uncommitted changes"))
+			Expect(err).To(MatchError(spaces.ErrDirtyWorktree))
 
 			_, err = os.Stat(worktreeDir)
 			Expect(err).NotTo(HaveOccurred())
@@ -87,14 +90,105 @@ var _ = Describe("Drop", func() {
 			Expect(err).NotTo(HaveOccurred())
 			defer os.RemoveAll(nonGitDir)
 
-			err = spaces.Drop(nonGitDir)
+			err = spaces.Drop(context.Background(), nonGitDir, spaces.DropOptions{})
 
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("not in a git worktree"))
+			Expect(err).To(MatchError(spaces.ErrNotWorktree))
 		})
 	})
 })
 
+var _ = Describe("drop command", func() {
+	var (
+		repoDir string
+		destDir string
+		name    string
+	)
+
+	BeforeEach(func() {
+		home := GinkgoT().TempDir()
+		for _, key := range []string{"HOME", "XDG_CONFIG_HOME", "TMUX", "TMUX_PANE"} {
+			value, set := os.LookupEnv(key)
+			DeferCleanup(func() {
+				if set {
+					os.Setenv(key, value)
+				} else {
+					os.Unsetenv(key)
+				}
+			})
+		}
+		os.Setenv("HOME", home)
+		os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+		os.Unsetenv("TMUX")
+		os.Unsetenv("TMUX_PANE")
+
+		repoDir = filepath.Join(GinkgoT().TempDir(), "app")
+		Expect(os.Mkdir(repoDir, 0755)).To(Succeed())
+		runGitCmd(repoDir, "init")
+		runGitCmd(repoDir, "config", "user.email", "test@test.com")
+		runGitCmd(repoDir, "config", "user.name", "Test User")
+		Expect(os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("# Test"), 0644)).To(Succeed())
+		runGitCmd(repoDir, "add", ".")
+		runGitCmd(repoDir, "commit", "-m", "Initial commit")
+
+		destDir = GinkgoT().TempDir()
+		path, err := spaces.Create(context.Background(), spaces.CreateOptions{RepoRoot: repoDir, DestDir: destDir, BranchName: "fix"})
+		Expect(err).NotTo(HaveOccurred())
+		name = filepath.Base(path)
+		Expect(name).To(Equal("app-fix"))
+
+		wd, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.Chdir, wd)
+	})
+
+	registered := func() []registry.Entry {
+		reg, err := registry.Load(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		return reg.List()
+	}
+
+	It("drops a space by its short name from inside its repository", func() {
+		Expect(os.Chdir(repoDir)).To(Succeed())
+		Expect(cmd.Run(context.Background(), "drop", "fix", "--dest", destDir)).To(Succeed())
+		Expect(registered()).To(BeEmpty())
+		Expect(filepath.Join(destDir, name)).NotTo(BeADirectory())
+	})
+
+	It("drops a space by its short name from outside any repository", func() {
+		Expect(os.Chdir(GinkgoT().TempDir())).To(Succeed())
+		Expect(cmd.Run(context.Background(), "drop", "fix", "--dest", destDir)).To(Succeed())
+		Expect(registered()).To(BeEmpty())
+		Expect(filepath.Join(destDir, name)).NotTo(BeADirectory())
+	})
+
+	It("drops a space by its full name from outside any repository", func() {
+		Expect(os.Chdir(GinkgoT().TempDir())).To(Succeed())
+		Expect(cmd.Run(context.Background(), "drop", name, "--dest", destDir)).To(Succeed())
+		Expect(registered()).To(BeEmpty())
+	})
+
+	It("refuses a short name that matches spaces of several repositories", func() {
+		Expect(registry.Update(destDir, func(reg *registry.Registry) error {
+			reg.Add("web-fix", "/src/web-fix", registry.BasePort+100, "/src/web")
+			return nil
+		})).To(Succeed())
+
+		Expect(os.Chdir(GinkgoT().TempDir())).To(Succeed())
+		err := cmd.Run(context.Background(), "drop", "fix", "--dest", destDir)
+		Expect(err).To(MatchError(spaces.ErrInvalidName))
+		Expect(err).To(MatchError(ContainSubstring("app-fix, web-fix")))
+		Expect(registered()).To(HaveLen(2))
+	})
+
+	It("reports a name no space has", func() {
+		Expect(os.Chdir(GinkgoT().TempDir())).To(Succeed())
+		err := cmd.Run(context.Background(), "drop", "nope", "--dest", destDir)
+		Expect(err).To(MatchError(spaces.ErrSpaceNotFound))
+		Expect(registered()).To(HaveLen(1))
+	})
+})
+
 func runGitCmd(repoDir string, args ...string) {
 	allArgs := append([]string{"-C", repoDir}, args...)
 	gitCmd := exec.Command("git", allArgs...)
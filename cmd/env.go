@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage the environment of workspace sessions",
+}
+
+var envApplyCmd = &cobra.Command{
+	Use:   "apply [name]",
+	Short: "Update a running session's env to the workspace's current config",
+	Long: `Sessions keep the env they were started with, so changes to the env section
+of .remux.yaml don't reach them. apply updates the tmux session environment,
+which new windows and panes start with, to the SPACE_* variables and config
+env of the workspace, and unsets variables removed from the config. Idle
+shells in existing panes get the matching export and unset commands typed
+into them; panes running other programs keep their env until restarted.
+
+Only the tmux backend is supported. Without a name, the current workspace is
+used. See also open --apply-env.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runEnvApply,
+}
+
+var envActivateCmd = &cobra.Command{
+	Use:   "activate bash|zsh|fish",
+	Short: "Print commands switching a shell to the env of the current workspace",
+	Long: `Print the commands that export the SPACE_* variables and config env of the
+workspace containing the current directory into the given shell, and restore
+the variables of a workspace activated before, for the shell's eval. Prints
+nothing when the workspace is already active.
+
+This is run on every cd by the hook of shell-init --env, which keeps the
+record of what it exported in $REMUX_ACTIVE_ENV.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	RunE:      runEnvActivate,
+}
+
+func init() {
+	envCmd.AddCommand(envApplyCmd)
+	envCmd.AddCommand(envActivateCmd)
+	rootCmd.AddCommand(envCmd)
+}
+
+func runEnvApply(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	change, err := st.ApplyEnv(cmd.Context(), name)
+	if err != nil {
+		return err
+	}
+
+	if len(change.Set) == 0 && len(change.Unset) == 0 {
+		fmt.Println("Session env is up to date")
+		return nil
+	}
+	if len(change.Set) > 0 {
+		fmt.Printf("Set: %s\n", strings.Join(change.Set, " "))
+	}
+	if len(change.Unset) > 0 {
+		fmt.Printf("Unset: %s\n", strings.Join(change.Unset, " "))
+	}
+	fmt.Printf("Updated %d idle shell(s)\n", change.Panes)
+	return nil
+}
+
+func runEnvActivate(cmd *cobra.Command, args []string) error {
+	shell := args[0]
+	if shell != "bash" && shell != "zsh" && shell != "fish" {
+		return fmt.Errorf("unsupported shell %q (expected bash, zsh or fish)", shell)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	prev := spaces.ParseActivation(os.Getenv(spaces.ActivationVar))
+	// Outside of a workspace the entry is empty, which deactivates
+	var env map[string]string
+	dest, entry, err := spaces.FindSpace(cwd)
+	if err == nil && entry.Name != prev.Space {
+		st, err := loadState(dest)
+		if err != nil {
+			return err
+		}
+		space, err := st.Space(entry.Name)
+		if err != nil {
+			return err
+		}
+		if env, err = space.SessionEnv(cmd.Context()); err != nil {
+			return err
+		}
+		for _, key := range slices.Sorted(maps.Keys(env)) {
+			if !spaces.ValidEnvName(key) {
+				slog.Warn("not exporting env var, its name isn't a valid shell variable name", "var", key)
+			}
+		}
+	}
+
+	fmt.Print(spaces.ActivateScript(shell, prev, entry.Name, env, os.LookupEnv))
+	return nil
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/spaces"
+)
+
+// Exit codes returned by remux. Scripts can use these to tell common
+// failures apart without parsing error messages.
+const (
+	ExitError       = 1   // Unclassified failure
+	ExitNotFound    = 2   // Space does not exist
+	ExitDirty       = 3   // Worktree has uncommitted changes
+	ExitExists      = 4   // Space, branch or session already exists
+	ExitNotRepo     = 5   // Not inside a git repository or worktree
+	ExitBusy        = 6   // Space still has live processes
+	ExitInvalidName = 7   // Branch or space name can't be used
+	ExitCheckFailed = 8   // A readiness check of remux check, or the tests of remux test, failed
+	ExitNotOwner    = 9   // Space was created by another user
+	ExitLimit       = 10  // Creating the space would exceed the user config's limits
+	ExitReadOnly    = 11  // The command would change workspaces under --read-only
+	ExitConflict    = 12  // A rebase stopped on conflicts, or there is no sync to continue
+	ExitInterrupted = 130 // Cancelled by SIGINT/SIGTERM
+)
+
+// ExitCode maps an error returned by a command to the process exit code.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.Is(err, spaces.ErrSpaceNotFound):
+		return ExitNotFound
+	case errors.Is(err, spaces.ErrDirtyWorktree):
+		return ExitDirty
+	case errors.Is(err, spaces.ErrLiveProcesses):
+		return ExitBusy
+	case errors.Is(err, spaces.ErrInvalidName):
+		return ExitInvalidName
+	case errors.Is(err, spaces.ErrChecksFailed),
+		errors.Is(err, spaces.ErrTestsFailed):
+		return ExitCheckFailed
+	case errors.Is(err, spaces.ErrNotOwner):
+		return ExitNotOwner
+	case errors.Is(err, spaces.ErrLimitReached):
+		return ExitLimit
+	case errors.Is(err, spaces.ErrReadOnly):
+		return ExitReadOnly
+	case errors.Is(err, spaces.ErrConflict),
+		errors.Is(err, spaces.ErrNoSync):
+		return ExitConflict
+	case errors.Is(err, spaces.ErrSpaceExists),
+		errors.Is(err, spaces.ErrBranchExists),
+		errors.Is(err, spaces.ErrSessionExists):
+		return ExitExists
+	case errors.Is(err, git.ErrNotRepository),
+		errors.Is(err, spaces.ErrNotWorktree):
+		return ExitNotRepo
+	default:
+		return ExitError
+	}
+}
@@ -0,0 +1,44 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux/cmd"
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/spaces"
+)
+
+var _ = Describe("ExitCode", func() {
+	It("returns 0 for nil", func() {
+		Expect(cmd.ExitCode(nil)).To(Equal(0))
+	})
+
+	It("maps wrapped sentinel errors", func() {
+		wrap := func(err error) error { return fmt.Errorf("my-space: %w", err) }
+
+		Expect(cmd.ExitCode(wrap(spaces.ErrSpaceNotFound))).To(Equal(cmd.ExitNotFound))
+		Expect(cmd.ExitCode(wrap(spaces.ErrDirtyWorktree))).To(Equal(cmd.ExitDirty))
+		Expect(cmd.ExitCode(wrap(&spaces.LiveProcessesError{}))).To(Equal(cmd.ExitBusy))
+		Expect(cmd.ExitCode(wrap(spaces.ErrBranchExists))).To(Equal(cmd.ExitExists))
+		Expect(cmd.ExitCode(wrap(spaces.ErrSessionExists))).To(Equal(cmd.ExitExists))
+		Expect(cmd.ExitCode(wrap(git.ErrNotRepository))).To(Equal(cmd.ExitNotRepo))
+		Expect(cmd.ExitCode(wrap(spaces.ErrInvalidName))).To(Equal(cmd.ExitInvalidName))
+		Expect(cmd.ExitCode(wrap(spaces.ErrChecksFailed))).To(Equal(cmd.ExitCheckFailed))
+		Expect(cmd.ExitCode(wrap(spaces.ErrTestsFailed))).To(Equal(cmd.ExitCheckFailed))
+		Expect(cmd.ExitCode(wrap(spaces.ErrNotOwner))).To(Equal(cmd.ExitNotOwner))
+		Expect(cmd.ExitCode(wrap(spaces.ErrLimitReached))).To(Equal(cmd.ExitLimit))
+		Expect(cmd.ExitCode(wrap(spaces.ErrReadOnly))).To(Equal(cmd.ExitReadOnly))
+		Expect(cmd.ExitCode(wrap(&spaces.ConflictError{}))).To(Equal(cmd.ExitConflict))
+		Expect(cmd.ExitCode(wrap(spaces.ErrNoSync))).To(Equal(cmd.ExitConflict))
+		Expect(cmd.ExitCode(wrap(context.Canceled))).To(Equal(cmd.ExitInterrupted))
+	})
+
+	It("returns the generic code for other errors", func() {
+		Expect(cmd.ExitCode(errors.New("boom"))).To(Equal(cmd.ExitError))
+	})
+})
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Run runs the root command with args, as if given on the command line.
+// Flags are reset to their defaults first, so runs don't leak into each other.
+func Run(ctx context.Context, args ...string) error {
+	resetFlags(rootCmd)
+	rootCmd.SetArgs(args)
+	return rootCmd.ExecuteContext(ctx)
+}
+
+// resetFlags sets the flags of cmd and its subcommands back to their defaults.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(nil)
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// ListRow is a row of remux list output.
+type ListRow = listRow
+
+// WriteYAML writes rows as remux list -o yaml does.
+func WriteYAML(out io.Writer, rows []ListRow) error {
+	return writeYAML(out, rows)
+}
+
+// MarkSessions sets the session column of rows from the running tmux sessions.
+func MarkSessions(rows []ListRow) error {
+	return markSessions(rows)
+}
+
+// RenderWatch draws one refresh of remux list --watch.
+func RenderWatch(out io.Writer, rows []ListRow, previous map[string]bool) map[string]bool {
+	return renderWatch(out, rows, previous)
+}
+
+// WriteDelimited writes rows as remux list -o csv (delimiter ',') or -o tsv (delimiter '\t') does.
+func WriteDelimited(out io.Writer, delimiter rune, rows []ListRow) error {
+	return writeDelimited(out, delimiter, rows)
+}
+
+// SetListWide sets remux list --wide, and returns a function that restores it.
+func SetListWide(wide bool) (restore func()) {
+	prev := wideFlag
+	wideFlag = wide
+	return func() { wideFlag = prev }
+}
+
+// NewWindowScript returns the AppleScript remux open --new-window runs.
+func NewWindowScript(iterm bool, profile, dir string, args ...string) string {
+	return newWindowScript(iterm, profile, dir, args...)
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/spaces"
+)
+
+// globalConfig returns the user's config file, see config.Global. A config
+// that fails to load is reported once and treated as empty.
+var globalConfig = sync.OnceValue(func() *config.Global {
+	g, err := config.LoadGlobal()
+	if err != nil {
+		slog.Warn("ignoring user config", "err", err)
+		return &config.Global{}
+	}
+	return g
+})
+
+// loadState loads the state of destDir with the defaults of the user's config.
+// The registry is read from the store given by registryStore.
+func loadState(destDir string) (*spaces.State, error) {
+	st, err := spaces.NewState(destDir, registryStore(destDir))
+	if err != nil {
+		return nil, err
+	}
+	st.DefaultBackend = globalConfig().Backend
+	return st, nil
+}
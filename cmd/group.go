@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/johanhenriksson/remux/tmux"
+	"github.com/spf13/cobra"
+)
+
+var groupDetached bool
+
+var groupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Manage groups of workspaces that are opened and dropped together",
+	Long: `A group is a named, ordered set of workspaces, such as the api, web and infra
+workspaces of one release. Groups are opened in order, and hibernated and
+dropped in reverse order. A workspace can be in several groups, and leaves
+them when it is dropped.`,
+}
+
+var groupAddCmd = &cobra.Command{
+	Use:   "add <group> <names...>",
+	Short: "Add workspaces to the end of a group, creating it if needed",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateGroup(args[0], args[1:], func(reg *registry.Registry, group string, names []string) error {
+			reg.AddToGroup(group, names...)
+			return nil
+		})
+	},
+}
+
+var groupSetCmd = &cobra.Command{
+	Use:   "set <group> <names...>",
+	Short: "Replace the workspaces of a group, in the given order",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateGroup(args[0], args[1:], func(reg *registry.Registry, group string, names []string) error {
+			reg.SetGroup(group, names...)
+			return nil
+		})
+	},
+}
+
+var groupRemoveCmd = &cobra.Command{
+	Use:   "remove <group> <names...>",
+	Short: "Remove workspaces from a group, deleting it once empty",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateGroup(args[0], args[1:], func(reg *registry.Registry, group string, names []string) error {
+			if !reg.RemoveFromGroup(group, names...) {
+				return fmt.Errorf("no group named %q", group)
+			}
+			return nil
+		})
+	},
+}
+
+var groupDeleteCmd = &cobra.Command{
+	Use:   "delete <group>",
+	Short: "Delete a group, keeping its workspaces",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateGroup(args[0], nil, func(reg *registry.Registry, group string, _ []string) error {
+			if !reg.DeleteGroup(group) {
+				return fmt.Errorf("no group named %q", group)
+			}
+			return nil
+		})
+	},
+}
+
+var groupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List groups and their workspaces",
+	Args:  cobra.NoArgs,
+	RunE:  runGroupList,
+}
+
+var groupOpenCmd = &cobra.Command{
+	Use:   "open <group>",
+	Short: "Open the sessions of a group's workspaces",
+	Long: `Open the session of each workspace in the group in order, resuming hibernated
+ones, and attach to the first. Sessions are only attached to once all of
+them opened.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runGroupOpen,
+}
+
+var groupHibernateCmd = &cobra.Command{
+	Use:   "hibernate <group>",
+	Short: "Hibernate a group's workspaces",
+	Long: `Hibernate each workspace in the group in reverse order, skipping those that
+already are.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runGroupHibernate,
+}
+
+var groupDropCmd = &cobra.Command{
+	Use:   "drop <group>",
+	Short: "Drop a group's workspaces",
+	Long: `Drop each workspace in the group in reverse order, like drop. Failures are
+reported after the rest were dropped, and the group is deleted once all of
+its workspaces are gone.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runGroupDrop,
+}
+
+var groupStatusCmd = &cobra.Command{
+	Use:   "status <group>",
+	Short: "Show the git status, session and port of a group's workspaces",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runGroupStatus,
+}
+
+func init() {
+	groupOpenCmd.Flags().BoolVar(&groupDetached, "detached", false, "start the sessions without attaching to one")
+	groupDropCmd.Flags().BoolVarP(&forceFlag, "force", "f", false, "force drop even with uncommitted changes or another user's space")
+	groupDropCmd.Flags().BoolVar(&stopFlag, "stop", false, "stop processes still using the spaces' ports or tmux panes")
+	groupDropCmd.Flags().DurationVar(&stopGrace, "grace", spaces.DefaultStopGrace, "time stopped processes get to exit before they are killed")
+	groupDropCmd.Flags().BoolVarP(&dropDryRun, "dry-run", "n", false, "print what would be done without doing it")
+	groupStatusCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "number of spaces to inspect concurrently (default: number of CPUs)")
+
+	groupCmd.AddCommand(groupAddCmd)
+	groupCmd.AddCommand(groupSetCmd)
+	groupCmd.AddCommand(groupRemoveCmd)
+	groupCmd.AddCommand(groupDeleteCmd)
+	groupCmd.AddCommand(groupListCmd)
+	groupCmd.AddCommand(groupOpenCmd)
+	groupCmd.AddCommand(groupHibernateCmd)
+	groupCmd.AddCommand(groupDropCmd)
+	groupCmd.AddCommand(groupStatusCmd)
+	rootCmd.AddCommand(groupCmd)
+}
+
+// updateGroup applies a group mutation and saves the registry once.
+// All names are resolved before anything is modified.
+func updateGroup(group string, names []string, apply func(*registry.Registry, string, []string) error) error {
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+
+	return registry.UpdateStore(registryStore(dest), func(reg *registry.Registry) error {
+		resolved := make([]string, len(names))
+		for i, name := range names {
+			var err error
+			if resolved[i], err = resolveSpaceName(reg, name); err != nil {
+				return err
+			}
+		}
+		return apply(reg, group, resolved)
+	})
+}
+
+// groupMembers loads the state and returns the spaces of the named group in
+// group order.
+func groupMembers(group string) (*spaces.State, []registry.Entry, error) {
+	dest, err := getDestDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := loadState(dest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st.Registry.Group(group) == nil {
+		return nil, nil, fmt.Errorf("no group named %q", group)
+	}
+	return st, st.Registry.GroupMembers(group), nil
+}
+
+func runGroupList(cmd *cobra.Command, args []string) error {
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+	reg, err := registryStore(dest).Load()
+	if err != nil {
+		return fmt.Errorf("failed to load space registry: %w", err)
+	}
+
+	if len(reg.Groups) == 0 {
+		fmt.Println("No groups")
+		return nil
+	}
+	for _, g := range reg.Groups {
+		fmt.Printf("%s\t%s\n", g.Name, strings.Join(g.Spaces, " "))
+	}
+	return nil
+}
+
+func runGroupOpen(cmd *cobra.Command, args []string) error {
+	st, members, err := groupMembers(args[0])
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, e := range members {
+		if err := st.OpenSession(cmd.Context(), spaces.OpenSessionOptions{Name: e.Name, Detached: true}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil || groupDetached || len(members) == 0 {
+		return err
+	}
+	return st.OpenSession(cmd.Context(), spaces.OpenSessionOptions{Name: members[0].Name})
+}
+
+func runGroupHibernate(cmd *cobra.Command, args []string) error {
+	st, members, err := groupMembers(args[0])
+	if err != nil {
+		return err
+	}
+
+	return st.Batch(func() error {
+		var errs []error
+		for _, e := range slices.Backward(members) {
+			if e.Hibernated {
+				continue
+			}
+			if err := st.Hibernate(cmd.Context(), e.Name); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+				continue
+			}
+			fmt.Printf("Hibernated space: %s\n", e.Name)
+		}
+		return errors.Join(errs...)
+	})
+}
+
+func runGroupDrop(cmd *cobra.Command, args []string) error {
+	st, members, err := groupMembers(args[0])
+	if err != nil {
+		return err
+	}
+	slices.Reverse(members)
+	return dropEntries(cmd.Context(), st, members)
+}
+
+func runGroupStatus(cmd *cobra.Command, args []string) error {
+	st, members, err := groupMembers(args[0])
+	if err != nil {
+		return err
+	}
+	running, err := runningSessions()
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]*spaces.Status, len(members))
+	// A space whose status fails is shown as missing, like list --status
+	_ = spaces.Parallel(members, jobs, func(i int, e registry.Entry) error {
+		status, err := spaces.GetStatus(st.DestDir, e)
+		if err != nil {
+			return err
+		}
+		statuses[i] = &status
+		return nil
+	})
+
+	for i, e := range members {
+		session := "stopped"
+		switch {
+		case e.Hibernated:
+			session = "hibernated"
+		case running[tmux.SessionName(e.Name)]:
+			session = "running"
+		}
+		fmt.Printf("%s\t%s\t%s\t%d\n", e.Name, formatStatus(statuses[i]), session, e.Port)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var resumeDetached bool
+
+var hibernateCmd = &cobra.Command{
+	Use:   "hibernate [name]",
+	Short: "Stop a workspace's services and session, keeping its worktree",
+	Long: `Free the memory and ports a workspace uses without removing it: stop the
+compose services and systemd units listed under services in .remux.yaml,
+close the session like kill, and mark the workspace hibernated. The
+workspace keeps its ports for when it is resumed. Without a name, the
+current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runHibernate,
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume [name]",
+	Short: "Start a hibernated workspace's services and open its session",
+	Long: `Start the services stopped by hibernate and open the workspace's session.
+Opening a hibernated workspace with open resumes it as well. Without a name,
+the current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runResume,
+}
+
+func init() {
+	resumeCmd.Flags().BoolVar(&resumeDetached, "detached", false, "start the session without attaching to it")
+	rootCmd.AddCommand(hibernateCmd)
+	rootCmd.AddCommand(resumeCmd)
+}
+
+func runHibernate(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	return st.Hibernate(cmd.Context(), name)
+}
+
+func runResume(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	if err := st.Resume(cmd.Context(), name); err != nil {
+		return err
+	}
+	return st.OpenSession(cmd.Context(), spaces.OpenSessionOptions{Name: name, Detached: resumeDetached})
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/spf13/cobra"
+)
+
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "Inspect workspace hooks",
+}
+
+var hooksExplainCmd = &cobra.Command{
+	Use:   "explain [event] [name]",
+	Short: "Show how a workspace's hooks would run, without running them",
+	Long: `Print each hook command of the workspace after template evaluation, along
+with the directory it runs in and the env vars remux adds to it. Nothing is
+executed, so template mistakes can be found before setting up a real
+worktree. Commands that fail to evaluate are shown with their error, and
+make the command fail.
+
+The event is on_create, on_open or on_drop; all events are explained if it
+is omitted or "all". Without a name, the current workspace is used.`,
+	Args:         cobra.MaximumNArgs(2),
+	ValidArgs:    []string{"on_create", "on_open", "on_drop", "all"},
+	SilenceUsage: true,
+	RunE:         runHooksExplain,
+}
+
+func init() {
+	hooksCmd.AddCommand(hooksExplainCmd)
+	rootCmd.AddCommand(hooksCmd)
+}
+
+func runHooksExplain(cmd *cobra.Command, args []string) error {
+	event := ""
+	if len(args) > 0 && args[0] != "all" {
+		event = args[0]
+	}
+	st, name, err := spaceArg(args[min(len(args), 1):])
+	if err != nil {
+		return err
+	}
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+	explanation, err := space.ExplainHooks(event)
+	if err != nil {
+		return err
+	}
+
+	failed := printHookExplanation(os.Stdout, explanation)
+	if failed > 0 {
+		return fmt.Errorf("%d hook command(s) failed to evaluate", failed)
+	}
+	return nil
+}
+
+// printHookExplanation writes the directory and env of the hooks, then the
+// commands of each event. Returns the number of commands that failed to
+// evaluate.
+func printHookExplanation(w io.Writer, e *config.HookExplanation) int {
+	fmt.Fprintf(w, "dir: %s\n", e.Dir)
+	fmt.Fprintln(w, "env:")
+	for _, key := range slices.Sorted(maps.Keys(e.Env)) {
+		fmt.Fprintf(w, "  %s=%s\n", key, e.Env[key])
+	}
+	if len(e.Hooks) == 0 {
+		fmt.Fprintln(w, "\nNo hooks configured")
+		return 0
+	}
+
+	failed := 0
+	event := ""
+	for _, hook := range e.Hooks {
+		if hook.Event != event {
+			event = hook.Event
+			fmt.Fprintf(w, "\n%s:\n", event)
+		}
+		if hook.Err != nil {
+			failed++
+			// Expression errors span lines, pointing at the mistake
+			fmt.Fprintf(w, "  %s\n    error: %s\n", hook.Template, strings.ReplaceAll(hook.Err.Error(), "\n", "\n    "))
+			continue
+		}
+		fmt.Fprintf(w, "  $ %s\n", hook.Command)
+		if hook.Command != hook.Template {
+			fmt.Fprintf(w, "    from: %s\n", hook.Template)
+		}
+	}
+	return failed
+}
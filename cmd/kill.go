@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var killCmd = &cobra.Command{
+	Use:   "kill [name]",
+	Short: "Close a workspace's session, keeping its worktree",
+	Long: `Close the session of a workspace without removing its worktree. With
+scrollback.save enabled, the scrollback of every pane is saved first and
+brought back the next time the workspace is opened. Without a name, the
+current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runKill,
+}
+
+func init() {
+	rootCmd.AddCommand(killCmd)
+}
+
+func runKill(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	return st.KillSession(name)
+}
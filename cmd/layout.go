@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var layoutCmd = &cobra.Command{
+	Use:   "layout [name]",
+	Short: "Generate a Zellij layout from a workspace's tabs",
+	Long: `Generate a Zellij KDL layout with one tab per configured tab, write it to
+the workspace's state directory and print its path. Without a name, the
+current workspace is used. Start Zellij with it using:
+
+  zellij --new-session-with-layout "$(remux layout)"`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLayout,
+}
+
+func init() {
+	rootCmd.AddCommand(layoutCmd)
+}
+
+func runLayout(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+
+	if err := space.WriteZellijLayout(); err != nil {
+		return err
+	}
+	fmt.Println(space.ZellijLayout())
+	return nil
+}
@@ -0,0 +1,425 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johanhenriksson/remux/forge"
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/johanhenriksson/remux/tmux"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	activeFlag    bool
+	inactiveFlag  bool
+	watchFlag     bool
+	watchInterval time.Duration
+	outputFormat  string
+	tagFilter     []string
+	groupFilter   string
+	sortOrder     string
+	statusFlag    bool
+	ciFlag        bool
+	wideFlag      bool
+	jobs          int
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all tracked workspaces",
+	Args:  cobra.NoArgs,
+	RunE:  runList,
+}
+
+func init() {
+	listCmd.Flags().BoolVar(&activeFlag, "active", false, "only list spaces with a running tmux session")
+	listCmd.Flags().BoolVar(&inactiveFlag, "inactive", false, "only list spaces without a running tmux session")
+	listCmd.MarkFlagsMutuallyExclusive("active", "inactive")
+	listCmd.Flags().BoolVarP(&watchFlag, "watch", "w", false, "continuously refresh the list")
+	listCmd.Flags().DurationVar(&watchInterval, "interval", 2*time.Second, "refresh interval for --watch")
+	listCmd.Flags().StringSliceVarP(&tagFilter, "tag", "t", nil, "only list spaces carrying all of the given tags")
+	listCmd.Flags().StringVarP(&groupFilter, "group", "g", "", "only list the spaces of the given group, in group order")
+	listCmd.Flags().StringVarP(&sortOrder, "sort", "s", "", "sort order: name or activity (default: creation order)")
+	listCmd.Flags().BoolVar(&statusFlag, "status", false, "include git status (dirty, ahead/behind upstream, merged)")
+	listCmd.Flags().BoolVar(&ciFlag, "ci", false, "include the CI status of each branch from the forge")
+	listCmd.Flags().BoolVarP(&wideFlag, "wide", "W", false, "include the owner and the first line of each space's note")
+	listCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "number of spaces to inspect concurrently (default: number of CPUs)")
+	listCmd.Flags().StringVarP(&outputFormat, "output", "o", "", "output format: csv, tsv, json or yaml (default: plain text)")
+	rootCmd.AddCommand(listCmd)
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+
+	if watchFlag {
+		return watchList(cmd.Context(), dest)
+	}
+
+	entries, err := listEntries(dest)
+	if err != nil {
+		return err
+	}
+	rows := buildRows(cmd.Context(), dest, entries)
+	if outputFormat != "" {
+		if err := markSessions(rows); err != nil {
+			return err
+		}
+	}
+
+	switch outputFormat {
+	case "":
+	case "csv":
+		return writeDelimited(os.Stdout, ',', rows)
+	case "tsv":
+		return writeDelimited(os.Stdout, '\t', rows)
+	case "json":
+		return writeJSON(os.Stdout, rows)
+	case "yaml":
+		return writeYAML(os.Stdout, rows)
+	default:
+		return fmt.Errorf("unknown output format %q (expected csv, tsv, json or yaml)", outputFormat)
+	}
+
+	if len(rows) == 0 {
+		fmt.Println("No tracked spaces")
+		return nil
+	}
+
+	for _, r := range rows {
+		fmt.Println(formatRow(r))
+	}
+	return nil
+}
+
+// listRow is a registry entry together with the optional columns requested on the command line.
+// In JSON and YAML, the entry's fields are followed by "session", and by "status", "tests", "ci" and
+// "note" when requested.
+type listRow struct {
+	registry.Entry `yaml:",inline"`
+	Session        bool               `json:"session" yaml:"session"` // The space's tmux session is running
+	Status         *spaces.Status     `json:"status,omitempty" yaml:"status,omitempty"`
+	Tests          *spaces.TestResult `json:"tests,omitempty" yaml:"tests,omitempty"` // Last run of remux test, with --status
+	CI             *forge.CIStatus    `json:"ci,omitempty" yaml:"ci,omitempty"`
+	Note           string             `json:"note,omitempty" yaml:"note,omitempty"`
+}
+
+// buildRows computes the optional columns for each entry.
+func buildRows(ctx context.Context, dest string, entries []registry.Entry) []listRow {
+	rows := make([]listRow, len(entries))
+	// Columns are best effort; a space whose status fails is shown as missing
+	_ = spaces.Parallel(entries, jobs, func(i int, e registry.Entry) error {
+		rows[i].Entry = e
+		if statusFlag {
+			status, err := spaces.GetStatus(dest, e)
+			if err != nil {
+				return err
+			}
+			rows[i].Status = &status
+			rows[i].Tests, _ = spaces.LastTestResult(dest, e.Name)
+		}
+		if ciFlag {
+			ci, err := spaces.GetCIStatus(ctx, dest, e)
+			if err != nil {
+				return err
+			}
+			rows[i].CI = ci
+		}
+		if wideFlag {
+			rows[i].Note = spaces.NoteSummary(dest, e.Name)
+		}
+		return nil
+	})
+	return rows
+}
+
+// markSessions sets the Session column of the rows whose tmux session is running.
+func markSessions(rows []listRow) error {
+	running, err := runningSessions()
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		rows[i].Session = running[tmux.SessionName(rows[i].Name)]
+	}
+	return nil
+}
+
+// listEntries loads the registry and applies the list filters.
+func listEntries(dest string) ([]registry.Entry, error) {
+	reg, err := registryStore(dest).Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load space registry: %w", err)
+	}
+
+	entries := reg.List()
+	if len(tagFilter) > 0 {
+		entries = reg.Tagged(tagFilter...)
+	}
+	if groupFilter != "" {
+		if reg.Group(groupFilter) == nil {
+			return nil, fmt.Errorf("no group named %q", groupFilter)
+		}
+		entries = slices.DeleteFunc(reg.GroupMembers(groupFilter), func(m registry.Entry) bool {
+			return !slices.ContainsFunc(entries, func(e registry.Entry) bool { return e.Name == m.Name })
+		})
+	}
+	if activeFlag || inactiveFlag {
+		entries, err = filterBySession(entries, activeFlag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch sortOrder {
+	case "":
+	case "name":
+		slices.SortStableFunc(entries, func(a, b registry.Entry) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+	case "activity":
+		sortByActivity(entries)
+	default:
+		return nil, fmt.Errorf("unknown sort order %q (expected name or activity)", sortOrder)
+	}
+
+	return entries, nil
+}
+
+// sortByActivity orders entries most recently active first, where activity is
+// the later of the last open and the last commit in the worktree.
+func sortByActivity(entries []registry.Entry) {
+	activity := make([]time.Time, len(entries))
+	_ = spaces.Parallel(entries, jobs, func(i int, e registry.Entry) error {
+		activity[i] = e.LastOpened
+		if commit, err := git.LastCommitTime(e.Path); err == nil && commit.After(activity[i]) {
+			activity[i] = commit
+		}
+		return nil
+	})
+
+	byName := make(map[string]time.Time, len(entries))
+	for i, e := range entries {
+		byName[e.Name] = activity[i]
+	}
+	slices.SortStableFunc(entries, func(a, b registry.Entry) int {
+		return byName[b.Name].Compare(byName[a.Name])
+	})
+}
+
+// formatRow returns the list line for a single row.
+func formatRow(r listRow) string {
+	line := fmt.Sprintf("%s\t%s", r.Name, r.Path)
+	if statusFlag {
+		line += "\t" + formatStatus(r.Status)
+		if r.Hibernated {
+			line += " hibernated"
+		}
+		if r.Tests != nil {
+			line += " " + r.Tests.String()
+		}
+	}
+	if ciFlag {
+		line += "\t" + formatCI(r.CI)
+	}
+	if wideFlag {
+		line += "\t" + r.Owner + "\t" + r.Note
+	}
+	return line
+}
+
+// formatCI returns a CI indicator such as "ci:pass".
+func formatCI(ci *forge.CIStatus) string {
+	if ci == nil {
+		return "ci:error"
+	}
+	switch ci.State {
+	case forge.CISuccess:
+		return "ci:pass"
+	case forge.CIFailure:
+		return "ci:fail"
+	case forge.CIPending:
+		return "ci:pending"
+	}
+	return "ci:none"
+}
+
+// formatStatus returns a compact status summary such as "dirty +2 -1".
+func formatStatus(status *spaces.Status) string {
+	if status == nil {
+		return "missing"
+	}
+	return status.String()
+}
+
+// writeDelimited writes rows as delimiter-separated values with a header row.
+// Fields are quoted as needed so the output can be imported into spreadsheets.
+func writeDelimited(out io.Writer, delimiter rune, rows []listRow) error {
+	w := csv.NewWriter(out)
+	w.Comma = delimiter
+
+	header := []string{"name", "path", "port", "repo_root"}
+	if statusFlag {
+		header = append(header, "dirty", "ahead", "behind", "merged", "hibernated")
+	}
+	if ciFlag {
+		header = append(header, "ci", "ci_url")
+	}
+	if wideFlag {
+		header = append(header, "owner", "note")
+	}
+	// Added after the optional columns, so columns never move
+	header = append(header, "session")
+	if statusFlag {
+		header = append(header, "tests")
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		record := []string{r.Name, r.Path, strconv.Itoa(r.Port), r.RepoRoot}
+		if statusFlag {
+			if r.Status != nil {
+				record = append(record,
+					strconv.FormatBool(r.Status.Dirty),
+					strconv.Itoa(r.Status.Ahead),
+					strconv.Itoa(r.Status.Behind),
+					strconv.FormatBool(r.Status.Merged))
+			} else {
+				record = append(record, "", "", "", "")
+			}
+			record = append(record, strconv.FormatBool(r.Hibernated))
+		}
+		if ciFlag {
+			if r.CI != nil {
+				record = append(record, string(r.CI.State), r.CI.URL)
+			} else {
+				record = append(record, "", "")
+			}
+		}
+		if wideFlag {
+			record = append(record, r.Owner, r.Note)
+		}
+		record = append(record, strconv.FormatBool(r.Session))
+		if statusFlag {
+			switch {
+			case r.Tests == nil:
+				record = append(record, "")
+			case r.Tests.Passed():
+				record = append(record, "pass")
+			default:
+				record = append(record, "fail")
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeJSON writes rows as a JSON array, one object per space.
+func writeJSON(out io.Writer, rows []listRow) error {
+	if rows == nil {
+		rows = []listRow{}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rows)
+}
+
+// writeYAML writes rows as a YAML sequence, one mapping per space.
+func writeYAML(out io.Writer, rows []listRow) error {
+	if rows == nil {
+		rows = []listRow{}
+	}
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(rows); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// watchList redraws the list every watchInterval until interrupted.
+func watchList(ctx context.Context, dest string) error {
+	var previous map[string]bool
+	for {
+		entries, err := listEntries(dest)
+		if err != nil {
+			return err
+		}
+		previous = renderWatch(os.Stdout, buildRows(ctx, dest, entries), previous)
+		time.Sleep(watchInterval)
+	}
+}
+
+// renderWatch draws one refresh of the watched list to out and returns its lines, to be passed
+// back as previous on the next refresh. Lines not in previous are highlighted; on the first
+// refresh, when previous is nil, none are.
+func renderWatch(out io.Writer, rows []listRow, previous map[string]bool) map[string]bool {
+	// Clear screen and move cursor home
+	fmt.Fprint(out, "\033[H\033[2J")
+	fmt.Fprintf(out, "Every %s: remux list\n\n", watchInterval)
+	if len(rows) == 0 {
+		fmt.Fprintln(out, "No tracked spaces")
+	}
+
+	current := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		line := formatRow(r)
+		current[line] = true
+		if previous != nil && !previous[line] {
+			fmt.Fprintf(out, "\033[1m%s\033[0m\n", line)
+		} else {
+			fmt.Fprintln(out, line)
+		}
+	}
+	return current
+}
+
+// filterBySession returns the entries whose tmux session is running (active=true)
+// or not running (active=false).
+func filterBySession(entries []registry.Entry, active bool) ([]registry.Entry, error) {
+	running, err := runningSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []registry.Entry
+	for _, e := range entries {
+		if running[tmux.SessionName(e.Name)] == active {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// runningSessions returns the set of running tmux sessions.
+func runningSessions() (map[string]bool, error) {
+	sessions, err := tmux.ListSessions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tmux sessions: %w", err)
+	}
+	running := make(map[string]bool, len(sessions))
+	for _, name := range sessions {
+		running[name] = true
+	}
+	return running, nil
+}
@@ -0,0 +1,142 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+
+	"github.com/johanhenriksson/remux/cmd"
+	"github.com/johanhenriksson/remux/forge"
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+var _ = Describe("list output", func() {
+	entry := func(name string) registry.Entry {
+		return registry.Entry{Name: name, Path: "/spaces/" + name, Port: 10000, RepoRoot: "/repos/app"}
+	}
+
+	Describe("yaml", func() {
+		It("uses the same keys as json and leaves out empty fields", func() {
+			rows := []cmd.ListRow{
+				{Entry: entry("app-a"), Session: true, CI: &forge.CIStatus{State: forge.CIPending}},
+				{Entry: entry("app-b"), CI: &forge.CIStatus{State: forge.CISuccess, URL: "https://ci.example/1"}},
+			}
+			var out bytes.Buffer
+			Expect(cmd.WriteYAML(&out, rows)).To(Succeed())
+
+			var parsed []map[string]any
+			Expect(yaml.Unmarshal(out.Bytes(), &parsed)).To(Succeed())
+			Expect(parsed).To(HaveLen(2))
+			Expect(parsed[0]).To(HaveKeyWithValue("name", "app-a"))
+			Expect(parsed[0]).To(HaveKeyWithValue("repo_root", "/repos/app"))
+			Expect(parsed[0]).To(HaveKeyWithValue("session", true))
+			Expect(parsed[0]).To(HaveKeyWithValue("ci", map[string]any{"state": "pending"}))
+			Expect(parsed[0]).NotTo(HaveKey("status"))
+			Expect(parsed[0]).NotTo(HaveKey("note"))
+			Expect(parsed[1]).To(HaveKeyWithValue("session", false))
+			Expect(parsed[1]).To(HaveKeyWithValue("ci", map[string]any{"state": "success", "url": "https://ci.example/1"}))
+		})
+
+		It("writes an empty sequence when there are no spaces", func() {
+			var out bytes.Buffer
+			Expect(cmd.WriteYAML(&out, nil)).To(Succeed())
+			Expect(out.String()).To(Equal("[]\n"))
+		})
+	})
+
+	Describe("delimited", func() {
+		write := func(delimiter rune, rows []cmd.ListRow) string {
+			var out bytes.Buffer
+			Expect(cmd.WriteDelimited(&out, delimiter, rows)).To(Succeed())
+			return out.String()
+		}
+
+		It("writes a header row even when there are no spaces", func() {
+			Expect(write(',', nil)).To(Equal("name,path,port,repo_root,session\n"))
+			Expect(write('\t', nil)).To(Equal("name\tpath\tport\trepo_root\tsession\n"))
+		})
+
+		It("adds the optional columns before session", func() {
+			DeferCleanup(cmd.SetListWide(true))
+			row := cmd.ListRow{Entry: entry("app-a"), Note: "fix login"}
+			row.Owner = "ada"
+			Expect(write(',', []cmd.ListRow{row})).To(Equal(
+				"name,path,port,repo_root,owner,note,session\n" +
+					"app-a,/spaces/app-a,10000,/repos/app,ada,fix login,false\n"))
+		})
+
+		It("quotes csv fields containing commas, quotes and newlines", func() {
+			DeferCleanup(cmd.SetListWide(true))
+			row := cmd.ListRow{Entry: entry("app-a"), Session: true, Note: "first, \"second\"\nthird"}
+			row.Path = "/spaces/a,b"
+			Expect(write(',', []cmd.ListRow{row})).To(HaveSuffix(
+				"\napp-a,\"/spaces/a,b\",10000,/repos/app,,\"first, \"\"second\"\"\nthird\",true\n"))
+		})
+
+		It("quotes tsv fields containing tabs, quotes and newlines but not commas", func() {
+			DeferCleanup(cmd.SetListWide(true))
+			row := cmd.ListRow{Entry: entry("app-a"), Note: "a\tb \"c\"\nd"}
+			row.Path = "/spaces/a,b"
+			Expect(write('\t', []cmd.ListRow{row})).To(HaveSuffix(
+				"\napp-a\t/spaces/a,b\t10000\t/repos/app\t\t\"a\tb \"\"c\"\"\nd\"\tfalse\n"))
+		})
+	})
+
+	Describe("watch", func() {
+		const bold = "\033[1m"
+
+		render := func(rows []cmd.ListRow, previous map[string]bool) (string, map[string]bool) {
+			var out bytes.Buffer
+			current := cmd.RenderWatch(&out, rows, previous)
+			return out.String(), current
+		}
+
+		It("highlights only the rows that changed since the previous refresh", func() {
+			rows := []cmd.ListRow{{Entry: entry("app-a")}, {Entry: entry("app-b")}}
+			out, previous := render(rows, nil)
+			Expect(out).To(ContainSubstring("app-a\t/spaces/app-a\n"))
+			Expect(out).NotTo(ContainSubstring(bold))
+
+			out, previous = render(rows, previous)
+			Expect(out).NotTo(ContainSubstring(bold))
+
+			rows[1].Path = "/elsewhere/app-b"
+			out, _ = render(rows, previous)
+			Expect(out).To(ContainSubstring("\napp-a\t/spaces/app-a\n"))
+			Expect(out).To(ContainSubstring(bold + "app-b\t/elsewhere/app-b\033[0m\n"))
+			Expect(strings.Count(out, bold)).To(Equal(1))
+		})
+
+		It("highlights a space added since the previous refresh", func() {
+			_, previous := render([]cmd.ListRow{{Entry: entry("app-a")}}, nil)
+			out, _ := render([]cmd.ListRow{{Entry: entry("app-a")}, {Entry: entry("app-b")}}, previous)
+			Expect(out).To(ContainSubstring(bold + "app-b\t/spaces/app-b"))
+			Expect(strings.Count(out, bold)).To(Equal(1))
+		})
+	})
+
+	Describe("session column", func() {
+		const running = "remux-list-test-running"
+
+		BeforeEach(func() {
+			if _, err := exec.LookPath("tmux"); err != nil {
+				Skip("tmux not available")
+			}
+			Expect(tmux.NewSessionDetached(context.Background(), tmux.SessionName(running), GinkgoT().TempDir(), nil)).To(Succeed())
+			DeferCleanup(tmux.KillSession, tmux.SessionName(running))
+		})
+
+		It("is set only for spaces whose session is running", func() {
+			rows := []cmd.ListRow{{Entry: entry(running)}, {Entry: entry("remux-list-test-stopped")}}
+			Expect(cmd.MarkSessions(rows)).To(Succeed())
+			Expect(rows[0].Session).To(BeTrue())
+			Expect(rows[1].Session).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// verbose lowers the log level to include the git, tmux and hook commands
+// remux runs.
+var verbose bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "log the git, tmux and hook commands being run")
+}
+
+// setupLogging makes the default logger, which the spaces, git, tmux and
+// config packages log through, print to stderr in the command's format.
+func setupLogging(w io.Writer) {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(NewLogHandler(w, level)))
+}
+
+// LogHandler prints log records as plain lines, e.g.
+// "warning: failed to save scrollback: <err>", instead of slog's key=value
+// records. An "err" attribute is appended to the message, other attributes
+// follow as key=value pairs.
+type LogHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+// NewLogHandler returns a LogHandler writing records at or above level to w.
+func NewLogHandler(w io.Writer, level slog.Leveler) *LogHandler {
+	return &LogHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+// Enabled reports whether level is at or above the handler's level.
+func (h *LogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes the record as a single line.
+func (h *LogHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("warning: ")
+	case r.Level < slog.LevelInfo:
+		b.WriteString("debug: ")
+	}
+	b.WriteString(r.Message)
+
+	var errText string
+	write := func(a slog.Attr) bool {
+		if a.Key == "err" {
+			errText = a.Value.String()
+			return true
+		}
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+	if errText != "" {
+		b.WriteString(": " + errText)
+	}
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+// WithAttrs returns a handler that includes attrs in every record.
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)
+	return &h2
+}
+
+// WithGroup returns the handler unchanged; groups are not shown.
+func (h *LogHandler) WithGroup(string) slog.Handler {
+	return h
+}
@@ -0,0 +1,42 @@
+package cmd_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux/cmd"
+)
+
+var _ = Describe("LogHandler", func() {
+	var out bytes.Buffer
+
+	BeforeEach(func() {
+		out.Reset()
+	})
+
+	It("prints warnings as plain lines with the error last", func() {
+		log := slog.New(cmd.NewLogHandler(&out, slog.LevelInfo))
+		log.Warn("setup failed", "err", errors.New("exit status 1"), "installer", "npm")
+		Expect(out.String()).To(Equal("warning: setup failed installer=npm: exit status 1\n"))
+	})
+
+	It("includes attributes added with With", func() {
+		log := slog.New(cmd.NewLogHandler(&out, slog.LevelInfo)).With("space", "app-feature")
+		log.Error("failed")
+		Expect(out.String()).To(Equal("error: failed space=app-feature\n"))
+	})
+
+	It("leaves out records below its level", func() {
+		log := slog.New(cmd.NewLogHandler(&out, slog.LevelInfo))
+		log.Debug("running git", "args", []string{"status"})
+		Expect(out.String()).To(BeEmpty())
+
+		log = slog.New(cmd.NewLogHandler(&out, slog.LevelDebug))
+		log.Debug("running git", "args", []string{"status"})
+		Expect(out.String()).To(Equal("debug: running git args=[status]\n"))
+	})
+})
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logsFollow bool
+	logsSource string
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [name]",
+	Short: "Show the logs of a workspace's hooks, services and tabs",
+	Long: `Show the output remux collected for a workspace: of its hooks and setup
+installers, of starting and stopping its services, and of the tabs that set
+log in the config. Processes that hooks leave running in the background keep
+logging there. Without a name, the current workspace is used.
+
+Each source has its own log in the workspace's state dir; with several, each
+line is prefixed with its source.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLogs,
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "keep printing new output until interrupted")
+	logsCmd.Flags().StringVarP(&logsSource, "source", "s", "", "only show one source: hook, service or tab:NAME")
+	rootCmd.AddCommand(logsCmd)
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	switch {
+	case logsSource == "", logsSource == config.LogSourceHook, logsSource == config.LogSourceService:
+	case strings.HasPrefix(logsSource, config.LogSourceTab) && logsSource != config.LogSourceTab:
+	default:
+		return fmt.Errorf("unknown log source %q (expected hook, service or tab:NAME)", logsSource)
+	}
+
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+	return space.Logs(cmd.Context(), os.Stdout, spaces.LogOptions{Source: logsSource, Follow: logsFollow})
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var maintainJobs int
+
+var maintainCmd = &cobra.Command{
+	Use:   "maintain",
+	Short: "Run git maintenance and prune stale state across workspaces",
+	Long: `Keep a workspace directory with many worktrees healthy. For each repository
+with workspaces, git's records of deleted worktrees are pruned and git
+maintenance repacks objects and collects garbage once enough has piled up.
+Worktrees share their repository's objects, so this runs once per
+repository, a few repositories at a time and at the lowest CPU and I/O
+priority. Then the state of dropped workspaces, such as cached statuses, is
+removed.
+
+The daemon runs this on a schedule with --maintain-every.`,
+	Args: cobra.NoArgs,
+	RunE: runMaintain,
+}
+
+func init() {
+	maintainCmd.Flags().IntVarP(&maintainJobs, "jobs", "j", spaces.DefaultMaintainJobs, "number of repositories to maintain concurrently")
+	rootCmd.AddCommand(maintainCmd)
+}
+
+func runMaintain(cmd *cobra.Command, args []string) error {
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
+
+	result, err := st.Maintain(cmd.Context(), maintainJobs)
+	for _, repo := range result.Repos {
+		fmt.Printf("Maintained %s\n", repo)
+	}
+	for _, name := range result.Stale {
+		fmt.Printf("Removed stale state of %s\n", name)
+	}
+	return err
+}
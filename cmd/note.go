@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var noteCmd = &cobra.Command{
+	Use:   "note [name]",
+	Short: "Edit a workspace's note",
+	Long: `Open the workspace's markdown note in the editor set by remux setup, or in
+$VISUAL or $EDITOR (default: vi). Notes are kept in the workspace's state
+dir, outside the worktree, and the first line is shown by list --wide.
+Without a name, the current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runNote,
+}
+
+func init() {
+	rootCmd.AddCommand(noteCmd)
+}
+
+func runNote(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+
+	path := space.NotePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return openEditor(path)
+}
+
+// openEditor edits path in the user's editor, which may include arguments,
+// e.g. EDITOR="code --wait".
+func openEditor(path string) error {
+	editor := globalConfig().Editor
+	if editor == "" {
+		editor = os.Getenv("VISUAL")
+	}
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run editor (%s): %w", editor, err)
+	}
+	return nil
+}
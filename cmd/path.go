@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var pathCmd = &cobra.Command{
+	Use:   "path [name]",
+	Short: "Print a workspace's worktree path",
+	Long: `Print the worktree path of a workspace, for scripts and the rcd shell
+function (see shell-init). Without a name, the current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runPath,
+}
+
+func init() {
+	rootCmd.AddCommand(pathCmd)
+}
+
+func runPath(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	entry := st.Registry.Get(name)
+	if entry == nil {
+		return fmt.Errorf("%w: %s", spaces.ErrSpaceNotFound, name)
+	}
+	fmt.Println(entry.Path)
+	return nil
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/johanhenriksson/remux/terminal"
+	"github.com/spf13/cobra"
+)
+
+var portsOnce bool
+
+var watchPortsCmd = &cobra.Command{
+	Use:   "watch-ports",
+	Short: "Show which workspace ports are in use, refreshing continuously",
+	Long: `Show the processes listening on the ports allocated to each workspace and
+refresh the view every --interval until interrupted. Listeners whose working
+directory is outside the workspace's worktree are marked foreign: another
+workspace's server or a system service holding the port. Processes are found
+with lsof; without it, busy ports are listed without their process.`,
+	Args: cobra.NoArgs,
+	RunE: runWatchPorts,
+}
+
+func init() {
+	watchPortsCmd.Flags().DurationVar(&watchInterval, "interval", 2*time.Second, "refresh interval")
+	watchPortsCmd.Flags().BoolVar(&portsOnce, "once", false, "print the port usage once and exit")
+	rootCmd.AddCommand(watchPortsCmd)
+}
+
+func runWatchPorts(cmd *cobra.Command, args []string) error {
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+	highlight := terminal.IsTerminal(os.Stdout)
+	if portsOnce {
+		return printPorts(os.Stdout, dest, highlight)
+	}
+	return watchPorts(cmd.Context(), dest, highlight)
+}
+
+// watchPorts redraws the port usage every watchInterval until ctx is cancelled.
+func watchPorts(ctx context.Context, dest string, highlight bool) error {
+	for {
+		// Clear screen and move cursor home
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("Every %s: remux watch-ports\n\n", watchInterval)
+		if err := printPorts(os.Stdout, dest, highlight); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchInterval):
+		}
+	}
+}
+
+// printPorts writes a block per space: its port range, then a line per
+// listener. Foreign listeners are shown in red if highlight is set.
+func printPorts(w io.Writer, dest string, highlight bool) error {
+	// A new state per refresh, so spaces created meanwhile show up
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
+	usage, err := st.PortUsage()
+	if err != nil {
+		return err
+	}
+	if len(usage) == 0 {
+		fmt.Fprintln(w, "No tracked spaces")
+	}
+	for _, u := range usage {
+		fmt.Fprintf(w, "%s\t%d-%d", u.Name, u.Port, u.Port+registry.PortRange-1)
+		if len(u.Listeners) == 0 {
+			fmt.Fprint(w, "\tidle")
+		}
+		fmt.Fprintln(w)
+		for _, l := range u.Listeners {
+			fmt.Fprintln(w, formatListener(l, highlight))
+		}
+	}
+	return nil
+}
+
+// formatListener returns the line of a listener, such as "  11010  1234  node".
+func formatListener(l spaces.PortListener, highlight bool) string {
+	pid := "?"
+	if l.Process.PID != 0 {
+		pid = fmt.Sprint(l.Process.PID)
+	}
+	line := fmt.Sprintf("  %d\t%s\t%s", l.Port, pid, l.Process.Command)
+	if !l.Foreign {
+		return line
+	}
+	line += "\tforeign: " + l.Cwd
+	if highlight {
+		return "\033[1;31m" + line + "\033[0m"
+	}
+	return line
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var promptNoStatus bool
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Print a shell prompt segment for the current workspace",
+	Long: `Print the name and port of the workspace containing the current directory,
+followed by * if its worktree has uncommitted changes, e.g. "app-login:11020*".
+Prints nothing outside of a workspace. The workspace is found without running
+git and the dirty marker uses the cached status of list --status, so it is fast
+enough to run on every prompt.`,
+	Args: cobra.NoArgs,
+	RunE: runPrompt,
+}
+
+func init() {
+	promptCmd.Flags().BoolVar(&promptNoStatus, "no-status", false, "leave out the dirty marker, so git is never run")
+	rootCmd.AddCommand(promptCmd)
+}
+
+func runPrompt(cmd *cobra.Command, args []string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	dest, entry, err := spaces.FindSpace(cwd)
+	if err != nil {
+		return nil
+	}
+
+	segment := fmt.Sprintf("%s:%d", entry.Name, entry.Port)
+	if !promptNoStatus {
+		if status, err := spaces.GetStatus(dest, entry); err == nil && status.Dirty {
+			segment += "*"
+		}
+	}
+	fmt.Println(segment)
+	return nil
+}
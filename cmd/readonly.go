@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var (
+	registryFile string
+	readOnly     bool
+)
+
+// readOnlyCommands are the commands allowed with --read-only. They only
+// inspect workspaces: none of them changes the registry, a worktree, a
+// session or a state dir.
+var readOnlyCommands = map[string]bool{
+	"browse":          true,
+	"completion":      true,
+	"config get":      true,
+	"config validate": true,
+	"copy":            true,
+	"diff":            true,
+	"group list":      true,
+	"group status":    true,
+	"help":            true,
+	"hooks explain":   true,
+	"list":            true,
+	"logs":            true,
+	"path":            true,
+	"prompt":          true,
+	"report":          true,
+	"shell-init":      true,
+	"status":          true,
+	"version":         true,
+	"watch-ports":     true,
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&destDir, "dest", "d", "", "worktree directory (default: ~/.remux)")
+	rootCmd.PersistentFlags().StringVar(&registryFile, "registry", "", "registry file to use instead of the one in the worktree directory")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", false, "only allow commands that inspect workspaces, and change no files")
+}
+
+// checkReadOnly refuses commands that change workspaces under --read-only,
+// and keeps the allowed ones from writing caches and git's index.
+func checkReadOnly(cmd *cobra.Command) error {
+	if !readOnly {
+		return nil
+	}
+	// Subcommands of an allowed command, such as completion bash, are allowed
+	allowed := false
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		allowed = allowed || readOnlyCommands[commandName(c)]
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s is not allowed with --read-only", spaces.ErrReadOnly, commandName(cmd))
+	}
+	spaces.ReadOnlyCaches = true
+	// git status refreshes the index of the worktree unless told not to
+	return os.Setenv("GIT_OPTIONAL_LOCKS", "0")
+}
+
+// registryStore returns the store of the registry of the spaces in dest,
+// which is the file given with --registry if set, and read-only with
+// --read-only.
+func registryStore(dest string) registry.Store {
+	var store registry.Store = registry.FileStore{Dir: dest, File: registryFile}
+	if readOnly {
+		store = registry.ReadOnlyStore{Store: store}
+	}
+	return store
+}
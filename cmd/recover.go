@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var recoverDryRun bool
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Clean up after interrupted creates and drops",
+	Long: `Find creates and drops whose remux process was killed before they finished,
+as recorded in the journal kept in the workspace directory while they run.
+Interrupted creates are rolled back: the registry entry, worktree and branch
+they made are removed and stashed changes are put back. Interrupted drops are
+completed: the worktree is removed and the workspace unregistered.
+
+Operations of remux processes that are still running are left alone.`,
+	Args: cobra.NoArgs,
+	RunE: runRecover,
+}
+
+func init() {
+	recoverCmd.Flags().BoolVarP(&recoverDryRun, "dry-run", "n", false, "only report interrupted operations")
+	rootCmd.AddCommand(recoverCmd)
+}
+
+func runRecover(cmd *cobra.Command, args []string) error {
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
+
+	ops, err := st.IncompleteOperations()
+	if err != nil {
+		return fmt.Errorf("failed to read operation journal: %w", err)
+	}
+	if len(ops) == 0 {
+		fmt.Println("No interrupted operations")
+		return nil
+	}
+	for _, op := range ops {
+		fmt.Println(op)
+	}
+	if recoverDryRun {
+		return nil
+	}
+
+	if err := st.Recover(cmd.Context(), ops); err != nil {
+		return err
+	}
+	fmt.Printf("Recovered %d operation(s)\n", len(ops))
+	return nil
+}
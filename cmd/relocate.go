@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var relocateCmd = &cobra.Command{
+	Use:   "relocate <old> <new>",
+	Short: "Update workspaces after moving the worktree directory or a worktree",
+	Long: `Update workspaces after moving the worktree directory or a single worktree.
+
+If <old> still exists and <new> doesn't, the directory is moved first.
+Registry paths are rewritten, git's worktree links are repaired and idle shells
+in the affected tmux sessions change to the new location.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runRelocate,
+}
+
+func init() {
+	rootCmd.AddCommand(relocateCmd)
+}
+
+func runRelocate(cmd *cobra.Command, args []string) error {
+	oldPath, err := resolveDestDir(args[0])
+	if err != nil {
+		return err
+	}
+	newPath, err := resolveDestDir(args[1])
+	if err != nil {
+		return err
+	}
+
+	// When the dest dir itself is moved, the registry is found at either end
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{newPath, oldPath} {
+		if _, err := os.Stat(filepath.Join(dir, "spaces.yaml")); err == nil {
+			dest = dir
+			break
+		}
+	}
+
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
+
+	relocated, err := st.Relocate(cmd.Context(), oldPath, newPath)
+	for _, e := range relocated {
+		fmt.Printf("Relocated %s -> %s\n", e.Name, e.Path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if defaultDest, err := resolveDestDir(""); err == nil && destDir == "" && st.DestDir != defaultDest {
+		fmt.Printf("Pass --dest %s to use the moved worktree directory\n", st.DestDir)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var repairDryRun bool
+
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Detect and fix broken workspaces",
+	Long: `Detect workspaces whose worktree directory was deleted or that git lost track
+of, remove their stale registry entries, relink worktrees with git worktree repair
+and prune git's records of deleted worktrees.`,
+	Args: cobra.NoArgs,
+	RunE: runRepair,
+}
+
+func init() {
+	repairCmd.Flags().BoolVarP(&repairDryRun, "dry-run", "n", false, "only report problems")
+	rootCmd.AddCommand(repairCmd)
+}
+
+func runRepair(cmd *cobra.Command, args []string) error {
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
+
+	problems := st.Diagnose()
+	if len(problems) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	unrepairable := 0
+	for _, p := range problems {
+		if !p.Repairable() {
+			unrepairable++
+			fmt.Printf("%s [manual fix required]\n", p)
+		} else {
+			fmt.Println(p)
+		}
+	}
+	if repairDryRun {
+		return nil
+	}
+
+	if err := st.Repair(cmd.Context(), problems); err != nil {
+		return err
+	}
+	fmt.Printf("Repaired %d of %d problems\n", len(problems)-unrepairable, len(problems))
+	return nil
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/johanhenriksson/remux/terminal"
+	"github.com/spf13/cobra"
+)
+
+var reportCopy bool
+
+var reportCmd = &cobra.Command{
+	Use:   "report [name]",
+	Short: "Print a markdown summary of a workspace",
+	Long: `Print a markdown summary of a workspace for a pull request description or
+standup update: its branch and base branch, linked issue and pull request,
+the commits and diffstat since the base branch, and its note. Set
+report.template in .remux.yaml to change the layout. Without a name, the
+current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runReport,
+}
+
+func init() {
+	reportCmd.Flags().BoolVarP(&reportCopy, "copy", "c", false, "copy the summary to the clipboard instead of printing it")
+	rootCmd.AddCommand(reportCmd)
+}
+
+func runReport(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	report, err := st.Report(cmd.Context(), name)
+	if err != nil {
+		return err
+	}
+
+	if reportCopy {
+		if err := terminal.Copy(report); err != nil {
+			return fmt.Errorf("failed to copy report: %w", err)
+		}
+		return nil
+	}
+	fmt.Print(report)
+	return nil
+}
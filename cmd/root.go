@@ -1,20 +1,78 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/johanhenriksson/remux/telemetry"
+	"github.com/johanhenriksson/remux/tmux"
 	"github.com/spf13/cobra"
 )
 
+// traceFlushTimeout bounds how long exporting the trace may delay exiting.
+const traceFlushTimeout = 5 * time.Second
+
 var rootCmd = &cobra.Command{
 	Use:   "remux",
 	Short: "Run multiple coding agents in parallel using git worktrees and tmux",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		setupLogging(os.Stderr)
+		if err := applyDefaults(cmd); err != nil {
+			return err
+		}
+		// Defaults may turn on --verbose
+		setupLogging(os.Stderr)
+		// Through a running daemon's control client, if there is one
+		if cmd != daemonCmd {
+			tmux.UseControl(tmux.NewRemote(daemonSocket()))
+		}
+		return checkReadOnly(cmd)
+	},
 }
 
+// Execute runs the root command. Interrupts cancel the command's context, so
+// running hooks and git commands are stopped and partial work is rolled back.
+// The exit code reflects the kind of error, see ExitCode.
+// The command is traced if the environment configures an OTLP endpoint.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := executeTraced(ctx)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(ExitCode(err))
+	}
+}
+
+// executeTraced runs the root command in a span named after the command,
+// e.g. "remux stack new", and flushes the trace before returning.
+func executeTraced(ctx context.Context) error {
+	shutdown, err := telemetry.Setup(ctx, Version)
+	if err != nil {
+		slog.Warn("failed to set up tracing", "err", err)
+		return rootCmd.ExecuteContext(ctx)
+	}
+	defer func() {
+		// Flushing must not hang the command when the collector is unreachable
+		flushCtx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+		defer cancel()
+		if err := shutdown(flushCtx); err != nil {
+			slog.Warn("failed to export traces", "err", err)
+		}
+	}()
+
+	name := rootCmd.Name()
+	if target, _, err := rootCmd.Find(os.Args[1:]); err == nil {
+		name = target.CommandPath()
 	}
+	ctx, span := telemetry.Start(ctx, name)
+	err = rootCmd.ExecuteContext(ctx)
+	telemetry.End(span, err)
+	return err
 }
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run <command> [name]",
+	Short: "Run a command from the commands section of a workspace's config",
+	Long: `Run a named command of a workspace, such as lint or seed-db, from the
+commands section of its .remux.yaml. The command runs in the worktree with
+the env its session starts with, plus the command's own env, and template
+expressions in both are evaluated like in hooks.
+
+Commands with tab: true run in a new tab of the workspace's tmux session, and
+commands with background: true keep running after remux returns, writing
+their output to a log in the workspace's state dir. Without a name, the
+current workspace is used.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runRun,
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+}
+
+func runRun(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args[1:])
+	if err != nil {
+		return err
+	}
+
+	run, err := st.RunCommand(cmd.Context(), name, args[0], os.Stdout, os.Stderr)
+	if err != nil || run == nil {
+		return err
+	}
+	if run.PID != 0 {
+		fmt.Printf("Started %s in the background (pid %d), output in %s\n", args[0], run.PID, run.Log)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/tmux"
+	"github.com/spf13/cobra"
+)
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Configure remux for first use",
+	Long: `Check the installed git and tmux versions, then ask for the defaults kept in
+~/.config/remux/config.yaml: the workspace directory, the first port given to
+workspaces, the editor for notes and the session backend. Finally, offer to
+load shell completion and the rcd function (see shell-init) from the shell's
+startup file. Run it again to change the answers; the current ones are the
+defaults.`,
+	Args: cobra.NoArgs,
+	RunE: runSetup,
+}
+
+func init() {
+	rootCmd.AddCommand(setupCmd)
+}
+
+// backends are the session backends offered by setup.
+var backends = []string{"tmux", "screen", "zellij", "wezterm", "kitty"}
+
+// toolRequirements are the oldest git and tmux versions providing every
+// command remux runs, such as git worktree repair and tmux new-session -e.
+var toolRequirements = []struct {
+	name         string
+	version      func() (string, error)
+	major, minor int
+	optional     bool // Only needed by the tmux backend
+}{
+	{name: "git", version: git.Version, major: 2, minor: 30},
+	{name: "tmux", version: tmux.Version, major: 3, minor: 0, optional: true},
+}
+
+func runSetup(cmd *cobra.Command, args []string) error {
+	in := bufio.NewReader(os.Stdin)
+	out := os.Stdout
+
+	if err := checkTools(out); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+
+	g := *globalConfig()
+	g.Dest = ask(in, out, "Workspace directory", orDefault(g.Dest, "~/.remux"))
+	for {
+		answer := ask(in, out, "First port for workspaces", strconv.Itoa(orDefaultInt(g.BasePort, registry.BasePort)))
+		port, err := strconv.Atoi(answer)
+		if err == nil && port > 0 && port+registry.PortRange <= 65536 {
+			g.BasePort = port
+			break
+		}
+		fmt.Fprintf(out, "%q is not a port number\n", answer)
+	}
+	g.Editor = ask(in, out, "Editor for notes", orDefault(g.Editor, orDefault(os.Getenv("VISUAL"), orDefault(os.Getenv("EDITOR"), "vi"))))
+	for {
+		answer := ask(in, out, "Session backend ("+strings.Join(backends, ", ")+")", orDefault(g.Backend, "tmux"))
+		if slices.Contains(backends, answer) {
+			g.Backend = answer
+			break
+		}
+		fmt.Fprintf(out, "%q is not a supported backend\n", answer)
+	}
+
+	if err := g.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Fprintln(out, "Saved defaults")
+	fmt.Fprintln(out)
+
+	shell := filepath.Base(os.Getenv("SHELL"))
+	rc, line, err := shellStartup(shell)
+	if err != nil {
+		fmt.Fprintf(out, "Shell integration: %v; see remux shell-init\n", err)
+		return nil
+	}
+	if !isYes(ask(in, out, "Load completion and the rcd function from "+rc+"? [y/N]", "")) {
+		return nil
+	}
+	added, err := installShellInit(rc, line)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", rc, err)
+	}
+	if added {
+		fmt.Fprintf(out, "Added to %s; open a new shell to use it\n", rc)
+	} else {
+		fmt.Fprintf(out, "%s already loads remux\n", rc)
+	}
+	return nil
+}
+
+// checkTools prints the installed version of each required tool. Fails if git
+// is missing or too old; tmux problems are only reported, since other
+// backends don't need it.
+func checkTools(out io.Writer) error {
+	for _, tool := range toolRequirements {
+		version, err := tool.version()
+		switch {
+		case err != nil && tool.optional:
+			fmt.Fprintf(out, "%s:\tnot found (needed by the tmux backend)\n", tool.name)
+		case err != nil:
+			return fmt.Errorf("%s not found: %w", tool.name, err)
+		case !versionAtLeast(version, tool.major, tool.minor):
+			if !tool.optional {
+				return fmt.Errorf("%s %s is too old (need %d.%d or later)", tool.name, version, tool.major, tool.minor)
+			}
+			fmt.Fprintf(out, "%s:\t%s is too old (need %d.%d or later)\n", tool.name, version, tool.major, tool.minor)
+		default:
+			fmt.Fprintf(out, "%s:\t%s ok\n", tool.name, version)
+		}
+	}
+	return nil
+}
+
+// versionNumber matches the major and minor number of versions like "2.39.5" or "3.3a".
+var versionNumber = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+// versionAtLeast reports whether version is major.minor or later. Versions
+// that can't be parsed, such as "next-3.5", are assumed recent enough.
+func versionAtLeast(version string, major, minor int) bool {
+	m := versionNumber.FindStringSubmatch(version)
+	if m == nil {
+		return true
+	}
+	gotMajor, _ := strconv.Atoi(m[1])
+	gotMinor, _ := strconv.Atoi(m[2])
+	return gotMajor > major || gotMajor == major && gotMinor >= minor
+}
+
+// ask prints a question with its default answer and returns the answer read
+// from in, or the default if the answer is empty.
+func ask(in *bufio.Reader, out io.Writer, question, def string) string {
+	if def != "" {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(out, "%s ", question)
+	}
+	answer, _ := in.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// isYes reports whether answer is y or yes.
+func isYes(answer string) bool {
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes"
+}
+
+// orDefault returns s, or def if s is empty.
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// orDefaultInt returns n, or def if n is zero.
+func orDefaultInt(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
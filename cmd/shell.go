@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var shellCmd = &cobra.Command{
+	Use:   "shell [name]",
+	Short: "Start a shell in a workspace with its env, without a session",
+	Long: `Start an interactive shell in the worktree of a workspace, with the SPACE_*
+variables and config env a session of the workspace starts with. Exiting the
+shell returns to where you were. No session is started and no hooks run, so
+this is a quick way to run a few commands in a workspace without attaching.
+
+The shell is $SHELL, or /bin/sh if it isn't set. Without a name, the current
+workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runShell,
+}
+
+var shellInitCmd = &cobra.Command{
+	Use:   "shell-init bash|zsh|fish",
+	Short: "Print shell completion and the rcd function for a shell's startup file",
+	Long: `Print the completion script of remux and the rcd function, which changes
+to a workspace's worktree (rcd feature-branch), for the given shell. Load it
+from the shell's startup file, which remux setup does for you:
+
+  eval "$(remux shell-init bash)"    # ~/.bashrc
+  eval "$(remux shell-init zsh)"     # ~/.zshrc
+  remux shell-init fish | source     # ~/.config/fish/config.fish
+
+It also reports the exit status of each command to tmux in the windows of
+tabs with rename: status, so their names can show it.
+
+With --env, it also adds a hook that exports the env of a workspace into the
+shell when you cd into its worktree outside of tmux, as a session would start
+with, and restores the variables when you leave it.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return writeShellInit(os.Stdout, args[0], shellInitEnv)
+	},
+}
+
+var shellInitEnv bool
+
+func init() {
+	shellInitCmd.Flags().BoolVar(&shellInitEnv, "env", false, "add a cd hook activating the env of workspaces")
+	rootCmd.AddCommand(shellCmd)
+	rootCmd.AddCommand(shellInitCmd)
+}
+
+func runShell(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+	env, err := space.SessionEnv(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	// Not bound to the command's context: interrupts are meant for the shell
+	sh := exec.Command(shell)
+	sh.Dir = space.Path
+	sh.Env = os.Environ()
+	for k, v := range env {
+		sh.Env = append(sh.Env, k+"="+v)
+	}
+	sh.Stdin = os.Stdin
+	sh.Stdout = os.Stdout
+	sh.Stderr = os.Stderr
+	err = sh.Run()
+
+	// The shell exits with the status of the last command run in it
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil
+	}
+	return err
+}
+
+// rcdPosix is the rcd function for bash and zsh.
+const rcdPosix = `
+# rcd changes to the worktree of a remux workspace
+rcd() {
+	local dir
+	dir="$(remux path "$@")" && cd "$dir"
+}
+`
+
+// rcdFish is the rcd function for fish.
+const rcdFish = `
+# rcd changes to the worktree of a remux workspace
+function rcd
+	set -l dir (remux path $argv); and cd $dir
+end
+`
+
+// envHookBash is the cd hook activating workspace env for bash. bash has no
+// cd event, so it checks for a changed directory before each prompt.
+const envHookBash = `
+# _remux_env exports the env of the remux workspace containing the current
+# directory, and restores the variables when leaving it
+_remux_env() {
+	[ -n "$TMUX" ] && return
+	[ "$PWD" = "${_remux_env_pwd-}" ] && return
+	_remux_env_pwd="$PWD"
+	eval "$(remux env activate bash 2>/dev/null)"
+}
+PROMPT_COMMAND="_remux_env${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+`
+
+// envHookZsh is the cd hook activating workspace env for zsh.
+const envHookZsh = `
+# _remux_env exports the env of the remux workspace containing the current
+# directory, and restores the variables when leaving it
+_remux_env() {
+	[[ -n "$TMUX" ]] && return
+	eval "$(remux env activate zsh 2>/dev/null)"
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook chpwd _remux_env
+_remux_env
+`
+
+// envHookFish is the cd hook activating workspace env for fish.
+const envHookFish = `
+# _remux_env exports the env of the remux workspace containing the current
+# directory, and restores the variables when leaving it
+function _remux_env --on-variable PWD
+	set -q TMUX; and return
+	remux env activate fish 2>/dev/null | source
+end
+_remux_env
+`
+
+// statusHookBash reports the exit status of each command for tabs renamed by
+// it. It goes first in PROMPT_COMMAND, before other hooks change $?.
+const statusHookBash = `
+# _remux_status reports the exit status of the last command to tmux, for
+# remux tabs whose name shows it
+_remux_status() {
+	local ret=$?
+	[ -n "${REMUX_REPORT_STATUS-}" ] && [ -n "$TMUX" ] && tmux set-option -p @remux_status "$ret" 2>/dev/null
+	return $ret
+}
+PROMPT_COMMAND="_remux_status${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+`
+
+// statusHookZsh reports the exit status of each command for tabs renamed by it.
+const statusHookZsh = `
+# _remux_status reports the exit status of the last command to tmux, for
+# remux tabs whose name shows it
+_remux_status() {
+	local ret=$?
+	[[ -n "${REMUX_REPORT_STATUS-}" && -n "$TMUX" ]] && tmux set-option -p @remux_status "$ret" 2>/dev/null
+	return $ret
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook precmd _remux_status
+`
+
+// statusHookFish reports the exit status of each command for tabs renamed by it.
+const statusHookFish = `
+# _remux_status reports the exit status of the last command to tmux, for
+# remux tabs whose name shows it
+function _remux_status --on-event fish_postexec
+	set -l ret $status
+	set -q REMUX_REPORT_STATUS; and set -q TMUX; and tmux set-option -p @remux_status $ret 2>/dev/null
+end
+`
+
+// writeShellInit writes the shell integration of the given shell to w,
+// including the env cd hook if env is set.
+func writeShellInit(w io.Writer, shell string, env bool) error {
+	var script, hook, status string
+	var err error
+	switch shell {
+	case "bash":
+		err = rootCmd.GenBashCompletionV2(w, true)
+		script, hook, status = rcdPosix, envHookBash, statusHookBash
+	case "zsh":
+		err = rootCmd.GenZshCompletion(w)
+		script, hook, status = rcdPosix, envHookZsh, statusHookZsh
+	case "fish":
+		err = rootCmd.GenFishCompletion(w, true)
+		script, hook, status = rcdFish, envHookFish, statusHookFish
+	default:
+		return fmt.Errorf("unsupported shell %q (expected bash, zsh or fish)", shell)
+	}
+	if err != nil {
+		return err
+	}
+	if env {
+		script += hook
+	}
+	script += status
+	_, err = io.WriteString(w, script)
+	return err
+}
+
+// shellStartup returns the startup file of the given shell and the line
+// loading remux's shell integration from it.
+func shellStartup(shell string) (path, line string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	switch shell {
+	case "bash":
+		return filepath.Join(home, ".bashrc"), `eval "$(remux shell-init bash)"`, nil
+	case "zsh":
+		dir := os.Getenv("ZDOTDIR")
+		if dir == "" {
+			dir = home
+		}
+		return filepath.Join(dir, ".zshrc"), `eval "$(remux shell-init zsh)"`, nil
+	case "fish":
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".config")
+		}
+		return filepath.Join(dir, "fish", "config.fish"), "remux shell-init fish | source", nil
+	}
+	return "", "", fmt.Errorf("unsupported shell %q (expected bash, zsh or fish)", shell)
+}
+
+// installShellInit appends line to the startup file at path, unless the file
+// already loads remux's shell integration. Reports whether it was added.
+func installShellInit(path, line string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if strings.Contains(string(data), "remux shell-init") {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	prefix := ""
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		prefix = "\n"
+	}
+	if _, err := fmt.Fprintf(f, "%s\n# remux completion and rcd\n%s\n", prefix, line); err != nil {
+		return false, err
+	}
+	return true, f.Close()
+}
@@ -2,47 +2,121 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/johanhenriksson/remux/forge"
 	"github.com/johanhenriksson/remux/git"
 	"github.com/johanhenriksson/remux/registry"
 	"github.com/johanhenriksson/remux/spaces"
 	"github.com/spf13/cobra"
 )
 
-var destDir string
+var (
+	destDir      string
+	fastFlag     bool
+	applyEnvFlag bool
+	timingsFlag  bool
+	fromIssue    int
+	issueComment bool
+	noSetup      bool
+	newDryRun    bool
+	templateName string
+	newWindow    bool
+	takeChanges  bool
+	fromFile     string
+	newPort      int
+	profile      string
+	openHere     bool
+	baseRef      string
+	trackBranch  string
+	newDetached  bool
+)
 
 var newCmd = &cobra.Command{
 	Use:   "new <name>",
 	Short: "Create a new workspace",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runNew,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if fromFile != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		if fromIssue > 0 || trackBranch != "" {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: runNew,
 }
 
 var openCmd = &cobra.Command{
 	Use:   "open <name>",
 	Short: "Open or resume a workspace session",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runOpen,
-}
+	Long: `Open or resume a workspace session.
 
-var listCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all tracked workspaces",
-	Args:  cobra.NoArgs,
-	RunE:  runList,
+With --here, the checkout containing the current directory is bound as a
+workspace first: it gets a port and a session with the tabs and env of its
+config, but stays where it is instead of being a worktree in the dest dir.
+The workspace is named after the checkout's directory unless a name is
+given. Dropping a bound workspace only unregisters it.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if openHere {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: runOpen,
 }
 
 func init() {
 	rootCmd.AddCommand(newCmd)
 	rootCmd.AddCommand(openCmd)
-	rootCmd.AddCommand(listCmd)
 
-	newCmd.Flags().StringVarP(&destDir, "dest", "d", "", "destination directory for worktrees (default: ~/.remux)")
-	openCmd.Flags().StringVarP(&destDir, "dest", "d", "", "worktree directory (default: ~/.remux)")
+	newCmd.Flags().BoolVar(&timingsFlag, "timings", false, "report how long each phase took")
+	openCmd.Flags().BoolVar(&timingsFlag, "timings", false, "report how long each phase took")
+	newCmd.Flags().IntVar(&fromIssue, "from-issue", 0, "create the workspace for an issue, naming the branch after its title")
+	newCmd.Flags().BoolVar(&noSetup, "no-setup", false, "don't run the setup installers configured in .remux.yaml")
+	newCmd.Flags().BoolVar(&issueComment, "comment", false, "with --from-issue, comment the branch name on the issue")
+	newCmd.Flags().BoolVarP(&newDryRun, "dry-run", "n", false, "print what would be done without doing it")
+	newCmd.Flags().StringVarP(&templateName, "template", "T", "", "start from a space template in ~/.config/remux/templates")
+	newCmd.Flags().BoolVar(&takeChanges, "take-changes", false, "move the current checkout's uncommitted changes into the new workspace")
+	newCmd.Flags().IntVar(&newPort, "port", 0, "use this first port for the workspace instead of allocating a free range")
+	newCmd.Flags().StringVar(&baseRef, "base", "", "start the new branch from this branch, tag or commit instead of HEAD")
+	newCmd.Flags().StringVar(&baseRef, "from", "", "alias of --base")
+	_ = newCmd.Flags().MarkHidden("from")
+	newCmd.Flags().StringVar(&trackBranch, "track", "", "fetch a remote branch such as origin/feature and check it out, naming the branch after it")
+	newCmd.Flags().BoolVar(&newDetached, "detached", false, "start the session without attaching to it")
+	newCmd.Flags().StringVar(&fromFile, "from-file", "", "create every workspace listed in a YAML manifest, without opening them")
+	newCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "with --from-file, number of workspaces to create concurrently (default: number of CPUs)")
+	newCmd.MarkFlagsMutuallyExclusive("from-file", "from-issue")
+	newCmd.MarkFlagsMutuallyExclusive("from-file", "take-changes")
+	newCmd.MarkFlagsMutuallyExclusive("from-file", "dry-run")
+	newCmd.MarkFlagsMutuallyExclusive("from-file", "port")
+	newCmd.MarkFlagsMutuallyExclusive("from-file", "detached")
+	newCmd.MarkFlagsMutuallyExclusive("from-file", "base", "from", "track")
+	newCmd.MarkFlagsMutuallyExclusive("from-issue", "track")
+	openCmd.Flags().BoolVar(&newWindow, "new-window", false, "open the session in a new iTerm2 or Terminal.app window (macOS)")
+	openCmd.Flags().StringVar(&profile, "profile", "", "with --new-window, the iTerm2 profile or Terminal.app settings set to use")
+	openCmd.Flags().BoolVar(&fastFlag, "fast", false, "skip env resolution and on_open hooks when the session is already running")
+	openCmd.Flags().BoolVar(&openHere, "here", false, "bind the checkout containing the current directory as a workspace and open it")
+	openCmd.Flags().BoolVar(&applyEnvFlag, "apply-env", false, "update the env of an already running session to the current config, like env apply")
+}
+
+// newTimings returns a phase recorder if --timings was given, nil otherwise.
+func newTimings() *spaces.Timings {
+	if !timingsFlag {
+		return nil
+	}
+	return &spaces.Timings{}
+}
+
+// printTimings writes the timing report to stderr. Safe to call with nil.
+func printTimings(timings *spaces.Timings) {
+	if timings != nil {
+		timings.Write(os.Stderr)
+	}
 }
 
 func getDestDir() (string, error) {
@@ -51,6 +125,9 @@ func getDestDir() (string, error) {
 
 // resolveDestDir resolves the destination directory, expanding ~ and making it absolute.
 func resolveDestDir(dest string) (string, error) {
+	if dest == "" {
+		dest = globalConfig().Dest
+	}
 	if dest == "" {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
@@ -72,6 +149,44 @@ func resolveDestDir(dest string) (string, error) {
 	return filepath.Abs(dest)
 }
 
+// resolveSpaceName maps a user-supplied name to a registered space name.
+// Exact registry names win; otherwise, when run inside a git repository,
+// the repository name is prefixed the same way `new` names worktrees.
+// Elsewhere, or if that isn't registered either, the name matches the one
+// space of any repository that `new` would have given it, and is ambiguous
+// if several do.
+func resolveSpaceName(reg *registry.Registry, name string) (string, error) {
+	if reg.Get(name) != nil {
+		return name, nil
+	}
+
+	if repoRoot, err := git.FindRoot(); err == nil {
+		if git.IsWorktree(repoRoot) {
+			if mainRepo, err := git.GetMainRepoPath(context.Background(), repoRoot); err == nil {
+				repoRoot = mainRepo
+			}
+		}
+		prefixed := spaces.SpaceName(repoRoot, name)
+		if reg.Get(prefixed) != nil {
+			return prefixed, nil
+		}
+	}
+
+	var matches []string
+	for _, e := range reg.List() {
+		if e.Name == spaces.SpaceName(e.RepoRoot, name) {
+			matches = append(matches, e.Name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", registry.ErrNotFound, name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%w: %s matches %s, give the full name", spaces.ErrInvalidName, name, strings.Join(matches, ", "))
+}
+
 func confirmPrompt(message string) bool {
 	fmt.Print(message)
 	reader := bufio.NewReader(os.Stdin)
@@ -81,15 +196,55 @@ func confirmPrompt(message string) bool {
 }
 
 func runNew(cmd *cobra.Command, args []string) error {
-	branchName := args[0]
+	if fromFile != "" {
+		return runNewBatch(cmd)
+	}
+
+	var (
+		fg    forge.Forge
+		issue *forge.Issue
+	)
+	if fromIssue > 0 {
+		root, err := git.FindRoot()
+		if err != nil {
+			return err
+		}
+		if fg, err = forge.Open(root); err != nil {
+			return err
+		}
+		if issue, err = fg.IssueInfo(cmd.Context(), fromIssue); err != nil {
+			return err
+		}
+	}
+
+	var branchName string
+	switch {
+	case len(args) > 0:
+		branchName = args[0]
+	case trackBranch != "":
+		_, branchName, _ = strings.Cut(trackBranch, "/")
+	default:
+		branchName = spaces.IssueBranchName(issue.Number, issue.Title)
+	}
+	if err := spaces.ValidateBranchName(branchName); err != nil {
+		normalized := spaces.NormalizeName(branchName)
+		if newDryRun || normalized == "" || spaces.ValidateBranchName(normalized) != nil {
+			return err
+		}
+		if !confirmPrompt(fmt.Sprintf("Branch name %q can't be used. Use %q instead? [y/N] ", branchName, normalized)) {
+			return nil
+		}
+		branchName = normalized
+	}
 
 	repoRoot, err := git.FindRoot()
 	if err != nil {
-		return fmt.Errorf("not in a git repository: %w", err)
+		return err
 	}
+	checkout := repoRoot
 
 	if git.IsWorktree(repoRoot) {
-		repoRoot, err = git.GetMainRepoPath(repoRoot)
+		repoRoot, err = git.GetMainRepoPath(cmd.Context(), repoRoot)
 		if err != nil {
 			return fmt.Errorf("failed to find main repository: %w", err)
 		}
@@ -100,69 +255,229 @@ func runNew(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	reuseExisting := false
-	if git.BranchExists(repoRoot, branchName) {
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
+
+	// The space is named after the given name, its branch follows the
+	// config's branch_name; a tracked branch keeps the remote's name
+	spaceName := branchName
+	if trackBranch == "" {
+		if branchName, spaceName, err = st.NameBranch(repoRoot, templateName, branchName); err != nil {
+			return err
+		}
+	}
+
+	// A dry run plans for reusing the branch instead of asking
+	reuseExisting := newDryRun
+	if !newDryRun && git.BranchExists(cmd.Context(), repoRoot, branchName) {
 		if !confirmPrompt(fmt.Sprintf("Branch %q already exists. Reuse it? [y/N] ", branchName)) {
 			return nil
 		}
 		reuseExisting = true
 	}
 
-	worktreePath, err := spaces.Create(spaces.CreateOptions{
+	timings := newTimings()
+	opts := spaces.CreateOptions{
 		RepoRoot:            repoRoot,
-		DestDir:             dest,
 		BranchName:          branchName,
+		Name:                spaceName,
 		ReuseExistingBranch: reuseExisting,
-	})
+		SkipSetup:           noSetup,
+		Timings:             timings,
+		Template:            templateName,
+		BasePort:            globalConfig().BasePort,
+		PortCount:           globalConfig().Ports,
+		Port:                newPort,
+		Limits:              globalConfig().Limits,
+		Base:                baseRef,
+		Track:               trackBranch,
+	}
+	if issue != nil {
+		opts.Issue = issue.URL
+	}
+	if takeChanges {
+		if !git.HasUncommittedChanges(cmd.Context(), checkout) {
+			fmt.Fprintf(os.Stderr, "warning: no uncommitted changes in %s\n", checkout)
+		}
+		opts.TakeChangesFrom = checkout
+		// The changes apply to what is checked out, which in another
+		// worktree isn't the main repository's HEAD
+		if checkout != repoRoot && opts.Base == "" && opts.Track == "" {
+			if opts.Base, err = git.CurrentBranch(checkout); err != nil {
+				if opts.Base, err = git.Head(checkout); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if newDryRun {
+		plan, err := st.PlanCreate(cmd.Context(), opts)
+		if err != nil {
+			return err
+		}
+		plan = append(plan, spaces.Action{Kind: spaces.ActionSession, Description: "open session " + spaces.SpaceName(repoRoot, spaceName)})
+		fmt.Print(plan)
+		return nil
+	}
+	worktreePath, err := st.Create(cmd.Context(), opts)
 	if err != nil {
 		return err
 	}
 
-	return spaces.OpenSession(spaces.OpenSessionOptions{
-		DestDir: dest,
-		Name:    filepath.Base(worktreePath),
+	if issue != nil && issueComment {
+		body := fmt.Sprintf("Working on this in branch `%s`.", branchName)
+		if err := fg.CommentIssue(cmd.Context(), issue.Number, body); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+
+	err = st.OpenSession(cmd.Context(), spaces.OpenSessionOptions{
+		Name:         filepath.Base(worktreePath),
+		Timings:      timings,
+		Detached:     newDetached,
+		BeforeAttach: func() { printTimings(timings) },
 	})
+	if newDetached {
+		printTimings(timings)
+	}
+	return err
 }
 
-func runOpen(cmd *cobra.Command, args []string) error {
-	spaceName := args[0]
+// runNewBatch creates the workspaces listed in the --from-file manifest and
+// prints a line for each, followed by a summary.
+func runNewBatch(cmd *cobra.Command) error {
+	specs, err := spaces.LoadManifest(fromFile)
+	if err != nil {
+		return err
+	}
+
+	repoRoot, err := git.FindRoot()
+	if err != nil {
+		return err
+	}
+	if git.IsWorktree(repoRoot) {
+		repoRoot, err = git.GetMainRepoPath(cmd.Context(), repoRoot)
+		if err != nil {
+			return fmt.Errorf("failed to find main repository: %w", err)
+		}
+	}
 
 	dest, err := getDestDir()
 	if err != nil {
 		return err
 	}
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
 
-	// If in a git repo, prefix the repo name
-	if repoRoot, err := git.FindRoot(); err == nil {
-		repoName := filepath.Base(repoRoot)
-		spaceName = fmt.Sprintf("%s-%s", repoName, spaceName)
+	results, err := st.CreateBatch(cmd.Context(), spaces.CreateOptions{
+		RepoRoot:  repoRoot,
+		SkipSetup: noSetup,
+		Template:  templateName,
+		BasePort:  globalConfig().BasePort,
+		PortCount: globalConfig().Ports,
+		Limits:    globalConfig().Limits,
+	}, specs, jobs)
+	if results == nil {
+		return err
 	}
 
-	return spaces.OpenSession(spaces.OpenSessionOptions{
-		DestDir: dest,
-		Name:    spaceName,
-	})
+	created := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("FAIL\t%s: %v\n", r.Spec.Name, r.Err)
+			continue
+		}
+		created++
+		fmt.Printf("ok\t%s\t%s\tports %d-%d\n", r.Name, r.Path, r.Port, r.Port+registry.PortRange-1)
+	}
+	fmt.Printf("Created %d of %d workspaces\n", created, len(results))
+	if err := cmd.Context().Err(); err != nil {
+		return err
+	}
+	if created < len(results) {
+		return fmt.Errorf("%d of %d workspaces failed", len(results)-created, len(results))
+	}
+	return nil
 }
 
-func runList(cmd *cobra.Command, args []string) error {
+func runOpen(cmd *cobra.Command, args []string) error {
+	var spaceName string
+	if len(args) > 0 {
+		spaceName = args[0]
+	}
+
 	dest, err := getDestDir()
 	if err != nil {
 		return err
 	}
 
-	reg, err := registry.Load(dest)
-	if err != nil {
-		return fmt.Errorf("failed to load space registry: %w", err)
+	// The new window runs open again from the same directory, so the name
+	// resolves the same way there
+	if newWindow {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		args := append([]string{exe, "open"}, args...)
+		args = append(args, "--dest", dest)
+		if openHere {
+			args = append(args, "--here")
+		}
+		if fastFlag {
+			args = append(args, "--fast")
+		}
+		if applyEnvFlag {
+			args = append(args, "--apply-env")
+		}
+		if timingsFlag {
+			args = append(args, "--timings")
+		}
+		return openInNewWindow(profile, cwd, args...)
 	}
 
-	entries := reg.List()
-	if len(entries) == 0 {
-		fmt.Println("No tracked spaces")
-		return nil
+	st, err := loadState(dest)
+	if err != nil {
+		return err
+	}
+	if openHere {
+		if spaceName, err = bindHere(cmd, st, spaceName); err != nil {
+			return err
+		}
+	} else if repoRoot, err := git.FindRoot(); err == nil {
+		// If in a git repo, prefix the repo name
+		spaceName = spaces.SpaceName(repoRoot, spaceName)
 	}
 
-	for _, e := range entries {
-		fmt.Printf("%s\t%s\n", e.Name, e.Path)
+	timings := newTimings()
+	return st.OpenSession(cmd.Context(), spaces.OpenSessionOptions{
+		Name:         spaceName,
+		Fast:         fastFlag,
+		ApplyEnv:     applyEnvFlag,
+		Timings:      timings,
+		BeforeAttach: func() { printTimings(timings) },
+	})
+}
+
+// bindHere binds the checkout containing the current directory as a space,
+// under name if it isn't empty, and returns the space's name.
+func bindHere(cmd *cobra.Command, st *spaces.State, name string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
 	}
-	return nil
+	return st.Bind(cmd.Context(), spaces.BindOptions{
+		Path:      cwd,
+		Name:      name,
+		BasePort:  globalConfig().BasePort,
+		PortCount: globalConfig().Ports,
+		Limits:    globalConfig().Limits,
+	})
 }
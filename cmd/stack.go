@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/johanhenriksson/remux/terminal"
+	"github.com/spf13/cobra"
+)
+
+var stackCmd = &cobra.Command{
+	Use:   "stack",
+	Short: "Manage stacked workspaces",
+	Long: `Manage stacks of workspaces whose branches build on each other, such as a
+series of pull requests where each targets the branch of the one before.`,
+}
+
+var stackNewCmd = &cobra.Command{
+	Use:   "new <name>",
+	Short: "Create a workspace stacked on the current one",
+	Long: `Create a workspace whose branch starts from the current workspace's branch.
+The new workspace is recorded as a child of the current one.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runStackNew,
+}
+
+var stackSyncCmd = &cobra.Command{
+	Use:   "sync [name]",
+	Short: "Rebase each workspace in a stack onto its parent",
+	Long: `Rebase the branch of every workspace in the stack onto the branch of its
+parent, from the bottom of the stack up. Without a name, the stack of the
+current workspace is synced.
+
+A rebase that stops on conflicts pauses the sync and opens a conflicts window
+in the workspace's tmux session, running the conflicts command of its config
+(default: git status). Without a running session, the command runs here when
+attached to a terminal. Resolve the conflicts, stage them, then run
+stack sync --continue to finish the sync, or stack sync --abort to undo it.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runStackSync,
+}
+
+var (
+	syncContinue bool
+	syncAbort    bool
+)
+
+func init() {
+	stackNewCmd.Flags().BoolVar(&noSetup, "no-setup", false, "don't run the setup installers configured in .remux.yaml")
+	stackSyncCmd.Flags().BoolVar(&syncContinue, "continue", false, "continue a sync stopped on conflicts once they are resolved")
+	stackSyncCmd.Flags().BoolVar(&syncAbort, "abort", false, "undo a sync stopped on conflicts, resetting the rebased branches")
+	stackSyncCmd.MarkFlagsMutuallyExclusive("continue", "abort")
+	stackCmd.AddCommand(stackNewCmd)
+	stackCmd.AddCommand(stackSyncCmd)
+	rootCmd.AddCommand(stackCmd)
+}
+
+func runStackNew(cmd *cobra.Command, args []string) error {
+	st, parentName, err := spaceArg(nil)
+	if err != nil {
+		return err
+	}
+	parent := st.Registry.Get(parentName)
+	if parent == nil {
+		return fmt.Errorf("%w: %s (run stack new inside a workspace)", spaces.ErrSpaceNotFound, parentName)
+	}
+	base, err := git.CurrentBranch(parent.Path)
+	if err != nil {
+		return err
+	}
+
+	timings := newTimings()
+	worktreePath, err := st.Create(cmd.Context(), spaces.CreateOptions{
+		RepoRoot:   parent.RepoRoot,
+		BranchName: args[0],
+		Base:       base,
+		Parent:     parentName,
+		SkipSetup:  noSetup,
+		Timings:    timings,
+		BasePort:   globalConfig().BasePort,
+		PortCount:  globalConfig().Ports,
+		Limits:     globalConfig().Limits,
+	})
+	if err != nil {
+		return err
+	}
+
+	return st.OpenSession(cmd.Context(), spaces.OpenSessionOptions{
+		Name:         filepath.Base(worktreePath),
+		Timings:      timings,
+		BeforeAttach: func() { printTimings(timings) },
+	})
+}
+
+func runStackSync(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+
+	if syncAbort {
+		restored, err := st.AbortSync(cmd.Context(), name)
+		for _, s := range restored {
+			fmt.Printf("Reset %s\n", s)
+		}
+		return err
+	}
+
+	var synced []string
+	if syncContinue {
+		synced, err = st.ContinueSync(cmd.Context(), name)
+	} else {
+		synced, err = st.SyncStack(cmd.Context(), name)
+	}
+	for _, s := range synced {
+		fmt.Printf("Rebased %s\n", s)
+	}
+	var conflict *spaces.ConflictError
+	if errors.As(err, &conflict) {
+		window, resolveErr := st.ResolveConflicts(cmd.Context(), conflict.Space, terminal.IsTerminal(os.Stdin))
+		if resolveErr != nil {
+			slog.Warn("failed to open conflict resolution", "err", resolveErr)
+		} else if window {
+			fmt.Printf("Opened a conflicts window in %s\n", conflict.Space)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(synced) == 0 {
+		fmt.Printf("Nothing is stacked on %s\n", name)
+	}
+	return nil
+}
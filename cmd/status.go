@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/johanhenriksson/remux/spaces"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [name]",
+	Short: "Show the git and CI status of a workspace",
+	Long: `Show the git status of a workspace and the CI status of its branch on the
+forge. Without a name, the current workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runStatus,
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+	entry := st.Registry.Get(name)
+	if entry == nil {
+		return fmt.Errorf("%w: %s", spaces.ErrSpaceNotFound, name)
+	}
+
+	status, err := spaces.GetStatus(st.DestDir, *entry)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\t%s\n", entry.Name, entry.Path)
+	fmt.Printf("git:\t%s\n", formatStatus(&status))
+
+	// The forge being unreachable shouldn't hide the git status
+	ci, err := spaces.GetCIStatus(cmd.Context(), st.DestDir, *entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		return nil
+	}
+	line := formatCI(ci)
+	if ci.URL != "" {
+		line += "\t" + ci.URL
+	}
+	fmt.Printf("ci:\t%s\n", line)
+	return nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/spf13/cobra"
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage workspace tags",
+}
+
+var tagAddCmd = &cobra.Command{
+	Use:   "add <tag> <names...>",
+	Short: "Add a tag to one or more workspaces",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateTags(args[0], args[1:], (*registry.Registry).AddTag)
+	},
+}
+
+var tagRemoveCmd = &cobra.Command{
+	Use:   "remove <tag> <names...>",
+	Short: "Remove a tag from one or more workspaces",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateTags(args[0], args[1:], (*registry.Registry).RemoveTag)
+	},
+}
+
+func init() {
+	tagCmd.AddCommand(tagAddCmd)
+	tagCmd.AddCommand(tagRemoveCmd)
+	rootCmd.AddCommand(tagCmd)
+}
+
+// updateTags applies a tag mutation to each named space and saves the registry once.
+// All names are resolved before anything is modified.
+func updateTags(tag string, names []string, apply func(*registry.Registry, string, string) bool) error {
+	dest, err := getDestDir()
+	if err != nil {
+		return err
+	}
+
+	return registry.UpdateStore(registryStore(dest), func(reg *registry.Registry) error {
+		resolved := make([]string, len(names))
+		for i, name := range names {
+			var err error
+			if resolved[i], err = resolveSpaceName(reg, name); err != nil {
+				return err
+			}
+		}
+
+		for _, name := range resolved {
+			apply(reg, name, tag)
+		}
+		return nil
+	})
+}
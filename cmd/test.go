@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var testWindowFlag bool
+
+var testCmd = &cobra.Command{
+	Use:   "test [name]",
+	Short: "Run a workspace's test command",
+	Long: `Run the test command of a workspace, commands.test in .remux.yaml (or
+check.test), in its worktree with the env its session starts with. The
+result is recorded in the workspace's state dir and shown by list --status.
+With --window, the tests run in a new window of the workspace's tmux session
+instead, and are recorded once they finish. Without a name, the current
+workspace is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runTest,
+}
+
+func init() {
+	testCmd.Flags().BoolVar(&testWindowFlag, "window", false, "run the tests in a new window of the workspace's tmux session")
+	rootCmd.AddCommand(testCmd)
+}
+
+func runTest(cmd *cobra.Command, args []string) error {
+	st, name, err := spaceArg(args)
+	if err != nil {
+		return err
+	}
+
+	// The window runs test again, in the foreground, so it records the result
+	if testWindowFlag {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		command := fmt.Sprintf("%s test %s --dest %s", shellQuote(exe), shellQuote(name), shellQuote(st.DestDir))
+		return st.TestInWindow(cmd.Context(), name, command)
+	}
+
+	result, err := st.RunTests(cmd.Context(), name, os.Stdout, os.Stderr)
+	if result != nil {
+		fmt.Fprintf(os.Stderr, "%s in %s\n", result, result.Duration)
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// openInNewWindow runs args in dir in a new terminal window: iTerm2 when remux
+// runs inside iTerm2, Terminal.app otherwise. A non-empty profile selects the
+// iTerm2 profile or Terminal.app settings set of the window. macOS only.
+func openInNewWindow(profile, dir string, args ...string) error {
+	if runtime.GOOS != "darwin" {
+		return fmt.Errorf("--new-window is only supported on macOS")
+	}
+
+	script := newWindowScript(os.Getenv("TERM_PROGRAM") == "iTerm.app", profile, dir, args...)
+	out, err := exec.Command("osascript", "-e", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to open terminal window: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// newWindowScript returns the AppleScript that opens a window running args in dir,
+// in iTerm2 if iterm is set and in Terminal.app otherwise.
+func newWindowScript(iterm bool, profile, dir string, args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	command := appleString("cd " + shellQuote(dir) + " && " + strings.Join(quoted, " "))
+
+	if iterm {
+		window := "create window with default profile"
+		if profile != "" {
+			window = "create window with profile " + appleString(profile)
+		}
+		return fmt.Sprintf(`tell application "iTerm2"
+	set w to (%s)
+	tell current session of w to write text %s
+	activate
+end tell`, window, command)
+	}
+
+	settings := ""
+	if profile != "" {
+		settings = fmt.Sprintf("\n\tset current settings of t to settings set %s", appleString(profile))
+	}
+	return fmt.Sprintf(`tell application "Terminal"
+	set t to do script %s%s
+	activate
+end tell`, command, settings)
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// appleString quotes s as an AppleScript string literal.
+func appleString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
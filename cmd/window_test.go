@@ -0,0 +1,51 @@
+package cmd_test
+
+import (
+	"context"
+	"runtime"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux/cmd"
+)
+
+var _ = Describe("open --new-window", func() {
+	It("opens an iTerm2 window running the command in the directory", func() {
+		script := cmd.NewWindowScript(true, "", "/work/app", "/usr/local/bin/remux", "open", "app-fix")
+		Expect(script).To(Equal(`tell application "iTerm2"
+	set w to (create window with default profile)
+	tell current session of w to write text "cd '/work/app' && '/usr/local/bin/remux' 'open' 'app-fix'"
+	activate
+end tell`))
+	})
+
+	It("opens a Terminal.app window running the command in the directory", func() {
+		script := cmd.NewWindowScript(false, "", "/work/app", "remux", "open", "app-fix")
+		Expect(script).To(Equal(`tell application "Terminal"
+	set t to do script "cd '/work/app' && 'remux' 'open' 'app-fix'"
+	activate
+end tell`))
+	})
+
+	It("selects the given profile", func() {
+		Expect(cmd.NewWindowScript(true, `Dark "Pro"`, "/work", "remux")).To(
+			ContainSubstring(`set w to (create window with profile "Dark \"Pro\"")`))
+		Expect(cmd.NewWindowScript(false, "Homebrew", "/work", "remux")).To(
+			ContainSubstring("\n\tset current settings of t to settings set \"Homebrew\"\n"))
+	})
+
+	It("escapes paths with spaces, quotes and backslashes", func() {
+		script := cmd.NewWindowScript(false, "", `/Users/me/My "Work"/it's`, `/Applications/re mux\bin`, "open", "app")
+		Expect(script).To(ContainSubstring(
+			`do script "cd '/Users/me/My \"Work\"/it'\\''s' && '/Applications/re mux\\bin' 'open' 'app'"`))
+	})
+
+	It("fails outside macOS", func() {
+		if runtime.GOOS == "darwin" {
+			Skip("opens a real window on macOS")
+		}
+		Expect(cmd.Run(context.Background(), "open", "app-fix", "--new-window", "--dest", GinkgoT().TempDir())).To(
+			MatchError("--new-window is only supported on macOS"))
+	})
+})
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nameMarker stands in for the name when finding the parts of the branch
+// name template around it.
+const nameMarker = "\x00"
+
+// NameBranch returns the branch a new space given name gets by the
+// branch_name template, whose expressions can use name and user besides the
+// usual variables, or name itself without a template. A name that already
+// follows the template, such as alice/fix-login with {{ user }}/{{ name }}, is
+// kept as the branch. short is the part of the branch the name stands for,
+// fix-login in both cases.
+func (c *Config) NameBranch(repoRoot, name, user string) (branch, short string, err error) {
+	if c.BranchName == "" {
+		return name, name, nil
+	}
+	prefix, suffix, err := c.branchAffixes(repoRoot, user)
+	if err != nil {
+		return "", "", err
+	}
+	if prefix+suffix != "" && len(name) > len(prefix)+len(suffix) && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) {
+		return name, strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix), nil
+	}
+
+	tmpl := newTemplateEnv(Space{RepoRoot: repoRoot})
+	tmpl.branch = map[string]any{"name": name, "user": user}
+	branch, err = tmpl.evaluate(c.BranchName)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to evaluate branch_name: %w", err)
+	}
+	return branch, name, nil
+}
+
+// branchAffixes returns what the branch_name template puts before and after
+// the name, or nothing if it doesn't use the name as given.
+func (c *Config) branchAffixes(repoRoot, user string) (prefix, suffix string, err error) {
+	tmpl := newTemplateEnv(Space{RepoRoot: repoRoot})
+	tmpl.branch = map[string]any{"name": nameMarker, "user": user}
+	marked, err := tmpl.evaluate(c.BranchName)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to evaluate branch_name: %w", err)
+	}
+	prefix, suffix, ok := strings.Cut(marked, nameMarker)
+	if !ok || strings.Contains(suffix, nameMarker) {
+		return "", "", nil
+	}
+	return prefix, suffix, nil
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Cache warms the build caches of new spaces, so their first build doesn't
+// start from scratch. Paths are relative to the worktree and taken from the
+// repository root, which usually has a recent build.
+type Cache struct {
+	Copy   []string `yaml:"copy,omitempty"`   // Paths copied into new worktrees, e.g. node_modules
+	Link   []string `yaml:"link,omitempty"`   // Paths symlinked to the repository root's copy, for caches that are safe to share
+	Shared []string `yaml:"shared,omitempty"` // Tools whose cache env vars point at a dir shared by all spaces, see SharedCaches
+	Dir    string   `yaml:"dir,omitempty"`    // Parent of the shared cache dirs (default remux in the user cache dir, e.g. ~/.cache/remux)
+}
+
+// SharedCache is a tool cache that can be shared by all spaces through env vars.
+type SharedCache struct {
+	Name string            // Used in cache.shared
+	Env  map[string]string // Env var to its dir beneath cache.dir
+}
+
+// SharedCaches are the tool caches cache.shared can name.
+var SharedCaches = []SharedCache{
+	{Name: "go", Env: map[string]string{"GOCACHE": "go/build", "GOMODCACHE": "go/mod"}},
+	{Name: "npm", Env: map[string]string{"npm_config_cache": "npm"}},
+	{Name: "pnpm", Env: map[string]string{"npm_config_store_dir": "pnpm-store"}},
+	{Name: "yarn", Env: map[string]string{"YARN_CACHE_FOLDER": "yarn"}},
+	{Name: "gradle", Env: map[string]string{"GRADLE_USER_HOME": "gradle"}},
+	{Name: "pip", Env: map[string]string{"PIP_CACHE_DIR": "pip"}},
+}
+
+// CacheEnv returns the env vars pointing the tools in cache.shared at the
+// shared cache dir. Returns nil if none are shared.
+func (c *Config) CacheEnv() (map[string]string, error) {
+	if len(c.Cache.Shared) == 0 {
+		return nil, nil
+	}
+	dir, err := c.Cache.dir()
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string)
+	for _, name := range c.Cache.Shared {
+		i := indexSharedCache(name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown shared cache %q", name)
+		}
+		for key, sub := range SharedCaches[i].Env {
+			env[key] = filepath.Join(dir, filepath.FromSlash(sub))
+		}
+	}
+	return env, nil
+}
+
+// WarmCache copies and links the cache.copy and cache.link paths of the
+// repository at from into the new worktree of space. Paths that don't exist
+// in from or already exist in the worktree are skipped. Logs warnings on
+// failure and continues with the next path, like setup. Returns the paths
+// that were warmed, as written in the config.
+func (c *Config) WarmCache(ctx context.Context, space Space, from string) []string {
+	var warmed []string
+	for _, path := range c.Cache.Copy {
+		src, dst, ok := cachePaths(from, space.Path, path)
+		if !ok {
+			continue
+		}
+		if err := copyTree(ctx, src, dst); err != nil {
+			log().Warn("failed to copy cache", "path", path, "err", err)
+			continue
+		}
+		warmed = append(warmed, path)
+	}
+	for _, path := range c.Cache.Link {
+		src, dst, ok := cachePaths(from, space.Path, path)
+		if !ok {
+			continue
+		}
+		if err := os.Symlink(src, dst); err != nil {
+			log().Warn("failed to link cache", "path", path, "err", err)
+			continue
+		}
+		warmed = append(warmed, path)
+	}
+	return warmed
+}
+
+// cachePaths returns where path is in the repository at from and in the
+// worktree, and whether it should be warmed.
+func cachePaths(from, worktree, path string) (string, string, bool) {
+	src := filepath.Join(from, filepath.FromSlash(path))
+	dst := filepath.Join(worktree, filepath.FromSlash(path))
+	if _, err := os.Stat(src); err != nil {
+		log().Debug("skipping cache, not found", "path", src)
+		return "", "", false
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		log().Debug("skipping cache, already in worktree", "path", dst)
+		return "", "", false
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		log().Warn("failed to create cache parent", "path", path, "err", err)
+		return "", "", false
+	}
+	return src, dst, true
+}
+
+// copyTree copies src to dst with cp, sharing blocks with copy-on-write where
+// the filesystem supports it.
+func copyTree(ctx context.Context, src, dst string) error {
+	args := []string{"-pR", src, dst}
+	if runtime.GOOS == "linux" {
+		args = []string{"-a", "--reflink=auto", src, dst}
+	}
+	log().Debug("running command", "command", "cp "+strings.Join(args, " "))
+	out, err := exec.CommandContext(ctx, "cp", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// dir returns the parent of the shared cache dirs.
+func (c Cache) dir() (string, error) {
+	if c.Dir != "" {
+		if rest, ok := strings.CutPrefix(c.Dir, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to get home directory: %w", err)
+			}
+			return filepath.Join(home, rest), nil
+		}
+		return c.Dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "remux"), nil
+}
+
+// indexSharedCache returns the index of the named shared cache, or -1.
+func indexSharedCache(name string) int {
+	for i, sc := range SharedCaches {
+		if sc.Name == name {
+			return i
+		}
+	}
+	return -1
+}
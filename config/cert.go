@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultCertDomain is the domain template of a space's certificate unless
+// cert.domains is set. Browsers resolve *.localhost to the local machine
+// without a hosts entry.
+const DefaultCertDomain = "{{ space.Name }}.localhost"
+
+// Cert configures a locally trusted HTTPS certificate per space, made with
+// mkcert, so HTTPS-only frontends work in every space. The certificate and
+// key files are exported to sessions, hooks and services as TLS_CERT_FILE
+// and TLS_KEY_FILE, and the first domain as TLS_DOMAIN.
+type Cert struct {
+	Create  bool     `yaml:"create,omitempty"`  // Create the certificate with the space and remove it when the space is dropped
+	Domains []string `yaml:"domains,omitempty"` // Domain templates (default DefaultCertDomain)
+}
+
+// CertEnv returns the TLS_CERT_FILE, TLS_KEY_FILE and TLS_DOMAIN variables of
+// the space, or nil if cert.create isn't set.
+func (c *Config) CertEnv(space Space) (map[string]string, error) {
+	return c.Cert.env(newTemplateEnv(space))
+}
+
+func (c Cert) env(tmpl *templateEnv) (map[string]string, error) {
+	if !c.Create {
+		return nil, nil
+	}
+	domains, err := c.domains(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"TLS_CERT_FILE": tmpl.space["CertFile"].(string),
+		"TLS_KEY_FILE":  tmpl.space["KeyFile"].(string),
+		"TLS_DOMAIN":    domains[0],
+	}, nil
+}
+
+// CertDomains returns the domains of the space's certificate, or nil if
+// cert.create isn't set.
+func (c *Config) CertDomains(space Space) ([]string, error) {
+	if !c.Cert.Create {
+		return nil, nil
+	}
+	return c.Cert.domains(newTemplateEnv(space))
+}
+
+// domains evaluates the domain templates of the certificate.
+func (c Cert) domains(tmpl *templateEnv) ([]string, error) {
+	templates := c.Domains
+	if len(templates) == 0 {
+		templates = []string{DefaultCertDomain}
+	}
+	domains := make([]string, 0, len(templates))
+	for _, template := range templates {
+		domain, err := tmpl.evaluate(template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate cert domain: %w", err)
+		}
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+// CreateCert makes the space's certificate with mkcert if cert.create is
+// set, writing it to the space's CertFile and KeyFile. mkcert must be
+// installed, and its CA installed with mkcert -install for browsers to trust
+// the certificate.
+func (c *Config) CreateCert(ctx context.Context, space Space) error {
+	if !c.Cert.Create {
+		return nil
+	}
+	domains, err := c.CertDomains(space)
+	if err != nil {
+		return err
+	}
+	for _, file := range []string{space.CertFile, space.KeyFile} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+	}
+	args := append([]string{"-cert-file", space.CertFile, "-key-file", space.KeyFile}, domains...)
+	return runMkcert(ctx, args...)
+}
+
+// RemoveCert removes the space's certificate and key files, if there are any.
+func (c *Config) RemoveCert(space Space) error {
+	var errs []error
+	for _, file := range []string{space.CertFile, space.KeyFile} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runMkcert runs mkcert, returning its output in the error on failure.
+func runMkcert(ctx context.Context, args ...string) error {
+	log().Debug("running command", "command", "mkcert "+strings.Join(args, " "))
+	out, err := exec.CommandContext(ctx, "mkcert", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mkcert %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"context"
+	"io"
+	"slices"
+)
+
+// DefaultMarkers are the words the markers check looks for unless check.markers is set.
+var DefaultMarkers = []string{"TODO", "FIXME"}
+
+// Check configures the readiness checklist of a space, run before opening a
+// pull request. The clean, rebased and markers checks always run unless
+// skipped; test and lint run when their command is set.
+type Check struct {
+	Test    string   `yaml:"test,omitempty"`    // Command that must pass, e.g. go test ./...
+	Lint    string   `yaml:"lint,omitempty"`    // Command that must pass, e.g. golangci-lint run
+	Markers []string `yaml:"markers,omitempty"` // Words lines added on the branch may not contain (default DefaultMarkers)
+	Skip    []string `yaml:"skip,omitempty"`    // Names of checks not to run: clean, rebased, markers, test or lint
+}
+
+// Skipped reports whether the named check is skipped.
+func (c Check) Skipped(name string) bool {
+	return slices.Contains(c.Skip, name)
+}
+
+// MarkerWords returns the configured markers, or DefaultMarkers.
+func (c Check) MarkerWords() []string {
+	if len(c.Markers) > 0 {
+		return c.Markers
+	}
+	return DefaultMarkers
+}
+
+// RunCheckCommand runs a check command, such as Check.Test, in the space with
+// its env, writing the command's output to w. The command is evaluated as a
+// template first, like hooks.
+func (c *Config) RunCheckCommand(ctx context.Context, space Space, command string, w io.Writer) error {
+	return c.RunCommand(ctx, space, Command{Run: command}, w, w)
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestCommand is the name of the command run by `remux test`.
+const TestCommand = "test"
+
+// Command is a named command of the commands section, run in a space by
+// `remux run`, such as lint or seed-db. A command can be given as just its
+// shell command.
+type Command struct {
+	Run        string            `yaml:"run"`                  // Shell command, evaluated as a template like hooks
+	Env        map[string]string `yaml:"env,omitempty"`        // Set on top of the space's env, values evaluated as templates
+	Tab        bool              `yaml:"tab,omitempty"`        // Run in a new tab of the space's tmux session
+	Background bool              `yaml:"background,omitempty"` // Run without waiting for it, logging its output to the space's state dir
+	Session    bool              `yaml:"session,omitempty"`    // Run in a window of the space's tmux session that isn't selected, waiting for it
+}
+
+// UnmarshalYAML accepts a plain string as the command's Run.
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Run = node.Value
+		return nil
+	}
+	type plain Command
+	return node.Decode((*plain)(c))
+}
+
+// MarshalYAML writes a command without options as a plain string.
+func (c Command) MarshalYAML() (any, error) {
+	if len(c.Env) == 0 && !c.Tab && !c.Background && !c.Session {
+		return c.Run, nil
+	}
+	type plain Command
+	return plain(c), nil
+}
+
+// validate reports a command without Run, or one that asks for more than
+// one of Tab, Background and Session.
+func (c Command) validate() error {
+	if c.Run == "" {
+		return errors.New("command has nothing to run")
+	}
+	modes := 0
+	for _, set := range []bool{c.Tab, c.Background, c.Session} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return errors.New("command can only run in one of a tab, the background or the session")
+	}
+	return nil
+}
+
+// Command returns the named command of the commands section, and whether
+// there is one. Without a commands.test, the test command is check.test.
+func (c *Config) Command(name string) (Command, bool) {
+	if command, ok := c.Commands[name]; ok && command.Run != "" {
+		return command, true
+	}
+	if name == TestCommand && c.Check.Test != "" {
+		return Command{Run: c.Check.Test}, true
+	}
+	return Command{}, false
+}
+
+// CommandNames returns the names of the commands the space can run, sorted.
+func (c *Config) CommandNames() []string {
+	names := slices.Sorted(maps.Keys(c.Commands))
+	if _, ok := c.Commands[TestCommand]; !ok && c.Check.Test != "" {
+		names = append(names, TestCommand)
+		slices.Sort(names)
+	}
+	return names
+}
+
+// ResolveCommand evaluates a command's Run and Env as templates, and returns
+// the shell command with the env it runs with: the space's env overridden by
+// the command's.
+func (c *Config) ResolveCommand(space Space, command Command) (string, map[string]string, error) {
+	tmpl := newTemplateEnv(space)
+	env, err := c.commandEnv(tmpl)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve env: %w", err)
+	}
+	for key, value := range command.Env {
+		if env[key], err = tmpl.evaluate(value); err != nil {
+			return "", nil, fmt.Errorf("failed to resolve env %s: %w", key, err)
+		}
+	}
+	resolved, err := tmpl.evaluate(command.Run)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to evaluate command: %w", err)
+	}
+	return resolved, env, nil
+}
+
+// RunCommand runs a command in the space with its env, writing the command's
+// output to stdout and stderr. See ResolveCommand.
+func (c *Config) RunCommand(ctx context.Context, space Space, command Command, stdout, stderr io.Writer) error {
+	resolved, env, err := c.ResolveCommand(space, command)
+	if err != nil {
+		return err
+	}
+	return runCommandOutput(ctx, resolved, space.Path, env, stdout, stderr)
+}
+
+// StartCommand starts a command in the space with its env like RunCommand,
+// but in a session of its own that outlives remux, writing its output to
+// output. Returns the command's process ID.
+func (c *Config) StartCommand(space Space, command Command, output *os.File) (int, error) {
+	resolved, env, err := c.ResolveCommand(space, command)
+	if err != nil {
+		return 0, err
+	}
+	log().Debug("starting command", "command", resolved, "dir", space.Path)
+	cmd := exec.Command("sh", "-c", resolved)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Dir = space.Path
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	return pid, cmd.Process.Release()
+}
@@ -1,35 +1,227 @@
 package config
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
-
-	"gopkg.in/yaml.v3"
 )
 
 const configFile = ".remux.yaml"
-const localConfigFile = ".remux.local.yaml"
+
+// LocalConfigFile is the name of the uncommitted config file whose keys
+// override those of .remux.yaml.
+const LocalConfigFile = ".remux.local.yaml"
 
 // Tab represents a tmux window/tab configuration.
 type Tab struct {
-	Name string `yaml:"name"`
-	Cmd  string `yaml:"cmd"`
+	Name string `yaml:"name,omitempty"`
+	Cmd  string `yaml:"cmd,omitempty"`
+
+	// Panes splits the tab into one pane per entry, each running its own
+	// command before Cmd (tmux only). Unless a pane sets a direction or size,
+	// the panes are tiled.
+	Panes []Pane `yaml:"panes,omitempty"`
+	// Synchronize sends input typed into one pane of the tab to all of them (tmux only).
+	Synchronize bool `yaml:"synchronize,omitempty"`
+	// Log appends the output of the tab's first pane to the tab's log (tmux only).
+	Log bool `yaml:"log,omitempty"`
+	// Dir is the directory the tab starts in, relative to the worktree unless
+	// absolute (default: the worktree).
+	Dir string `yaml:"dir,omitempty"`
+	// Env is set in the tab's shells on top of the space's env.
+	Env map[string]string `yaml:"env,omitempty"`
+	// Rename keeps the tab's name in sync with what runs in it (tmux only):
+	// command names it after the foreground process, status also marks it
+	// with the exit status of the last command, and anything else is used as
+	// a tmux format, e.g. "#{pane_current_command}:#{b:pane_current_path}".
+	Rename string `yaml:"rename,omitempty"`
+
+	// LogFile is the file the tab logs to, set by ResolveTabs if Log is set.
+	LogFile string `yaml:"-"`
+}
+
+// WorkDir returns the directory the resolved tab starts in, its Dir or else
+// workdir.
+func (t Tab) WorkDir(workdir string) string {
+	if t.Dir != "" {
+		return t.Dir
+	}
+	return workdir
+}
+
+// Exports returns a shell command exporting the tab's Env, or "" if it has
+// none.
+func (t Tab) Exports() string {
+	if len(t.Env) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("export")
+	for _, key := range slices.Sorted(maps.Keys(t.Env)) {
+		b.WriteString(" " + key + "=" + shellQuote(t.Env[key]))
+	}
+	return b.String()
+}
+
+// Tab renames, see Tab.Rename.
+const (
+	TabRenameCommand = "command"
+	TabRenameStatus  = "status"
+)
+
+// ExitStatusOption is the tmux pane option the shell hook of remux
+// shell-init sets to the exit status of the last command.
+const ExitStatusOption = "@remux_status"
+
+// RenameFormat returns the tmux format the tab's name follows, or "" if it
+// keeps its name.
+func (t Tab) RenameFormat() string {
+	switch t.Rename {
+	case TabRenameCommand:
+		return "#{pane_current_command}"
+	case TabRenameStatus:
+		// Nothing is shown until the first command finished
+		return "#{?#{==:#{" + ExitStatusOption + "},},,#{?#{==:#{" + ExitStatusOption + "},0},✓,✗} }#{pane_current_command}"
+	}
+	return t.Rename
+}
+
+// ShowsExitStatus reports whether the tab's name shows the exit status of
+// the last command, which its shells then have to report.
+func (t Tab) ShowsExitStatus() bool {
+	return strings.Contains(t.RenameFormat(), ExitStatusOption)
+}
+
+// Prelude returns a shell command moving a shell that is already running to
+// the tab's Dir and exporting its Env, or "" if the tab has neither.
+func (t Tab) Prelude() string {
+	var commands []string
+	if t.Dir != "" {
+		commands = append(commands, "cd "+shellQuote(t.Dir))
+	}
+	if exports := t.Exports(); exports != "" {
+		commands = append(commands, exports)
+	}
+	return strings.Join(commands, " && ")
 }
 
 // Config represents a workspace configuration file.
 type Config struct {
-	Env   map[string]string `yaml:"env"`
-	Hooks Hooks             `yaml:"hooks"`
-	Tabs  []Tab             `yaml:"tabs"`
+	// Preset selects a built-in config for a common stack, such as node, which
+	// lies beneath the rest of the config. See Presets.
+	Preset string `yaml:"preset,omitempty"`
+
+	Env   map[string]string `yaml:"env,omitempty"`
+	Hooks Hooks             `yaml:"hooks,omitempty"`
+	Tabs  []Tab             `yaml:"tabs,omitempty"`
+
+	// Backend selects the session backend: tmux (default), wezterm or kitty.
+	Backend string `yaml:"backend,omitempty"`
+
+	// FastReattach skips env resolution and on_open hooks when a session is already running.
+	FastReattach bool `yaml:"fast_reattach,omitempty"`
+
+	// Setup runs installers for tooling detected in new worktrees. See Installers.
+	Setup Setup `yaml:"setup,omitempty"`
+
+	// Scrollback saves pane scrollback when a session is killed and restores it on the next open.
+	Scrollback Scrollback `yaml:"scrollback,omitempty"`
+
+	// Drop configures what happens to a tmux client attached to a dropped space.
+	Drop Drop `yaml:"drop,omitempty"`
+
+	// Forge selects the code hosting service (optional, detected from the origin remote by default).
+	Forge Forge `yaml:"forge,omitempty"`
+
+	// Report customizes the markdown summary printed by `remux report`.
+	Report Report `yaml:"report,omitempty"`
+
+	// Check configures the readiness checklist run by `remux check`.
+	Check Check `yaml:"check,omitempty"`
+
+	// Commands are shell commands run in a space by name with `remux run`,
+	// such as the test command run by `remux test`.
+	Commands map[string]Command `yaml:"commands,omitempty"`
+
+	// Cache warms the build caches of new spaces.
+	Cache Cache `yaml:"cache,omitempty"`
+
+	// Docker names the space's docker network, images and containers.
+	Docker Docker `yaml:"docker,omitempty"`
+
+	// Cert makes a locally trusted HTTPS certificate for each space.
+	Cert Cert `yaml:"cert,omitempty"`
+
+	// Hosts names each space and registers the names in a hosts file.
+	Hosts Hosts `yaml:"hosts,omitempty"`
+
+	// ID picks how space IDs are derived from space names.
+	ID IDs `yaml:"id,omitempty"`
+
+	// Conflicts picks the command that resolves conflicts of `remux stack sync`.
+	Conflicts Conflicts `yaml:"conflicts,omitempty"`
+
+	// Remotes picks the remotes new branches start from and are pushed to.
+	Remotes Remotes `yaml:"remotes,omitempty"`
+
+	// BranchName is the template new branches are named by, such as
+	// {{ user }}/{{ name }}. See NameBranch.
+	BranchName string `yaml:"branch_name,omitempty"`
+
+	// Services lists the compose files and systemd units stopped by `remux hibernate`.
+	Services Services `yaml:"services,omitempty"`
+
+	// Defaults are flag values used when they aren't given on the command
+	// line, overriding the defaults of the user's config.
+	Defaults Defaults `yaml:"defaults,omitempty"`
+
+	// Strict rejects unknown keys, wrong types and invalid template expressions
+	// when loading, instead of ignoring them. See Validate.
+	Strict bool `yaml:"strict,omitempty"`
+}
+
+// Forge configures the code hosting service used for issues, pull requests and CI status.
+type Forge struct {
+	Type string `yaml:"type,omitempty"` // github, gitlab, gitea or bitbucket
+	URL  string `yaml:"url,omitempty"`  // Web URL of a self-hosted instance, e.g. https://git.example.com
+}
+
+// Setup configures the built-in tooling installers run when a space is created.
+type Setup struct {
+	Auto bool     `yaml:"auto,omitempty"` // Detect tooling and run its installer before on_create hooks
+	Skip []string `yaml:"skip,omitempty"` // Names of installers never to run, e.g. npm
+}
+
+// Scrollback configures saving the scrollback of a space's panes when its
+// session is killed, so output like test failures survives the session.
+type Scrollback struct {
+	Save    bool   `yaml:"save,omitempty"`    // Capture pane scrollback to the state dir on kill
+	Lines   int    `yaml:"lines,omitempty"`   // Lines captured per pane (default 2000)
+	Restore string `yaml:"restore,omitempty"` // tail prints the end of it in each tab, pager opens it in an extra tab (default tail)
+}
+
+// Drop configures where a tmux client attached to a space goes when the space
+// is dropped, instead of being left in a dying session.
+type Drop struct {
+	Client string `yaml:"client,omitempty"` // last (previous session), home or detach (default)
+	Home   string `yaml:"home,omitempty"`   // Session used by client: home, created in the home directory if needed
 }
 
 // Hooks contains lifecycle hook commands.
 type Hooks struct {
-	OnCreate []string `yaml:"on_create"`
-	OnOpen   []string `yaml:"on_open"`
-	OnDrop   []string `yaml:"on_drop"`
+	OnCreate []string `yaml:"on_create,omitempty"`
+	OnOpen   []string `yaml:"on_open,omitempty"`
+	OnDrop   []string `yaml:"on_drop,omitempty"`
+
+	// InSession runs the on_create and on_open hooks of tmux spaces in a
+	// window of the space's session once it is started, instead of before,
+	// so they get the session's env and keep running if remux exits.
+	InSession bool `yaml:"in_session,omitempty"`
 }
 
 // Space provides template variables for expression evaluation.
@@ -39,22 +231,53 @@ type Space struct {
 	Port     int
 	ID       string
 	RepoRoot string
+
+	// SessionName is the name of the space's session in its backend, which
+	// may differ from Name; tmux replaces dots and colons.
+	SessionName string
+
+	// Editor session state, see the spaces package
+	NvimSession     string // nvim session file
+	Nvim            string // Command starting nvim with the session resumed and saved on exit
+	VSCodeWorkspace string // VS Code workspace file
+
+	// HTTPS certificate and key files, see Cert
+	CertFile string
+	KeyFile  string
+
+	Host string // Hostname, see Hosts
+
+	// LogDir holds the logs of the space's hooks, services and tabs, see
+	// LogFile. Without it, output only goes to the terminal.
+	LogDir string
+
+	// URL returns the web URL of the space's branch. It is only called when an
+	// expression references space.URL, since it may need to run git.
+	URL func() string
+
+	// Spaces returns the registered spaces, for the spaces template variable.
+	// It is only called when an expression references spaces.
+	Spaces func() []Space
 }
 
-// NewSpace creates a Space from the given values, computing the ID automatically.
+// NewSpace creates a Space from the given values, with the default ID of the
+// name, see Config.SpaceID. SessionName defaults to the name.
 func NewSpace(name, path string, port int, repoRoot string) Space {
 	return Space{
-		Name:     name,
-		Path:     path,
-		Port:     port,
-		ID:       strings.ReplaceAll(name, "-", "_"),
-		RepoRoot: repoRoot,
+		Name:        name,
+		Path:        path,
+		Port:        port,
+		ID:          strings.ReplaceAll(name, "-", "_"),
+		RepoRoot:    repoRoot,
+		SessionName: name,
 	}
 }
 
 // Load reads a config file from the workspace directory.
 // Returns a default empty config if the file doesn't exist.
 // If a .remux.local.yaml file exists, it is merged on top of the base config.
+// If either file sets strict: true, both files are validated first.
+// The preset the files select is expanded beneath them.
 func Load(workspacePath string) (*Config, error) {
 	base, err := loadFile(filepath.Join(workspacePath, configFile))
 	if err != nil {
@@ -64,7 +287,7 @@ func Load(workspacePath string) (*Config, error) {
 		base = &Config{}
 	}
 
-	local, err := loadFile(filepath.Join(workspacePath, localConfigFile))
+	local, err := loadFile(filepath.Join(workspacePath, LocalConfigFile))
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +296,13 @@ func Load(workspacePath string) (*Config, error) {
 		base = merge(base, local)
 	}
 
-	return base, nil
+	if base.Strict {
+		if err := Validate(workspacePath); err != nil {
+			return nil, err
+		}
+	}
+
+	return expandPreset(base)
 }
 
 // loadFile reads and parses a single YAML config file.
@@ -87,17 +316,35 @@ func loadFile(path string) (*Config, error) {
 		return nil, err
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
-	return &cfg, nil
+	return cfg, nil
 }
 
 // merge returns a new Config combining base and override.
 // Env: maps are merged (override keys win, base-only keys preserved).
+// Preset: replaced if override sets it.
 // Tabs: replaced entirely if override defines any.
-// Hooks: replaced per hook type (on_create, on_open, on_drop are independent).
+// FastReattach, Strict, Setup.Auto: enabled if either config enables it.
+// Backend: replaced if override sets it.
+// Forge: replaced per field.
+// Report.Template: replaced if override sets it.
+// Check: replaced per field.
+// Commands: maps are merged (override keys win).
+// Cache: replaced per field.
+// Docker: replaced per field, with Ports merged per service; CreateNetwork enabled if either config enables it.
+// Cert: Domains replaced if override defines any; Create enabled if either config enables it.
+// Hosts: replaced per field; Register enabled if either config enables it.
+// ID: replaced per field; Hash enabled if either config enables it.
+// Conflicts: replaced per field.
+// Remotes: replaced per field; Fetch enabled if either config enables it.
+// BranchName: replaced if override sets it.
+// Services: replaced per field.
+// Defaults: replaced per command flag.
+// Setup.Skip: replaced if override defines any.
+// Hooks: replaced per hook type (on_create, on_open, on_drop are independent); InSession enabled if either config enables it.
 func merge(base, override *Config) *Config {
 	result := *base
 
@@ -113,11 +360,173 @@ func merge(base, override *Config) *Config {
 		result.Env = merged
 	}
 
+	if override.Preset != "" {
+		result.Preset = override.Preset
+	}
+
 	// Replace tabs entirely
 	if len(override.Tabs) > 0 {
 		result.Tabs = override.Tabs
 	}
 
+	if override.Backend != "" {
+		result.Backend = override.Backend
+	}
+
+	if override.FastReattach {
+		result.FastReattach = true
+	}
+	if override.Strict {
+		result.Strict = true
+	}
+
+	if override.Setup.Auto {
+		result.Setup.Auto = true
+	}
+	if len(override.Setup.Skip) > 0 {
+		result.Setup.Skip = override.Setup.Skip
+	}
+
+	if override.Scrollback.Save {
+		result.Scrollback.Save = true
+	}
+	if override.Scrollback.Lines != 0 {
+		result.Scrollback.Lines = override.Scrollback.Lines
+	}
+	if override.Scrollback.Restore != "" {
+		result.Scrollback.Restore = override.Scrollback.Restore
+	}
+
+	if override.Drop.Client != "" {
+		result.Drop.Client = override.Drop.Client
+	}
+	if override.Drop.Home != "" {
+		result.Drop.Home = override.Drop.Home
+	}
+
+	if override.Forge.Type != "" {
+		result.Forge.Type = override.Forge.Type
+	}
+	if override.Forge.URL != "" {
+		result.Forge.URL = override.Forge.URL
+	}
+
+	if override.Report.Template != "" {
+		result.Report.Template = override.Report.Template
+	}
+
+	if override.Check.Test != "" {
+		result.Check.Test = override.Check.Test
+	}
+	if override.Check.Lint != "" {
+		result.Check.Lint = override.Check.Lint
+	}
+	if len(override.Check.Markers) > 0 {
+		result.Check.Markers = override.Check.Markers
+	}
+	if len(override.Check.Skip) > 0 {
+		result.Check.Skip = override.Check.Skip
+	}
+
+	if len(override.Commands) > 0 {
+		merged := make(map[string]Command, len(base.Commands)+len(override.Commands))
+		maps.Copy(merged, base.Commands)
+		maps.Copy(merged, override.Commands)
+		result.Commands = merged
+	}
+
+	if len(override.Cache.Copy) > 0 {
+		result.Cache.Copy = override.Cache.Copy
+	}
+	if len(override.Cache.Link) > 0 {
+		result.Cache.Link = override.Cache.Link
+	}
+	if len(override.Cache.Shared) > 0 {
+		result.Cache.Shared = override.Cache.Shared
+	}
+	if override.Cache.Dir != "" {
+		result.Cache.Dir = override.Cache.Dir
+	}
+
+	if override.Docker.Network != "" {
+		result.Docker.Network = override.Docker.Network
+	}
+	if override.Docker.ImageTag != "" {
+		result.Docker.ImageTag = override.Docker.ImageTag
+	}
+	if override.Docker.ContainerPrefix != "" {
+		result.Docker.ContainerPrefix = override.Docker.ContainerPrefix
+	}
+	if override.Docker.CreateNetwork {
+		result.Docker.CreateNetwork = true
+	}
+	if len(override.Docker.Ports) > 0 {
+		merged := make(map[string][]string, len(base.Docker.Ports)+len(override.Docker.Ports))
+		for k, v := range base.Docker.Ports {
+			merged[k] = v
+		}
+		for k, v := range override.Docker.Ports {
+			merged[k] = v
+		}
+		result.Docker.Ports = merged
+	}
+	if override.Docker.ComposeOverride != "" {
+		result.Docker.ComposeOverride = override.Docker.ComposeOverride
+	}
+
+	if override.Cert.Create {
+		result.Cert.Create = true
+	}
+	if len(override.Cert.Domains) > 0 {
+		result.Cert.Domains = override.Cert.Domains
+	}
+	if override.Hosts.Name != "" {
+		result.Hosts.Name = override.Hosts.Name
+	}
+	if override.Hosts.Register {
+		result.Hosts.Register = true
+	}
+	if override.Hosts.File != "" {
+		result.Hosts.File = override.Hosts.File
+	}
+	if override.ID.Charset != "" {
+		result.ID.Charset = override.ID.Charset
+	}
+	if override.ID.MaxLength != 0 {
+		result.ID.MaxLength = override.ID.MaxLength
+	}
+	if override.ID.Hash {
+		result.ID.Hash = true
+	}
+	if override.Conflicts.Command != "" {
+		result.Conflicts.Command = override.Conflicts.Command
+	}
+
+	if override.Remotes.Base != "" {
+		result.Remotes.Base = override.Remotes.Base
+	}
+	if override.Remotes.Push != "" {
+		result.Remotes.Push = override.Remotes.Push
+	}
+	if override.Remotes.Fetch {
+		result.Remotes.Fetch = true
+	}
+	if override.BranchName != "" {
+		result.BranchName = override.BranchName
+	}
+
+	if len(override.Services.Compose) > 0 {
+		result.Services.Compose = override.Services.Compose
+	}
+	if override.Services.ComposeCommand != "" {
+		result.Services.ComposeCommand = override.Services.ComposeCommand
+	}
+	if len(override.Services.Systemd) > 0 {
+		result.Services.Systemd = override.Services.Systemd
+	}
+
+	result.Defaults = override.Defaults.Over(base.Defaults)
+
 	// Replace hooks per type
 	if len(override.Hooks.OnCreate) > 0 {
 		result.Hooks.OnCreate = override.Hooks.OnCreate
@@ -128,19 +537,24 @@ func merge(base, override *Config) *Config {
 	if len(override.Hooks.OnDrop) > 0 {
 		result.Hooks.OnDrop = override.Hooks.OnDrop
 	}
+	result.Hooks.InSession = base.Hooks.InSession || override.Hooks.InSession
 
 	return &result
 }
 
 // ResolveEnv evaluates template expressions in env vars and returns resolved values.
 func (c *Config) ResolveEnv(space Space) (map[string]string, error) {
+	return c.resolveEnv(newTemplateEnv(space))
+}
+
+func (c *Config) resolveEnv(tmpl *templateEnv) (map[string]string, error) {
 	if len(c.Env) == 0 {
 		return nil, nil
 	}
 
 	result := make(map[string]string, len(c.Env))
 	for key, value := range c.Env {
-		resolved, err := EvaluateTemplate(value, space)
+		resolved, err := tmpl.evaluate(value)
 		if err != nil {
 			return nil, err
 		}
@@ -149,68 +563,112 @@ func (c *Config) ResolveEnv(space Space) (map[string]string, error) {
 	return result, nil
 }
 
-// RunOnCreate executes on_create hooks. Prints warnings on failure, does not return error.
-func (c *Config) RunOnCreate(space Space) {
+// RunOnCreate executes on_create hooks. Logs warnings on failure, does not return error.
+func (c *Config) RunOnCreate(ctx context.Context, space Space) {
 	if len(c.Hooks.OnCreate) == 0 {
 		return
 	}
-	env, err := c.ResolveEnv(space)
+	tmpl := newTemplateEnv(space)
+	env, err := c.commandEnv(tmpl)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "warning: on_create hook failed to resolve env: %v\n", err)
+		log().Warn("on_create hook failed to resolve env", "err", err)
 		return
 	}
-	if err := runHooks(c.Hooks.OnCreate, space, space.Path, env); err != nil {
-		fmt.Fprintf(os.Stderr, "warning: on_create hook failed: %v\n", err)
+	if err := runHooks(ctx, "on_create", c.Hooks.OnCreate, tmpl, space, env); err != nil {
+		log().Warn("on_create hook failed", "err", err)
 	}
 }
 
 // RunOnOpen executes on_open hooks. Returns error on failure.
-func (c *Config) RunOnOpen(space Space) error {
+func (c *Config) RunOnOpen(ctx context.Context, space Space) error {
 	if len(c.Hooks.OnOpen) == 0 {
 		return nil
 	}
-	env, err := c.ResolveEnv(space)
+	tmpl := newTemplateEnv(space)
+	env, err := c.commandEnv(tmpl)
 	if err != nil {
 		return fmt.Errorf("on_open hook failed to resolve env: %w", err)
 	}
-	if err := runHooks(c.Hooks.OnOpen, space, space.Path, env); err != nil {
+	if err := runHooks(ctx, "on_open", c.Hooks.OnOpen, tmpl, space, env); err != nil {
 		return fmt.Errorf("on_open hook failed: %w", err)
 	}
 	return nil
 }
 
 // RunOnDrop executes on_drop hooks. Returns error on failure.
-func (c *Config) RunOnDrop(space Space) error {
+func (c *Config) RunOnDrop(ctx context.Context, space Space) error {
 	if len(c.Hooks.OnDrop) == 0 {
 		return nil
 	}
-	env, err := c.ResolveEnv(space)
+	tmpl := newTemplateEnv(space)
+	env, err := c.commandEnv(tmpl)
 	if err != nil {
 		return fmt.Errorf("on_drop hook failed to resolve env: %w", err)
 	}
-	if err := runHooks(c.Hooks.OnDrop, space, space.Path, env); err != nil {
+	if err := runHooks(ctx, "on_drop", c.Hooks.OnDrop, tmpl, space, env); err != nil {
 		return fmt.Errorf("on_drop hook failed: %w", err)
 	}
 	return nil
 }
 
-// ResolveTabs evaluates template expressions in tab names and commands.
+// ResolveTabs evaluates template expressions in tab names, commands, dirs and
+// env, and makes relative dirs absolute.
 func (c *Config) ResolveTabs(space Space) ([]Tab, error) {
 	if len(c.Tabs) == 0 {
 		return nil, nil
 	}
 
+	tmpl := newTemplateEnv(space)
 	result := make([]Tab, len(c.Tabs))
 	for i, tab := range c.Tabs {
-		name, err := EvaluateTemplate(tab.Name, space)
+		name, err := tmpl.evaluate(tab.Name)
 		if err != nil {
 			return nil, fmt.Errorf("tab %d name: %w", i, err)
 		}
-		cmd, err := EvaluateTemplate(tab.Cmd, space)
+		cmd, err := tmpl.evaluate(tab.Cmd)
 		if err != nil {
 			return nil, fmt.Errorf("tab %d cmd: %w", i, err)
 		}
-		result[i] = Tab{Name: name, Cmd: cmd}
+		var panes []Pane
+		for j, pane := range tab.Panes {
+			if pane.Cmd, err = tmpl.evaluate(pane.Cmd); err != nil {
+				return nil, fmt.Errorf("tab %d pane %d: %w", i, j, err)
+			}
+			panes = append(panes, pane)
+		}
+		dir, err := tmpl.evaluate(tab.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("tab %d dir: %w", i, err)
+		}
+		if dir != "" {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(space.Path, dir)
+			}
+			dir = filepath.Clean(dir)
+		}
+		rename, err := tmpl.evaluate(tab.Rename)
+		if err != nil {
+			return nil, fmt.Errorf("tab %d rename: %w", i, err)
+		}
+		var env map[string]string
+		for key, value := range tab.Env {
+			resolved, err := tmpl.evaluate(value)
+			if err != nil {
+				return nil, fmt.Errorf("tab %d env %s: %w", i, key, err)
+			}
+			if env == nil {
+				env = make(map[string]string, len(tab.Env))
+			}
+			env[key] = resolved
+		}
+		result[i] = Tab{Name: name, Cmd: cmd, Panes: panes, Synchronize: tab.Synchronize, Log: tab.Log, Dir: dir, Env: env, Rename: rename}
+		if tab.Log && space.LogDir != "" {
+			source := name
+			if source == "" {
+				source = strconv.Itoa(i + 1)
+			}
+			result[i].LogFile = LogFile(space.LogDir, LogSourceTab+source)
+		}
 	}
 	return result, nil
 }
@@ -1,9 +1,17 @@
 package config_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -92,6 +100,110 @@ tabs:
 		})
 	})
 
+	Describe("Validate", func() {
+		write := func(name, content string) {
+			err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		It("accepts a valid config", func() {
+			write(".remux.yaml", "env:\n  URL: \"http://localhost:{{ space.Port }}\"\ntabs:\n  - name: shell\n")
+			Expect(config.Validate(tmpDir)).To(Succeed())
+		})
+
+		It("accepts path functions", func() {
+			write(".remux.yaml", "env:\n  DEV: \"{{ join(space.RepoRoot, 'scripts') }}\"\n  UP: \"{{ rel(space.Path, space.RepoRoot) }}\"\n")
+			Expect(config.Validate(tmpDir)).To(Succeed())
+		})
+
+		It("accepts a missing config", func() {
+			Expect(config.Validate(tmpDir)).To(Succeed())
+		})
+
+		It("reports unknown keys with file and line", func() {
+			write(".remux.yaml", "env:\n  FOO: bar\ntabz:\n  - cmd: x\n")
+
+			err := config.Validate(tmpDir)
+			Expect(err).To(HaveOccurred())
+
+			var verr *config.ValidationError
+			Expect(errors.As(err, &verr)).To(BeTrue())
+			Expect(verr.File).To(Equal(filepath.Join(tmpDir, ".remux.yaml")))
+			Expect(verr.Line).To(Equal(3))
+			Expect(verr.Message).To(ContainSubstring("tabz"))
+		})
+
+		It("reports values of the wrong type", func() {
+			write(".remux.yaml", "fast_reattach: maybe\n")
+			Expect(config.Validate(tmpDir)).To(MatchError(ContainSubstring(".remux.yaml:1:")))
+		})
+
+		It("reports invalid expressions", func() {
+			write(".remux.yaml", "hooks:\n  on_open:\n    - echo {{ unknown_var }}\n")
+			Expect(config.Validate(tmpDir)).To(MatchError(ContainSubstring(".remux.yaml:3: invalid expression \"unknown_var\"")))
+		})
+
+		It("checks tab panes", func() {
+			write(".remux.yaml", "tabs:\n  - name: dev\n    panes:\n      - vim\n      - {cmd: make logs, direction: right, size: 30%}\n")
+			Expect(config.Validate(tmpDir)).To(Succeed())
+
+			write(".remux.yaml", "tabs:\n  - name: dev\n    panes:\n      - vim\n      - cmd: make logs\n        direction: sideways\n        width: 30\n")
+			err := config.Validate(tmpDir)
+			Expect(err).To(MatchError(ContainSubstring(".remux.yaml:5: unknown pane direction \"sideways\"")))
+			Expect(err).To(MatchError(ContainSubstring(".remux.yaml:7: unknown pane key \"width\"")))
+		})
+
+		It("checks commands", func() {
+			write(".remux.yaml", "commands:\n  lint: make lint\n  seed-db:\n    run: ./seed {{ space.Port }}\n    background: true\n")
+			Expect(config.Validate(tmpDir)).To(Succeed())
+
+			write(".remux.yaml", "commands:\n  lint:\n    cmd: make lint\n  logs:\n    run: make logs\n    tab: true\n    background: true\n")
+			err := config.Validate(tmpDir)
+			Expect(err).To(MatchError(ContainSubstring(".remux.yaml:2: lint: command has nothing to run")))
+			Expect(err).To(MatchError(ContainSubstring(".remux.yaml:3: unknown key \"cmd\" in command lint")))
+			Expect(err).To(MatchError(ContainSubstring(".remux.yaml:4: logs: command can only run in one of a tab, the background or the session")))
+		})
+
+		It("checks branch_name", func() {
+			write(".remux.yaml", "branch_name: \"{{ user }}/{{ name }}\"\n")
+			Expect(config.Validate(tmpDir)).To(Succeed())
+		})
+
+		It("checks the local config too", func() {
+			write(".remux.local.yaml", "bogus: true\n")
+			Expect(config.Validate(tmpDir)).To(MatchError(ContainSubstring(".remux.local.yaml:1:")))
+		})
+	})
+
+	Describe("Strict load", func() {
+		It("ignores unknown keys by default", func() {
+			err := os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte("bogus: true\n"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = config.Load(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects unknown keys when strict is set", func() {
+			err := os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte("strict: true\nbogus: true\n"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			cfg, err := config.Load(tmpDir)
+			Expect(err).To(MatchError(ContainSubstring("bogus")))
+			Expect(cfg).To(BeNil())
+		})
+
+		It("validates the base config when strict is set locally", func() {
+			err := os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte("bogus: true\n"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+			err = os.WriteFile(filepath.Join(tmpDir, ".remux.local.yaml"), []byte("strict: true\n"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = config.Load(tmpDir)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	Describe("Local config merge", func() {
 		It("merges env vars with local overriding base", func() {
 			base := "env:\n  FOO: base\n  BAR: base_only\n"
@@ -106,6 +218,81 @@ tabs:
 			Expect(cfg.Env).To(HaveKeyWithValue("BAZ", "local_only"))
 		})
 
+		It("merges flag defaults per command flag", func() {
+			base := "defaults:\n  new:\n    template: review\n    no-setup: true\n  open:\n    profile: Work\n"
+			local := "defaults:\n  new:\n    template: solo\n"
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte(base), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.local.yaml"), []byte(local), 0644)).To(Succeed())
+
+			cfg, err := config.Load(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Defaults).To(Equal(config.Defaults{
+				"new":  {"template": "solo", "no-setup": "true"},
+				"open": {"profile": "Work"},
+			}))
+
+			global := config.Defaults{"new": {"dest": "/srv/remux", "template": "global"}}
+			Expect(cfg.Defaults.Over(global)["new"]).To(Equal(map[string]string{"dest": "/srv/remux", "template": "solo", "no-setup": "true"}))
+		})
+
+		It("edits flag defaults in the local config, keeping the rest", func() {
+			local := "# my overrides\nenv:\n  FOO: bar # keep\n"
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.local.yaml"), []byte(local), 0644)).To(Succeed())
+
+			Expect(config.SetLocalDefault(tmpDir, "stack new", "no-setup", "true")).To(Succeed())
+			Expect(config.SetLocalDefault(tmpDir, "stack new", "no-setup", "false")).To(Succeed())
+			cfg, err := config.Load(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Defaults).To(Equal(config.Defaults{"stack new": {"no-setup": "false"}}))
+			data, err := os.ReadFile(filepath.Join(tmpDir, ".remux.local.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(HavePrefix("# my overrides\nenv:\n  FOO: bar # keep\n"))
+
+			Expect(config.UnsetLocalDefault(tmpDir, "stack new", "no-setup")).To(BeTrue())
+			Expect(config.UnsetLocalDefault(tmpDir, "stack new", "no-setup")).To(BeFalse())
+			data, err = os.ReadFile(filepath.Join(tmpDir, ".remux.local.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal(local))
+		})
+
+		It("merges commands per name", func() {
+			base := "check:\n  test: make check\ncommands:\n  lint: make lint\n"
+			local := "commands:\n  test:\n    run: go test ./pkg/...\n    env:\n      CI: \"1\"\n"
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte(base), 0644)).To(Succeed())
+
+			cfg, err := config.Load(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			command, ok := cfg.Command(config.TestCommand)
+			Expect(ok).To(BeTrue())
+			Expect(command).To(Equal(config.Command{Run: "make check"}))
+			Expect(cfg.CommandNames()).To(Equal([]string{"lint", "test"}))
+
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.local.yaml"), []byte(local), 0644)).To(Succeed())
+			cfg, err = config.Load(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			command, _ = cfg.Command(config.TestCommand)
+			Expect(command).To(Equal(config.Command{Run: "go test ./pkg/...", Env: map[string]string{"CI": "1"}}))
+			command, _ = cfg.Command("lint")
+			Expect(command).To(Equal(config.Command{Run: "make lint"}))
+			_, ok = cfg.Command("deploy")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("runs commands with their env", func() {
+			cfg := &config.Config{
+				Env: map[string]string{"A": "space", "B": "space"},
+				Commands: map[string]config.Command{
+					"show": {Run: "echo {{ space.Name }} $A $B", Env: map[string]string{"B": "port-{{ space.Port }}"}},
+				},
+			}
+			command, ok := cfg.Command("show")
+			Expect(ok).To(BeTrue())
+			var out bytes.Buffer
+			space := config.Space{Name: "app", Path: tmpDir, Port: 3000}
+			Expect(cfg.RunCommand(context.Background(), space, command, &out, &out)).To(Succeed())
+			Expect(out.String()).To(Equal("app space port-3000\n"))
+		})
+
 		It("replaces tabs when local defines them", func() {
 			base := "tabs:\n  - cmd: base-cmd\n"
 			local := "tabs:\n  - cmd: local-cmd\n  - cmd: local-cmd-2\n"
@@ -132,6 +319,39 @@ tabs:
 			Expect(cfg.Hooks.OnDrop).To(Equal([]string{"base-drop"}))
 		})
 
+		It("enables fast_reattach from local config", func() {
+			base := "env:\n  FOO: bar\n"
+			local := "fast_reattach: true\n"
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte(base), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.local.yaml"), []byte(local), 0644)).To(Succeed())
+
+			cfg, err := config.Load(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.FastReattach).To(BeTrue())
+		})
+
+		It("replaces forge fields set in local config", func() {
+			base := "forge:\n  type: gitea\n  url: https://git.example.com\n"
+			local := "forge:\n  url: https://git.internal\n"
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte(base), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.local.yaml"), []byte(local), 0644)).To(Succeed())
+
+			cfg, err := config.Load(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Forge).To(Equal(config.Forge{Type: "gitea", URL: "https://git.internal"}))
+		})
+
+		It("replaces drop fields set in local config", func() {
+			base := "drop:\n  client: home\n  home: main\n"
+			local := "drop:\n  home: scratch\n"
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte(base), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.local.yaml"), []byte(local), 0644)).To(Succeed())
+
+			cfg, err := config.Load(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Drop).To(Equal(config.Drop{Client: "home", Home: "scratch"}))
+		})
+
 		It("has no effect when local config is missing", func() {
 			base := "env:\n  FOO: bar\ntabs:\n  - cmd: test\n"
 			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte(base), 0644)).To(Succeed())
@@ -171,7 +391,7 @@ tabs:
 			}
 
 			space := config.NewSpace("test-space", tmpDir, 12345, tmpDir)
-			err := cfg.RunOnOpen(space)
+			err := cfg.RunOnOpen(context.Background(), space)
 			Expect(err).NotTo(HaveOccurred())
 
 			content, err := os.ReadFile(outputFile)
@@ -188,7 +408,7 @@ tabs:
 			}
 
 			space := config.NewSpace("test-space", tmpDir, 11000, tmpDir)
-			err := cfg.RunOnOpen(space)
+			err := cfg.RunOnOpen(context.Background(), space)
 			Expect(err).NotTo(HaveOccurred())
 
 			content, err := os.ReadFile(outputFile)
@@ -205,7 +425,7 @@ tabs:
 			}
 
 			space := config.NewSpace("test-space", tmpDir, 11000, tmpDir)
-			err := cfg.RunOnOpen(space)
+			err := cfg.RunOnOpen(context.Background(), space)
 			Expect(err).NotTo(HaveOccurred())
 
 			content, err := os.ReadFile(outputFile)
@@ -213,6 +433,52 @@ tabs:
 			Expect(strings.TrimSpace(string(content))).To(Equal("success"))
 		})
 
+		It("explains hooks without running them", func() {
+			outputFile := filepath.Join(tmpDir, "explained.txt")
+			cfg := &config.Config{
+				Env: map[string]string{"APP_PORT": "{{ space.Port }}"},
+				Hooks: config.Hooks{
+					OnCreate: []string{"echo {{ space.Name }} > " + outputFile},
+					OnDrop:   []string{"echo {{ space.Missing( }}", "true"},
+				},
+			}
+
+			space := config.NewSpace("test-space", tmpDir, 12345, tmpDir)
+			explanation, err := cfg.ExplainHooks(space, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(explanation.Dir).To(Equal(tmpDir))
+			Expect(explanation.Env).To(HaveKeyWithValue("APP_PORT", "12345"))
+			Expect(explanation.Hooks).To(HaveLen(3))
+			Expect(explanation.Hooks[0].Event).To(Equal("on_create"))
+			Expect(explanation.Hooks[0].Command).To(Equal("echo test-space > " + outputFile))
+			Expect(explanation.Hooks[1].Err).To(HaveOccurred())
+			Expect(explanation.Hooks[2].Command).To(Equal("true"))
+			Expect(outputFile).NotTo(BeAnExistingFile())
+
+			explanation, err = cfg.ExplainHooks(space, "on_drop")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(explanation.Hooks).To(HaveLen(2))
+
+			_, err = cfg.ExplainHooks(space, "on_close")
+			Expect(err).To(MatchError(ContainSubstring("unknown hook event")))
+		})
+
+		It("stops a running hook when the context is cancelled", func() {
+			cfg := &config.Config{
+				Hooks: config.Hooks{
+					OnOpen: []string{"sleep 10"},
+				},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err := cfg.RunOnOpen(ctx, config.NewSpace("test-space", tmpDir, 11000, tmpDir))
+			Expect(err).To(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		})
+
 		It("inherits parent environment", func() {
 			outputFile := filepath.Join(tmpDir, "parent_env_output.txt")
 			os.Setenv("REMUX_TEST_PARENT_VAR", "inherited_value")
@@ -225,7 +491,7 @@ tabs:
 			}
 
 			space := config.NewSpace("test-space", tmpDir, 11000, tmpDir)
-			err := cfg.RunOnOpen(space)
+			err := cfg.RunOnOpen(context.Background(), space)
 			Expect(err).NotTo(HaveOccurred())
 
 			content, err := os.ReadFile(outputFile)
@@ -234,6 +500,473 @@ tabs:
 		})
 	})
 
+	Describe("Setup", func() {
+		touch := func(names ...string) {
+			for _, name := range names {
+				Expect(os.WriteFile(filepath.Join(tmpDir, name), nil, 0644)).To(Succeed())
+			}
+		}
+
+		installerNames := func(installers []config.Installer) []string {
+			var names []string
+			for _, inst := range installers {
+				names = append(names, inst.Name)
+			}
+			return names
+		}
+
+		It("detects nothing unless enabled", func() {
+			touch("go.mod")
+			cfg := &config.Config{}
+			Expect(cfg.DetectSetup(tmpDir)).To(BeEmpty())
+		})
+
+		It("detects tooling in installer order", func() {
+			touch(".pre-commit-config.yaml", "package-lock.json", "go.mod")
+			cfg := &config.Config{Setup: config.Setup{Auto: true}}
+			Expect(installerNames(cfg.DetectSetup(tmpDir))).To(Equal([]string{"go", "npm", "pre-commit"}))
+		})
+
+		It("leaves out skipped installers", func() {
+			touch("package-lock.json", "lefthook.yml")
+			cfg := &config.Config{Setup: config.Setup{Auto: true, Skip: []string{"npm"}}}
+			Expect(installerNames(cfg.DetectSetup(tmpDir))).To(Equal([]string{"lefthook"}))
+		})
+
+		It("runs detected installers with the space env", func() {
+			bin := GinkgoT().TempDir()
+			script := "#!/bin/sh\necho \"$@ $APP_PORT\" > \"$PWD/ran\"\n"
+			Expect(os.WriteFile(filepath.Join(bin, "lefthook"), []byte(script), 0755)).To(Succeed())
+			GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+			touch("lefthook.yml")
+
+			cfg := &config.Config{
+				Env:   map[string]string{"APP_PORT": "{{ space.Port }}"},
+				Setup: config.Setup{Auto: true},
+			}
+			cfg.RunSetup(context.Background(), config.NewSpace("test-space", tmpDir, 11010, tmpDir))
+
+			out, err := os.ReadFile(filepath.Join(tmpDir, "ran"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("install 11010\n"))
+		})
+
+		It("logs failed installers to the package logger", func() {
+			bin := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(bin, "lefthook"), []byte("#!/bin/sh\nexit 1\n"), 0755)).To(Succeed())
+			GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+			touch("lefthook.yml")
+
+			var logs bytes.Buffer
+			config.SetLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+			DeferCleanup(config.SetLogger, (*slog.Logger)(nil))
+
+			cfg := &config.Config{Setup: config.Setup{Auto: true}}
+			cfg.RunSetup(context.Background(), config.NewSpace("test-space", tmpDir, 11010, tmpDir))
+
+			Expect(logs.String()).To(ContainSubstring(`level=WARN msg="setup failed" installer=lefthook`))
+		})
+	})
+
+	Describe("Services", func() {
+		var calls string
+
+		// fakeTools installs docker and systemctl scripts on PATH that log
+		// their arguments and the space env to calls.
+		fakeTools := func() {
+			bin := GinkgoT().TempDir()
+			calls = filepath.Join(tmpDir, "calls")
+			for _, name := range []string{"docker", "systemctl"} {
+				script := "#!/bin/sh\necho \"" + name + " $* $APP_PORT\" >> \"" + calls + "\"\n"
+				Expect(os.WriteFile(filepath.Join(bin, name), []byte(script), 0755)).To(Succeed())
+			}
+			GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+		}
+
+		readCalls := func() string {
+			out, err := os.ReadFile(calls)
+			Expect(err).NotTo(HaveOccurred())
+			return string(out)
+		}
+
+		It("starts compose services before systemd units and stops them after", func() {
+			fakeTools()
+			cfg := &config.Config{
+				Env: map[string]string{"APP_PORT": "{{ space.Port }}"},
+				Services: config.Services{
+					Compose: []string{"compose.yaml", "compose.dev.yaml"},
+					Systemd: []string{"worker@{{ space.Name }}.service"},
+				},
+			}
+			space := config.NewSpace("test-space", tmpDir, 11010, tmpDir)
+
+			Expect(cfg.StartServices(context.Background(), space)).To(Succeed())
+			Expect(cfg.StopServices(context.Background(), space)).To(Succeed())
+			Expect(readCalls()).To(Equal("" +
+				"docker compose -f compose.yaml -f compose.dev.yaml up -d 11010\n" +
+				"systemctl --user start worker@test-space.service 11010\n" +
+				"systemctl --user stop worker@test-space.service 11010\n" +
+				"docker compose -f compose.yaml -f compose.dev.yaml down 11010\n"))
+		})
+
+		It("passes the compose override file after the compose files", func() {
+			fakeTools()
+			cfg := &config.Config{
+				Env:      map[string]string{"APP_PORT": "{{ space.Port }}"},
+				Services: config.Services{Compose: []string{"compose.yaml"}},
+				Docker:   config.Docker{Ports: map[string][]string{"web": {"{{ space.Port }}:3000"}}, ComposeOverride: "ports.yaml"},
+			}
+			Expect(cfg.StartServices(context.Background(), config.NewSpace("test-space", tmpDir, 11010, tmpDir))).To(Succeed())
+			Expect(readCalls()).To(Equal("docker compose -f compose.yaml -f ports.yaml up -d 11010\n"))
+		})
+
+		It("does nothing without services", func() {
+			cfg := &config.Config{}
+			Expect(cfg.StopServices(context.Background(), config.NewSpace("test-space", tmpDir, 11010, tmpDir))).To(Succeed())
+		})
+
+		It("reports the failing command", func() {
+			cfg := &config.Config{Services: config.Services{Compose: []string{"compose.yaml"}, ComposeCommand: "false"}}
+			err := cfg.StopServices(context.Background(), config.NewSpace("test-space", tmpDir, 11010, tmpDir))
+			Expect(err).To(MatchError(ContainSubstring("false -f 'compose.yaml' down")))
+		})
+	})
+
+	Describe("Cache", func() {
+		It("points shared tool caches at the cache dir", func() {
+			cfg := &config.Config{Cache: config.Cache{Shared: []string{"go", "pnpm"}, Dir: "/var/cache/remux"}}
+			env, err := cfg.CacheEnv()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal(map[string]string{
+				"GOCACHE":              "/var/cache/remux/go/build",
+				"GOMODCACHE":           "/var/cache/remux/go/mod",
+				"npm_config_store_dir": "/var/cache/remux/pnpm-store",
+			}))
+
+			cfg.Cache.Shared = []string{"maven"}
+			_, err = cfg.CacheEnv()
+			Expect(err).To(MatchError(ContainSubstring(`unknown shared cache "maven"`)))
+		})
+
+		It("copies and links caches from the repository", func() {
+			repo := GinkgoT().TempDir()
+			Expect(os.MkdirAll(filepath.Join(repo, "node_modules", "left-pad"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(repo, "node_modules", "left-pad", "index.js"), []byte("pad"), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(repo, "build", "gradle"), 0755)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(tmpDir, "target"), 0755)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(repo, "target"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(repo, "target", "stale"), nil, 0644)).To(Succeed())
+
+			cfg := &config.Config{Cache: config.Cache{
+				Copy: []string{"node_modules", "target", "missing"},
+				Link: []string{"build/gradle"},
+			}}
+			warmed := cfg.WarmCache(context.Background(), config.NewSpace("test-space", tmpDir, 11010, repo), repo)
+			Expect(warmed).To(Equal([]string{"node_modules", "build/gradle"}))
+
+			Expect(os.ReadFile(filepath.Join(tmpDir, "node_modules", "left-pad", "index.js"))).To(Equal([]byte("pad")))
+			Expect(filepath.Join(tmpDir, "target", "stale")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(tmpDir, "missing")).NotTo(BeAnExistingFile())
+			link, err := os.Readlink(filepath.Join(tmpDir, "build", "gradle"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link).To(Equal(filepath.Join(repo, "build", "gradle")))
+		})
+	})
+
+	Describe("Docker", func() {
+		It("derives the docker names from the space ID", func() {
+			cfg := &config.Config{}
+			env, err := cfg.DockerEnv(config.NewSpace("app-feature", tmpDir, 11010, tmpDir))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal(map[string]string{
+				"DOCKER_NETWORK":   "app_feature",
+				"IMAGE_TAG":        "app_feature",
+				"CONTAINER_PREFIX": "app_feature_",
+			}))
+		})
+
+		It("evaluates configured templates", func() {
+			cfg := &config.Config{Docker: config.Docker{Network: "net-{{ space.Port }}"}}
+			env, err := cfg.DockerEnv(config.NewSpace("app-feature", tmpDir, 11010, tmpDir))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(HaveKeyWithValue("DOCKER_NETWORK", "net-11010"))
+			Expect(env).To(HaveKeyWithValue("IMAGE_TAG", "app_feature"))
+		})
+
+		It("exports the names to hooks, under the config env", func() {
+			cfg := &config.Config{
+				Env:   map[string]string{"IMAGE_TAG": "latest"},
+				Hooks: config.Hooks{OnOpen: []string{`echo "$DOCKER_NETWORK $IMAGE_TAG" > names`}},
+			}
+			Expect(cfg.RunOnOpen(context.Background(), config.NewSpace("app-feature", tmpDir, 11010, tmpDir))).To(Succeed())
+			out, err := os.ReadFile(filepath.Join(tmpDir, "names"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("app_feature latest\n"))
+		})
+
+		It("creates and removes the network when enabled", func() {
+			bin := GinkgoT().TempDir()
+			calls := filepath.Join(tmpDir, "calls")
+			networks := filepath.Join(tmpDir, "networks")
+			// A docker that keeps its networks in a file
+			script := "#!/bin/sh\n" +
+				"echo \"$*\" >> " + calls + "\n" +
+				"case \"$2\" in\n" +
+				"inspect) grep -qx \"$3\" " + networks + " 2>/dev/null ;;\n" +
+				"create) echo \"$3\" >> " + networks + " ;;\n" +
+				"rm) : > " + networks + " ;;\n" +
+				"esac\n"
+			Expect(os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0755)).To(Succeed())
+			GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+			space := config.NewSpace("app-feature", tmpDir, 11010, tmpDir)
+			Expect((&config.Config{}).CreateDockerNetwork(context.Background(), space)).To(Succeed())
+			Expect(calls).NotTo(BeAnExistingFile())
+
+			cfg := &config.Config{Docker: config.Docker{CreateNetwork: true}}
+			Expect(cfg.CreateDockerNetwork(context.Background(), space)).To(Succeed())
+			Expect(cfg.CreateDockerNetwork(context.Background(), space)).To(Succeed())
+			Expect(cfg.RemoveDockerNetwork(context.Background(), space)).To(Succeed())
+			out, err := os.ReadFile(calls)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("" +
+				"network inspect app_feature\n" +
+				"network create app_feature\n" +
+				"network inspect app_feature\n" +
+				"network inspect app_feature\n" +
+				"network rm app_feature\n"))
+		})
+
+		It("writes service ports to the compose override file", func() {
+			space := config.NewSpace("app-feature", tmpDir, 11010, tmpDir)
+			path, err := (&config.Config{}).WriteComposeOverride(space)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(path).To(BeEmpty())
+
+			cfg := &config.Config{Docker: config.Docker{Ports: map[string][]string{
+				"web": {"{{ space.Port }}:3000"},
+				"db":  {"{{ space.Port + 1 }}:5432"},
+			}}}
+			path, err = cfg.WriteComposeOverride(space)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(path).To(Equal(filepath.Join(tmpDir, "compose.override.yaml")))
+			out, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("" +
+				"# Generated by remux from docker.ports in .remux.yaml and rewritten on open, don't edit.\n" +
+				"services:\n" +
+				"  db:\n" +
+				"    ports: !override\n" +
+				"      - \"11011:5432\"\n" +
+				"  web:\n" +
+				"    ports: !override\n" +
+				"      - \"11010:3000\"\n"))
+
+			cfg.Docker.Ports["web"] = []string{"{{ bogus }}"}
+			_, err = cfg.WriteComposeOverride(space)
+			Expect(err).To(MatchError(ContainSubstring("ports of web")))
+		})
+	})
+
+	Describe("Cert", func() {
+		certSpace := func() config.Space {
+			space := config.NewSpace("app-feature", tmpDir, 11010, tmpDir)
+			space.CertFile = filepath.Join(tmpDir, "state", "cert.pem")
+			space.KeyFile = filepath.Join(tmpDir, "state", "key.pem")
+			return space
+		}
+
+		It("exports the certificate files when enabled", func() {
+			env, err := (&config.Config{}).CertEnv(certSpace())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(BeEmpty())
+
+			cfg := &config.Config{Cert: config.Cert{Create: true}}
+			env, err = cfg.CertEnv(certSpace())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal(map[string]string{
+				"TLS_CERT_FILE": filepath.Join(tmpDir, "state", "cert.pem"),
+				"TLS_KEY_FILE":  filepath.Join(tmpDir, "state", "key.pem"),
+				"TLS_DOMAIN":    "app-feature.localhost",
+			}))
+		})
+
+		It("creates and removes the certificate with mkcert", func() {
+			bin := GinkgoT().TempDir()
+			calls := filepath.Join(tmpDir, "calls")
+			// An mkcert that writes its arguments to the certificate and key files
+			script := "#!/bin/sh\n" +
+				"echo \"$*\" >> " + calls + "\n" +
+				"echo cert > \"$2\"\n" +
+				"echo key > \"$4\"\n"
+			Expect(os.WriteFile(filepath.Join(bin, "mkcert"), []byte(script), 0755)).To(Succeed())
+			GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+			space := certSpace()
+			Expect((&config.Config{}).CreateCert(context.Background(), space)).To(Succeed())
+			Expect(calls).NotTo(BeAnExistingFile())
+
+			cfg := &config.Config{Cert: config.Cert{Create: true, Domains: []string{
+				"{{ space.Name }}.localhost",
+				"*.{{ space.Name }}.localhost",
+			}}}
+			Expect(cfg.CreateCert(context.Background(), space)).To(Succeed())
+			out, err := os.ReadFile(calls)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("-cert-file " + space.CertFile + " -key-file " + space.KeyFile +
+				" app-feature.localhost *.app-feature.localhost\n"))
+			Expect(space.CertFile).To(BeAnExistingFile())
+			Expect(space.KeyFile).To(BeAnExistingFile())
+
+			Expect(cfg.RemoveCert(space)).To(Succeed())
+			Expect(space.CertFile).NotTo(BeAnExistingFile())
+			Expect(space.KeyFile).NotTo(BeAnExistingFile())
+			Expect(cfg.RemoveCert(space)).To(Succeed())
+		})
+	})
+
+	Describe("Hosts", func() {
+		It("names the space from a template", func() {
+			space := config.NewSpace("app-feature", tmpDir, 11010, tmpDir)
+			Expect((&config.Config{}).Hostname(space)).To(Equal("app-feature.test"))
+			cfg := &config.Config{Hosts: config.Hosts{Name: "{{ space.Name }}.dev.internal"}}
+			Expect(cfg.Hostname(space)).To(Equal("app-feature.dev.internal"))
+		})
+
+		It("keeps one entry per space in the hosts file", func() {
+			hosts := filepath.Join(tmpDir, "hosts")
+			Expect(os.WriteFile(hosts, []byte("127.0.0.1\tlocalhost\n"), 0644)).To(Succeed())
+			cfg := &config.Config{Hosts: config.Hosts{Register: true, File: hosts}}
+			app := config.NewSpace("app-feature", tmpDir, 11010, tmpDir)
+			api := config.NewSpace("api-feature", tmpDir, 11020, tmpDir)
+
+			Expect((&config.Config{}).HostsFile()).To(BeEmpty())
+			Expect((&config.Config{Hosts: config.Hosts{Register: true}}).HostsFile()).To(Equal(config.DefaultHostsFile))
+
+			Expect(cfg.RegisterHost(app)).To(Succeed())
+			Expect(cfg.RegisterHost(api)).To(Succeed())
+			Expect(cfg.RegisterHost(app)).To(Succeed())
+			Expect(os.ReadFile(hosts)).To(BeEquivalentTo("" +
+				"127.0.0.1\tlocalhost\n" +
+				"127.0.0.1\tapi-feature.test\t# remux:api-feature\n" +
+				"127.0.0.1\tapp-feature.test\t# remux:app-feature\n"))
+
+			Expect(cfg.UnregisterHost(api)).To(Succeed())
+			Expect(cfg.UnregisterHost(app)).To(Succeed())
+			Expect(os.ReadFile(hosts)).To(BeEquivalentTo("127.0.0.1\tlocalhost\n"))
+		})
+
+		It("keeps the entries of concurrent registrations", func() {
+			hosts := filepath.Join(tmpDir, "hosts")
+			cfg := &config.Config{Hosts: config.Hosts{Register: true, File: hosts}}
+
+			var wg sync.WaitGroup
+			for i := range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					space := config.NewSpace(fmt.Sprintf("app-%d", i), tmpDir, 11000+10*i, tmpDir)
+					Expect(cfg.RegisterHost(space)).To(Succeed())
+				}()
+			}
+			wg.Wait()
+
+			data, err := os.ReadFile(hosts)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range 10 {
+				Expect(string(data)).To(ContainSubstring(fmt.Sprintf("\tapp-%d.test\t# remux:app-%d\n", i, i)))
+			}
+		})
+
+		It("leaves a missing hosts file alone when unregistering", func() {
+			hosts := filepath.Join(tmpDir, "hosts")
+			cfg := &config.Config{Hosts: config.Hosts{Register: true, File: hosts}}
+			Expect(cfg.UnregisterHost(config.NewSpace("app-feature", tmpDir, 11010, tmpDir))).To(Succeed())
+			Expect(hosts).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Describe("ID", func() {
+		DescribeTable("derives the space ID from its name",
+			func(ids config.IDs, name, id string) {
+				cfg := &config.Config{ID: ids}
+				Expect(cfg.SpaceID(name)).To(Equal(id))
+			},
+			Entry("legacy default", config.IDs{}, "app-Feature.x", "app_Feature.x"),
+			Entry("underscore charset", config.IDs{Charset: config.IDCharsetUnderscore}, "app-Feature.x", "app_feature_x"),
+			Entry("dash charset", config.IDs{Charset: config.IDCharsetDash}, "app_Feature--x", "app-feature-x"),
+			Entry("alnum charset", config.IDs{Charset: config.IDCharsetAlnum}, "app-feature", "appfeature"),
+			Entry("leading digit", config.IDs{Charset: config.IDCharsetDash}, "42-fix", "s-42-fix"),
+			Entry("hash suffix", config.IDs{Hash: true}, "app-feature", "app_feature_f1152538"),
+			Entry("cut short", config.IDs{MaxLength: 16}, "app-very-long-feature", "app_ver_0a93918c"),
+			Entry("short enough", config.IDs{MaxLength: 16}, "app-feature", "app_feature"),
+		)
+
+		It("tells apart names that slug alike with hash", func() {
+			cfg := &config.Config{ID: config.IDs{Hash: true}}
+			Expect(cfg.SpaceID("foo-bar")).NotTo(Equal(cfg.SpaceID("foo_bar")))
+			Expect((&config.Config{}).SpaceID("foo-bar")).To(Equal((&config.Config{}).SpaceID("foo_bar")))
+		})
+
+		It("exposes the configured ID to templates", func() {
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte("id:\n  charset: dash\n"), 0644)).To(Succeed())
+			cfg, err := config.Load(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.SpaceID("app_feature")).To(Equal("app-feature"))
+		})
+
+		It("reports an unknown charset", func() {
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".remux.yaml"), []byte("env: {}\nid:\n  charset: emoji\n"), 0644)).To(Succeed())
+			err := config.Validate(tmpDir)
+			Expect(err).To(MatchError(ContainSubstring(".remux.yaml:2: unknown id charset \"emoji\"")))
+		})
+	})
+
+	Describe("Logs", func() {
+		It("maps sources to log files and back", func() {
+			for _, source := range []string{config.LogSourceHook, config.LogSourceService, "tab:server"} {
+				Expect(config.LogSource(config.LogFile(tmpDir, source))).To(Equal(source))
+			}
+			Expect(config.LogFile(tmpDir, "tab:web/api")).To(Equal(filepath.Join(tmpDir, "tab-web_api.log")))
+			Expect(config.LogSource("notes.md")).To(BeEmpty())
+			Expect(config.LogSource("other.log")).To(BeEmpty())
+		})
+
+		It("logs hooks, including what they leave running in the background", func() {
+			space := config.NewSpace("app-feature", tmpDir, 11010, tmpDir)
+			space.LogDir = filepath.Join(tmpDir, "logs")
+			cfg := &config.Config{Hooks: config.Hooks{OnOpen: []string{"echo started; (sleep 0.2; echo later) &"}}}
+
+			start := time.Now()
+			Expect(cfg.RunOnOpen(context.Background(), space)).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("<", 200*time.Millisecond))
+
+			logFile := config.LogFile(space.LogDir, config.LogSourceHook)
+			Eventually(func() (string, error) {
+				out, err := os.ReadFile(logFile)
+				return string(out), err
+			}).Should(MatchRegexp(`^--- \S+ on_open: echo started; \(sleep 0.2; echo later\) &\nstarted\nlater\n$`))
+
+			cfg.Hooks.OnOpen = []string{"exit 3"}
+			Expect(cfg.RunOnOpen(context.Background(), space)).NotTo(Succeed())
+			out, err := os.ReadFile(logFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(HaveSuffix("on_open: exit 3\n--- failed: exit status 3\n"))
+		})
+
+		It("resolves the log files of tabs that log", func() {
+			space := config.NewSpace("app-feature", tmpDir, 11010, tmpDir)
+			space.LogDir = filepath.Join(tmpDir, "logs")
+			cfg := &config.Config{Tabs: []config.Tab{{Name: "server", Log: true}, {Log: true}, {Name: "shell"}}}
+			tabs, err := cfg.ResolveTabs(space)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tabs[0].LogFile).To(Equal(filepath.Join(space.LogDir, "tab-server.log")))
+			Expect(tabs[1].LogFile).To(Equal(filepath.Join(space.LogDir, "tab-2.log")))
+			Expect(tabs[2].LogFile).To(BeEmpty())
+		})
+	})
+
 	Describe("ResolveEnv", func() {
 		It("resolves template expressions", func() {
 			cfg := &config.Config{
@@ -260,6 +993,29 @@ tabs:
 			Expect(resolved).To(HaveKeyWithValue("STATIC", "no_template"))
 		})
 
+		It("resolves space.URL only when referenced", func() {
+			calls := 0
+			ctx := config.Space{
+				Name: "my-feature",
+				URL: func() string {
+					calls++
+					return "https://github.com/o/r/tree/my-feature"
+				},
+			}
+
+			cfg := &config.Config{Env: map[string]string{"NAME": "{{ space.Name }}"}}
+			_, err := cfg.ResolveEnv(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).To(Equal(0))
+
+			cfg.Env["LINK"] = "{{ space.URL }}"
+			cfg.Env["PR"] = "{{ space.URL + '/pulls' }}"
+			resolved, err := cfg.ResolveEnv(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resolved).To(HaveKeyWithValue("LINK", "https://github.com/o/r/tree/my-feature"))
+			Expect(calls).To(Equal(1))
+		})
+
 		It("returns nil for empty env", func() {
 			cfg := &config.Config{}
 			resolved, err := cfg.ResolveEnv(config.Space{})
@@ -302,6 +1058,64 @@ tabs:
 			Expect(tabs[2]).To(Equal(config.Tab{Name: "", Cmd: "shell"}))
 		})
 
+		It("resolves template expressions in panes", func() {
+			cfg := &config.Config{
+				Tabs: []config.Tab{
+					{Name: "services", Cmd: "make test", Panes: []config.Pane{{Cmd: "cd api"}, {Cmd: "cd {{ space.Name }}", Direction: "right", Size: "30%"}}, Synchronize: true},
+				},
+			}
+
+			tabs, err := cfg.ResolveTabs(config.Space{Name: "web"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tabs).To(Equal([]config.Tab{
+				{Name: "services", Cmd: "make test", Panes: []config.Pane{{Cmd: "cd api"}, {Cmd: "cd web", Direction: "right", Size: "30%"}}, Synchronize: true},
+			}))
+		})
+
+		It("resolves tab dirs against the worktree and tab env", func() {
+			cfg := &config.Config{
+				Tabs: []config.Tab{
+					{Name: "ui", Dir: "frontend/", Env: map[string]string{"PORT": "{{ space.Port + 1 }}", "MODE": "it's dev"}},
+					{Name: "logs", Dir: "/var/log"},
+					{Name: "shell"},
+				},
+			}
+
+			tabs, err := cfg.ResolveTabs(config.Space{Name: "web", Path: "/work/web", Port: 11010})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tabs[0].Dir).To(Equal("/work/web/frontend"))
+			Expect(tabs[0].Env).To(Equal(map[string]string{"PORT": "11011", "MODE": "it's dev"}))
+			Expect(tabs[1].Dir).To(Equal("/var/log"))
+			Expect(tabs[2].Dir).To(BeEmpty())
+			Expect(tabs[2].Env).To(BeNil())
+
+			Expect(tabs[0].WorkDir("/work/web")).To(Equal("/work/web/frontend"))
+			Expect(tabs[2].WorkDir("/work/web")).To(Equal("/work/web"))
+			Expect(tabs[0].Prelude()).To(Equal(`cd '/work/web/frontend' && export MODE='it'\''s dev' PORT='11011'`))
+			Expect(tabs[1].Prelude()).To(Equal("cd '/var/log'"))
+			Expect(tabs[2].Prelude()).To(BeEmpty())
+		})
+
+		It("resolves tab renames to tmux formats", func() {
+			cfg := &config.Config{
+				Tabs: []config.Tab{
+					{Name: "shell", Rename: "command"},
+					{Name: "tests", Rename: "status"},
+					{Name: "web", Rename: "{{ space.Name }}:#{pane_current_command}"},
+					{Name: "logs"},
+				},
+			}
+
+			tabs, err := cfg.ResolveTabs(config.Space{Name: "web", Path: "/work/web"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tabs[0].RenameFormat()).To(Equal("#{pane_current_command}"))
+			Expect(tabs[0].ShowsExitStatus()).To(BeFalse())
+			Expect(tabs[1].RenameFormat()).To(ContainSubstring("#{@remux_status}"))
+			Expect(tabs[1].ShowsExitStatus()).To(BeTrue())
+			Expect(tabs[2].RenameFormat()).To(Equal("web:#{pane_current_command}"))
+			Expect(tabs[3].RenameFormat()).To(BeEmpty())
+		})
+
 		It("returns nil for empty tabs", func() {
 			cfg := &config.Config{}
 			tabs, err := cfg.ResolveTabs(config.Space{})
@@ -362,6 +1176,81 @@ var _ = Describe("Template", func() {
 			Expect(result).To(Equal("/repo/root/scripts/setup.sh"))
 		})
 
+		It("evaluates SessionName expression", func() {
+			space := config.NewSpace("v1.2", "/path/to/space", 11020, "/repo/root")
+			space.SessionName = "v1_2"
+			result, err := config.EvaluateTemplate("{{ space.SessionName }}", space)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("v1_2"))
+
+			result, err = config.EvaluateTemplate("{{ space.SessionName }}", config.NewSpace("plain", "", 0, ""))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("plain"))
+		})
+
+		It("joins paths", func() {
+			result, err := config.EvaluateTemplate(`{{ join(space.RepoRoot, "scripts", "../bin/dev.sh") }}`, ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("/repo/root/bin/dev.sh"))
+		})
+
+		It("evaluates remote URLs", func() {
+			repoRoot := GinkgoT().TempDir()
+			for _, args := range [][]string{
+				{"init", "--quiet"},
+				{"remote", "add", "origin", "git@github.com:me/app.git"},
+				{"remote", "add", "upstream", "https://github.com/org/app.git"},
+			} {
+				Expect(exec.Command("git", append([]string{"-C", repoRoot}, args...)...).Run()).To(Succeed())
+			}
+
+			space := config.NewSpace("test-space", "/path/to/space", 11020, repoRoot)
+			result, err := config.EvaluateTemplate("{{ remotes.upstream }} {{ remotes.origin }}", space)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("https://github.com/org/app.git git@github.com:me/app.git"))
+		})
+
+		It("looks up other spaces", func() {
+			space := config.NewSpace("app-web", "/spaces/app-web", 11020, "/src/app")
+			space.Spaces = func() []config.Space {
+				return []config.Space{space, config.NewSpace("app-auth", "/spaces/app-auth", 11010, "/src/app")}
+			}
+			result, err := config.EvaluateTemplate(`{{ spaces["app-auth"].Port + 1 }} {{ spaces["app-auth"].Path }}`, space)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("11011 /spaces/app-auth"))
+
+			_, err = config.EvaluateTemplate(`{{ spaces["app-missing"].Port }}`, space)
+			Expect(err).To(HaveOccurred())
+			Expect(config.EvaluateTemplate(`{{ "app-missing" in spaces }}`, space)).To(Equal("false"))
+		})
+
+		It("makes paths relative", func() {
+			result, err := config.EvaluateTemplate(`{{ rel(space.Path, join(space.RepoRoot, "scripts")) }}`, ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("../../../repo/root/scripts"))
+
+			_, err = config.EvaluateTemplate(`{{ rel("relative", space.Path) }}`, ctx)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("evaluates env expressions", func() {
+			os.Setenv("REMUX_TEST_TEMPLATE_VAR", "from_env")
+			defer os.Unsetenv("REMUX_TEST_TEMPLATE_VAR")
+
+			result, err := config.EvaluateTemplate("{{ env.REMUX_TEST_TEMPLATE_VAR }}-{{ space.Port }}", ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("from_env-11020"))
+		})
+
+		It("evaluates env index expressions", func() {
+			os.Setenv("REMUX_TEST_TEMPLATE_VAR", "indexed")
+			defer os.Unsetenv("REMUX_TEST_TEMPLATE_VAR")
+
+			result, err := config.EvaluateTemplate(`{{ env["REMUX_TEST_TEMPLATE_VAR"] }}`, ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("indexed"))
+		})
+
 		It("returns string unchanged when no templates", func() {
 			result, err := config.EvaluateTemplate("no templates here", ctx)
 			Expect(err).NotTo(HaveOccurred())
@@ -374,3 +1263,293 @@ var _ = Describe("Template", func() {
 		})
 	})
 })
+
+var _ = Describe("Building configs", func() {
+	It("marshals only the fields that are set", func() {
+		cfg := config.New().
+			SetEnv("PORT", "{{ space.Port }}").
+			AddTab(config.Tab{Name: "server", Cmd: "npm start"}).
+			AddTab(config.Tab{Cmd: "shell"}).
+			OnCreate("npm ci")
+
+		data, err := cfg.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(`env:
+  PORT: '{{ space.Port }}'
+hooks:
+  on_create:
+    - npm ci
+tabs:
+  - name: server
+    cmd: npm start
+  - cmd: shell
+`))
+	})
+
+	It("reports invalid expressions", func() {
+		cfg := config.New().OnOpen("echo {{ space.Nope( }}")
+
+		err := cfg.Validate()
+		var vErr *config.ValidationError
+		Expect(errors.As(err, &vErr)).To(BeTrue())
+		Expect(vErr.Message).To(ContainSubstring("invalid expression"))
+	})
+
+	It("saves a config that loads back unchanged", func() {
+		dir := GinkgoT().TempDir()
+		cfg := config.New().
+			SetEnv("DB", "app_{{ space.ID }}").
+			AddTab(config.Tab{Name: "services", Panes: []config.Pane{{Cmd: "cd api"}, {Cmd: "cd web", Direction: "below"}}, Synchronize: true}).
+			OnDrop("make clean")
+		cfg.Backend = "zellij"
+
+		Expect(cfg.Save(dir)).To(Succeed())
+		Expect(config.Validate(dir)).To(Succeed())
+
+		loaded, err := config.Load(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(cfg))
+	})
+
+	It("does not save invalid configs", func() {
+		dir := GinkgoT().TempDir()
+		Expect(config.New().SetEnv("X", "{{ ) }}").Save(dir)).NotTo(Succeed())
+		Expect(filepath.Join(dir, ".remux.yaml")).NotTo(BeAnExistingFile())
+	})
+})
+
+var _ = Describe("SpaceTemplate", func() {
+	var dir string
+
+	BeforeEach(func() {
+		configHome := GinkgoT().TempDir()
+		GinkgoT().Setenv("XDG_CONFIG_HOME", configHome)
+		dir = filepath.Join(configHome, "remux", "templates")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+	})
+
+	It("loads a template from the template dir", func() {
+		data := "base: main\nenv:\n  ROLE: review\ntabs:\n  - name: diff\n    cmd: git diff main\n"
+		Expect(os.WriteFile(filepath.Join(dir, "review.yaml"), []byte(data), 0644)).To(Succeed())
+
+		tmpl, err := config.LoadTemplate("review")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tmpl.Name).To(Equal("review"))
+		Expect(tmpl.Base).To(Equal("main"))
+		Expect(tmpl.Env).To(Equal(map[string]string{"ROLE": "review"}))
+		Expect(tmpl.Tabs).To(Equal([]config.Tab{{Name: "diff", Cmd: "git diff main"}}))
+
+		Expect(config.ListTemplates()).To(Equal([]string{"review"}))
+	})
+
+	It("lies beneath the repository config", func() {
+		data := "env:\n  ROLE: agent\n  PORT: '1'\nhooks:\n  on_create:\n    - agent-setup\n"
+		Expect(os.WriteFile(filepath.Join(dir, "agent.yaml"), []byte(data), 0644)).To(Succeed())
+		tmpl, err := config.LoadTemplate("agent")
+		Expect(err).NotTo(HaveOccurred())
+
+		cfg := tmpl.Beneath(&config.Config{Env: map[string]string{"PORT": "{{ space.Port }}"}})
+		Expect(cfg.Env).To(Equal(map[string]string{"ROLE": "agent", "PORT": "{{ space.Port }}"}))
+		Expect(cfg.Hooks.OnCreate).To(Equal([]string{"agent-setup"}))
+	})
+
+	It("rejects unknown and invalid names", func() {
+		_, err := config.LoadTemplate("missing")
+		Expect(err).To(MatchError(config.ErrTemplateNotFound))
+
+		_, err = config.LoadTemplate("../secrets")
+		Expect(err).To(MatchError(ContainSubstring("invalid template name")))
+	})
+
+	It("expands its preset beneath itself", func() {
+		data := "preset: go\ntabs:\n  - name: agent\n"
+		Expect(os.WriteFile(filepath.Join(dir, "agent.yaml"), []byte(data), 0644)).To(Succeed())
+		tmpl, err := config.LoadTemplate("agent")
+		Expect(err).NotTo(HaveOccurred())
+
+		cfg := tmpl.Beneath(&config.Config{})
+		Expect(cfg.Cache.Shared).To(Equal([]string{"go"}))
+		Expect(cfg.Tabs).To(Equal([]config.Tab{{Name: "agent"}}))
+
+		Expect(os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("preset: cobol\n"), 0644)).To(Succeed())
+		_, err = config.LoadTemplate("bad")
+		Expect(err).To(MatchError(ContainSubstring(`unknown preset "cobol"`)))
+	})
+})
+
+var _ = Describe("Presets", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("expands a preset beneath the config files", func() {
+		Expect(os.WriteFile(filepath.Join(dir, ".remux.yaml"), []byte("preset: node\nenv:\n  NODE_ENV: test\n"), 0644)).To(Succeed())
+
+		cfg, err := config.Load(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Env).To(Equal(map[string]string{"PORT": "{{ space.Port }}", "NODE_ENV": "test"}))
+		Expect(cfg.Cache.Copy).To(Equal([]string{"node_modules"}))
+		Expect(cfg.Cache.Shared).To(Equal([]string{"npm"}))
+		Expect(cfg.Tabs).To(HaveLen(3))
+		Expect(cfg.Tabs[1]).To(Equal(config.Tab{Name: "server", Cmd: "npm run dev"}))
+	})
+
+	It("lets the local config pick the preset", func() {
+		Expect(os.WriteFile(filepath.Join(dir, ".remux.yaml"), []byte("tabs:\n  - name: main\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, ".remux.local.yaml"), []byte("preset: python\n"), 0644)).To(Succeed())
+
+		cfg, err := config.Load(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Env).To(HaveKeyWithValue("PYTHONDONTWRITEBYTECODE", "1"))
+		Expect(cfg.Tabs).To(Equal([]config.Tab{{Name: "main"}}))
+	})
+
+	It("parses every preset", func() {
+		Expect(config.Presets()).To(Equal([]string{"go", "node", "python", "rails"}))
+		for _, name := range config.Presets() {
+			cfg, err := config.Preset(name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Tabs).NotTo(BeEmpty())
+		}
+	})
+
+	It("rejects unknown presets", func() {
+		Expect(os.WriteFile(filepath.Join(dir, ".remux.yaml"), []byte("env:\n  A: b\npreset: cobol\n"), 0644)).To(Succeed())
+
+		_, err := config.Load(dir)
+		Expect(err).To(MatchError(ContainSubstring(`unknown preset "cobol" (expected one of go, node, python, rails)`)))
+		Expect(config.Validate(dir)).To(MatchError(ContainSubstring(".remux.yaml:3: unknown preset")))
+	})
+})
+
+var _ = Describe("Report", func() {
+	space := config.NewSpace("app-feature", "/tmp/app-feature", 11010, "/src/app")
+	data := config.ReportData{
+		Branch:  "feature",
+		Base:    "main",
+		Issue:   "https://github.com/me/app/issues/42",
+		Commits: "- `abc1234` Add login",
+		Stat:    " login.go | 2 ++",
+	}
+
+	It("renders the default template, leaving out empty parts", func() {
+		out, err := config.New().RenderReport(space, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("## feature\n\n" +
+			"Base: `main`  \nIssue: https://github.com/me/app/issues/42\n\n" +
+			"### Commits\n\n- `abc1234` Add login\n\n" +
+			"### Changes\n\n```\n login.go | 2 ++\n```\n"))
+
+		withNote := data
+		withNote.Note = "Waiting on review"
+		out, err = config.New().RenderReport(space, withNote)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(HaveSuffix("```\n\n### Notes\n\nWaiting on review\n"))
+	})
+
+	It("renders a custom template from the config", func() {
+		dir := GinkgoT().TempDir()
+		cfg := "report:\n  template: \"{{ space.Name }}: {{ report.Branch }} onto {{ upper(report.Base) }}\"\n"
+		Expect(os.WriteFile(filepath.Join(dir, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		Expect(config.Validate(dir)).To(Succeed())
+
+		loaded, err := config.Load(dir)
+		Expect(err).NotTo(HaveOccurred())
+		out, err := loaded.RenderReport(space, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("app-feature: feature onto MAIN"))
+	})
+})
+
+var _ = Describe("Global", func() {
+	BeforeEach(func() {
+		GinkgoT().Setenv("XDG_CONFIG_HOME", GinkgoT().TempDir())
+	})
+
+	It("is empty until saved", func() {
+		g, err := config.LoadGlobal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*g).To(BeZero())
+	})
+
+	It("round-trips through the user's config file", func() {
+		g := &config.Global{Dest: "~/work", BasePort: 20000, Editor: "code --wait", Backend: "zellij", Limits: config.Limits{Spaces: 50, Disk: "20G"}}
+		Expect(g.Save()).To(Succeed())
+
+		path, err := config.GlobalPath()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Base(path)).To(Equal("config.yaml"))
+
+		loaded, err := config.LoadGlobal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(g))
+	})
+})
+
+var _ = Describe("NameBranch", func() {
+	It("keeps the name without a template", func() {
+		branch, short, err := (&config.Config{}).NameBranch("/src/app", "fix-login", "alice")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(branch).To(Equal("fix-login"))
+		Expect(short).To(Equal("fix-login"))
+	})
+
+	It("names the branch by the template", func() {
+		cfg := &config.Config{BranchName: "{{ user }}/{{ name }}"}
+		branch, short, err := cfg.NameBranch("/src/app", "fix-login", "alice")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(branch).To(Equal("alice/fix-login"))
+		Expect(short).To(Equal("fix-login"))
+
+		cfg = &config.Config{BranchName: "feature/{{ name }}-{{ user }}"}
+		branch, _, err = cfg.NameBranch("/src/app", "search", "bob")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(branch).To(Equal("feature/search-bob"))
+	})
+
+	It("keeps a name that already follows the template", func() {
+		cfg := &config.Config{BranchName: "{{ user }}/{{ name }}"}
+		branch, short, err := cfg.NameBranch("/src/app", "alice/fix-login", "alice")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(branch).To(Equal("alice/fix-login"))
+		Expect(short).To(Equal("fix-login"))
+
+		branch, short, err = cfg.NameBranch("/src/app", "bob/fix-login", "alice")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(branch).To(Equal("alice/bob/fix-login"))
+		Expect(short).To(Equal("bob/fix-login"))
+	})
+
+	It("reports a template that fails to evaluate", func() {
+		cfg := &config.Config{BranchName: "{{ nope }}/{{ name }}"}
+		_, _, err := cfg.NameBranch("/src/app", "fix", "alice")
+		Expect(err).To(MatchError(ContainSubstring("branch_name")))
+	})
+})
+
+var _ = Describe("Limits", func() {
+	It("parses disk sizes", func() {
+		for input, bytes := range map[string]int64{
+			"":      0,
+			"512":   512,
+			"2K":    2048,
+			"1.5G":  3 << 29,
+			"20GiB": 20 << 30,
+			"1tb":   1 << 40,
+		} {
+			size, err := config.Limits{Disk: input}.DiskBytes()
+			Expect(err).NotTo(HaveOccurred(), input)
+			Expect(size).To(Equal(bytes), input)
+		}
+		_, err := config.Limits{Disk: "lots"}.DiskBytes()
+		Expect(err).To(MatchError(ContainSubstring("limits.disk")))
+	})
+
+	It("formats sizes the way they are parsed", func() {
+		Expect(config.FormatSize(512)).To(Equal("512B"))
+		Expect(config.FormatSize(3 << 29)).To(Equal("1.5G"))
+		Expect(config.FormatSize(20 << 30)).To(Equal("20G"))
+	})
+})
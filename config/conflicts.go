@@ -0,0 +1,21 @@
+package config
+
+// DefaultConflictCommand is run to resolve conflicts unless
+// conflicts.command is set.
+const DefaultConflictCommand = "git status"
+
+// Conflicts configures how `remux stack sync` helps resolve a rebase that
+// stops on conflicts. The command runs in a conflicts window of the space's
+// tmux session, or in the foreground when the session isn't running.
+type Conflicts struct {
+	Command string `yaml:"command,omitempty"` // Command template, e.g. "git mergetool" (default DefaultConflictCommand)
+}
+
+// ConflictCommand returns the command resolving the space's conflicts.
+func (c *Config) ConflictCommand(space Space) (string, error) {
+	command := c.Conflicts.Command
+	if command == "" {
+		command = DefaultConflictCommand
+	}
+	return newTemplateEnv(space).evaluate(command)
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults maps commands to default values of their flags, used when a flag
+// isn't given on the command line. Commands are named by their path below
+// remux, e.g. "new" or "stack new":
+//
+//	defaults:
+//	  new:
+//	    template: review
+//	    no-setup: true
+//	  open:
+//	    profile: Work
+type Defaults map[string]map[string]string
+
+// Get returns the default of the flag of command, and whether one is set.
+func (d Defaults) Get(command, flag string) (string, bool) {
+	value, ok := d[command][flag]
+	return value, ok
+}
+
+// Set sets the default of the flag of command.
+func (d *Defaults) Set(command, flag, value string) {
+	if *d == nil {
+		*d = make(Defaults)
+	}
+	if (*d)[command] == nil {
+		(*d)[command] = make(map[string]string)
+	}
+	(*d)[command][flag] = value
+}
+
+// Unset removes the default of the flag of command. Returns false if none was set.
+func (d Defaults) Unset(command, flag string) bool {
+	if _, ok := d[command][flag]; !ok {
+		return false
+	}
+	delete(d[command], flag)
+	if len(d[command]) == 0 {
+		delete(d, command)
+	}
+	return true
+}
+
+// Over returns the defaults of d, with the flags set in base added for
+// commands d sets no default of the same flag for.
+func (d Defaults) Over(base Defaults) Defaults {
+	if len(d) == 0 {
+		return base
+	}
+	result := make(Defaults, len(base)+len(d))
+	for _, defaults := range []Defaults{base, d} {
+		for command, flags := range defaults {
+			for flag, value := range flags {
+				result.Set(command, flag, value)
+			}
+		}
+	}
+	return result
+}
+
+// SetLocalDefault sets the default of the flag of command in the
+// .remux.local.yaml file of the workspace or repository at path, creating the
+// file if needed. The rest of the file, including comments, is kept.
+func SetLocalDefault(path, command, flag, value string) error {
+	return editLocal(path, func(root *yaml.Node) bool {
+		defaults := mappingValue(root, "defaults", true)
+		flags := mappingValue(defaults, command, true)
+		setScalar(flags, flag, value)
+		return true
+	})
+}
+
+// UnsetLocalDefault removes the default of the flag of command from the
+// .remux.local.yaml file at path. Returns false if none was set there.
+func UnsetLocalDefault(path, command, flag string) (bool, error) {
+	removed := false
+	err := editLocal(path, func(root *yaml.Node) bool {
+		defaults := mappingValue(root, "defaults", false)
+		flags := mappingValue(defaults, command, false)
+		removed = removeKey(flags, flag)
+		if removed && len(flags.Content) == 0 {
+			removeKey(defaults, command)
+		}
+		if removed && len(defaults.Content) == 0 {
+			removeKey(root, "defaults")
+		}
+		return removed
+	})
+	return removed, err
+}
+
+// editLocal applies edit to the top-level mapping of the .remux.local.yaml
+// file at path and writes it back if edit reports a change.
+func editLocal(path string, edit func(root *yaml.Node) bool) error {
+	file := filepath.Join(path, LocalConfigFile)
+	var doc yaml.Node
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: not a mapping", file)
+	}
+	if !edit(root) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// mappingValue returns the mapping under key in the mapping node, adding an
+// empty one if create is set. Returns an empty mapping not part of node if
+// there is none and create isn't set.
+func mappingValue(node *yaml.Node, key string, create bool) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key && node.Content[i+1].Kind == yaml.MappingNode {
+			return node.Content[i+1]
+		}
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	if create {
+		removeKey(node, key)
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	}
+	return value
+}
+
+// setScalar sets key in the mapping node to the scalar value.
+func setScalar(node *yaml.Node, key, value string) {
+	scalar := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = scalar
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, scalar)
+}
+
+// removeKey removes key and its value from the mapping node. Returns false if
+// the node doesn't have the key.
+func removeKey(node *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = slices.Delete(node.Content, i, i+2)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default templates of the docker names of a space.
+const (
+	DefaultDockerNetwork         = "{{ space.ID }}"
+	DefaultDockerImageTag        = "{{ space.ID }}"
+	DefaultDockerContainerPrefix = "{{ space.ID }}_"
+)
+
+// DefaultComposeOverride is the file docker.ports are written to unless
+// docker.compose_override is set. docker compose reads it next to compose.yaml
+// without being told to.
+const DefaultComposeOverride = "compose.override.yaml"
+
+// Docker names the docker resources of a space. The names are exported to
+// sessions, hooks and services as DOCKER_NETWORK, IMAGE_TAG and
+// CONTAINER_PREFIX, so compose files and scripts can keep the containers of
+// each space apart by convention.
+type Docker struct {
+	Network         string `yaml:"network,omitempty"`          // Network name template (default DefaultDockerNetwork)
+	ImageTag        string `yaml:"image_tag,omitempty"`        // Image tag template (default DefaultDockerImageTag)
+	ContainerPrefix string `yaml:"container_prefix,omitempty"` // Container name prefix template (default DefaultDockerContainerPrefix)
+	CreateNetwork   bool   `yaml:"create_network,omitempty"`   // Create the network with the space and remove it when the space is dropped
+
+	// Ports maps compose services to the port mappings they publish, e.g.
+	// web: ["{{ space.Port }}:3000"]. They are written to the compose
+	// override file, replacing the ports the compose files publish.
+	Ports           map[string][]string `yaml:"ports,omitempty"`
+	ComposeOverride string              `yaml:"compose_override,omitempty"` // Override file, relative to the worktree (default DefaultComposeOverride)
+}
+
+// DockerEnv returns the DOCKER_NETWORK, IMAGE_TAG and CONTAINER_PREFIX
+// variables of the space.
+func (c *Config) DockerEnv(space Space) (map[string]string, error) {
+	return c.Docker.env(newTemplateEnv(space))
+}
+
+func (d Docker) env(tmpl *templateEnv) (map[string]string, error) {
+	vars := []struct{ key, template, def string }{
+		{"DOCKER_NETWORK", d.Network, DefaultDockerNetwork},
+		{"IMAGE_TAG", d.ImageTag, DefaultDockerImageTag},
+		{"CONTAINER_PREFIX", d.ContainerPrefix, DefaultDockerContainerPrefix},
+	}
+	env := make(map[string]string, len(vars))
+	for _, v := range vars {
+		template := v.template
+		if template == "" {
+			template = v.def
+		}
+		resolved, err := tmpl.evaluate(template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate %s: %w", v.key, err)
+		}
+		env[v.key] = resolved
+	}
+	return env, nil
+}
+
+// CreateDockerNetwork creates the space's docker network if docker.create_network
+// is set and the network doesn't exist yet.
+func (c *Config) CreateDockerNetwork(ctx context.Context, space Space) error {
+	name, err := c.DockerNetwork(space)
+	if err != nil || name == "" || dockerNetworkExists(ctx, name) {
+		return err
+	}
+	return runDocker(ctx, "network", "create", name)
+}
+
+// RemoveDockerNetwork removes the space's docker network if docker.create_network
+// is set and the network exists. Fails while containers are attached to it.
+func (c *Config) RemoveDockerNetwork(ctx context.Context, space Space) error {
+	name, err := c.DockerNetwork(space)
+	if err != nil || name == "" || !dockerNetworkExists(ctx, name) {
+		return err
+	}
+	return runDocker(ctx, "network", "rm", name)
+}
+
+// DockerNetwork returns the name of the network CreateDockerNetwork creates,
+// or "" if docker.create_network isn't set.
+func (c *Config) DockerNetwork(space Space) (string, error) {
+	if !c.Docker.CreateNetwork {
+		return "", nil
+	}
+	env, err := c.DockerEnv(space)
+	if err != nil {
+		return "", err
+	}
+	return env["DOCKER_NETWORK"], nil
+}
+
+// ComposeOverride returns the path of the compose override file the space's
+// docker.ports are written to, or "" if none are configured.
+func (c *Config) ComposeOverride(space Space) string {
+	if file := c.Docker.overrideFile(); file != "" {
+		return filepath.Join(space.Path, file)
+	}
+	return ""
+}
+
+// WriteComposeOverride writes the space's docker.ports, evaluated as
+// templates, to its compose override file. The file is left alone when its
+// content is unchanged. Returns the file's path, or "" if no ports are
+// configured.
+func (c *Config) WriteComposeOverride(space Space) (string, error) {
+	path := c.ComposeOverride(space)
+	if path == "" {
+		return "", nil
+	}
+	data, err := c.Docker.composeOverride(newTemplateEnv(space))
+	if err != nil {
+		return "", err
+	}
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return path, nil
+	}
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// overrideFile returns the compose override file relative to the worktree,
+// or "" if no ports are configured.
+func (d Docker) overrideFile() string {
+	switch {
+	case len(d.Ports) == 0:
+		return ""
+	case d.ComposeOverride != "":
+		return d.ComposeOverride
+	}
+	return DefaultComposeOverride
+}
+
+// composeOverride returns the compose override file publishing d.Ports. The
+// !override tag makes compose replace the ports of the compose files instead
+// of adding to them, so a fixed port in compose.yaml doesn't clash between
+// spaces.
+func (d Docker) composeOverride(tmpl *templateEnv) ([]byte, error) {
+	scalar := func(value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	}
+	services := &yaml.Node{Kind: yaml.MappingNode}
+	for _, name := range slices.Sorted(maps.Keys(d.Ports)) {
+		ports := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!override"}
+		for _, mapping := range d.Ports[name] {
+			resolved, err := tmpl.evaluate(mapping)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate ports of %s: %w", name, err)
+			}
+			// Quoted, so YAML 1.1 readers don't take 80:80 for a number
+			ports.Content = append(ports.Content, &yaml.Node{Kind: yaml.ScalarNode, Style: yaml.DoubleQuotedStyle, Value: resolved})
+		}
+		service := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{scalar("ports"), ports}}
+		services.Content = append(services.Content, scalar(name), service)
+	}
+	doc := &yaml.Node{
+		Kind:        yaml.MappingNode,
+		HeadComment: "Generated by remux from docker.ports in .remux.yaml and rewritten on open, don't edit.",
+		Content:     []*yaml.Node{scalar("services"), services},
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// commandEnv returns the env of commands run for a space: the shared cache
+// dirs, the docker names and the certificate files, overridden by the
+// config's env.
+func (c *Config) commandEnv(tmpl *templateEnv) (map[string]string, error) {
+	env, err := c.CacheEnv()
+	if err != nil {
+		return nil, err
+	}
+	docker, err := c.Docker.env(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := c.Cert.env(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := c.resolveEnv(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		env = make(map[string]string)
+	}
+	maps.Copy(env, docker)
+	maps.Copy(env, cert)
+	maps.Copy(env, resolved)
+	return env, nil
+}
+
+// dockerNetworkExists reports whether a docker network with the given name exists.
+func dockerNetworkExists(ctx context.Context, name string) bool {
+	return exec.CommandContext(ctx, "docker", "network", "inspect", name).Run() == nil
+}
+
+// runDocker runs a docker command, returning its output in the error on failure.
+func runDocker(ctx context.Context, args ...string) error {
+	log().Debug("running command", "command", "docker "+strings.Join(args, " "))
+	out, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const globalFile = "config.yaml"
+
+// Global holds the user's defaults for every repository, kept in
+// ~/.config/remux/config.yaml and written by `remux setup`. Command-line flags
+// and repository configs take precedence over it.
+type Global struct {
+	Dest     string `yaml:"dest,omitempty"`      // Dest dir used unless --dest is given (default ~/.remux)
+	BasePort int    `yaml:"base_port,omitempty"` // First port allocated to new spaces (default registry.BasePort)
+	Ports    int    `yaml:"ports,omitempty"`     // Number of ports from BasePort new spaces must fit in, when sharing a dest dir (default unlimited)
+	Editor   string `yaml:"editor,omitempty"`    // Editor for notes (default $VISUAL or $EDITOR)
+	Backend  string `yaml:"backend,omitempty"`   // Session backend of spaces whose config selects none
+	Limits   Limits `yaml:"limits,omitempty"`    // Limits on the spaces new creates
+
+	// Defaults are flag values used when they aren't given, beneath the
+	// defaults of the repository's config.
+	Defaults Defaults `yaml:"defaults,omitempty"`
+}
+
+// GlobalPath returns the path of the user's config file,
+// $XDG_CONFIG_HOME/remux/config.yaml or ~/.config/remux/config.yaml.
+func GlobalPath() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, globalFile), nil
+}
+
+// LoadGlobal reads the user's config file. Returns an empty config if the
+// file doesn't exist.
+func LoadGlobal() (*Global, error) {
+	path, err := GlobalPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Global{}, nil
+		}
+		return nil, err
+	}
+
+	g := &Global{}
+	if err := yaml.Unmarshal(data, g); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return g, nil
+}
+
+// Save writes g to the user's config file, creating its directory if needed.
+func (g *Global) Save() error {
+	path, err := GlobalPath()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(g)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
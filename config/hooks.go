@@ -1,32 +1,62 @@
 package config
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/johanhenriksson/remux/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// runHooks executes a list of hook commands in the workspace directory.
-// Each command is evaluated as a template before execution.
-func runHooks(commands []string, space Space, workdir string, env map[string]string) error {
+// hookWaitDelay is how long a cancelled hook may take to exit before it is killed.
+const hookWaitDelay = 5 * time.Second
+
+// runHooks executes a list of hook commands of event in the workspace
+// directory, logging their output to the hook log. Each command is evaluated
+// as a template before execution.
+func runHooks(ctx context.Context, event string, commands []string, tmpl *templateEnv, space Space, env map[string]string) error {
 	for _, cmd := range commands {
-		resolved, err := EvaluateTemplate(cmd, space)
+		resolved, err := tmpl.evaluate(cmd)
 		if err != nil {
 			return fmt.Errorf("failed to evaluate hook command: %w", err)
 		}
 
-		if err := runCommand(resolved, workdir, env); err != nil {
+		if err := runLogged(ctx, space, LogSourceHook, event+": "+resolved, resolved, env); err != nil {
 			return fmt.Errorf("hook failed: %s: %w", resolved, err)
 		}
 	}
 	return nil
 }
 
-func runCommand(command, workdir string, env map[string]string) error {
-	cmd := exec.Command("sh", "-c", command)
+// runCommand runs a shell command, writing its output to remux's stdout and
+// stderr, see runCommandOutput.
+func runCommand(ctx context.Context, command, workdir string, env map[string]string) error {
+	return runCommandOutput(ctx, command, workdir, env, os.Stdout, os.Stderr)
+}
+
+// runCommandOutput runs a shell command, writing its output to stdout and
+// stderr. Cancelling ctx terminates the command and kills it if it hasn't
+// exited after hookWaitDelay. The command runs in its own process group so
+// that cancelling also reaches the processes the shell started, which would
+// otherwise outlive it.
+func runCommandOutput(ctx context.Context, command, workdir string, env map[string]string, stdout, stderr io.Writer) (err error) {
+	log().Debug("running command", "command", command, "dir", workdir)
+	ctx, span := telemetry.Start(ctx, "command", attribute.String("command", command))
+	defer func() { telemetry.End(span, err) }()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM) }
+	cmd.WaitDelay = hookWaitDelay
 	cmd.Dir = workdir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	// Combine parent environment with custom env vars
 	cmd.Env = os.Environ()
@@ -36,3 +66,83 @@ func runCommand(command, workdir string, env map[string]string) error {
 
 	return cmd.Run()
 }
+
+// HookEvents are the events hooks run on, in lifecycle order.
+var HookEvents = []string{"on_create", "on_open", "on_drop"}
+
+// HookExplanation describes how the hooks of a space would run, see ExplainHooks.
+type HookExplanation struct {
+	Dir   string            // Working directory of the hooks
+	Env   map[string]string // Env vars added to the environment remux runs in
+	Hooks []ExplainedHook   // In event order, then config order
+}
+
+// ExplainedHook is a hook command after template evaluation.
+type ExplainedHook struct {
+	Event    string // on_create, on_open or on_drop
+	Template string // Command as written in the config
+	Command  string // Evaluated command, empty if Err is set
+	Err      error  // Why the command failed to evaluate
+}
+
+// ExplainHooks evaluates the hooks of event for space without running them,
+// or the hooks of every event if event is empty. A command that fails to
+// evaluate is returned with its error, so every mistake shows up at once.
+func (c *Config) ExplainHooks(space Space, event string) (*HookExplanation, error) {
+	events := HookEvents
+	if event != "" {
+		if !slices.Contains(HookEvents, event) {
+			return nil, fmt.Errorf("unknown hook event %q (want one of %s)", event, strings.Join(HookEvents, ", "))
+		}
+		events = []string{event}
+	}
+
+	tmpl := newTemplateEnv(space)
+	env, err := c.commandEnv(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve env: %w", err)
+	}
+	result := &HookExplanation{Dir: space.Path, Env: env}
+	for _, ev := range events {
+		for _, command := range c.Hooks.event(ev) {
+			hook := ExplainedHook{Event: ev, Template: command}
+			hook.Command, hook.Err = tmpl.evaluate(command)
+			result.Hooks = append(result.Hooks, hook)
+		}
+	}
+	return result, nil
+}
+
+// HookScript evaluates the hooks of the given events into one shell script
+// that runs them in order, printing each first, and stops at the first that
+// fails. Returns "" if there are no hooks to run.
+func (c *Config) HookScript(space Space, events ...string) (string, error) {
+	tmpl := newTemplateEnv(space)
+	var lines []string
+	for _, event := range events {
+		for _, command := range c.Hooks.event(event) {
+			resolved, err := tmpl.evaluate(command)
+			if err != nil {
+				return "", fmt.Errorf("failed to evaluate %s hook: %w", event, err)
+			}
+			lines = append(lines, "echo "+shellQuote(event+": "+resolved), resolved)
+		}
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return "set -e\n" + strings.Join(lines, "\n"), nil
+}
+
+// event returns the commands of the named hook event.
+func (h Hooks) event(name string) []string {
+	switch name {
+	case "on_create":
+		return h.OnCreate
+	case "on_open":
+		return h.OnOpen
+	case "on_drop":
+		return h.OnDrop
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// DefaultHostname is the hostname template of a space unless hosts.name is
+// set. The .test top-level domain is reserved for testing, so it never
+// clashes with real hosts.
+const DefaultHostname = "{{ space.Name }}.test"
+
+// DefaultHostsFile is the file hostnames are registered in unless hosts.file
+// is set.
+const DefaultHostsFile = "/etc/hosts"
+
+// hostsAddress is the address registered hostnames point at.
+const hostsAddress = "127.0.0.1"
+
+// hostsMarker starts the comment that tags the hosts file lines remux manages
+// with the name of their space.
+const hostsMarker = "# remux:"
+
+// Hosts names each space, so several spaces can be addressed by hostname
+// instead of by port. The hostname is exported to sessions as SPACE_HOST and
+// to templates as space.Host.
+type Hosts struct {
+	Name     string `yaml:"name,omitempty"`     // Hostname template (default DefaultHostname)
+	Register bool   `yaml:"register,omitempty"` // Point the hostname at localhost in File while the space exists
+	File     string `yaml:"file,omitempty"`     // Hosts file (default DefaultHostsFile)
+}
+
+// Hostname returns the hostname of the space.
+func (c *Config) Hostname(space Space) (string, error) {
+	template := c.Hosts.Name
+	if template == "" {
+		template = DefaultHostname
+	}
+	return newTemplateEnv(space).evaluate(template)
+}
+
+// HostsFile returns the hosts file the space's hostname is registered in, or
+// "" if hosts.register isn't set.
+func (c *Config) HostsFile() string {
+	if !c.Hosts.Register {
+		return ""
+	}
+	if c.Hosts.File != "" {
+		return c.Hosts.File
+	}
+	return DefaultHostsFile
+}
+
+// RegisterHost points the space's hostname at localhost in the hosts file if
+// hosts.register is set, replacing an earlier entry of the space. The default
+// /etc/hosts is usually only writable by root.
+func (c *Config) RegisterHost(space Space) error {
+	file := c.HostsFile()
+	if file == "" {
+		return nil
+	}
+	host, err := c.Hostname(space)
+	if err != nil {
+		return err
+	}
+	return updateHosts(file, space.Name, hostsAddress+"\t"+host+"\t"+hostsMarker+space.Name)
+}
+
+// UnregisterHost removes the space's entry from the hosts file if
+// hosts.register is set.
+func (c *Config) UnregisterHost(space Space) error {
+	file := c.HostsFile()
+	if file == "" {
+		return nil
+	}
+	return updateHosts(file, space.Name, "")
+}
+
+// updateHosts replaces the lines of the hosts file tagged with the named
+// space by entry, or removes them if entry is empty. The file is locked from
+// read to write, so concurrent updates keep each other's entries. It is
+// written in place, since its directory is often not writable: the new
+// content overwrites the old before the file is truncated to its length, so a
+// failed write never leaves the file empty. It is left alone when nothing
+// changes.
+func updateHosts(file, name, entry string) error {
+	flags := os.O_RDWR
+	if entry != "" {
+		flags |= os.O_CREATE
+	}
+	f, err := os.OpenFile(file, flags, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	if content := strings.TrimSuffix(string(data), "\n"); content != "" {
+		lines = strings.Split(content, "\n")
+	}
+	kept := make([]string, 0, len(lines)+1)
+	for _, line := range lines {
+		if !strings.HasSuffix(line, hostsMarker+name) {
+			kept = append(kept, line)
+		}
+	}
+	if entry != "" {
+		kept = append(kept, entry)
+	}
+	updated := ""
+	if len(kept) > 0 {
+		updated = strings.Join(kept, "\n") + "\n"
+	}
+	if updated == string(data) {
+		return nil
+	}
+	if _, err := f.WriteAt([]byte(updated), 0); err != nil {
+		return err
+	}
+	return f.Truncate(int64(len(updated)))
+}
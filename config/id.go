@@ -0,0 +1,107 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ID charsets, see IDs.
+const (
+	IDCharsetUnderscore = "underscore" // a-z, 0-9 and _, for database names and shell variables
+	IDCharsetDash       = "dash"       // a-z, 0-9 and -, for DNS labels and Kubernetes names
+	IDCharsetAlnum      = "alnum"      // a-z and 0-9 only
+)
+
+// idHashLength is the number of hex digits of the hash that ends IDs with
+// id.hash set or that were cut short.
+const idHashLength = 8
+
+// IDs configures how the ID of a space, exported to templates as space.ID,
+// is derived from its name. Without any of the fields set, the ID is the name
+// with hyphens replaced by underscores, which keeps other characters and can
+// make two names share an ID, e.g. foo-bar and foo_bar. With a charset, the
+// name is lowercased, runs of other characters become one separator, and an
+// ID starting with a digit gets an s in front.
+type IDs struct {
+	Charset   string `yaml:"charset,omitempty"`    // underscore, dash or alnum (default: underscore if MaxLength or Hash is set)
+	MaxLength int    `yaml:"max_length,omitempty"` // Longer IDs are cut short and end in a hash of the name, e.g. 63 for Kubernetes or PostgreSQL
+	Hash      bool   `yaml:"hash,omitempty"`       // End every ID in a hash of the name, so names that slug alike get different IDs
+}
+
+// SpaceID returns the ID of the named space.
+func (c *Config) SpaceID(name string) string {
+	return c.ID.id(name)
+}
+
+func (ids IDs) id(name string) string {
+	if ids.Charset == "" && ids.MaxLength <= 0 && !ids.Hash {
+		return strings.ReplaceAll(name, "-", "_")
+	}
+	sep := ids.separator()
+	id := slug(name, sep)
+	if id == "" || id[0] >= '0' && id[0] <= '9' {
+		id = "s" + sep + id
+		id = strings.TrimSuffix(id, sep)
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:idHashLength]
+	if ids.Hash {
+		id += sep + hash
+	}
+	if ids.MaxLength > 0 && len(id) > ids.MaxLength {
+		// The hash keeps names that share a long prefix apart
+		keep := max(ids.MaxLength-len(sep)-len(hash), 0)
+		id = strings.TrimSuffix(id[:keep], sep) + sep + hash
+		id = strings.TrimPrefix(id, sep)
+		if len(id) > ids.MaxLength {
+			id = id[len(id)-ids.MaxLength:]
+		}
+	}
+	return id
+}
+
+// separator returns the character replacing those outside the charset.
+func (ids IDs) separator() string {
+	switch ids.Charset {
+	case IDCharsetDash:
+		return "-"
+	case IDCharsetAlnum:
+		return ""
+	}
+	return "_"
+}
+
+// slug lowercases name and replaces each run of characters other than a-z
+// and 0-9 with sep, trimming it from the ends.
+func slug(name, sep string) string {
+	var b strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if pending && b.Len() > 0 {
+				b.WriteString(sep)
+			}
+			pending = false
+			b.WriteRune(r)
+		} else {
+			pending = true
+		}
+	}
+	return b.String()
+}
+
+// validate reports an unknown charset or a negative maximum length.
+func (ids IDs) validate() error {
+	switch ids.Charset {
+	case "", IDCharsetUnderscore, IDCharsetDash, IDCharsetAlnum:
+	default:
+		return fmt.Errorf("unknown id charset %q (expected %s, %s or %s)", ids.Charset, IDCharsetUnderscore, IDCharsetDash, IDCharsetAlnum)
+	}
+	if ids.MaxLength < 0 {
+		return fmt.Errorf("id max_length must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits caps how many spaces may be created and how much disk they may use,
+// so scripts and agents creating spaces in a loop can't fill the disk or the
+// port space. Zero values are unlimited.
+type Limits struct {
+	Spaces     int    `yaml:"spaces,omitempty"`      // Spaces in the dest dir
+	RepoSpaces int    `yaml:"repo_spaces,omitempty"` // Spaces of one repository
+	Disk       string `yaml:"disk,omitempty"`        // Disk used by the dest dir, e.g. 50G
+}
+
+// DiskBytes returns the disk limit in bytes, or 0 if none is set.
+func (l Limits) DiskBytes() (int64, error) {
+	if l.Disk == "" {
+		return 0, nil
+	}
+	size, err := ParseSize(l.Disk)
+	if err != nil {
+		return 0, fmt.Errorf("limits.disk: %w", err)
+	}
+	return size, nil
+}
+
+// sizeUnits are the suffixes accepted by ParseSize, in powers of 1024.
+var sizeUnits = map[string]int64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseSize parses a size such as 512M, 20G or 1.5T into bytes. Units are
+// powers of 1024 and may be followed by B or iB; a plain number is bytes.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "IB"), "B")
+	unit := ""
+	if n := len(value); n > 0 && strings.ContainsRune("KMGT", rune(value[n-1])) {
+		unit = value[n-1:]
+		value = strings.TrimSpace(value[:n-1])
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(sizeUnits[unit])), nil
+}
+
+// FormatSize formats bytes like ParseSize reads them, e.g. 1.5G.
+func FormatSize(bytes int64) string {
+	for _, unit := range []string{"T", "G", "M", "K"} {
+		if size := sizeUnits[unit]; bytes >= size {
+			value := strconv.FormatFloat(float64(bytes)/float64(size), 'f', 1, 64)
+			return strings.TrimSuffix(value, ".0") + unit
+		}
+	}
+	return strconv.FormatInt(bytes, 10) + "B"
+}
@@ -0,0 +1,20 @@
+package config
+
+import "log/slog"
+
+// logger, when set, receives the package's logs instead of slog.Default().
+var logger *slog.Logger
+
+// SetLogger sends the warnings of failed setup and on_create hooks, and the
+// commands hooks run at debug level, to l. Passing nil restores slog.Default().
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// log returns the logger of the package.
+func log() *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Log sources of a space. Each logs to its own file in the space's log dir.
+const (
+	LogSourceHook    = "hook"    // Hooks and setup installers
+	LogSourceService = "service" // Starting and stopping services
+	LogSourceTab     = "tab:"    // Prefix of the source of a tab with log set, e.g. tab:server
+)
+
+// MaxLogSize is the size beyond which a log is moved aside to <file>.1 when
+// a command next logs to it, replacing the previous one.
+const MaxLogSize = 1 << 20
+
+// logEchoInterval is how often output logged by a running command is copied
+// to the terminal.
+const logEchoInterval = 100 * time.Millisecond
+
+// LogFile returns the file the named source logs to in dir.
+func LogFile(dir, source string) string {
+	if tab, ok := strings.CutPrefix(source, LogSourceTab); ok {
+		return filepath.Join(dir, "tab-"+strings.ReplaceAll(tab, "/", "_")+".log")
+	}
+	return filepath.Join(dir, source+".log")
+}
+
+// LogSource returns the source logging to the named file, the reverse of
+// LogFile, or "" if the file isn't a log.
+func LogSource(file string) string {
+	name, ok := strings.CutSuffix(filepath.Base(file), ".log")
+	if !ok {
+		return ""
+	}
+	if tab, ok := strings.CutPrefix(name, "tab-"); ok {
+		return LogSourceTab + tab
+	}
+	if name == LogSourceHook || name == LogSourceService {
+		return name
+	}
+	return ""
+}
+
+// openLog opens the named source's log in dir for appending, first moving
+// it aside if it grew beyond MaxLogSize.
+func openLog(dir, source string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := LogFile(dir, source)
+	if info, err := os.Stat(path); err == nil && info.Size() > MaxLogSize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return nil, err
+		}
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+// runLogged runs a shell command like runCommand, appending its output to the
+// log of source in the space's log dir after a line with label. The command
+// writes to the log file itself rather than through a pipe, so processes it
+// leaves running in the background keep logging there and don't hold up
+// remux. While the command runs its output is also copied to stdout. Without
+// a log dir, or if the log can't be opened, the command writes to stdout and
+// stderr as usual.
+func runLogged(ctx context.Context, space Space, source, label, command string, env map[string]string) error {
+	if space.LogDir == "" {
+		return runCommand(ctx, command, space.Path, env)
+	}
+	f, err := openLog(space.LogDir, source)
+	if err != nil {
+		log().Warn("failed to open log", "source", source, "err", err)
+		return runCommand(ctx, command, space.Path, env)
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "--- %s %s\n", time.Now().Format(time.RFC3339), label)
+	stop := echoLog(f.Name(), os.Stdout)
+	err = runCommandOutput(ctx, command, space.Path, env, f, f)
+	stop()
+	if err != nil {
+		fmt.Fprintf(f, "--- failed: %v\n", err)
+	}
+	return err
+}
+
+// echoLog copies what is appended to the file from now on to w, until the
+// returned function is called. That function copies what is left and waits
+// for the copying to finish.
+func echoLog(path string, w io.Writer) func() {
+	f, err := os.Open(path)
+	if err != nil {
+		return func() {}
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer f.Close()
+		ticker := time.NewTicker(logEchoInterval)
+		defer ticker.Stop()
+		for {
+			_, _ = io.Copy(w, f)
+			select {
+			case <-done:
+				_, _ = io.Copy(w, f)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// New returns an empty config for building a config file programmatically,
+// e.g. in a repository scaffolder:
+//
+//	cfg := config.New().
+//		SetEnv("PORT", "{{ space.Port }}").
+//		AddTab(config.Tab{Name: "server", Cmd: "npm start"}).
+//		OnCreate("npm ci")
+//	err := cfg.Save(repoRoot)
+func New() *Config {
+	return &Config{}
+}
+
+// SetEnv sets an env var. The value may contain template expressions.
+func (c *Config) SetEnv(key, value string) *Config {
+	if c.Env == nil {
+		c.Env = make(map[string]string)
+	}
+	c.Env[key] = value
+	return c
+}
+
+// AddTab appends a tab.
+func (c *Config) AddTab(tab Tab) *Config {
+	c.Tabs = append(c.Tabs, tab)
+	return c
+}
+
+// OnCreate appends on_create hook commands.
+func (c *Config) OnCreate(cmds ...string) *Config {
+	c.Hooks.OnCreate = append(c.Hooks.OnCreate, cmds...)
+	return c
+}
+
+// OnOpen appends on_open hook commands.
+func (c *Config) OnOpen(cmds ...string) *Config {
+	c.Hooks.OnOpen = append(c.Hooks.OnOpen, cmds...)
+	return c
+}
+
+// OnDrop appends on_drop hook commands.
+func (c *Config) OnDrop(cmds ...string) *Config {
+	c.Hooks.OnDrop = append(c.Hooks.OnDrop, cmds...)
+	return c
+}
+
+// Parse reads a config from YAML.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Marshal returns the config as YAML in the layout of a config file. Unset
+// fields are left out.
+func (c *Config) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Validate checks the config like Validate checks config files: template
+// expressions that don't compile are reported as *ValidationError values
+// joined into one error, with lines referring to the output of Marshal.
+func (c *Config) Validate() error {
+	data, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	return errors.Join(validateFile(configFile, data)...)
+}
+
+// Save validates the config and writes it to the .remux.yaml file of the
+// workspace or repository at path, replacing any existing file.
+func (c *Config) Save(path string) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	data, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(path, configFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
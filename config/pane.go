@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Pane directions, see Pane.
+const (
+	PaneRight = "right"
+	PaneLeft  = "left"
+	PaneBelow = "below"
+	PaneAbove = "above"
+)
+
+// Pane is one pane of a tab split into several (tmux only). Each pane after
+// the first is split off the pane before it. A pane can be given as just its
+// command.
+type Pane struct {
+	Cmd       string `yaml:"cmd,omitempty"`       // Run in the pane before the tab's Cmd
+	Direction string `yaml:"direction,omitempty"` // right, left, below or above the pane before it (default: below)
+	Size      string `yaml:"size,omitempty"`      // Columns or lines, or a percentage such as 30% (default: half of the pane before it)
+}
+
+// UnmarshalYAML accepts a plain string as the pane's command.
+func (p *Pane) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		p.Cmd = node.Value
+		return nil
+	}
+	type plain Pane
+	return node.Decode((*plain)(p))
+}
+
+// MarshalYAML writes a pane with only a command as a plain string.
+func (p Pane) MarshalYAML() (any, error) {
+	if p.Direction == "" && p.Size == "" {
+		return p.Cmd, nil
+	}
+	type plain Pane
+	return plain(p), nil
+}
+
+// validate reports an unknown direction or a size that is neither a count
+// nor a percentage.
+func (p Pane) validate() error {
+	switch p.Direction {
+	case "", PaneRight, PaneLeft, PaneBelow, PaneAbove:
+	default:
+		return fmt.Errorf("unknown pane direction %q (expected %s, %s, %s or %s)", p.Direction, PaneRight, PaneLeft, PaneBelow, PaneAbove)
+	}
+	if p.Size == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(p.Size, "%"))
+	if err != nil || n <= 0 || strings.HasSuffix(p.Size, "%") && n >= 100 {
+		return fmt.Errorf("invalid pane size %q (expected a number of columns or lines, or a percentage such as 30%%)", p.Size)
+	}
+	return nil
+}
+
+// Arranged reports whether any of the tab's panes sets a direction or size.
+// Otherwise the panes are tiled.
+func (t Tab) Arranged() bool {
+	for _, pane := range t.Panes {
+		if pane.Direction != "" || pane.Size != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrTemplateNotFound is returned when no space template has the given name.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// SpaceTemplate is a preset for new spaces, such as "review" or "agent",
+// shared across repositories. Its config lies beneath the repository's config
+// files, which override it the same way .remux.local.yaml overrides
+// .remux.yaml.
+type SpaceTemplate struct {
+	Name   string `yaml:"-"`
+	Config `yaml:",inline"`
+
+	// Base is the branch new spaces start from unless one is given.
+	Base string `yaml:"base,omitempty"`
+}
+
+// TemplateDir returns the directory holding space templates,
+// $XDG_CONFIG_HOME/remux/templates or ~/.config/remux/templates.
+func TemplateDir() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "templates"), nil
+}
+
+// userConfigDir returns the directory holding the user's remux config,
+// $XDG_CONFIG_HOME/remux or ~/.config/remux.
+func userConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "remux"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "remux"), nil
+}
+
+// LoadTemplate reads the named template from <TemplateDir>/<name>.yaml.
+func LoadTemplate(name string) (*SpaceTemplate, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid template name %q", name)
+	}
+	dir, err := TemplateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, name+".yaml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s (looked for %s)", ErrTemplateNotFound, name, path)
+		}
+		return nil, err
+	}
+
+	tmpl := &SpaceTemplate{Name: name}
+	if err := yaml.Unmarshal(data, tmpl); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if tmpl.Preset != "" {
+		if _, err := Preset(tmpl.Preset); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return tmpl, nil
+}
+
+// ListTemplates returns the names of the templates in TemplateDir, sorted.
+func ListTemplates() ([]string, error) {
+	dir, err := TemplateDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range files {
+		if name, ok := strings.CutSuffix(f.Name(), ".yaml"); ok && !f.IsDir() {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Beneath returns cfg merged over the template's config, with the preset
+// either of them selects beneath both.
+func (t *SpaceTemplate) Beneath(cfg *Config) *Config {
+	merged := merge(&t.Config, cfg)
+	if expanded, err := expandPreset(merged); err == nil {
+		return expanded
+	}
+	// Unknown presets are rejected by Load and LoadTemplate
+	return merged
+}
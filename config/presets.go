@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// presets are the built-in configs for common stacks, selected with
+// preset: <name>. A preset lies beneath the config files, which override it
+// the same way they override a space template.
+var presets = map[string]string{
+	"go": `
+env:
+  PORT: "{{ space.Port }}"
+cache:
+  shared: [go]
+tabs:
+  - name: shell
+  - name: test
+    cmd: go test ./...
+`,
+	"node": `
+env:
+  PORT: "{{ space.Port }}"
+  NODE_ENV: development
+cache:
+  copy: [node_modules]
+  shared: [npm]
+tabs:
+  - name: shell
+  - name: server
+    cmd: npm run dev
+  - name: test
+    cmd: npm test -- --watch
+`,
+	"python": `
+env:
+  PORT: "{{ space.Port }}"
+  PYTHONDONTWRITEBYTECODE: "1"
+cache:
+  shared: [pip]
+tabs:
+  - name: shell
+  - name: repl
+    cmd: python3
+  - name: test
+    cmd: python3 -m pytest
+`,
+	"rails": `
+env:
+  PORT: "{{ space.Port }}"
+  RAILS_ENV: development
+cache:
+  copy: [node_modules, vendor/bundle]
+tabs:
+  - name: shell
+  - name: server
+    cmd: bin/rails server -p $PORT
+  - name: console
+    cmd: bin/rails console
+  - name: test
+    cmd: bin/rails test
+`,
+}
+
+// Presets returns the names of the built-in stack presets, sorted.
+func Presets() []string {
+	return slices.Sorted(maps.Keys(presets))
+}
+
+// Preset returns the config of the named built-in stack preset.
+func Preset(name string) (*Config, error) {
+	data, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q (expected one of %s)", name, strings.Join(Presets(), ", "))
+	}
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, fmt.Errorf("preset %s: %w", name, err)
+	}
+	return &cfg, nil
+}
+
+// expandPreset returns cfg merged over the preset it selects, if any.
+// Expanding a config twice gives the same result.
+func expandPreset(cfg *Config) (*Config, error) {
+	if cfg.Preset == "" {
+		return cfg, nil
+	}
+	preset, err := Preset(cfg.Preset)
+	if err != nil {
+		return nil, err
+	}
+	return merge(preset, cfg), nil
+}
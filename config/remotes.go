@@ -0,0 +1,10 @@
+package config
+
+// Remotes picks the git remotes of fork workflows, where branches start from
+// the repository contributed to, usually the upstream remote, and are pushed
+// to a fork, usually origin.
+type Remotes struct {
+	Base  string `yaml:"base,omitempty"`  // Remote new branches start from, e.g. upstream (default: local branches)
+	Push  string `yaml:"push,omitempty"`  // Remote new branches are pushed to, set as their pushRemote (default: git's choice)
+	Fetch bool   `yaml:"fetch,omitempty"` // Fetch the base remote before creating a space
+}
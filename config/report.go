@@ -0,0 +1,62 @@
+package config
+
+// Report configures the markdown summary of a space printed by `remux report`.
+type Report struct {
+	// Template replaces DefaultReportTemplate. Besides space.* and env.*, its
+	// expressions can use the parts of the summary as report.*, see ReportData.
+	Template string `yaml:"template,omitempty"`
+}
+
+// ReportData holds the parts of a space's summary. Parts that don't apply,
+// such as the pull request of a branch that was never pushed, are empty.
+type ReportData struct {
+	Branch      string
+	Base        string // Branch the space is compared against
+	Issue       string // URL of the linked issue
+	PullRequest string // URL of the open pull request
+	Commits     string // Markdown list of the commits since Base, oldest first
+	Stat        string // Diffstat of the changes since Base, including uncommitted ones
+	Note        string // The space's note
+}
+
+// DefaultReportTemplate is the report template used unless report.template is set.
+const DefaultReportTemplate = "## {{ report.Branch }}\n" +
+	"\n" +
+	"Base: `{{ report.Base }}`" +
+	`{{ report.Issue != "" ? "  \nIssue: " + report.Issue : "" }}` +
+	`{{ report.PullRequest != "" ? "  \nPull request: " + report.PullRequest : "" }}` + "\n" +
+	"\n" +
+	"### Commits\n" +
+	"\n" +
+	"{{ report.Commits }}\n" +
+	"\n" +
+	"### Changes\n" +
+	"\n" +
+	"```\n" +
+	"{{ report.Stat }}\n" +
+	"```\n" +
+	`{{ report.Note != "" ? "\n### Notes\n\n" + report.Note + "\n" : "" }}`
+
+// vars returns the report's template variables.
+func (d ReportData) vars() map[string]any {
+	return map[string]any{
+		"Branch":      d.Branch,
+		"Base":        d.Base,
+		"Issue":       d.Issue,
+		"PullRequest": d.PullRequest,
+		"Commits":     d.Commits,
+		"Stat":        d.Stat,
+		"Note":        d.Note,
+	}
+}
+
+// RenderReport evaluates the report template for the space.
+func (c *Config) RenderReport(space Space, data ReportData) (string, error) {
+	tmpl := c.Report.Template
+	if tmpl == "" {
+		tmpl = DefaultReportTemplate
+	}
+	env := newTemplateEnv(space)
+	env.report = data.vars()
+	return env.evaluate(tmpl)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// defaultComposeCommand runs compose files unless services.compose_command is set.
+const defaultComposeCommand = "docker compose"
+
+// Services configures the background services of a space, which
+// `remux hibernate` stops and `remux resume` starts again.
+type Services struct {
+	Compose        []string `yaml:"compose,omitempty"`         // Compose files, relative to the worktree, run with up -d and down
+	ComposeCommand string   `yaml:"compose_command,omitempty"` // Command running the compose files (default "docker compose"), e.g. podman compose
+	Systemd        []string `yaml:"systemd,omitempty"`         // systemd user units, e.g. app@{{ space.Name }}.service
+}
+
+// StartServices starts the space's compose services, then its systemd units,
+// with the space's env. Returns on the first failure.
+func (c *Config) StartServices(ctx context.Context, space Space) error {
+	return c.runServices(ctx, space, true)
+}
+
+// StopServices stops the space's systemd units, then its compose services,
+// with the space's env. Returns on the first failure.
+func (c *Config) StopServices(ctx context.Context, space Space) error {
+	return c.runServices(ctx, space, false)
+}
+
+func (c *Config) runServices(ctx context.Context, space Space, start bool) error {
+	tmpl := newTemplateEnv(space)
+	commands, err := c.Services.commands(tmpl, start, c.Docker.overrideFile())
+	if err != nil || len(commands) == 0 {
+		return err
+	}
+	env, err := c.commandEnv(tmpl)
+	if err != nil {
+		return fmt.Errorf("failed to resolve env: %w", err)
+	}
+	for _, command := range commands {
+		if err := runLogged(ctx, space, LogSourceService, command, command, env); err != nil {
+			return fmt.Errorf("%s: %w", command, err)
+		}
+	}
+	return nil
+}
+
+// commands returns the shell commands starting or stopping the services, in
+// the order they run. Compose files and unit names are evaluated as templates.
+// The compose override file, if not empty, is passed after the compose files,
+// since compose only reads it on its own when no files are given.
+func (s Services) commands(tmpl *templateEnv, start bool, override string) ([]string, error) {
+	var compose, systemd string
+	if len(s.Compose) > 0 {
+		compose = s.ComposeCommand
+		if compose == "" {
+			compose = defaultComposeCommand
+		}
+		for _, file := range s.Compose {
+			resolved, err := tmpl.evaluate(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate compose file: %w", err)
+			}
+			compose += " -f " + shellQuote(resolved)
+		}
+		if override != "" {
+			compose += " -f " + shellQuote(override)
+		}
+		if start {
+			compose += " up -d"
+		} else {
+			compose += " down"
+		}
+	}
+	if len(s.Systemd) > 0 {
+		systemd = "systemctl --user stop"
+		if start {
+			systemd = "systemctl --user start"
+		}
+		for _, unit := range s.Systemd {
+			resolved, err := tmpl.evaluate(unit)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate systemd unit: %w", err)
+			}
+			systemd += " " + shellQuote(resolved)
+		}
+	}
+
+	// Units may depend on the compose services, so they start last and stop first
+	var commands []string
+	order := []string{compose, systemd}
+	if !start {
+		order = []string{systemd, compose}
+	}
+	for _, command := range order {
+		if command != "" {
+			commands = append(commands, command)
+		}
+	}
+	return commands, nil
+}
+
+// shellQuote quotes s for use as a single sh argument.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
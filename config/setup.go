@@ -0,0 +1,78 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Installer installs a piece of project tooling in a fresh worktree.
+type Installer struct {
+	Name    string   // Used in setup.skip
+	Detect  []string // Installer runs if any of these paths exist in the worktree
+	Command string   // Shell command, its first word must be on PATH
+}
+
+// Installers are the built-in setup steps, in the order they run.
+// Dependencies are installed before the git hook managers that may need them.
+var Installers = []Installer{
+	{Name: "go", Detect: []string{"go.mod"}, Command: "go mod download"},
+	{Name: "npm", Detect: []string{"package-lock.json"}, Command: "npm ci"},
+	{Name: "pre-commit", Detect: []string{".pre-commit-config.yaml"}, Command: "pre-commit install"},
+	{Name: "husky", Detect: []string{".husky"}, Command: "npx --no-install husky"},
+	{Name: "lefthook", Detect: []string{"lefthook.yml", ".lefthook.yml", "lefthook.yaml"}, Command: "lefthook install"},
+}
+
+// DetectSetup returns the installers that apply to the worktree at path,
+// excluding skipped ones. Returns nil unless setup.auto is enabled.
+func (c *Config) DetectSetup(path string) []Installer {
+	if !c.Setup.Auto {
+		return nil
+	}
+
+	var result []Installer
+	for _, inst := range Installers {
+		if slices.Contains(c.Setup.Skip, inst.Name) {
+			continue
+		}
+		for _, name := range inst.Detect {
+			if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+				result = append(result, inst)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// RunSetup runs the detected installers in the space's worktree with the
+// space's env. Installers whose tool is missing are skipped. Logs warnings
+// on failure and continues with the next installer, like on_create hooks.
+func (c *Config) RunSetup(ctx context.Context, space Space) {
+	installers := c.DetectSetup(space.Path)
+	if len(installers) == 0 {
+		return
+	}
+	env, err := c.commandEnv(newTemplateEnv(space))
+	if err != nil {
+		log().Warn("setup failed to resolve env", "err", err)
+		return
+	}
+
+	for _, inst := range installers {
+		tool, _, _ := strings.Cut(inst.Command, " ")
+		if _, err := exec.LookPath(tool); err != nil {
+			log().Warn("skipping setup, tool not found", "installer", inst.Name, "tool", tool)
+			continue
+		}
+		if err := runLogged(ctx, space, LogSourceHook, "setup: "+inst.Command, inst.Command, env); err != nil {
+			log().Warn("setup failed", "installer", inst.Name, "command", inst.Command, "err", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -2,28 +2,128 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
 	"github.com/expr-lang/expr"
+	"github.com/johanhenriksson/remux/git"
 )
 
 var templatePattern = regexp.MustCompile(`\{\{\s*(.+?)\s*\}\}`)
 
+// envReference matches expressions that reference the env variable.
+var envReference = regexp.MustCompile(`\benv\b`)
+
+// remotesReference matches expressions that reference the remotes variable.
+var remotesReference = regexp.MustCompile(`\bremotes\b`)
+
+// spacesReference matches expressions that reference the spaces variable.
+var spacesReference = regexp.MustCompile(`\bspaces\b`)
+
+// urlReference matches expressions that reference space.URL.
+var urlReference = regexp.MustCompile(`\bURL\b`)
+
+// templateFuncs are the functions available to templates, in addition to
+// expr's builtins. join replaces the builtin joining arrays, which no
+// template variable is.
+var templateFuncs = map[string]any{
+	"join": filepath.Join, // join(space.RepoRoot, "scripts", "dev.sh")
+	"rel":  filepath.Rel,  // rel(space.RepoRoot, space.Path), fails if there is no relative path
+}
+
+// templateEnv holds the expression environment for one resolve pass.
+// The process environment, the remote URLs, the space URL and the other
+// spaces are only captured when an expression references them, and at most
+// once per pass.
+type templateEnv struct {
+	space   map[string]any
+	env     map[string]any
+	remotes map[string]any
+	report  map[string]any // Only set when rendering a report
+	branch  map[string]any // name and user, only set when naming a branch
+	url     func() string
+
+	spaces     map[string]any
+	listSpaces func() []Space
+}
+
+// newTemplateEnv creates the expression environment for the given space.
+func newTemplateEnv(space Space) *templateEnv {
+	return &templateEnv{
+		space:      spaceVars(space),
+		url:        space.URL,
+		listSpaces: space.Spaces,
+	}
+}
+
+// spaceVars returns the template variables of a space.
+func spaceVars(space Space) map[string]any {
+	return map[string]any{
+		"Name":     space.Name,
+		"Path":     space.Path,
+		"Port":     space.Port,
+		"ID":       space.ID,
+		"RepoRoot": space.RepoRoot,
+		"URL":      "",
+
+		"SessionName": space.SessionName,
+
+		"NvimSession":     space.NvimSession,
+		"Nvim":            space.Nvim,
+		"VSCodeWorkspace": space.VSCodeWorkspace,
+
+		"CertFile": space.CertFile,
+		"KeyFile":  space.KeyFile,
+
+		"Host": space.Host,
+	}
+}
+
+// vars returns the variables available to the given expression.
+func (t *templateEnv) vars(expression string) map[string]any {
+	vars := map[string]any{
+		"space": t.space,
+	}
+	maps.Copy(vars, templateFuncs)
+	if t.report != nil {
+		vars["report"] = t.report
+	}
+	maps.Copy(vars, t.branch)
+	if envReference.MatchString(expression) {
+		if t.env == nil {
+			t.env = getEnvMap()
+		}
+		vars["env"] = t.env
+	}
+	if remotesReference.MatchString(expression) {
+		if t.remotes == nil {
+			t.remotes = getRemotes(t.space["RepoRoot"].(string))
+		}
+		vars["remotes"] = t.remotes
+	}
+	if spacesReference.MatchString(expression) {
+		if t.spaces == nil {
+			t.spaces = getSpaces(t.listSpaces)
+		}
+		vars["spaces"] = t.spaces
+	}
+	if t.url != nil && urlReference.MatchString(expression) {
+		t.space["URL"] = t.url()
+		t.url = nil
+	}
+	return vars
+}
+
 // EvaluateTemplate evaluates all {{ expr }} patterns in the input string.
 func EvaluateTemplate(input string, space Space) (string, error) {
-	env := map[string]any{
-		"space": map[string]any{
-			"Name":     space.Name,
-			"Path":     space.Path,
-			"Port":     space.Port,
-			"ID":       space.ID,
-			"RepoRoot": space.RepoRoot,
-		},
-		"env": getEnvMap(),
-	}
+	return newTemplateEnv(space).evaluate(input)
+}
 
+// evaluate evaluates all {{ expr }} patterns in the input string.
+func (t *templateEnv) evaluate(input string) (string, error) {
 	var evalErr error
 	result := templatePattern.ReplaceAllStringFunc(input, func(match string) string {
 		if evalErr != nil {
@@ -36,15 +136,16 @@ func EvaluateTemplate(input string, space Space) (string, error) {
 			return match
 		}
 		expression := strings.TrimSpace(groups[1])
+		vars := t.vars(expression)
 
 		// Evaluate with expr-lang
-		program, err := expr.Compile(expression, expr.Env(env))
+		program, err := expr.Compile(expression, expr.Env(vars))
 		if err != nil {
 			evalErr = fmt.Errorf("invalid expression %q: %w", expression, err)
 			return match
 		}
 
-		output, err := expr.Run(program, env)
+		output, err := expr.Run(program, vars)
 		if err != nil {
 			evalErr = fmt.Errorf("failed to evaluate %q: %w", expression, err)
 			return match
@@ -59,6 +160,37 @@ func EvaluateTemplate(input string, space Space) (string, error) {
 	return result, nil
 }
 
+// getSpaces returns the variables of the spaces listed by list by name, or
+// none if list is nil. Their URLs are left empty.
+func getSpaces(list func() []Space) map[string]any {
+	result := make(map[string]any)
+	if list == nil {
+		return result
+	}
+	for _, space := range list() {
+		result[space.Name] = spaceVars(space)
+	}
+	return result
+}
+
+// getRemotes returns the URLs of the repository's remotes by name, or none
+// if they can't be listed.
+func getRemotes(repoRoot string) map[string]any {
+	result := make(map[string]any)
+	if repoRoot == "" {
+		return result
+	}
+	remotes, err := git.Remotes(repoRoot)
+	if err != nil {
+		log().Warn("failed to list remotes", "err", err)
+		return result
+	}
+	for name, url := range remotes {
+		result[name] = url
+	}
+	return result
+}
+
 // getEnvMap returns all environment variables as a map.
 func getEnvMap() map[string]any {
 	result := make(map[string]any)
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlLine matches the line prefix yaml.v3 puts on its error messages.
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// ValidationError describes a single problem found in a config file.
+type ValidationError struct {
+	File    string
+	Line    int // 0 if unknown
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Message)
+}
+
+// Validate strictly checks the config files in the workspace directory.
+// Unknown keys, values of the wrong type and template expressions that don't
+// compile are reported as *ValidationError values joined into one error.
+// Missing config files are not an error.
+func Validate(workspacePath string) error {
+	var errs []error
+	for _, name := range []string{configFile, LocalConfigFile} {
+		path := filepath.Join(workspacePath, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		errs = append(errs, validateFile(path, data)...)
+	}
+	return errors.Join(errs...)
+}
+
+// validateFile strictly decodes a single config file and checks its expressions.
+func validateFile(path string, data []byte) []error {
+	var errs []error
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			for _, msg := range typeErr.Errors {
+				errs = append(errs, yamlError(path, msg))
+			}
+		} else {
+			// Syntax errors leave nothing to check expressions in
+			return []error{yamlError(path, err.Error())}
+		}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err == nil {
+		errs = append(errs, checkExpressions(path, &root)...)
+		errs = append(errs, checkPreset(path, &root)...)
+		errs = append(errs, checkIDs(path, &root, cfg.ID)...)
+		errs = append(errs, checkPanes(path, &root)...)
+		errs = append(errs, checkCommands(path, &root)...)
+	}
+
+	slices.SortStableFunc(errs, func(a, b error) int {
+		return a.(*ValidationError).Line - b.(*ValidationError).Line
+	})
+	return errs
+}
+
+// yamlError converts a yaml.v3 error message into a ValidationError.
+func yamlError(path, msg string) error {
+	if m := yamlLine.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &ValidationError{File: path, Line: line, Message: m[2]}
+	}
+	return &ValidationError{File: path, Message: strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// checkExpressions compiles every template expression in the scalar values under node.
+func checkExpressions(path string, node *yaml.Node) []error {
+	var errs []error
+	if node.Kind == yaml.ScalarNode {
+		for _, groups := range templatePattern.FindAllStringSubmatch(node.Value, -1) {
+			expression := strings.TrimSpace(groups[1])
+			if _, err := expr.Compile(expression, expr.Env(checkVars)); err != nil {
+				// expr appends a source excerpt on further lines; keep the summary
+				msg, _, _ := strings.Cut(err.Error(), "\n")
+				errs = append(errs, &ValidationError{
+					File:    path,
+					Line:    node.Line,
+					Message: fmt.Sprintf("invalid expression %q: %s", expression, msg),
+				})
+			}
+		}
+	}
+	for _, child := range node.Content {
+		errs = append(errs, checkExpressions(path, child)...)
+	}
+	return errs
+}
+
+// checkPreset reports a preset key naming no built-in preset in the
+// document node.
+func checkPreset(path string, doc *yaml.Node) []error {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value != "preset" || value.Value == "" {
+			continue
+		}
+		if _, err := Preset(value.Value); err != nil {
+			return []error{&ValidationError{File: path, Line: value.Line, Message: err.Error()}}
+		}
+	}
+	return nil
+}
+
+// checkIDs reports id options that make no sense, at the line of the id key
+// in the document node.
+func checkIDs(path string, doc *yaml.Node, ids IDs) []error {
+	err := ids.validate()
+	if err == nil || len(doc.Content) == 0 {
+		return nil
+	}
+	line := 0
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "id" {
+			line = root.Content[i].Line
+		}
+	}
+	return []error{&ValidationError{File: path, Line: line, Message: err.Error()}}
+}
+
+// paneKeys are the keys of a pane given as a mapping.
+var paneKeys = []string{"cmd", "direction", "size"}
+
+// checkPanes reports unknown keys, directions and sizes of the tab panes in
+// the document node. Panes decode themselves, so the strict decoder doesn't
+// see their keys.
+func checkPanes(path string, doc *yaml.Node) []error {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	var errs []error
+	for _, tab := range keyValue(doc.Content[0], "tabs").Content {
+		for _, node := range keyValue(tab, "panes").Content {
+			if node.Kind != yaml.MappingNode {
+				continue
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if key := node.Content[i]; !slices.Contains(paneKeys, key.Value) {
+					errs = append(errs, &ValidationError{File: path, Line: key.Line, Message: fmt.Sprintf("unknown pane key %q", key.Value)})
+				}
+			}
+			var pane Pane
+			if err := node.Decode(&pane); err != nil {
+				continue // reported by the strict decoder
+			}
+			if err := pane.validate(); err != nil {
+				errs = append(errs, &ValidationError{File: path, Line: node.Line, Message: err.Error()})
+			}
+		}
+	}
+	return errs
+}
+
+// commandKeys are the keys of a command given as a mapping.
+var commandKeys = []string{"run", "env", "tab", "background", "session"}
+
+// checkCommands reports unknown keys and impossible options of the commands
+// in the document node. Like panes, commands decode themselves.
+func checkCommands(path string, doc *yaml.Node) []error {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	var errs []error
+	commands := keyValue(doc.Content[0], "commands")
+	for i := 0; i+1 < len(commands.Content); i += 2 {
+		name, node := commands.Content[i], commands.Content[i+1]
+		if node.Kind == yaml.MappingNode {
+			for j := 0; j+1 < len(node.Content); j += 2 {
+				if key := node.Content[j]; !slices.Contains(commandKeys, key.Value) {
+					errs = append(errs, &ValidationError{File: path, Line: key.Line, Message: fmt.Sprintf("unknown key %q in command %s", key.Value, name.Value)})
+				}
+			}
+		}
+		var command Command
+		if err := node.Decode(&command); err != nil {
+			continue // reported by the strict decoder
+		}
+		if err := command.validate(); err != nil {
+			errs = append(errs, &ValidationError{File: path, Line: name.Line, Message: fmt.Sprintf("%s: %s", name.Value, err)})
+		}
+	}
+	return errs
+}
+
+// keyValue returns the value of key in a mapping node of any kind, or an
+// empty node if node isn't a mapping or has no such key.
+func keyValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	}
+	return &yaml.Node{}
+}
+
+// checkVars mirrors the variables available to templates, for compile checks.
+var checkVars = map[string]any{
+	"space":   newTemplateEnv(Space{}).space,
+	"env":     map[string]any{},
+	"remotes": map[string]any{},
+	"spaces":  map[string]any{},
+	"report":  ReportData{}.vars(),
+	"name":    "",
+	"user":    "",
+	"join":    templateFuncs["join"],
+	"rel":     templateFuncs["rel"],
+}
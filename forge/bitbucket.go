@@ -0,0 +1,143 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// Bitbucket Cloud API and web base URLs.
+const (
+	bitbucketAPI = "https://api.bitbucket.org/2.0"
+	bitbucketWeb = "https://bitbucket.org"
+)
+
+// Bitbucket talks to the Bitbucket Cloud REST API. The token is read from BITBUCKET_TOKEN.
+type Bitbucket struct {
+	client restClient
+	repo   string // workspace/repo
+}
+
+// NewBitbucket returns a Bitbucket client for the repository at path.
+func NewBitbucket(path string) *Bitbucket {
+	return &Bitbucket{
+		client: restClient{base: bitbucketAPI, token: os.Getenv("BITBUCKET_TOKEN")},
+		repo:   path,
+	}
+}
+
+// Name returns "bitbucket".
+func (b *Bitbucket) Name() string { return "bitbucket" }
+
+// RepoURL returns the web URL of the repository.
+func (b *Bitbucket) RepoURL() string { return bitbucketWeb + "/" + b.repo }
+
+// BranchURL returns the source view of a branch.
+func (b *Bitbucket) BranchURL(branch string) string { return b.RepoURL() + "/src/" + branch }
+
+type bitbucketLinks struct {
+	HTML struct {
+		Href string `json:"href"`
+	} `json:"html"`
+}
+
+type bitbucketPR struct {
+	ID     int            `json:"id"`
+	Title  string         `json:"title"`
+	State  string         `json:"state"`
+	Links  bitbucketLinks `json:"links"`
+	Source struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+	} `json:"source"`
+}
+
+func (pr bitbucketPR) pullRequest() *PullRequest {
+	return &PullRequest{Number: pr.ID, Title: pr.Title, URL: pr.Links.HTML.Href, Branch: pr.Source.Branch.Name, State: pr.State}
+}
+
+// IssueInfo fetches an issue from the repository's issue tracker.
+func (b *Bitbucket) IssueInfo(ctx context.Context, number int) (*Issue, error) {
+	var issue struct {
+		ID    int            `json:"id"`
+		Title string         `json:"title"`
+		Links bitbucketLinks `json:"links"`
+	}
+	if err := b.client.get(ctx, fmt.Sprintf("/repositories/%s/issues/%d", b.repo, number), &issue); err != nil {
+		return nil, fmt.Errorf("failed to fetch issue #%d: %w", number, err)
+	}
+	return &Issue{Number: issue.ID, Title: issue.Title, URL: issue.Links.HTML.Href}, nil
+}
+
+// CommentIssue posts a comment on an issue.
+func (b *Bitbucket) CommentIssue(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("/repositories/%s/issues/%d/comments", b.repo, number)
+	content := map[string]any{"content": map[string]string{"raw": body}}
+	if err := b.client.post(ctx, path, content, nil); err != nil {
+		return fmt.Errorf("failed to comment on issue #%d: %w", number, err)
+	}
+	return nil
+}
+
+// ResolvePR finds the open pull request for branch.
+func (b *Bitbucket) ResolvePR(ctx context.Context, branch string) (*PullRequest, error) {
+	var page struct {
+		Values []bitbucketPR `json:"values"`
+	}
+	query := url.QueryEscape(fmt.Sprintf(`source.branch.name="%s" AND state="OPEN"`, branch))
+	if err := b.client.get(ctx, fmt.Sprintf("/repositories/%s/pullrequests?q=%s", b.repo, query), &page); err != nil {
+		return nil, fmt.Errorf("failed to find pull request for %s: %w", branch, err)
+	}
+	if len(page.Values) == 0 {
+		return nil, fmt.Errorf("%w: pull request for %s", ErrNotFound, branch)
+	}
+	return page.Values[0].pullRequest(), nil
+}
+
+// CreatePR opens a pull request.
+func (b *Bitbucket) CreatePR(ctx context.Context, opts CreatePROptions) (*PullRequest, error) {
+	body := map[string]any{
+		"title":       opts.Title,
+		"description": opts.Body,
+		"source":      map[string]any{"branch": map[string]string{"name": opts.Branch}},
+		"destination": map[string]any{"branch": map[string]string{"name": opts.Base}},
+	}
+	var pr bitbucketPR
+	if err := b.client.post(ctx, fmt.Sprintf("/repositories/%s/pullrequests", b.repo), body, &pr); err != nil {
+		return nil, fmt.Errorf("failed to create pull request: %w", err)
+	}
+	return pr.pullRequest(), nil
+}
+
+// CIStatus combines the build statuses of a commit.
+func (b *Bitbucket) CIStatus(ctx context.Context, commit string) (*CIStatus, error) {
+	var page struct {
+		Values []struct {
+			State string `json:"state"`
+			URL   string `json:"url"`
+		} `json:"values"`
+	}
+	if err := b.client.get(ctx, fmt.Sprintf("/repositories/%s/commit/%s/statuses", b.repo, commit), &page); err != nil {
+		return nil, fmt.Errorf("failed to fetch statuses of %s: %w", commit, err)
+	}
+
+	status := &CIStatus{}
+	states := make([]CIState, len(page.Values))
+	for i, v := range page.Values {
+		switch v.State {
+		case "SUCCESSFUL":
+			states[i] = CISuccess
+		case "INPROGRESS":
+			states[i] = CIPending
+		default:
+			states[i] = CIFailure
+		}
+		if status.URL == "" || states[i] == CIFailure {
+			status.URL = v.URL
+		}
+	}
+	status.State = combine(states)
+	return status, nil
+}
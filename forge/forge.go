@@ -0,0 +1,199 @@
+// Package forge abstracts the code hosting service (GitHub, GitLab, Gitea,
+// Bitbucket) behind a common interface for issues, pull requests and CI status.
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/git"
+)
+
+var (
+	// ErrUnknownForge is returned when the forge can't be detected from the remote URL.
+	ErrUnknownForge = errors.New("unknown forge, set forge.type in .remux.yaml")
+	// ErrNotFound is returned when an issue or pull request doesn't exist.
+	ErrNotFound = errors.New("not found")
+)
+
+// Issue is an issue on a forge.
+type Issue struct {
+	Number int
+	Title  string
+	URL    string
+}
+
+// PullRequest is a pull or merge request on a forge.
+type PullRequest struct {
+	Number int
+	Title  string
+	URL    string
+	Branch string // Source branch
+	State  string // Forge-specific state, e.g. "open" or "OPEN"
+}
+
+// CreatePROptions contains the parameters for opening a pull request.
+type CreatePROptions struct {
+	Branch string // Source branch, must be pushed
+	Base   string // Target branch
+	Title  string
+	Body   string
+}
+
+// CIState is the combined state of the CI checks of a commit.
+type CIState string
+
+const (
+	CIUnknown CIState = "unknown" // No checks reported
+	CIPending CIState = "pending"
+	CISuccess CIState = "success"
+	CIFailure CIState = "failure"
+)
+
+// Done reports whether all checks have finished.
+func (s CIState) Done() bool {
+	return s == CISuccess || s == CIFailure
+}
+
+// CIStatus is the combined CI status of a commit.
+type CIStatus struct {
+	State CIState `yaml:"state" json:"state"`
+	URL   string  `yaml:"url,omitempty" json:"url,omitempty"` // Link to the checks, if the forge provides one
+}
+
+// Forge is a code hosting service.
+type Forge interface {
+	// Name returns the forge type, e.g. "github".
+	Name() string
+	// RepoURL returns the web URL of the repository.
+	RepoURL() string
+	// BranchURL returns the web URL of a branch. The branch is not checked to exist.
+	BranchURL(branch string) string
+	// IssueInfo fetches an issue by number.
+	IssueInfo(ctx context.Context, number int) (*Issue, error)
+	// CommentIssue posts a comment on an issue.
+	CommentIssue(ctx context.Context, number int, body string) error
+	// ResolvePR returns the open pull request for a branch, or ErrNotFound.
+	ResolvePR(ctx context.Context, branch string) (*PullRequest, error)
+	// CreatePR opens a pull request.
+	CreatePR(ctx context.Context, opts CreatePROptions) (*PullRequest, error)
+	// CIStatus returns the combined CI status of a commit.
+	CIStatus(ctx context.Context, commit string) (*CIStatus, error)
+}
+
+// Remote is a parsed git remote URL.
+type Remote struct {
+	Scheme string // https or http; ssh remotes use https
+	Host   string // Includes the port of http(s) remotes
+	Path   string // e.g. owner/repo, without .git
+}
+
+// scpRemote matches scp-like remotes such as git@github.com:owner/repo.git.
+var scpRemote = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// ParseRemote parses https, ssh and scp-like git remote URLs.
+func ParseRemote(raw string) (Remote, error) {
+	var r Remote
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		r = Remote{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+		if r.Scheme != "http" && r.Scheme != "https" {
+			// The port of an ssh remote is not the web port
+			r = Remote{Scheme: "https", Host: u.Hostname(), Path: u.Path}
+		}
+	} else if m := scpRemote.FindStringSubmatch(raw); m != nil {
+		r = Remote{Scheme: "https", Host: m[1], Path: m[2]}
+	} else {
+		return Remote{}, fmt.Errorf("unsupported remote url %q", raw)
+	}
+
+	r.Path = strings.TrimSuffix(strings.Trim(r.Path, "/"), ".git")
+	if r.Path == "" {
+		return Remote{}, fmt.Errorf("remote url %q has no repository path", raw)
+	}
+	return r, nil
+}
+
+// detectType guesses the forge type from the remote host.
+func detectType(host string) string {
+	switch {
+	case strings.Contains(host, "github"):
+		return "github"
+	case strings.Contains(host, "gitlab"):
+		return "gitlab"
+	case strings.Contains(host, "bitbucket"):
+		return "bitbucket"
+	case strings.Contains(host, "gitea"), host == "codeberg.org":
+		return "gitea"
+	}
+	return ""
+}
+
+// Open returns the forge of the repository at repoRoot, chosen by the forge
+// section of its config or detected from the origin remote.
+func Open(repoRoot string) (Forge, error) {
+	cfg, err := config.Load(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	rawURL, err := git.RemoteURL(repoRoot, "origin")
+	if err != nil {
+		return nil, err
+	}
+	remote, err := ParseRemote(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg.Forge, remote, repoRoot)
+}
+
+// New returns the forge for the given config and remote. The type is detected
+// from the remote host unless set in cfg.
+func New(cfg config.Forge, remote Remote, repoRoot string) (Forge, error) {
+	kind := cfg.Type
+	if kind == "" {
+		kind = detectType(remote.Host)
+	}
+
+	web := strings.TrimSuffix(cfg.URL, "/")
+	if web == "" {
+		web = remote.Scheme + "://" + remote.Host
+	}
+
+	switch kind {
+	case "github":
+		return &GitHub{RepoRoot: repoRoot, URL: web + "/" + remote.Path}, nil
+	case "gitlab":
+		return NewGitLab(web, remote.Path), nil
+	case "gitea":
+		return NewGitea(web, remote.Path), nil
+	case "bitbucket":
+		return NewBitbucket(remote.Path), nil
+	case "":
+		return nil, fmt.Errorf("%w: %s", ErrUnknownForge, remote.Host)
+	}
+	return nil, fmt.Errorf("unsupported forge type %q (expected github, gitlab, gitea or bitbucket)", kind)
+}
+
+// combine folds individual check states into one: any failure fails, then
+// any pending check keeps the result pending.
+func combine(states []CIState) CIState {
+	if len(states) == 0 {
+		return CIUnknown
+	}
+	result := CISuccess
+	for _, s := range states {
+		switch s {
+		case CIFailure:
+			return CIFailure
+		case CIPending, CIUnknown:
+			result = CIPending
+		}
+	}
+	return result
+}
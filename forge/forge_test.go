@@ -0,0 +1,190 @@
+package forge_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/forge"
+)
+
+// fakeGH installs a gh script on PATH that runs the given shell body.
+func fakeGH(body string) string {
+	dir := GinkgoT().TempDir()
+	script := "#!/bin/sh\n" + body + "\n"
+	Expect(os.WriteFile(filepath.Join(dir, "gh"), []byte(script), 0755)).To(Succeed())
+	GinkgoT().Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+var _ = Describe("Forge", func() {
+	Describe("ParseRemote", func() {
+		DescribeTable("parses remote urls",
+			func(raw string, expected forge.Remote) {
+				remote, err := forge.ParseRemote(raw)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(remote).To(Equal(expected))
+			},
+			Entry("https", "https://github.com/o/r.git", forge.Remote{Scheme: "https", Host: "github.com", Path: "o/r"}),
+			Entry("http with port", "http://git.local:3000/o/r", forge.Remote{Scheme: "http", Host: "git.local:3000", Path: "o/r"}),
+			Entry("ssh", "ssh://git@gitlab.com:2222/group/sub/r.git", forge.Remote{Scheme: "https", Host: "gitlab.com", Path: "group/sub/r"}),
+			Entry("scp-like", "git@bitbucket.org:ws/r.git", forge.Remote{Scheme: "https", Host: "bitbucket.org", Path: "ws/r"}),
+		)
+
+		It("rejects urls without a repository path", func() {
+			_, err := forge.ParseRemote("https://github.com/")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("New", func() {
+		DescribeTable("detects the forge from the remote host",
+			func(host, expected string) {
+				f, err := forge.New(config.Forge{}, forge.Remote{Scheme: "https", Host: host, Path: "o/r"}, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f.Name()).To(Equal(expected))
+			},
+			Entry("github", "github.com", "github"),
+			Entry("gitlab", "gitlab.example.com", "gitlab"),
+			Entry("bitbucket", "bitbucket.org", "bitbucket"),
+			Entry("codeberg", "codeberg.org", "gitea"),
+		)
+
+		DescribeTable("builds web urls",
+			func(cfg config.Forge, host, repo, branch string) {
+				f, err := forge.New(cfg, forge.Remote{Scheme: "https", Host: host, Path: "o/r"}, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f.RepoURL()).To(Equal(repo))
+				Expect(f.BranchURL("feat/x")).To(Equal(branch))
+			},
+			Entry("github", config.Forge{}, "github.com", "https://github.com/o/r", "https://github.com/o/r/tree/feat/x"),
+			Entry("gitlab", config.Forge{}, "gitlab.com", "https://gitlab.com/o/r", "https://gitlab.com/o/r/-/tree/feat/x"),
+			Entry("gitea", config.Forge{Type: "gitea", URL: "https://git.example.com/"}, "ssh.example.com", "https://git.example.com/o/r", "https://git.example.com/o/r/src/branch/feat/x"),
+			Entry("bitbucket", config.Forge{}, "bitbucket.org", "https://bitbucket.org/o/r", "https://bitbucket.org/o/r/src/feat/x"),
+		)
+
+		It("prefers the configured type", func() {
+			f, err := forge.New(config.Forge{Type: "gitea"}, forge.Remote{Scheme: "https", Host: "git.example.com", Path: "o/r"}, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Name()).To(Equal("gitea"))
+		})
+
+		It("returns ErrUnknownForge for unknown hosts", func() {
+			_, err := forge.New(config.Forge{}, forge.Remote{Scheme: "https", Host: "git.example.com", Path: "o/r"}, "")
+			Expect(err).To(MatchError(forge.ErrUnknownForge))
+		})
+
+		It("rejects unsupported types", func() {
+			_, err := forge.New(config.Forge{Type: "svn"}, forge.Remote{Scheme: "https", Host: "git.example.com", Path: "o/r"}, "")
+			Expect(err).To(MatchError(ContainSubstring("unsupported forge type")))
+		})
+	})
+
+	Describe("GitHub", func() {
+		var gh *forge.GitHub
+
+		BeforeEach(func() {
+			gh = &forge.GitHub{RepoRoot: GinkgoT().TempDir()}
+		})
+
+		It("parses the issue", func() {
+			fakeGH(`echo '{"number":42,"title":"Fix login crash","url":"https://github.com/o/r/issues/42"}'`)
+
+			issue, err := gh.IssueInfo(context.Background(), 42)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(issue).To(Equal(&forge.Issue{Number: 42, Title: "Fix login crash", URL: "https://github.com/o/r/issues/42"}))
+		})
+
+		It("includes gh's error message", func() {
+			fakeGH(`echo "could not resolve to an issue" >&2; exit 1`)
+
+			_, err := gh.IssueInfo(context.Background(), 7)
+			Expect(err).To(MatchError(ContainSubstring("could not resolve to an issue")))
+		})
+
+		It("returns ErrNoCLI without gh", func() {
+			GinkgoT().Setenv("PATH", GinkgoT().TempDir())
+
+			_, err := gh.IssueInfo(context.Background(), 1)
+			Expect(err).To(MatchError(forge.ErrNoCLI))
+		})
+
+		It("passes the comment body to gh", func() {
+			dir := fakeGH(`echo "$@" > "$(dirname "$0")/args"`)
+
+			Expect(gh.CommentIssue(context.Background(), 42, "hello")).To(Succeed())
+
+			args, err := os.ReadFile(filepath.Join(dir, "args"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(args)).To(Equal("issue comment 42 --body hello\n"))
+		})
+
+		It("returns ErrNotFound when no pull request is open", func() {
+			fakeGH(`echo '[]'`)
+
+			_, err := gh.ResolvePR(context.Background(), "feature")
+			Expect(err).To(MatchError(forge.ErrNotFound))
+		})
+
+		It("combines check runs", func() {
+			fakeGH(`echo '{"check_runs":[{"status":"completed","conclusion":"success"},{"status":"in_progress","html_url":"https://ci/2"}]}'`)
+
+			status, err := gh.CIStatus(context.Background(), "abc123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.State).To(Equal(forge.CIPending))
+		})
+	})
+
+	Describe("Gitea", func() {
+		var (
+			server *httptest.Server
+			gitea  forge.Forge
+		)
+
+		BeforeEach(func() {
+			GinkgoT().Setenv("GITEA_TOKEN", "secret")
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /api/v1/repos/o/r/issues/42", func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Header.Get("Authorization")).To(Equal("Bearer secret"))
+				json.NewEncoder(w).Encode(map[string]any{"number": 42, "title": "Fix login crash", "html_url": "https://git/o/r/issues/42"})
+			})
+			mux.HandleFunc("GET /api/v1/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode([]map[string]any{
+					{"number": 1, "title": "Other", "head": map[string]string{"ref": "other"}},
+					{"number": 2, "title": "Feature", "state": "open", "head": map[string]string{"ref": "feature"}},
+				})
+			})
+			server = httptest.NewServer(mux)
+			DeferCleanup(server.Close)
+
+			var err error
+			gitea, err = forge.New(config.Forge{Type: "gitea", URL: server.URL + "/"}, forge.Remote{Scheme: "https", Host: "git.example.com", Path: "o/r"}, "")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("fetches issues from the configured url", func() {
+			issue, err := gitea.IssueInfo(context.Background(), 42)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(issue).To(Equal(&forge.Issue{Number: 42, Title: "Fix login crash", URL: "https://git/o/r/issues/42"}))
+		})
+
+		It("returns ErrNotFound for missing issues", func() {
+			_, err := gitea.IssueInfo(context.Background(), 7)
+			Expect(err).To(MatchError(forge.ErrNotFound))
+		})
+
+		It("resolves the pull request of a branch", func() {
+			pr, err := gitea.ResolvePR(context.Background(), "feature")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pr.Number).To(Equal(2))
+			Expect(pr.Branch).To(Equal("feature"))
+		})
+	})
+})
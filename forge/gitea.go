@@ -0,0 +1,124 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Gitea talks to the Gitea (and Forgejo) REST API. The token is read from GITEA_TOKEN.
+type Gitea struct {
+	client restClient
+	repo   string // owner/repo
+	web    string // Web URL of the repository
+}
+
+// NewGitea returns a Gitea client for the repository at path on the instance at web.
+func NewGitea(web, path string) *Gitea {
+	return &Gitea{
+		client: restClient{base: web + "/api/v1", token: os.Getenv("GITEA_TOKEN")},
+		repo:   path,
+		web:    web + "/" + path,
+	}
+}
+
+// Name returns "gitea".
+func (g *Gitea) Name() string { return "gitea" }
+
+// RepoURL returns the web URL of the repository.
+func (g *Gitea) RepoURL() string { return g.web }
+
+// BranchURL returns the source view of a branch.
+func (g *Gitea) BranchURL(branch string) string { return g.web + "/src/branch/" + branch }
+
+type giteaPR struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+func (pr giteaPR) pullRequest() *PullRequest {
+	return &PullRequest{Number: pr.Number, Title: pr.Title, URL: pr.HTMLURL, Branch: pr.Head.Ref, State: pr.State}
+}
+
+// IssueInfo fetches an issue by number.
+func (g *Gitea) IssueInfo(ctx context.Context, number int) (*Issue, error) {
+	var issue struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := g.client.get(ctx, fmt.Sprintf("/repos/%s/issues/%d", g.repo, number), &issue); err != nil {
+		return nil, fmt.Errorf("failed to fetch issue #%d: %w", number, err)
+	}
+	return &Issue{Number: issue.Number, Title: issue.Title, URL: issue.HTMLURL}, nil
+}
+
+// CommentIssue posts a comment on an issue.
+func (g *Gitea) CommentIssue(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments", g.repo, number)
+	if err := g.client.post(ctx, path, map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("failed to comment on issue #%d: %w", number, err)
+	}
+	return nil
+}
+
+// ResolvePR finds the open pull request for branch.
+func (g *Gitea) ResolvePR(ctx context.Context, branch string) (*PullRequest, error) {
+	var prs []giteaPR
+	if err := g.client.get(ctx, fmt.Sprintf("/repos/%s/pulls?state=open", g.repo), &prs); err != nil {
+		return nil, fmt.Errorf("failed to find pull request for %s: %w", branch, err)
+	}
+	for _, pr := range prs {
+		if pr.Head.Ref == branch {
+			return pr.pullRequest(), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: pull request for %s", ErrNotFound, branch)
+}
+
+// CreatePR opens a pull request.
+func (g *Gitea) CreatePR(ctx context.Context, opts CreatePROptions) (*PullRequest, error) {
+	body := map[string]string{
+		"head":  opts.Branch,
+		"base":  opts.Base,
+		"title": opts.Title,
+		"body":  opts.Body,
+	}
+	var pr giteaPR
+	if err := g.client.post(ctx, fmt.Sprintf("/repos/%s/pulls", g.repo), body, &pr); err != nil {
+		return nil, fmt.Errorf("failed to create pull request: %w", err)
+	}
+	return pr.pullRequest(), nil
+}
+
+// CIStatus returns the combined commit status of a commit.
+func (g *Gitea) CIStatus(ctx context.Context, commit string) (*CIStatus, error) {
+	var status struct {
+		State    string `json:"state"`
+		Statuses []struct {
+			TargetURL string `json:"target_url"`
+		} `json:"statuses"`
+	}
+	if err := g.client.get(ctx, fmt.Sprintf("/repos/%s/commits/%s/status", g.repo, commit), &status); err != nil {
+		return nil, fmt.Errorf("failed to fetch status of %s: %w", commit, err)
+	}
+
+	result := &CIStatus{State: CIUnknown}
+	if len(status.Statuses) > 0 {
+		result.URL = status.Statuses[0].TargetURL
+		switch status.State {
+		case "success":
+			result.State = CISuccess
+		case "pending", "warning":
+			result.State = CIPending
+		default:
+			result.State = CIFailure
+		}
+	}
+	return result, nil
+}
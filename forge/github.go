@@ -0,0 +1,147 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrNoCLI is returned when the gh CLI is not installed.
+var ErrNoCLI = errors.New("gh CLI not found (https://cli.github.com)")
+
+// GitHub talks to GitHub through the gh CLI, which handles authentication
+// and GitHub Enterprise hosts.
+type GitHub struct {
+	RepoRoot string // gh resolves the repository from this checkout
+	URL      string // Web URL of the repository
+}
+
+// Name returns "github".
+func (g *GitHub) Name() string { return "github" }
+
+// RepoURL returns the web URL of the repository.
+func (g *GitHub) RepoURL() string { return g.URL }
+
+// BranchURL returns the tree view of a branch.
+func (g *GitHub) BranchURL(branch string) string { return g.URL + "/tree/" + branch }
+
+// IssueInfo fetches an issue with gh issue view.
+func (g *GitHub) IssueInfo(ctx context.Context, number int) (*Issue, error) {
+	var issue struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+		URL    string `json:"url"`
+	}
+	if err := g.json(ctx, &issue, "issue", "view", strconv.Itoa(number), "--json", "number,title,url"); err != nil {
+		return nil, fmt.Errorf("failed to fetch issue #%d: %w", number, err)
+	}
+	return &Issue{Number: issue.Number, Title: issue.Title, URL: issue.URL}, nil
+}
+
+// CommentIssue posts a comment with gh issue comment.
+func (g *GitHub) CommentIssue(ctx context.Context, number int, body string) error {
+	if _, err := g.gh(ctx, "issue", "comment", strconv.Itoa(number), "--body", body); err != nil {
+		return fmt.Errorf("failed to comment on issue #%d: %w", number, err)
+	}
+	return nil
+}
+
+// ResolvePR finds the open pull request for branch with gh pr list.
+func (g *GitHub) ResolvePR(ctx context.Context, branch string) (*PullRequest, error) {
+	var prs []struct {
+		Number      int    `json:"number"`
+		Title       string `json:"title"`
+		URL         string `json:"url"`
+		HeadRefName string `json:"headRefName"`
+		State       string `json:"state"`
+	}
+	if err := g.json(ctx, &prs, "pr", "list", "--head", branch, "--state", "open", "--limit", "1", "--json", "number,title,url,headRefName,state"); err != nil {
+		return nil, fmt.Errorf("failed to find pull request for %s: %w", branch, err)
+	}
+	if len(prs) == 0 {
+		return nil, fmt.Errorf("%w: pull request for %s", ErrNotFound, branch)
+	}
+	pr := prs[0]
+	return &PullRequest{Number: pr.Number, Title: pr.Title, URL: pr.URL, Branch: pr.HeadRefName, State: pr.State}, nil
+}
+
+// CreatePR opens a pull request with gh pr create.
+func (g *GitHub) CreatePR(ctx context.Context, opts CreatePROptions) (*PullRequest, error) {
+	out, err := g.gh(ctx, "pr", "create", "--head", opts.Branch, "--base", opts.Base, "--title", opts.Title, "--body", opts.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pull request: %w", err)
+	}
+
+	// gh prints the URL of the new pull request, ending in its number
+	url := strings.TrimSpace(string(out))
+	number, _ := strconv.Atoi(path.Base(url))
+	return &PullRequest{Number: number, Title: opts.Title, URL: url, Branch: opts.Branch, State: "OPEN"}, nil
+}
+
+// CIStatus combines the check runs of a commit.
+func (g *GitHub) CIStatus(ctx context.Context, commit string) (*CIStatus, error) {
+	var result struct {
+		CheckRuns []struct {
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+			HTMLURL    string `json:"html_url"`
+		} `json:"check_runs"`
+	}
+	if err := g.json(ctx, &result, "api", "repos/{owner}/{repo}/commits/"+commit+"/check-runs"); err != nil {
+		return nil, fmt.Errorf("failed to fetch checks of %s: %w", commit, err)
+	}
+
+	status := &CIStatus{}
+	states := make([]CIState, len(result.CheckRuns))
+	for i, run := range result.CheckRuns {
+		switch {
+		case run.Status != "completed":
+			states[i] = CIPending
+		case run.Conclusion == "success", run.Conclusion == "neutral", run.Conclusion == "skipped":
+			states[i] = CISuccess
+		default:
+			states[i] = CIFailure
+		}
+		if status.URL == "" || states[i] == CIFailure {
+			status.URL = run.HTMLURL
+		}
+	}
+	status.State = combine(states)
+	return status, nil
+}
+
+// json runs gh and decodes its JSON output into v.
+func (g *GitHub) json(ctx context.Context, v any, args ...string) error {
+	out, err := g.gh(ctx, args...)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(out, v)
+}
+
+// gh runs the gh CLI in the repository and returns its stdout.
+// gh's error message is included in the returned error.
+func (g *GitHub) gh(ctx context.Context, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("gh"); err != nil {
+		return nil, ErrNoCLI
+	}
+
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	cmd.Dir = g.RepoRoot
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,120 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// GitLab talks to the GitLab REST API. The token is read from GITLAB_TOKEN.
+type GitLab struct {
+	client  restClient
+	project string // URL-encoded project path
+	web     string // Web URL of the project
+}
+
+// NewGitLab returns a GitLab client for the project at path on the instance at web.
+func NewGitLab(web, path string) *GitLab {
+	return &GitLab{
+		client:  restClient{base: web + "/api/v4", token: os.Getenv("GITLAB_TOKEN")},
+		project: url.PathEscape(path),
+		web:     web + "/" + path,
+	}
+}
+
+// Name returns "gitlab".
+func (g *GitLab) Name() string { return "gitlab" }
+
+// RepoURL returns the web URL of the project.
+func (g *GitLab) RepoURL() string { return g.web }
+
+// BranchURL returns the tree view of a branch.
+func (g *GitLab) BranchURL(branch string) string { return g.web + "/-/tree/" + branch }
+
+type gitlabMR struct {
+	IID          int    `json:"iid"`
+	Title        string `json:"title"`
+	WebURL       string `json:"web_url"`
+	SourceBranch string `json:"source_branch"`
+	State        string `json:"state"`
+}
+
+func (mr gitlabMR) pullRequest() *PullRequest {
+	return &PullRequest{Number: mr.IID, Title: mr.Title, URL: mr.WebURL, Branch: mr.SourceBranch, State: mr.State}
+}
+
+// IssueInfo fetches an issue by its project-local number.
+func (g *GitLab) IssueInfo(ctx context.Context, number int) (*Issue, error) {
+	var issue struct {
+		IID    int    `json:"iid"`
+		Title  string `json:"title"`
+		WebURL string `json:"web_url"`
+	}
+	if err := g.client.get(ctx, fmt.Sprintf("/projects/%s/issues/%d", g.project, number), &issue); err != nil {
+		return nil, fmt.Errorf("failed to fetch issue #%d: %w", number, err)
+	}
+	return &Issue{Number: issue.IID, Title: issue.Title, URL: issue.WebURL}, nil
+}
+
+// CommentIssue adds a note to an issue.
+func (g *GitLab) CommentIssue(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("/projects/%s/issues/%d/notes", g.project, number)
+	if err := g.client.post(ctx, path, map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("failed to comment on issue #%d: %w", number, err)
+	}
+	return nil
+}
+
+// ResolvePR finds the open merge request for branch.
+func (g *GitLab) ResolvePR(ctx context.Context, branch string) (*PullRequest, error) {
+	var mrs []gitlabMR
+	path := fmt.Sprintf("/projects/%s/merge_requests?state=opened&source_branch=%s", g.project, url.QueryEscape(branch))
+	if err := g.client.get(ctx, path, &mrs); err != nil {
+		return nil, fmt.Errorf("failed to find merge request for %s: %w", branch, err)
+	}
+	if len(mrs) == 0 {
+		return nil, fmt.Errorf("%w: merge request for %s", ErrNotFound, branch)
+	}
+	return mrs[0].pullRequest(), nil
+}
+
+// CreatePR opens a merge request.
+func (g *GitLab) CreatePR(ctx context.Context, opts CreatePROptions) (*PullRequest, error) {
+	body := map[string]string{
+		"source_branch": opts.Branch,
+		"target_branch": opts.Base,
+		"title":         opts.Title,
+		"description":   opts.Body,
+	}
+	var mr gitlabMR
+	if err := g.client.post(ctx, fmt.Sprintf("/projects/%s/merge_requests", g.project), body, &mr); err != nil {
+		return nil, fmt.Errorf("failed to create merge request: %w", err)
+	}
+	return mr.pullRequest(), nil
+}
+
+// CIStatus returns the status of the latest pipeline for a commit.
+func (g *GitLab) CIStatus(ctx context.Context, commit string) (*CIStatus, error) {
+	var pipelines []struct {
+		Status string `json:"status"`
+		WebURL string `json:"web_url"`
+	}
+	path := fmt.Sprintf("/projects/%s/pipelines?per_page=1&sha=%s", g.project, url.QueryEscape(commit))
+	if err := g.client.get(ctx, path, &pipelines); err != nil {
+		return nil, fmt.Errorf("failed to fetch pipelines of %s: %w", commit, err)
+	}
+	if len(pipelines) == 0 {
+		return &CIStatus{State: CIUnknown}, nil
+	}
+
+	p := pipelines[0]
+	state := CIPending
+	switch p.Status {
+	case "success", "skipped":
+		state = CISuccess
+	case "failed", "canceled":
+		state = CIFailure
+	}
+	return &CIStatus{State: state, URL: p.WebURL}, nil
+}
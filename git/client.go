@@ -0,0 +1,69 @@
+package git
+
+import "context"
+
+// CLI runs the git command line. Its methods are the package functions, for
+// callers that take git as an interface such as spaces.GitClient.
+type CLI struct{}
+
+func (CLI) CheckBranchName(ctx context.Context, name string) error {
+	return CheckBranchName(ctx, name)
+}
+
+func (CLI) BranchExists(ctx context.Context, repoRoot, name string) bool {
+	return BranchExists(ctx, repoRoot, name)
+}
+
+func (CLI) CreateBranch(ctx context.Context, repoRoot, name, start string) error {
+	return CreateBranch(ctx, repoRoot, name, start)
+}
+
+func (CLI) DeleteBranch(ctx context.Context, repoRoot, name string) error {
+	return DeleteBranch(ctx, repoRoot, name)
+}
+
+func (CLI) AddWorktree(ctx context.Context, repoRoot, path, branch string) error {
+	return AddWorktree(ctx, repoRoot, path, branch)
+}
+
+func (CLI) RemoveWorktree(ctx context.Context, repoRoot, worktreePath string) error {
+	return RemoveWorktree(ctx, repoRoot, worktreePath)
+}
+
+func (CLI) PruneWorktrees(ctx context.Context, repoRoot string) error {
+	return PruneWorktrees(ctx, repoRoot)
+}
+
+func (CLI) IsWorktree(path string) bool { return IsWorktree(path) }
+
+func (CLI) HasUncommittedChanges(ctx context.Context, path string) bool {
+	return HasUncommittedChanges(ctx, path)
+}
+
+func (CLI) GetMainRepoPath(ctx context.Context, worktreePath string) (string, error) {
+	return GetMainRepoPath(ctx, worktreePath)
+}
+
+func (CLI) StashPush(ctx context.Context, path, message string) (bool, error) {
+	return StashPush(ctx, path, message)
+}
+
+func (CLI) StashPop(ctx context.Context, path string) error {
+	return StashPop(ctx, path)
+}
+
+func (CLI) Fetch(ctx context.Context, repoRoot, remote string) error {
+	return Fetch(ctx, repoRoot, remote)
+}
+
+func (CLI) RemoteBranch(ctx context.Context, repoRoot, remote, branch string) (string, error) {
+	return RemoteBranch(ctx, repoRoot, remote, branch)
+}
+
+func (CLI) SetPushRemote(ctx context.Context, repoRoot, branch, remote string) error {
+	return SetPushRemote(ctx, repoRoot, branch, remote)
+}
+
+func (CLI) SetUpstream(ctx context.Context, repoRoot, branch, upstream string) error {
+	return SetUpstream(ctx, repoRoot, branch, upstream)
+}
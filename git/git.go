@@ -1,54 +1,192 @@
 package git
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/johanhenriksson/remux/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrNotRepository is returned when the working directory is not inside a git repository.
+	ErrNotRepository = errors.New("not in a git repository")
+	// ErrBranchExists is returned when creating a branch that already exists.
+	ErrBranchExists = errors.New("branch already exists")
 )
 
 // FindRoot returns the root of the current git repository.
 func FindRoot() (string, error) {
 	out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: %w", ErrNotRepository, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Toplevel returns the root of the working tree containing dir.
+func Toplevel(dir string) (string, error) {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrNotRepository, err)
 	}
 	return strings.TrimSpace(string(out)), nil
 }
 
 // BranchExists checks if a branch exists in the repository.
-func BranchExists(repoRoot, name string) bool {
-	cmd := exec.Command("git", "-C", repoRoot, "show-ref", "--verify", "--quiet", "refs/heads/"+name)
+func BranchExists(ctx context.Context, repoRoot, name string) bool {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoRoot, "show-ref", "--verify", "--quiet", "refs/heads/"+name)
 	return cmd.Run() == nil
 }
 
 // run runs a git command in the specified repository.
-func run(repoRoot string, args ...string) error {
+// Cancelling ctx terminates git, giving it a chance to clean up its lock files.
+func run(ctx context.Context, repoRoot string, args ...string) error {
+	return runWrapped(ctx, nil, repoRoot, args...)
+}
+
+// runWrapped runs a git command in the specified repository through wrapper,
+// a command prefix such as the one of lowPriority.
+func runWrapped(ctx context.Context, wrapper []string, repoRoot string, args ...string) (err error) {
 	allArgs := append([]string{"-C", repoRoot}, args...)
-	cmd := exec.Command("git", allArgs...)
+	log().Debug("running git", "args", allArgs)
+	ctx, span := telemetry.Start(ctx, "git "+args[0], attribute.StringSlice("git.args", allArgs))
+	defer func() { telemetry.End(span, err) }()
+	argv := append(append(slices.Clone(wrapper), "git"), allArgs...)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = 5 * time.Second
 	return cmd.Run()
 }
 
-// CreateBranch creates a new branch at the current HEAD.
-func CreateBranch(repoRoot, name string) error {
-	return run(repoRoot, "branch", name)
+// CreateBranch creates a new branch at start, or at the current HEAD if start is empty.
+// Returns ErrBranchExists if the branch already exists.
+func CreateBranch(ctx context.Context, repoRoot, name, start string) error {
+	if BranchExists(ctx, repoRoot, name) {
+		return fmt.Errorf("%w: %s", ErrBranchExists, name)
+	}
+	args := []string{"branch", name}
+	if start != "" {
+		args = append(args, start)
+	}
+	return run(ctx, repoRoot, args...)
 }
 
 // DeleteBranch deletes a branch.
-func DeleteBranch(repoRoot, name string) error {
-	return run(repoRoot, "branch", "-d", name)
+func DeleteBranch(ctx context.Context, repoRoot, name string) error {
+	return run(ctx, repoRoot, "branch", "-d", name)
+}
+
+// Rebase rebases the branch checked out in the worktree at path onto upstream.
+// A rebase that stops on conflicts is left in progress for the user to resolve.
+func Rebase(ctx context.Context, path, upstream string) error {
+	return run(ctx, path, "rebase", upstream)
+}
+
+// RebaseOnto rebases the commits of the branch checked out in the worktree
+// at path that follow since onto newBase, leaving out those before it.
+// A rebase that stops on conflicts is left in progress for the user to resolve.
+func RebaseOnto(ctx context.Context, path, newBase, since string) error {
+	return run(ctx, path, "rebase", "--onto", newBase, since)
+}
+
+// RebaseInProgress reports whether a rebase is stopped in the worktree at path.
+func RebaseInProgress(path string) bool {
+	dir, err := GitDir(path)
+	if err != nil {
+		return false
+	}
+	for _, name := range []string{"rebase-merge", "rebase-apply"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RebaseContinue continues the rebase stopped in the worktree at path,
+// keeping the messages of the commits it replays. Fails, leaving the rebase
+// stopped, while conflicts are unresolved.
+func RebaseContinue(ctx context.Context, path string) error {
+	return runWrapped(ctx, []string{"env", "GIT_EDITOR=true"}, path, "rebase", "--continue")
+}
+
+// RebaseAbort abandons the rebase stopped in the worktree at path, returning
+// its branch to where it was before the rebase.
+func RebaseAbort(ctx context.Context, path string) error {
+	return run(ctx, path, "rebase", "--abort")
+}
+
+// ConflictedFiles returns the files with unresolved conflicts in the worktree
+// at path.
+func ConflictedFiles(ctx context.Context, path string) ([]string, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", path, "diff", "--name-only", "--diff-filter=U", "-z").Output()
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00"), nil
+}
+
+// ResetKeep moves the branch checked out in the worktree at path to commit,
+// updating the files it changes. Fails instead of discarding local changes.
+func ResetKeep(ctx context.Context, path, commit string) error {
+	return run(ctx, path, "reset", "--keep", commit)
 }
 
 // AddWorktree creates a new worktree for the given branch.
-func AddWorktree(repoRoot, path, branch string) error {
-	return run(repoRoot, "worktree", "add", path, branch)
+func AddWorktree(ctx context.Context, repoRoot, path, branch string) error {
+	return run(ctx, repoRoot, "worktree", "add", path, branch)
 }
 
 // RemoveWorktree removes a worktree.
-func RemoveWorktree(repoRoot, worktreePath string) error {
-	return run(repoRoot, "worktree", "remove", worktreePath)
+func RemoveWorktree(ctx context.Context, repoRoot, worktreePath string) error {
+	return run(ctx, repoRoot, "worktree", "remove", worktreePath)
+}
+
+// PruneWorktrees removes git's records of worktrees whose directories no longer exist.
+func PruneWorktrees(ctx context.Context, repoRoot string) error {
+	return run(ctx, repoRoot, "worktree", "prune")
+}
+
+// Maintain runs git's housekeeping for a repository and its worktrees, which
+// share its object store: records of deleted worktrees are pruned, and git
+// maintenance repacks objects and collects garbage once enough has piled up.
+// Maintenance runs at low priority so it doesn't slow down work meanwhile.
+func Maintain(ctx context.Context, repoRoot string) error {
+	if err := PruneWorktrees(ctx, repoRoot); err != nil {
+		return err
+	}
+	return runWrapped(ctx, lowPriority(), repoRoot, "maintenance", "run", "--auto")
+}
+
+// lowPriority returns the command prefix running a program at the lowest CPU
+// priority, and in the idle I/O class where ionice is available (Linux).
+// Without nice and ionice, programs run as usual.
+func lowPriority() []string {
+	var prefix []string
+	if _, err := exec.LookPath("ionice"); err == nil {
+		// -t: run anyway if the I/O class can't be set
+		prefix = append(prefix, "ionice", "-t", "-c3")
+	}
+	if _, err := exec.LookPath("nice"); err == nil {
+		prefix = append(prefix, "nice", "-n", "19")
+	}
+	return prefix
 }
 
 // IsWorktree checks if the given path is a git worktree (not the main repo).
@@ -63,8 +201,8 @@ func IsWorktree(path string) bool {
 }
 
 // HasUncommittedChanges checks if there are uncommitted changes in the worktree.
-func HasUncommittedChanges(path string) bool {
-	cmd := exec.Command("git", "-C", path, "status", "--porcelain")
+func HasUncommittedChanges(ctx context.Context, path string) bool {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "status", "--porcelain")
 	out, err := cmd.Output()
 	if err != nil {
 		return true // Assume changes if we can't check
@@ -73,14 +211,354 @@ func HasUncommittedChanges(path string) bool {
 }
 
 // GetMainRepoPath returns the path to the main repository from a worktree.
-func GetMainRepoPath(worktreePath string) (string, error) {
-	cmd := exec.Command("git", "-C", worktreePath, "rev-parse", "--git-common-dir")
+func GetMainRepoPath(ctx context.Context, worktreePath string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", worktreePath, "rev-parse", "--git-common-dir")
 	out, err := cmd.Output()
 	if err != nil {
 		return "", err
 	}
 	// git-common-dir returns the .git directory of the main repo
 	gitDir := strings.TrimSpace(string(out))
+	// In the main repo itself, it is relative to the working tree
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(worktreePath, gitDir)
+	}
 	// Return the parent of .git
 	return filepath.Dir(gitDir), nil
 }
+
+// LastCommitTime returns the committer time of HEAD in the given worktree.
+func LastCommitTime(path string) (time.Time, error) {
+	out, err := exec.Command("git", "-C", path, "log", "-1", "--format=%ct").Output()
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// Head returns the commit hash of HEAD in the given repository or worktree.
+func Head(path string) (string, error) {
+	out, err := exec.Command("git", "-C", path, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// CurrentBranch returns the branch checked out in the given worktree.
+// Returns an error if HEAD is detached.
+func CurrentBranch(path string) (string, error) {
+	out, err := exec.Command("git", "-C", path, "symbolic-ref", "--short", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("no branch checked out in %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// HasUpstream reports whether the branch checked out in the given worktree has an upstream branch.
+func HasUpstream(path string) bool {
+	return exec.Command("git", "-C", path, "rev-parse", "--abbrev-ref", "@{upstream}").Run() == nil
+}
+
+// AheadBehind returns how many commits HEAD is ahead of and behind its upstream branch.
+// Returns an error if the branch has no upstream.
+func AheadBehind(path string) (ahead, behind int, err error) {
+	out, err := exec.Command("git", "-C", path, "rev-list", "--left-right", "--count", "HEAD...@{upstream}").Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %q", out)
+	}
+	if ahead, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	if behind, err = strconv.Atoi(fields[1]); err != nil {
+		return 0, 0, err
+	}
+	return ahead, behind, nil
+}
+
+// IsAncestor checks if commit is an ancestor of (or equal to) target.
+func IsAncestor(path, commit, target string) bool {
+	cmd := exec.Command("git", "-C", path, "merge-base", "--is-ancestor", commit, target)
+	return cmd.Run() == nil
+}
+
+// GitDir returns the git directory for the given repository or worktree without
+// spawning git. For worktrees this follows the gitdir pointer in the .git file.
+func GitDir(path string) (string, error) {
+	gitPath := filepath.Join(path, ".git")
+	info, err := os.Stat(gitPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return gitPath, nil
+	}
+
+	data, err := os.ReadFile(gitPath)
+	if err != nil {
+		return "", err
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("invalid .git file: %s", gitPath)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(path, dir)
+	}
+	return dir, nil
+}
+
+// ExcludeLocally keeps file, relative to the worktree at path, out of git
+// status by adding it to the repository's info/exclude, unless it is
+// ignored already.
+func ExcludeLocally(path, file string) error {
+	if exec.Command("git", "-C", path, "check-ignore", "--quiet", file).Run() == nil {
+		return nil
+	}
+	out, err := exec.Command("git", "-C", path, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotRepository, err)
+	}
+	commonDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(path, commonDir)
+	}
+
+	exclude := filepath.Join(commonDir, "info", "exclude")
+	if err := os.MkdirAll(filepath.Dir(exclude), 0755); err != nil {
+		return err
+	}
+	line := "/" + filepath.ToSlash(file) + "\n"
+	if data, err := os.ReadFile(exclude); err == nil && len(data) > 0 && data[len(data)-1] != '\n' {
+		line = "\n" + line
+	}
+	f, err := os.OpenFile(exclude, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Worktree describes a worktree as reported by `git worktree list --porcelain`.
+type Worktree struct {
+	Path     string
+	Head     string
+	Branch   string // Short branch name, empty when detached
+	Bare     bool
+	Detached bool
+	Prunable bool   // The worktree's directory or gitdir link is gone
+	Reason   string // Why the worktree is prunable
+}
+
+// ListWorktrees returns all worktrees of the repository, including the main one.
+func ListWorktrees(repoRoot string) ([]Worktree, error) {
+	out, err := exec.Command("git", "-C", repoRoot, "worktree", "list", "--porcelain").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseWorktrees(string(out)), nil
+}
+
+// parseWorktrees parses the output of `git worktree list --porcelain`.
+func parseWorktrees(out string) []Worktree {
+	var result []Worktree
+	var current *Worktree
+	for _, line := range strings.Split(out, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		if key != "worktree" && current == nil {
+			continue
+		}
+		switch key {
+		case "worktree":
+			result = append(result, Worktree{Path: value})
+			current = &result[len(result)-1]
+		case "HEAD":
+			current.Head = value
+		case "branch":
+			current.Branch = strings.TrimPrefix(value, "refs/heads/")
+		case "bare":
+			current.Bare = true
+		case "detached":
+			current.Detached = true
+		case "prunable":
+			current.Prunable = true
+			current.Reason = value
+		}
+	}
+	return result
+}
+
+// RepairWorktrees fixes the administrative links between the repository and
+// the given worktrees, e.g. after a worktree or the repository was moved.
+func RepairWorktrees(ctx context.Context, repoRoot string, paths ...string) error {
+	return run(ctx, repoRoot, append([]string{"worktree", "repair"}, paths...)...)
+}
+
+// CheckBranchName reports whether name is a valid branch name according to
+// `git check-ref-format`.
+func CheckBranchName(ctx context.Context, name string) error {
+	return exec.CommandContext(ctx, "git", "check-ref-format", "refs/heads/"+name).Run()
+}
+
+// RemoteURL returns the URL of the named remote.
+func RemoteURL(repoRoot, remote string) (string, error) {
+	out, err := exec.Command("git", "-C", repoRoot, "remote", "get-url", remote).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get url of remote %s: %w", remote, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Remotes returns the URLs of the repository's remotes by name.
+func Remotes(repoRoot string) (map[string]string, error) {
+	out, err := exec.Command("git", "-C", repoRoot, "config", "--get-regexp", `^remote\..*\.url$`).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// No remotes
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remotes: %w", err)
+	}
+	remotes := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		key, url, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "remote."), ".url")
+		remotes[name] = url
+	}
+	return remotes, nil
+}
+
+// RemoteBranch returns the remote-tracking branch of remote for branch, e.g.
+// "upstream/main", or the remote's default branch if branch is empty. Fails
+// if the remote-tracking branch doesn't exist, or if the remote's default
+// branch is unknown (see git remote set-head).
+func RemoteBranch(ctx context.Context, repoRoot, remote, branch string) (string, error) {
+	if branch == "" {
+		out, err := exec.CommandContext(ctx, "git", "-C", repoRoot, "symbolic-ref", "--quiet", "--short", "refs/remotes/"+remote+"/HEAD").Output()
+		if err != nil {
+			return "", fmt.Errorf("default branch of remote %s is unknown, see git remote set-head", remote)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	ref := remote + "/" + branch
+	if err := exec.CommandContext(ctx, "git", "-C", repoRoot, "rev-parse", "--verify", "--quiet", "refs/remotes/"+ref).Run(); err != nil {
+		return "", fmt.Errorf("remote branch %s not found", ref)
+	}
+	return ref, nil
+}
+
+// SetPushRemote makes git push branch to remote, whatever it tracks.
+func SetPushRemote(ctx context.Context, repoRoot, branch, remote string) error {
+	return run(ctx, repoRoot, "config", "branch."+branch+".pushRemote", remote)
+}
+
+// SetUpstream makes branch track upstream, a remote-tracking branch such as
+// origin/main.
+func SetUpstream(ctx context.Context, repoRoot, branch, upstream string) error {
+	return run(ctx, repoRoot, "branch", "--set-upstream-to="+upstream, branch)
+}
+
+// Fetch fetches from the named remote in the given repository.
+func Fetch(ctx context.Context, repoRoot, remote string) error {
+	return run(ctx, repoRoot, "fetch", "--quiet", remote)
+}
+
+// Upstream returns the upstream of a local branch, e.g. "origin/main", and
+// the remote it is fetched from. Returns an error if the branch has no upstream.
+func Upstream(repoRoot, branch string) (ref, remote string, err error) {
+	out, err := exec.Command("git", "-C", repoRoot, "for-each-ref", "--format=%(upstream:short) %(upstream:remotename)", "refs/heads/"+branch).Output()
+	if err != nil {
+		return "", "", err
+	}
+	ref, remote, _ = strings.Cut(strings.TrimSpace(string(out)), " ")
+	if ref == "" || remote == "" {
+		return "", "", fmt.Errorf("branch %s has no upstream", branch)
+	}
+	return ref, remote, nil
+}
+
+// MergeBase returns the best common ancestor of the commits a and b.
+func MergeBase(ctx context.Context, path, a, b string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", path, "merge-base", a, b).Output()
+	if err != nil {
+		return "", fmt.Errorf("no common ancestor of %s and %s: %w", a, b, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Diff writes the diff from commit to the working tree at path to w, with
+// extra diff options such as --stat in args. When w is a terminal, git
+// colors the output and pages it as usual.
+func Diff(ctx context.Context, path, commit string, w io.Writer, args ...string) error {
+	allArgs := append([]string{"-C", path, "diff"}, args...)
+	allArgs = append(allArgs, commit, "--")
+	log().Debug("running git", "args", allArgs)
+	cmd := exec.CommandContext(ctx, "git", allArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Commit is a commit listed by Log.
+type Commit struct {
+	Hash    string // Abbreviated commit hash
+	Subject string
+}
+
+// Log returns the commits in the given worktree reachable from HEAD but not
+// from since, oldest first.
+func Log(ctx context.Context, path, since string) ([]Commit, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", path, "log", "--reverse", "--format=%h%x00%s", since+"..HEAD").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits since %s: %w", since, err)
+	}
+	var commits []Commit
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if hash, subject, ok := strings.Cut(line, "\x00"); ok {
+			commits = append(commits, Commit{Hash: hash, Subject: subject})
+		}
+	}
+	return commits, nil
+}
+
+// Version returns the installed git version, e.g. "2.39.5".
+func Version() (string, error) {
+	out, err := exec.Command("git", "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "git version "), nil
+}
+
+// StashPush stashes the uncommitted changes of the worktree at path,
+// including untracked files. Reports whether there were changes to stash.
+func StashPush(ctx context.Context, path, message string) (bool, error) {
+	if !HasUncommittedChanges(ctx, path) {
+		return false, nil
+	}
+	return true, run(ctx, path, "stash", "push", "--include-untracked", "--message", message)
+}
+
+// StashPop applies the latest stash to the worktree at path and drops it. The
+// stash is shared by all worktrees of a repository. A stash that doesn't apply
+// cleanly is kept.
+func StashPop(ctx context.Context, path string) error {
+	return run(ctx, path, "stash", "pop")
+}
@@ -1,10 +1,13 @@
 package git_test
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -78,7 +81,7 @@ var _ = Describe("Git", func() {
 
 	Describe("HasUncommittedChanges", func() {
 		It("returns false for a clean worktree", func() {
-			Expect(git.HasUncommittedChanges(worktreeDir)).To(BeFalse())
+			Expect(git.HasUncommittedChanges(context.Background(), worktreeDir)).To(BeFalse())
 		})
 
 		It("returns true when there are uncommitted changes", func() {
@@ -86,23 +89,135 @@ var _ = Describe("Git", func() {
 			err := os.WriteFile(testFile, []byte("uncommitted"), 0644)
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(git.HasUncommittedChanges(worktreeDir)).To(BeTrue())
+			Expect(git.HasUncommittedChanges(context.Background(), worktreeDir)).To(BeTrue())
 		})
 	})
 
 	Describe("BranchExists", func() {
 		It("returns true for an existing branch", func() {
-			Expect(git.BranchExists(mainRepoDir, "test-branch")).To(BeTrue())
+			Expect(git.BranchExists(context.Background(), mainRepoDir, "test-branch")).To(BeTrue())
 		})
 
 		It("returns false for a non-existent branch", func() {
-			Expect(git.BranchExists(mainRepoDir, "non-existent")).To(BeFalse())
+			Expect(git.BranchExists(context.Background(), mainRepoDir, "non-existent")).To(BeFalse())
+		})
+	})
+
+	Describe("CreateBranch", func() {
+		It("returns ErrBranchExists for an existing branch", func() {
+			err := git.CreateBranch(context.Background(), mainRepoDir, "test-branch", "")
+			Expect(err).To(MatchError(git.ErrBranchExists))
+		})
+	})
+
+	Describe("LastCommitTime", func() {
+		It("returns the HEAD commit time", func() {
+			t, err := git.LastCommitTime(worktreeDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t).To(BeTemporally("~", time.Now(), time.Minute))
+		})
+
+		It("returns an error for a non-git directory", func() {
+			nonGitDir, err := os.MkdirTemp("", "non-git-*")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(nonGitDir)
+
+			_, err = git.LastCommitTime(nonGitDir)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("GitDir", func() {
+		It("returns the .git directory of the main repo", func() {
+			dir, err := git.GitDir(mainRepoDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dir).To(Equal(filepath.Join(mainRepoDir, ".git")))
+		})
+
+		It("follows the gitdir pointer of a worktree", func() {
+			dir, err := git.GitDir(worktreeDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(dir, "HEAD")).To(BeAnExistingFile())
+			Expect(dir).To(ContainSubstring(filepath.Join(".git", "worktrees")))
+		})
+	})
+
+	Describe("AheadBehind", func() {
+		It("returns an error without an upstream", func() {
+			_, _, err := git.AheadBehind(worktreeDir)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("counts commits relative to the upstream", func() {
+			runGitCmd(mainRepoDir, "branch", "base")
+			runGitCmd(worktreeDir, "branch", "--set-upstream-to", "base")
+			runGitCmd(worktreeDir, "commit", "--allow-empty", "-m", "ahead")
+
+			ahead, behind, err := git.AheadBehind(worktreeDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ahead).To(Equal(1))
+			Expect(behind).To(Equal(0))
+		})
+	})
+
+	Describe("Remotes", func() {
+		It("lists remote URLs and resolves remote branches", func() {
+			clone := filepath.Join(destDir, "clone")
+			runGitCmd(destDir, "clone", "--quiet", mainRepoDir, clone)
+			runGitCmd(clone, "remote", "add", "upstream", mainRepoDir)
+			runGitCmd(clone, "fetch", "--quiet", "upstream")
+
+			remotes, err := git.Remotes(clone)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remotes).To(Equal(map[string]string{"origin": mainRepoDir, "upstream": mainRepoDir}))
+
+			ref, err := git.RemoteBranch(context.Background(), clone, "upstream", "test-branch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ref).To(Equal("upstream/test-branch"))
+			_, err = git.RemoteBranch(context.Background(), clone, "upstream", "missing")
+			Expect(err).To(HaveOccurred())
+
+			// The default branch is only known once set
+			_, err = git.RemoteBranch(context.Background(), clone, "upstream", "")
+			Expect(err).To(HaveOccurred())
+			runGitCmd(clone, "remote", "set-head", "upstream", "test-branch")
+			ref, err = git.RemoteBranch(context.Background(), clone, "upstream", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ref).To(Equal("upstream/test-branch"))
+
+			runGitCmd(clone, "branch", "--no-track", "review", "upstream/test-branch")
+			Expect(git.SetUpstream(context.Background(), clone, "review", "upstream/test-branch")).To(Succeed())
+			ref, remote, err := git.Upstream(clone, "review")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ref).To(Equal("upstream/test-branch"))
+			Expect(remote).To(Equal("upstream"))
+		})
+
+		It("returns no remotes for a local repository", func() {
+			remotes, err := git.Remotes(mainRepoDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remotes).To(BeEmpty())
+		})
+	})
+
+	Describe("ExcludeLocally", func() {
+		It("keeps a generated file out of the status of every worktree", func() {
+			Expect(os.WriteFile(filepath.Join(worktreeDir, "compose.override.yaml"), nil, 0644)).To(Succeed())
+			Expect(git.HasUncommittedChanges(context.Background(), worktreeDir)).To(BeTrue())
+
+			Expect(git.ExcludeLocally(worktreeDir, "compose.override.yaml")).To(Succeed())
+			Expect(git.ExcludeLocally(worktreeDir, "compose.override.yaml")).To(Succeed())
+			Expect(git.HasUncommittedChanges(context.Background(), worktreeDir)).To(BeFalse())
+
+			exclude, err := os.ReadFile(filepath.Join(mainRepoDir, ".git", "info", "exclude"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Count(string(exclude), "/compose.override.yaml\n")).To(Equal(1))
 		})
 	})
 
 	Describe("GetMainRepoPath", func() {
 		It("returns the main repo path from a worktree", func() {
-			path, err := git.GetMainRepoPath(worktreeDir)
+			path, err := git.GetMainRepoPath(context.Background(), worktreeDir)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Resolve symlinks for comparison (macOS /var -> /private/var)
@@ -111,6 +226,42 @@ var _ = Describe("Git", func() {
 			Expect(actualPath).To(Equal(expectedPath))
 		})
 	})
+
+	Describe("ListWorktrees", func() {
+		It("lists the main repo and its worktrees", func() {
+			worktrees, err := git.ListWorktrees(mainRepoDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(worktrees).To(HaveLen(2))
+
+			wt := worktrees[1]
+			expectedPath, _ := filepath.EvalSymlinks(worktreeDir)
+			Expect(wt.Path).To(Equal(expectedPath))
+			Expect(wt.Branch).To(Equal("test-branch"))
+			Expect(wt.Head).NotTo(BeEmpty())
+			Expect(wt.Prunable).To(BeFalse())
+		})
+
+		It("marks deleted worktrees as prunable", func() {
+			Expect(os.RemoveAll(worktreeDir)).To(Succeed())
+
+			worktrees, err := git.ListWorktrees(mainRepoDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(worktrees).To(HaveLen(2))
+			Expect(worktrees[1].Prunable).To(BeTrue())
+			Expect(worktrees[1].Reason).NotTo(BeEmpty())
+		})
+	})
+
+	Describe("Maintain", func() {
+		It("prunes deleted worktrees and runs maintenance", func() {
+			Expect(os.RemoveAll(worktreeDir)).To(Succeed())
+			Expect(git.Maintain(context.Background(), mainRepoDir)).To(Succeed())
+
+			worktrees, err := git.ListWorktrees(mainRepoDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(worktrees).To(HaveLen(1))
+		})
+	})
 })
 
 func runGitCmd(repoDir string, args ...string) {
@@ -0,0 +1,211 @@
+// Package proc finds and stops the processes that keep a space in use.
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Process is a running process.
+type Process struct {
+	PID     int // 0 if the process could not be identified
+	PPID    int
+	Command string
+}
+
+// List returns all running processes.
+func List() ([]Process, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,comm=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	var procs []Process
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		procs = append(procs, Process{PID: pid, PPID: ppid, Command: strings.Join(fields[2:], " ")})
+	}
+	return procs, nil
+}
+
+// Children returns the direct children of the given parent processes,
+// leaving out the current process and its ancestors.
+func Children(parents ...int) ([]Process, error) {
+	procs, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	parent := make(map[int]bool, len(parents))
+	for _, pid := range parents {
+		parent[pid] = true
+	}
+
+	var result []Process
+	self := ancestors(procs)
+	for _, p := range procs {
+		if parent[p.PPID] && !self[p.PID] {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// ancestors returns the current process and all of its ancestors.
+func ancestors(procs []Process) map[int]bool {
+	ppid := make(map[int]int, len(procs))
+	for _, p := range procs {
+		ppid[p.PID] = p.PPID
+	}
+
+	result := map[int]bool{}
+	for pid := os.Getpid(); pid > 1 && !result[pid]; pid = ppid[pid] {
+		result[pid] = true
+	}
+	return result
+}
+
+// ListeningOn returns the processes listening on TCP ports in [from, to].
+// Processes are identified with lsof; without it, ports that are in use are
+// reported with PID 0.
+func ListeningOn(from, to int) (map[int][]Process, error) {
+	if _, err := exec.LookPath("lsof"); err != nil {
+		return probePorts(from, to), nil
+	}
+
+	// lsof exits with 1 when nothing matches
+	out, err := exec.Command("lsof", "-nP", fmt.Sprintf("-iTCP:%d-%d", from, to), "-sTCP:LISTEN", "-Fpcn").Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && len(out) == 0) {
+		return nil, fmt.Errorf("failed to list listening processes: %w", err)
+	}
+	return parseLsof(string(out)), nil
+}
+
+// parseLsof parses lsof -Fpcn output into processes by port.
+func parseLsof(out string) map[int][]Process {
+	result := map[int][]Process{}
+	var current Process
+	seen := map[[2]int]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		value := line[1:]
+		switch line[0] {
+		case 'p':
+			pid, _ := strconv.Atoi(value)
+			current = Process{PID: pid}
+		case 'c':
+			current.Command = value
+		case 'n':
+			// Address such as *:11010 or 127.0.0.1:11010
+			i := strings.LastIndex(value, ":")
+			if i < 0 {
+				continue
+			}
+			port, err := strconv.Atoi(value[i+1:])
+			if err != nil {
+				continue
+			}
+			// A process listening on IPv4 and IPv6 is reported once per port
+			if key := [2]int{port, current.PID}; !seen[key] {
+				seen[key] = true
+				result[port] = append(result[port], current)
+			}
+		}
+	}
+	return result
+}
+
+// Cwd returns the working directory of the process, read from /proc on Linux
+// and with lsof elsewhere.
+func Cwd(pid int) (string, error) {
+	if dir, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid)); err == nil {
+		return dir, nil
+	}
+	out, err := exec.Command("lsof", "-a", "-p", strconv.Itoa(pid), "-d", "cwd", "-Fn").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find working directory of %d: %w", pid, err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if dir, ok := strings.CutPrefix(line, "n"); ok {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find working directory of %d", pid)
+}
+
+// probePorts reports the ports in [from, to] that can't be bound.
+func probePorts(from, to int) map[int][]Process {
+	result := map[int][]Process{}
+	for port := from; port <= to; port++ {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			result[port] = []Process{{Command: "unknown"}}
+			continue
+		}
+		l.Close()
+	}
+	return result
+}
+
+// Terminate sends SIGTERM to each process and waits up to grace for them to
+// exit, then kills the ones still running.
+func Terminate(procs []Process, grace time.Duration) error {
+	var errs []error
+	var pending []Process
+	for _, p := range procs {
+		if p.PID == 0 {
+			errs = append(errs, fmt.Errorf("cannot stop unidentified process %s", p.Command))
+			continue
+		}
+		if err := syscall.Kill(p.PID, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+			errs = append(errs, fmt.Errorf("failed to stop %d (%s): %w", p.PID, p.Command, err))
+			continue
+		}
+		pending = append(pending, p)
+	}
+
+	deadline := time.Now().Add(grace)
+	for len(pending) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		pending = running(pending)
+	}
+
+	for _, p := range pending {
+		if err := syscall.Kill(p.PID, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+			errs = append(errs, fmt.Errorf("failed to kill %d (%s): %w", p.PID, p.Command, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// running returns the processes that still exist.
+func running(procs []Process) []Process {
+	var result []Process
+	for _, p := range procs {
+		if syscall.Kill(p.PID, 0) == nil {
+			result = append(result, p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,13 @@
+package proc_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestProc(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Proc Suite")
+}
@@ -0,0 +1,103 @@
+package proc_test
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux/proc"
+)
+
+var _ = Describe("Proc", func() {
+	Describe("Children", func() {
+		It("returns the children of the given process", func() {
+			child := exec.Command("sleep", "10")
+			Expect(child.Start()).To(Succeed())
+			defer child.Process.Kill()
+
+			children, err := proc.Children(os.Getpid())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(children).To(ContainElement(HaveField("PID", child.Process.Pid)))
+		})
+
+		It("leaves out the current process", func() {
+			children, err := proc.Children(os.Getppid())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(children).NotTo(ContainElement(HaveField("PID", os.Getpid())))
+		})
+	})
+
+	Describe("ListeningOn", func() {
+		It("finds a listening port", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer l.Close()
+			port := l.Addr().(*net.TCPAddr).Port
+
+			listeners, err := proc.ListeningOn(port, port)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listeners).To(HaveKey(port))
+		})
+
+		It("returns nothing for free ports", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			port := l.Addr().(*net.TCPAddr).Port
+			l.Close()
+
+			listeners, err := proc.ListeningOn(port, port)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listeners).To(BeEmpty())
+		})
+	})
+
+	Describe("Cwd", func() {
+		It("returns the working directory of a process", func() {
+			wd, err := os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+
+			cwd, err := proc.Cwd(os.Getpid())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cwd).To(Equal(wd))
+		})
+	})
+
+	Describe("Terminate", func() {
+		It("stops processes", func() {
+			child := exec.Command("sleep", "10")
+			Expect(child.Start()).To(Succeed())
+			exited := make(chan struct{})
+			go func() {
+				child.Wait()
+				close(exited)
+			}()
+
+			err := proc.Terminate([]proc.Process{{PID: child.Process.Pid, Command: "sleep"}}, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(exited).Should(BeClosed())
+		})
+
+		It("kills processes that ignore SIGTERM after the grace period", func() {
+			child := exec.Command("sh", "-c", "trap '' TERM; sleep 10")
+			Expect(child.Start()).To(Succeed())
+			exited := make(chan struct{})
+			go func() {
+				child.Wait()
+				close(exited)
+			}()
+
+			err := proc.Terminate([]proc.Process{{PID: child.Process.Pid, Command: "sh"}}, 200*time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(exited).Should(BeClosed())
+		})
+
+		It("fails for unidentified processes", func() {
+			err := proc.Terminate([]proc.Process{{Command: "unknown"}}, time.Second)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,129 @@
+package registry
+
+import "slices"
+
+// Group is a named, ordered set of spaces that are opened, hibernated and
+// dropped together, such as the api, web and infra spaces of one release.
+// Unlike tags, membership is recorded on the group, so its spaces keep the
+// order they were added in.
+type Group struct {
+	Name   string   `yaml:"name" json:"name"`
+	Spaces []string `yaml:"spaces" json:"spaces"` // Names of the member spaces, in order
+}
+
+// Has reports whether the named space is a member of the group.
+func (g *Group) Has(name string) bool {
+	return slices.Contains(g.Spaces, name)
+}
+
+// Group returns a pointer to the named group, or nil if not found.
+func (r *Registry) Group(name string) *Group {
+	for i := range r.Groups {
+		if r.Groups[i].Name == name {
+			return &r.Groups[i]
+		}
+	}
+	return nil
+}
+
+// AddToGroup appends the named spaces to a group, creating it if needed.
+// Spaces that are already members keep their position.
+func (r *Registry) AddToGroup(group string, names ...string) {
+	g := r.Group(group)
+	if g == nil {
+		r.Groups = append(r.Groups, Group{Name: group})
+		g = &r.Groups[len(r.Groups)-1]
+	}
+	for _, name := range names {
+		if !g.Has(name) {
+			g.Spaces = append(g.Spaces, name)
+		}
+	}
+}
+
+// SetGroup replaces the members of a group with the named spaces, in the
+// given order, creating the group if needed.
+func (r *Registry) SetGroup(group string, names ...string) {
+	if g := r.Group(group); g != nil {
+		g.Spaces = nil
+	}
+	r.AddToGroup(group, names...)
+}
+
+// RemoveFromGroup removes the named spaces from a group. A group left without
+// members is deleted. Returns false if the group doesn't exist.
+func (r *Registry) RemoveFromGroup(group string, names ...string) bool {
+	g := r.Group(group)
+	if g == nil {
+		return false
+	}
+	g.Spaces = slices.DeleteFunc(g.Spaces, func(s string) bool { return slices.Contains(names, s) })
+	if len(g.Spaces) == 0 {
+		r.DeleteGroup(group)
+	}
+	return true
+}
+
+// DeleteGroup removes a group, leaving its spaces in place.
+// Returns false if the group doesn't exist.
+func (r *Registry) DeleteGroup(name string) bool {
+	n := len(r.Groups)
+	r.Groups = slices.DeleteFunc(r.Groups, func(g Group) bool { return g.Name == name })
+	return len(r.Groups) < n
+}
+
+// GroupMembers returns the spaces of the named group in group order.
+// Members that are no longer registered are skipped.
+func (r *Registry) GroupMembers(name string) []Entry {
+	g := r.Group(name)
+	if g == nil {
+		return nil
+	}
+	var result []Entry
+	for _, member := range g.Spaces {
+		if entry := r.Get(member); entry != nil {
+			result = append(result, *entry)
+		}
+	}
+	return result
+}
+
+// GroupsOf returns the names of the groups the named space is a member of.
+func (r *Registry) GroupsOf(name string) []string {
+	var result []string
+	for _, g := range r.Groups {
+		if g.Has(name) {
+			result = append(result, g.Name)
+		}
+	}
+	return result
+}
+
+// removeMember drops a removed space from every group.
+func (r *Registry) removeMember(name string) {
+	for _, g := range slices.Clone(r.Groups) {
+		if g.Has(name) {
+			r.RemoveFromGroup(g.Name, name)
+		}
+	}
+}
+
+// renameMember follows a renamed space in every group.
+func (r *Registry) renameMember(oldName, newName string) {
+	for i := range r.Groups {
+		for j, member := range r.Groups[i].Spaces {
+			if member == oldName {
+				r.Groups[i].Spaces[j] = newName
+			}
+		}
+	}
+}
+
+// cloneGroups deep-copies groups so stored registries don't share member slices.
+func cloneGroups(groups []Group) []Group {
+	result := slices.Clone(groups)
+	for i := range result {
+		result[i].Spaces = slices.Clone(result[i].Spaces)
+	}
+	return result
+}
@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const lockFile = "spaces.lock"
+
+// Lock acquires an exclusive lock on the registry in dir, blocking until it is available.
+// The returned function releases the lock.
+func Lock(dir string) (func(), error) {
+	return LockFile(filepath.Join(dir, lockFile))
+}
+
+// LockFile acquires an exclusive advisory lock on the file at path, creating
+// it and its parent directories if needed. It blocks until the lock is
+// available. The returned function releases the lock.
+func LockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// Update loads the registry in dir under the lock, applies fn, and saves the result once.
+// Use it for bulk mutations so concurrent processes can't interleave their writes.
+// If fn returns an error, nothing is written.
+func Update(dir string, fn func(*Registry) error) error {
+	return UpdateStore(FileStore{Dir: dir}, fn)
+}
@@ -1,14 +1,22 @@
 package registry
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 const registryFile = "spaces.yaml"
 
+// ErrNotFound is returned when a space is not present in the registry.
+var ErrNotFound = errors.New("space not found")
+
+// ErrReadOnly is returned when saving through a ReadOnlyStore.
+var ErrReadOnly = errors.New("registry is read-only")
+
 // Port allocation constants.
 const (
 	BasePort  = 11010
@@ -16,22 +24,67 @@ const (
 )
 
 // Entry represents a tracked space in the registry.
+//
+// The YAML form is the registry file; the JSON form is what `remux list -o
+// json` prints. Both use the same snake_case keys, and fields are only ever
+// added to them, never renamed or removed.
 type Entry struct {
-	Name     string `yaml:"name"`
-	Path     string `yaml:"path"`
-	Port     int    `yaml:"port"`
-	RepoRoot string `yaml:"repo_root"`
+	Name       string    `yaml:"name" json:"name"`
+	Path       string    `yaml:"path" json:"path"`
+	Port       int       `yaml:"port" json:"port"` // First of the PortRange ports reserved for the space
+	RepoRoot   string    `yaml:"repo_root" json:"repo_root"`
+	Tags       []string  `yaml:"tags,omitempty" json:"tags,omitempty"`
+	LastOpened time.Time `yaml:"last_opened,omitempty" json:"last_opened,omitzero"` // RFC 3339 in JSON
+	Issue      string    `yaml:"issue,omitempty" json:"issue,omitempty"`            // URL of the issue the space was created for
+	Parent     string    `yaml:"parent,omitempty" json:"parent,omitempty"`          // Name of the space whose branch this one is stacked on
+	Template   string    `yaml:"template,omitempty" json:"template,omitempty"`      // Name of the space template the space was created from
+	Base       string    `yaml:"base,omitempty" json:"base,omitempty"`              // Branch the space's branch was started from, if one was given
+	Hibernated bool      `yaml:"hibernated,omitempty" json:"hibernated,omitempty"`  // Services and session were stopped by hibernate
+	Owner      string    `yaml:"owner,omitempty" json:"owner,omitempty"`            // User who created the space, in a dest dir shared by several users
+	Bound      bool      `yaml:"bound,omitempty" json:"bound,omitempty"`            // Path is an existing checkout bound with open --here, not a worktree remux created
+}
+
+// HasTag reports whether the entry carries the given tag.
+func (e *Entry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
+// Version is the version of the registry file format. Files of earlier
+// versions are migrated when loaded, see migrate.
+const Version = 2
+
 // Registry holds a list of tracked spaces.
 type Registry struct {
-	Spaces []Entry `yaml:"spaces"`
+	Version int     `yaml:"version,omitempty" json:"version,omitempty"`
+	Spaces  []Entry `yaml:"spaces" json:"spaces"`
+	Groups  []Group `yaml:"groups,omitempty" json:"groups,omitempty"`
+
+	// index maps space names to their position in Spaces.
+	// It is rebuilt whenever it falls out of sync with Spaces.
+	index   map[string]int
+	indexed int // len(Spaces) when the index was built
+}
+
+// Exists reports whether dir holds a registry file.
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, registryFile))
+	return err == nil
 }
 
 // Load reads the space registry from the given directory.
 // Returns an empty registry if the file doesn't exist.
 func Load(dir string) (*Registry, error) {
-	path := filepath.Join(dir, registryFile)
+	return LoadFile(filepath.Join(dir, registryFile))
+}
+
+// LoadFile reads a space registry from the file at path.
+// Returns an empty registry if the file doesn't exist.
+func LoadFile(path string) (*Registry, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -44,61 +97,285 @@ func Load(dir string) (*Registry, error) {
 	if err := yaml.Unmarshal(data, &reg); err != nil {
 		return nil, err
 	}
+	reg.migrate()
+	reg.reindex()
 	return &reg, nil
 }
 
+// migrate brings a registry loaded from a file of an earlier version up to
+// Version. It is saved in the new format the next time the registry changes.
+//
+// Version 1 files allocated each space the ports after the highest ones in
+// use, so no range was handed out twice as long as spaces were only added.
+// Hand edits and creates racing before the registry was locked could still
+// leave spaces without ports or with overlapping ranges, which recycling
+// freed ranges would make worse. Each such space, after the first to claim
+// its ports, gets the lowest free range.
+func (r *Registry) migrate() {
+	if r.Version >= Version {
+		return
+	}
+	reserved := map[int]bool{}
+	for i := range r.Spaces {
+		s := &r.Spaces[i]
+		if s.Port <= 0 || rangeReserved(reserved, s.Port) {
+			s.Port = firstFreeRange(reserved, BasePort)
+		}
+		reserve(reserved, s.Port)
+	}
+	r.Version = Version
+}
+
 // Save writes the registry to the given directory.
+// The file is replaced atomically so readers never see a partial write.
 func (r *Registry) Save(dir string) error {
-	path := filepath.Join(dir, registryFile)
+	return r.saveFile(filepath.Join(dir, registryFile))
+}
+
+// saveFile atomically replaces the registry file at path.
+func (r *Registry) saveFile(path string) error {
+	r.Version = Version
 	data, err := yaml.Marshal(r)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
 // Add adds a space to the registry. Idempotent - updates path if name exists.
 func (r *Registry) Add(name, path string, port int, repoRoot string) {
-	for i, s := range r.Spaces {
-		if s.Name == name {
-			r.Spaces[i].Path = path
-			r.Spaces[i].Port = port
-			r.Spaces[i].RepoRoot = repoRoot
-			return
-		}
+	if i := r.indexOf(name); i >= 0 {
+		r.Spaces[i].Path = path
+		r.Spaces[i].Port = port
+		r.Spaces[i].RepoRoot = repoRoot
+		return
 	}
 	r.Spaces = append(r.Spaces, Entry{Name: name, Path: path, Port: port, RepoRoot: repoRoot})
+	r.index[name] = len(r.Spaces) - 1
+	r.indexed = len(r.Spaces)
 }
 
 // Get returns a pointer to the entry with the given name, or nil if not found.
 func (r *Registry) Get(name string) *Entry {
+	if i := r.indexOf(name); i >= 0 {
+		return &r.Spaces[i]
+	}
+	return nil
+}
+
+// indexOf returns the position of the named space in Spaces, or -1 if not found.
+// Spaces is exported and may be modified directly, so hits are verified and the
+// index is rebuilt when it looks stale.
+func (r *Registry) indexOf(name string) int {
+	if r.index == nil || r.indexed != len(r.Spaces) {
+		r.reindex()
+	}
+	i, ok := r.index[name]
+	if !ok {
+		return -1
+	}
+	if i < len(r.Spaces) && r.Spaces[i].Name == name {
+		return i
+	}
+	r.reindex()
+	if i, ok = r.index[name]; ok {
+		return i
+	}
+	return -1
+}
+
+// reindex rebuilds the name index from Spaces.
+// If names are duplicated, the first occurrence wins.
+func (r *Registry) reindex() {
+	r.index = make(map[string]int, len(r.Spaces))
 	for i, s := range r.Spaces {
-		if s.Name == name {
-			return &r.Spaces[i]
+		if _, ok := r.index[s.Name]; !ok {
+			r.index[s.Name] = i
 		}
 	}
-	return nil
+	r.indexed = len(r.Spaces)
+}
+
+// Rename changes the name of a space. Returns false if the space doesn't
+// exist or the new name is already taken.
+func (r *Registry) Rename(oldName, newName string) bool {
+	i := r.indexOf(oldName)
+	if i < 0 || r.indexOf(newName) >= 0 {
+		return false
+	}
+	r.Spaces[i].Name = newName
+	delete(r.index, oldName)
+	r.index[newName] = i
+	for j := range r.Spaces {
+		if r.Spaces[j].Parent == oldName {
+			r.Spaces[j].Parent = newName
+		}
+	}
+	r.renameMember(oldName, newName)
+	return true
+}
+
+// Touch records t as the last time the named space was opened.
+func (r *Registry) Touch(name string, t time.Time) {
+	if entry := r.Get(name); entry != nil {
+		entry.LastOpened = t
+	}
 }
 
 // AllocatePort finds the next available port range.
 func (r *Registry) AllocatePort() int {
-	maxPort := BasePort - PortRange
+	return r.AllocatePortFrom(BasePort)
+}
+
+// AllocatePortFrom finds the lowest port range at or after base, in steps of
+// PortRange, that no space reserves. Ranges of dropped spaces are reused.
+func (r *Registry) AllocatePortFrom(base int) int {
+	return firstFreeRange(r.reservedPorts(), base)
+}
+
+// AllocatePortWithin finds the first port range within the count ports
+// starting at base that no space reserves. Reports false if all are taken.
+func (r *Registry) AllocatePortWithin(base, count int) (int, bool) {
+	port := r.AllocatePortFrom(base)
+	return port, port+PortRange <= base+count
+}
+
+// reservedPorts returns the set of ports reserved by the spaces.
+func (r *Registry) reservedPorts() map[int]bool {
+	reserved := make(map[int]bool, len(r.Spaces)*PortRange)
 	for _, s := range r.Spaces {
-		if s.Port > maxPort {
-			maxPort = s.Port
+		reserve(reserved, s.Port)
+	}
+	return reserved
+}
+
+// reserve adds the PortRange ports starting at port to the set.
+func reserve(reserved map[int]bool, port int) {
+	for p := port; p < port+PortRange; p++ {
+		reserved[p] = true
+	}
+}
+
+// rangeReserved reports whether any of the PortRange ports starting at port
+// is in the set.
+func rangeReserved(reserved map[int]bool, port int) bool {
+	for p := port; p < port+PortRange; p++ {
+		if reserved[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// firstFreeRange returns the lowest port at or after base, in steps of
+// PortRange, whose range has no port in the set.
+func firstFreeRange(reserved map[int]bool, base int) int {
+	port := base
+	for rangeReserved(reserved, port) {
+		port += PortRange
+	}
+	return port
+}
+
+// ReservedBy returns the space whose ports overlap the PortRange ports
+// starting at port, or nil if none does.
+func (r *Registry) ReservedBy(port int) *Entry {
+	for i := range r.Spaces {
+		if s := &r.Spaces[i]; s.Port < port+PortRange && port < s.Port+PortRange {
+			return s
 		}
 	}
-	return maxPort + PortRange
+	return nil
 }
 
 // Remove removes a space by name.
+// Spaces stacked on it are moved onto its parent, and it leaves its groups.
 func (r *Registry) Remove(name string) {
-	for i, s := range r.Spaces {
-		if s.Name == name {
-			r.Spaces = append(r.Spaces[:i], r.Spaces[i+1:]...)
-			return
+	if i := r.indexOf(name); i >= 0 {
+		parent := r.Spaces[i].Parent
+		r.Spaces = append(r.Spaces[:i], r.Spaces[i+1:]...)
+		for j := range r.Spaces {
+			if r.Spaces[j].Parent == name {
+				r.Spaces[j].Parent = parent
+			}
+		}
+		r.removeMember(name)
+		r.reindex()
+	}
+}
+
+// Children returns the spaces stacked directly on the named space, in registry order.
+func (r *Registry) Children(name string) []Entry {
+	var result []Entry
+	for _, s := range r.Spaces {
+		if s.Parent == name {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// AddTag adds a tag to the named space. Returns false if the space doesn't exist.
+// Adding a tag that is already present is a no-op.
+func (r *Registry) AddTag(name, tag string) bool {
+	entry := r.Get(name)
+	if entry == nil {
+		return false
+	}
+	if !entry.HasTag(tag) {
+		entry.Tags = append(entry.Tags, tag)
+	}
+	return true
+}
+
+// RemoveTag removes a tag from the named space. Returns false if the space doesn't exist.
+func (r *Registry) RemoveTag(name, tag string) bool {
+	entry := r.Get(name)
+	if entry == nil {
+		return false
+	}
+	for i, t := range entry.Tags {
+		if t == tag {
+			entry.Tags = append(entry.Tags[:i], entry.Tags[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Tagged returns all spaces carrying every one of the given tags.
+func (r *Registry) Tagged(tags ...string) []Entry {
+	var result []Entry
+	for _, s := range r.Spaces {
+		matches := true
+		for _, tag := range tags {
+			if !s.HasTag(tag) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			result = append(result, s)
 		}
 	}
+	return result
 }
 
 // List returns all tracked spaces.
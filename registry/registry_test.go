@@ -1,8 +1,14 @@
 package registry_test
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -49,10 +55,75 @@ var _ = Describe("Registry", func() {
 			Expect(reg.AllocatePort()).To(Equal(11040))
 		})
 
-		It("handles non-sequential ports", func() {
+		It("reuses the ranges of dropped spaces", func() {
 			reg.Add("space1", "/path/1", 11010, "/repo/root")
 			reg.Add("space2", "/path/2", 11050, "/repo/root") // gap
-			Expect(reg.AllocatePort()).To(Equal(11060))
+			Expect(reg.AllocatePort()).To(Equal(11020))
+
+			reg.Add("space3", "/path/3", 11020, "/repo/root")
+			reg.Remove("space1")
+			Expect(reg.AllocatePort()).To(Equal(11010))
+		})
+
+		It("skips ranges overlapping unaligned ones", func() {
+			reg.Add("space1", "/path/1", 11015, "/repo/root")
+			Expect(reg.AllocatePort()).To(Equal(11030))
+		})
+	})
+
+	Describe("Migration", func() {
+		It("gives spaces of old files that share ports the lowest free range", func() {
+			content := "spaces:\n" +
+				"  - {name: a, path: /path/a, port: 11010, repo_root: /repo}\n" +
+				"  - {name: b, path: /path/b, port: 11030, repo_root: /repo}\n" +
+				"  - {name: c, path: /path/c, port: 11035, repo_root: /repo}\n" +
+				"  - {name: d, path: /path/d, repo_root: /repo}\n"
+			Expect(os.WriteFile(filepath.Join(tempDir, "spaces.yaml"), []byte(content), 0644)).To(Succeed())
+
+			loaded, err := registry.Load(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Version).To(Equal(registry.Version))
+			Expect(loaded.Get("a").Port).To(Equal(11010))
+			Expect(loaded.Get("b").Port).To(Equal(11030))
+			Expect(loaded.Get("c").Port).To(Equal(11020))
+			Expect(loaded.Get("d").Port).To(Equal(11040))
+		})
+
+		It("leaves files of the current version alone", func() {
+			content := "version: 2\nspaces:\n  - {name: a, path: /path/a, port: 11015, repo_root: /repo}\n  - {name: b, path: /path/b, port: 11020, repo_root: /repo}\n"
+			Expect(os.WriteFile(filepath.Join(tempDir, "spaces.yaml"), []byte(content), 0644)).To(Succeed())
+
+			loaded, err := registry.Load(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Get("b").Port).To(Equal(11020))
+		})
+	})
+
+	Describe("AllocatePortWithin", func() {
+		It("returns the first free range, skipping other users' ranges", func() {
+			reg.Add("space1", "/path/1", 20000, "/repo/root")
+			reg.Add("space2", "/path/2", 20020, "/repo/root")
+			reg.Add("space3", "/path/3", 30000, "/repo/root")
+			port, ok := reg.AllocatePortWithin(20000, 100)
+			Expect(ok).To(BeTrue())
+			Expect(port).To(Equal(20010))
+		})
+
+		It("reports when the ranges are used up", func() {
+			reg.Add("space1", "/path/1", 20000, "/repo/root")
+			reg.Add("space2", "/path/2", 20015, "/repo/root")
+			_, ok := reg.AllocatePortWithin(20000, 30)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("ReservedBy", func() {
+		It("returns the space whose range overlaps", func() {
+			reg.Add("space1", "/path/1", 20000, "/repo/root")
+			Expect(reg.ReservedBy(19990)).To(BeNil())
+			Expect(reg.ReservedBy(19995).Name).To(Equal("space1"))
+			Expect(reg.ReservedBy(20009).Name).To(Equal("space1"))
+			Expect(reg.ReservedBy(20010)).To(BeNil())
 		})
 	})
 
@@ -86,6 +157,274 @@ var _ = Describe("Registry", func() {
 		})
 	})
 
+	Describe("Remove", func() {
+		It("keeps lookups consistent after removal", func() {
+			reg.Add("a", "/path/a", 11010, "/repo/root")
+			reg.Add("b", "/path/b", 11020, "/repo/root")
+			reg.Add("c", "/path/c", 11030, "/repo/root")
+
+			reg.Remove("a")
+			Expect(reg.Get("a")).To(BeNil())
+			Expect(reg.Get("b").Path).To(Equal("/path/b"))
+			Expect(reg.Get("c").Path).To(Equal("/path/c"))
+			Expect(reg.List()).To(HaveLen(2))
+		})
+
+		It("moves stacked spaces onto the removed space's parent", func() {
+			reg.Add("a", "/path/a", 11010, "/repo/root")
+			reg.Add("b", "/path/b", 11020, "/repo/root")
+			reg.Add("c", "/path/c", 11030, "/repo/root")
+			reg.Get("b").Parent = "a"
+			reg.Get("c").Parent = "b"
+
+			reg.Remove("b")
+			Expect(reg.Get("c").Parent).To(Equal("a"))
+			Expect(reg.Children("a")).To(HaveLen(1))
+		})
+	})
+
+	Describe("Index", func() {
+		It("stays correct when Spaces is modified directly", func() {
+			reg.Add("a", "/path/a", 11010, "/repo/root")
+			reg.Add("b", "/path/b", 11020, "/repo/root")
+			Expect(reg.Get("a")).NotTo(BeNil())
+
+			// Reorder without going through the registry methods
+			reg.Spaces[0], reg.Spaces[1] = reg.Spaces[1], reg.Spaces[0]
+			Expect(reg.Get("a").Path).To(Equal("/path/a"))
+			Expect(reg.Get("b").Path).To(Equal("/path/b"))
+
+			reg.Spaces = append(reg.Spaces, registry.Entry{Name: "c", Path: "/path/c"})
+			Expect(reg.Get("c").Path).To(Equal("/path/c"))
+		})
+
+		It("indexes loaded registries without changing the file format", func() {
+			content := "version: 2\nspaces:\n    - name: a\n      path: /path/a\n      port: 11010\n      repo_root: /repo/root\n"
+			Expect(os.WriteFile(filepath.Join(tempDir, "spaces.yaml"), []byte(content), 0644)).To(Succeed())
+
+			loaded, err := registry.Load(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Get("a").Port).To(Equal(11010))
+
+			Expect(loaded.Save(tempDir)).To(Succeed())
+			data, err := os.ReadFile(filepath.Join(tempDir, "spaces.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal(content))
+		})
+	})
+
+	Describe("Tags", func() {
+		BeforeEach(func() {
+			reg.Add("api", "/path/api", 11010, "/repo/root")
+			reg.Add("web", "/path/web", 11020, "/repo/root")
+		})
+
+		It("adds tags idempotently", func() {
+			Expect(reg.AddTag("api", "preview")).To(BeTrue())
+			Expect(reg.AddTag("api", "preview")).To(BeTrue())
+			Expect(reg.Get("api").Tags).To(Equal([]string{"preview"}))
+		})
+
+		It("returns false when tagging a missing space", func() {
+			Expect(reg.AddTag("missing", "preview")).To(BeFalse())
+			Expect(reg.RemoveTag("missing", "preview")).To(BeFalse())
+		})
+
+		It("removes tags", func() {
+			reg.AddTag("api", "preview")
+			reg.AddTag("api", "epic")
+			Expect(reg.RemoveTag("api", "preview")).To(BeTrue())
+			Expect(reg.Get("api").Tags).To(Equal([]string{"epic"}))
+		})
+
+		It("selects spaces carrying all given tags", func() {
+			reg.AddTag("api", "preview")
+			reg.AddTag("api", "epic")
+			reg.AddTag("web", "preview")
+
+			Expect(reg.Tagged("preview")).To(HaveLen(2))
+			tagged := reg.Tagged("preview", "epic")
+			Expect(tagged).To(HaveLen(1))
+			Expect(tagged[0].Name).To(Equal("api"))
+		})
+
+		It("persists tags", func() {
+			reg.AddTag("web", "preview")
+			Expect(reg.Save(tempDir)).To(Succeed())
+
+			loaded, err := registry.Load(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Get("web").Tags).To(Equal([]string{"preview"}))
+			Expect(loaded.Get("api").Tags).To(BeEmpty())
+		})
+	})
+
+	Describe("Groups", func() {
+		BeforeEach(func() {
+			reg.Add("api", "/path/api", 11010, "/repo/root")
+			reg.Add("web", "/path/web", 11020, "/repo/root")
+			reg.Add("infra", "/path/infra", 11030, "/repo/root")
+		})
+
+		It("keeps members in the order they were added", func() {
+			reg.AddToGroup("release", "web", "api")
+			reg.AddToGroup("release", "api", "infra")
+			Expect(reg.Group("release").Spaces).To(Equal([]string{"web", "api", "infra"}))
+
+			members := reg.GroupMembers("release")
+			Expect(members).To(HaveLen(3))
+			Expect(members[0].Name).To(Equal("web"))
+			Expect(members[2].Name).To(Equal("infra"))
+		})
+
+		It("replaces members with set", func() {
+			reg.AddToGroup("release", "api", "web")
+			reg.SetGroup("release", "infra", "api")
+			Expect(reg.Group("release").Spaces).To(Equal([]string{"infra", "api"}))
+		})
+
+		It("deletes a group when its last member leaves", func() {
+			reg.AddToGroup("release", "api", "web")
+			Expect(reg.RemoveFromGroup("release", "api")).To(BeTrue())
+			Expect(reg.Group("release").Spaces).To(Equal([]string{"web"}))
+			Expect(reg.RemoveFromGroup("release", "web")).To(BeTrue())
+			Expect(reg.Group("release")).To(BeNil())
+			Expect(reg.RemoveFromGroup("release", "web")).To(BeFalse())
+		})
+
+		It("follows removed and renamed spaces", func() {
+			reg.AddToGroup("release", "api", "web")
+			reg.AddToGroup("hotfix", "api")
+
+			Expect(reg.Rename("web", "frontend")).To(BeTrue())
+			Expect(reg.Group("release").Spaces).To(Equal([]string{"api", "frontend"}))
+
+			reg.Remove("api")
+			Expect(reg.Group("release").Spaces).To(Equal([]string{"frontend"}))
+			Expect(reg.Group("hotfix")).To(BeNil())
+			Expect(reg.GroupsOf("frontend")).To(Equal([]string{"release"}))
+		})
+
+		It("persists groups", func() {
+			reg.AddToGroup("release", "web", "api")
+			Expect(reg.Save(tempDir)).To(Succeed())
+
+			loaded, err := registry.Load(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Group("release").Spaces).To(Equal([]string{"web", "api"}))
+		})
+	})
+
+	Describe("Rename", func() {
+		It("renames a space", func() {
+			reg.Add("old", "/path/old", 11010, "/repo/root")
+			Expect(reg.Rename("old", "new")).To(BeTrue())
+			Expect(reg.Get("old")).To(BeNil())
+			Expect(reg.Get("new").Path).To(Equal("/path/old"))
+		})
+
+		It("updates the parent of stacked spaces", func() {
+			reg.Add("old", "/path/old", 11010, "/repo/root")
+			reg.Add("child", "/path/child", 11020, "/repo/root")
+			reg.Get("child").Parent = "old"
+
+			Expect(reg.Rename("old", "new")).To(BeTrue())
+			Expect(reg.Get("child").Parent).To(Equal("new"))
+		})
+
+		It("refuses to overwrite an existing space", func() {
+			reg.Add("a", "/path/a", 11010, "/repo/root")
+			reg.Add("b", "/path/b", 11020, "/repo/root")
+			Expect(reg.Rename("a", "b")).To(BeFalse())
+			Expect(reg.Get("a")).NotTo(BeNil())
+			Expect(reg.Get("b").Path).To(Equal("/path/b"))
+		})
+
+		It("returns false for unknown spaces", func() {
+			Expect(reg.Rename("missing", "new")).To(BeFalse())
+		})
+	})
+
+	Describe("Touch", func() {
+		It("records the last opened time", func() {
+			reg.Add("test", "/path/test", 11010, "/repo/root")
+			now := time.Now().Truncate(time.Second)
+			reg.Touch("test", now)
+			Expect(reg.Get("test").LastOpened).To(BeTemporally("==", now))
+		})
+
+		It("ignores unknown spaces", func() {
+			reg.Touch("missing", time.Now())
+			Expect(reg.List()).To(BeEmpty())
+		})
+
+		It("persists the last opened time", func() {
+			reg.Add("test", "/path/test", 11010, "/repo/root")
+			now := time.Now().Truncate(time.Second)
+			reg.Touch("test", now)
+			Expect(reg.Save(tempDir)).To(Succeed())
+
+			loaded, err := registry.Load(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Get("test").LastOpened).To(BeTemporally("==", now))
+		})
+	})
+
+	Describe("Update", func() {
+		It("applies all mutations with a single save", func() {
+			err := registry.Update(tempDir, func(r *registry.Registry) error {
+				r.Add("a", "/path/a", 11010, "/repo/root")
+				r.Add("b", "/path/b", 11020, "/repo/root")
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			loaded, err := registry.Load(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.List()).To(HaveLen(2))
+		})
+
+		It("writes nothing when fn fails", func() {
+			err := registry.Update(tempDir, func(r *registry.Registry) error {
+				r.Add("a", "/path/a", 11010, "/repo/root")
+				return fmt.Errorf("abort")
+			})
+			Expect(err).To(MatchError("abort"))
+
+			loaded, err := registry.Load(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.List()).To(BeEmpty())
+		})
+
+		It("serializes concurrent updates", func() {
+			var wg sync.WaitGroup
+			for i := range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					err := registry.Update(tempDir, func(r *registry.Registry) error {
+						r.Add(fmt.Sprintf("space%d", i), "/path", r.AllocatePort(), "/repo/root")
+						return nil
+					})
+					Expect(err).NotTo(HaveOccurred())
+				}()
+			}
+			wg.Wait()
+
+			loaded, err := registry.Load(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.List()).To(HaveLen(10))
+			ports := make(map[int]bool)
+			for i := range 10 {
+				entry := loaded.Get(fmt.Sprintf("space%d", i))
+				Expect(entry).NotTo(BeNil())
+				ports[entry.Port] = true
+			}
+			Expect(ports).To(HaveLen(10))
+		})
+	})
+
 	Describe("Save and Load", func() {
 		It("persists port and repo_root fields", func() {
 			reg.Add("test", "/path/test", 11010, "/repo/root")
@@ -99,4 +438,145 @@ var _ = Describe("Registry", func() {
 			Expect(loaded.List()[0].RepoRoot).To(Equal("/repo/root"))
 		})
 	})
+
+	Describe("JSON", func() {
+		It("uses the same keys as the registry file", func() {
+			reg.Add("test", "/path/test", 11010, "/repo/root")
+			data, err := json.Marshal(reg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(MatchJSON(`{"spaces": [{"name": "test", "path": "/path/test", "port": 11010, "repo_root": "/repo/root"}]}`))
+		})
+
+		It("round-trips every field", func() {
+			entry := registry.Entry{
+				Name:       "app-feature",
+				Path:       "/spaces/app-feature",
+				Port:       11020,
+				RepoRoot:   "/src/app",
+				Tags:       []string{"review"},
+				LastOpened: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+				Issue:      "https://github.com/org/app/issues/7",
+				Parent:     "app-base",
+			}
+			data, err := json.Marshal(entry)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(`"last_opened":"2026-01-02T03:04:05Z"`))
+
+			var decoded registry.Entry
+			Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+			Expect(decoded).To(Equal(entry))
+		})
+	})
+})
+
+var _ = Describe("MemoryStore", func() {
+	It("starts empty", func() {
+		reg, err := (&registry.MemoryStore{}).Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reg.List()).To(BeEmpty())
+	})
+
+	It("returns copies of the saved registry", func() {
+		store := &registry.MemoryStore{}
+		reg := &registry.Registry{}
+		reg.Add("space-a", "/dest/space-a", registry.BasePort, "/repo")
+		reg.AddTag("space-a", "wip")
+		Expect(store.Save(reg)).To(Succeed())
+
+		// Later changes to the saved registry are not visible until saved again
+		reg.AddTag("space-a", "review")
+
+		loaded, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Get("space-a").Tags).To(Equal([]string{"wip"}))
+
+		loaded.Remove("space-a")
+		again, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again.Get("space-a")).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Store", func() {
+	DescribeTable("applies UpdateStore under the lock",
+		func(newStore func() registry.Store) {
+			store := newStore()
+
+			var wg sync.WaitGroup
+			for i := range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					err := registry.UpdateStore(store, func(r *registry.Registry) error {
+						r.Add(fmt.Sprintf("space%d", i), "/path", r.AllocatePort(), "/repo")
+						return nil
+					})
+					Expect(err).NotTo(HaveOccurred())
+				}()
+			}
+			wg.Wait()
+
+			reg, err := store.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reg.List()).To(HaveLen(10))
+		},
+		Entry("file", func() registry.Store { return registry.FileStore{Dir: GinkgoT().TempDir()} }),
+		Entry("memory", func() registry.Store { return &registry.MemoryStore{} }),
+	)
+
+	DescribeTable("reports saves to watchers until cancelled",
+		func(newStore func() registry.Store) {
+			store := newStore()
+			ctx, cancel := context.WithCancel(context.Background())
+			changes, err := store.Watch(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Consistently(changes, 50*time.Millisecond).ShouldNot(Receive())
+
+			reg := &registry.Registry{}
+			reg.Add("space-a", "/dest/space-a", registry.BasePort, "/repo")
+			Expect(store.Save(reg)).To(Succeed())
+			Eventually(changes).Should(Receive())
+
+			cancel()
+			Eventually(changes).Should(BeClosed())
+		},
+		Entry("file", func() registry.Store {
+			return registry.FileStore{Dir: GinkgoT().TempDir(), PollInterval: 10 * time.Millisecond}
+		}),
+		Entry("memory", func() registry.Store { return &registry.MemoryStore{} }),
+	)
+	It("keeps the registry in File instead of Dir", func() {
+		dir, other := GinkgoT().TempDir(), GinkgoT().TempDir()
+		store := registry.FileStore{Dir: dir, File: filepath.Join(other, "backup.yaml")}
+		reg := &registry.Registry{}
+		reg.Add("space-a", "/dest/space-a", registry.BasePort, "/repo")
+		Expect(store.Save(reg)).To(Succeed())
+
+		Expect(registry.Exists(dir)).To(BeFalse())
+		loaded, err := registry.LoadFile(store.File)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Get("space-a")).NotTo(BeNil())
+	})
+
+	It("never writes through a ReadOnlyStore", func() {
+		dir := GinkgoT().TempDir()
+		reg := &registry.Registry{}
+		reg.Add("space-a", "/dest/space-a", registry.BasePort, "/repo")
+		Expect(reg.Save(dir)).To(Succeed())
+
+		store := registry.ReadOnlyStore{Store: registry.FileStore{Dir: dir}}
+		err := registry.UpdateStore(store, func(r *registry.Registry) error {
+			r.Remove("space-a")
+			return nil
+		})
+		Expect(err).To(MatchError(registry.ErrReadOnly))
+
+		loaded, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Get("space-a")).NotTo(BeNil())
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1), "no lock file is created")
+	})
 })
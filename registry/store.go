@@ -0,0 +1,223 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Store persists a registry. Space operations reload the registry under the
+// store's lock, change it and save the result back before unlocking, so
+// operations of other processes sharing the store aren't lost. Implementations
+// other than the registry file, such as a database or a registry held by a
+// daemon, plug in here without changes to the code using the registry.
+type Store interface {
+	// Load returns a copy of the stored registry.
+	Load() (*Registry, error)
+	// Save replaces the stored registry with r. A Save is atomic: Load never
+	// returns a partially saved registry.
+	Save(r *Registry) error
+	// Lock acquires the store's exclusive lock, blocking until it is
+	// available, and returns the function releasing it. Holding the lock
+	// across Load and Save keeps other holders from interleaving their
+	// changes; see UpdateStore.
+	Lock() (func(), error)
+	// Watch sends on the returned channel after the stored registry changes,
+	// including changes saved through the same store. Changes made in quick
+	// succession may be reported once. The channel is closed once ctx is done.
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// UpdateStore loads the registry from s under its lock, applies fn, and saves
+// the result once. If fn returns an error, nothing is saved.
+func UpdateStore(s Store, fn func(*Registry) error) error {
+	unlock, err := s.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	reg, err := s.Load()
+	if err != nil {
+		return err
+	}
+	if err := fn(reg); err != nil {
+		return err
+	}
+	return s.Save(reg)
+}
+
+// DefaultPollInterval is how often a FileStore checks the registry file for
+// changes while it is watched.
+const DefaultPollInterval = time.Second
+
+// FileStore keeps the registry in a YAML file in Dir, the dest dir, where the
+// remux command keeps it. Its lock is the registry lock taken by Lock, shared
+// with other processes.
+type FileStore struct {
+	Dir string
+
+	// File is the registry file, if not the one in Dir. The lock is kept in Dir.
+	File string
+
+	// PollInterval is how often Watch checks the file (default DefaultPollInterval).
+	PollInterval time.Duration
+}
+
+// path returns the registry file of the store.
+func (s FileStore) path() string {
+	if s.File != "" {
+		return s.File
+	}
+	return filepath.Join(s.Dir, registryFile)
+}
+
+// Load reads the registry file. See Load.
+func (s FileStore) Load() (*Registry, error) {
+	return LoadFile(s.path())
+}
+
+// Save replaces the registry file. See Registry.Save.
+func (s FileStore) Save(r *Registry) error {
+	return r.saveFile(s.path())
+}
+
+// Lock acquires the registry lock of Dir. See Lock.
+func (s FileStore) Lock() (func(), error) {
+	return Lock(s.Dir)
+}
+
+// Watch polls the registry file and reports when it is replaced, created or
+// removed.
+func (s FileStore) Watch(ctx context.Context) (<-chan struct{}, error) {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	path := s.path()
+	last, _ := os.Stat(path)
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, _ := os.Stat(path)
+			if !fileChanged(last, info) {
+				continue
+			}
+			last = info
+			notify(changes)
+		}
+	}()
+	return changes, nil
+}
+
+// fileChanged reports whether a file differs between two stats, either of
+// which is nil if the file didn't exist. Saves replace the file, so a new
+// file is a change even if its size and mtime are the same.
+func fileChanged(old, cur os.FileInfo) bool {
+	if old == nil || cur == nil {
+		return old != cur
+	}
+	return !os.SameFile(old, cur) || !old.ModTime().Equal(cur.ModTime()) || old.Size() != cur.Size()
+}
+
+// notify sends on a change channel with a buffer of one without blocking. A
+// pending notification already covers the new change.
+func notify(changes chan struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+// ReadOnlyStore reads the registry from Store but never changes it, for
+// inspecting registries that must be left as they are, such as a backup or
+// another user's. Saves fail with ErrReadOnly, and Lock takes no lock, since
+// taking it creates the lock file.
+type ReadOnlyStore struct {
+	Store
+}
+
+// Save returns ErrReadOnly.
+func (s ReadOnlyStore) Save(r *Registry) error {
+	return ErrReadOnly
+}
+
+// Lock returns without locking.
+func (s ReadOnlyStore) Lock() (func(), error) {
+	return func() {}, nil
+}
+
+// MemoryStore keeps the registry in memory, for programs that track spaces
+// themselves and for tests. The zero value is an empty registry. It is safe
+// for concurrent use.
+type MemoryStore struct {
+	mu       sync.Mutex
+	spaces   []Entry
+	groups   []Group
+	watchers []chan struct{}
+
+	lock sync.Mutex // taken by Lock, independent of mu so Load and Save work while held
+}
+
+// Load returns a copy of the stored registry.
+func (s *MemoryStore) Load() (*Registry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &Registry{Spaces: cloneEntries(s.spaces), Groups: cloneGroups(s.groups)}, nil
+}
+
+// Save replaces the stored registry with a copy of r and notifies watchers.
+func (s *MemoryStore) Save(r *Registry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spaces = cloneEntries(r.Spaces)
+	s.groups = cloneGroups(r.Groups)
+	for _, w := range s.watchers {
+		notify(w)
+	}
+	return nil
+}
+
+// Lock acquires the store's lock.
+func (s *MemoryStore) Lock() (func(), error) {
+	s.lock.Lock()
+	return s.lock.Unlock, nil
+}
+
+// Watch reports every Save.
+func (s *MemoryStore) Watch(ctx context.Context) (<-chan struct{}, error) {
+	changes := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.watchers = append(s.watchers, changes)
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.watchers = slices.DeleteFunc(s.watchers, func(w chan struct{}) bool { return w == changes })
+		close(changes)
+	}()
+	return changes, nil
+}
+
+// cloneEntries deep-copies entries so stored registries don't share tag slices.
+func cloneEntries(entries []Entry) []Entry {
+	result := slices.Clone(entries)
+	for i := range result {
+		result[i].Tags = slices.Clone(result[i].Tags)
+	}
+	return result
+}
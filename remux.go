@@ -0,0 +1,246 @@
+// Package remux is the embeddable API of remux. A Manager creates, opens,
+// drops and inspects the spaces of a dest dir the same way the remux command
+// does, for Go tools such as bots and editor plugins that want to manage
+// spaces without shelling out to the command.
+package remux
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/spaces"
+)
+
+// Types shared with the spaces and registry packages.
+type (
+	// Entry describes a registered space.
+	Entry = registry.Entry
+	// Status summarizes the git state of a space.
+	Status = spaces.Status
+	// SessionManager hosts the terminal sessions of spaces.
+	SessionManager = spaces.SessionManager
+	// CreateOptions contains the parameters for creating a space. DestDir is
+	// ignored, the Manager's dest dir is used.
+	CreateOptions = spaces.CreateOptions
+	// OpenOptions contains the parameters for opening a space. DestDir and
+	// Name are ignored, the Manager's dest dir and the given name are used.
+	OpenOptions = spaces.OpenSessionOptions
+	// DropOptions contains the parameters for dropping a space.
+	DropOptions = spaces.DropOptions
+	// BindOptions contains the parameters for binding an existing checkout.
+	BindOptions = spaces.BindOptions
+	// GitClient runs the git operations of create, open and drop.
+	GitClient = spaces.GitClient
+	// Plan is the ordered list of actions a Create or Drop would take.
+	Plan = spaces.Plan
+	// Action is a step of a Plan.
+	Action = spaces.Action
+)
+
+// Errors returned by Manager methods, wrapped with details. Match them with errors.Is.
+var (
+	ErrSpaceNotFound = spaces.ErrSpaceNotFound
+	ErrSpaceExists   = spaces.ErrSpaceExists
+	ErrBranchExists  = spaces.ErrBranchExists
+	ErrDirtyWorktree = spaces.ErrDirtyWorktree
+	ErrLiveProcesses = spaces.ErrLiveProcesses
+	ErrNotOwner      = spaces.ErrNotOwner
+)
+
+// Options configures a Manager.
+type Options struct {
+	// DestDir holds the worktrees and their state (default ~/.remux, shared
+	// with the remux command).
+	DestDir string
+
+	// Registry persists the list of spaces (default: the registry file in
+	// DestDir used by the remux command).
+	Registry registry.Store
+
+	// Backend hosts the sessions of every space, overriding the backend
+	// selected by their configs (optional).
+	Backend SessionManager
+
+	// Git runs the git operations of create, open and drop (default: the git
+	// command). See the remuxtest package for in-memory implementations.
+	Git GitClient
+
+	// Logger receives warnings about steps that fail without failing the
+	// call, such as writing the VS Code workspace (default slog.Default()).
+	// The git, tmux and config packages have their own SetLogger.
+	Logger *slog.Logger
+}
+
+// Manager manages the spaces of a dest dir. The registry is reloaded for
+// every call, so a long-lived Manager sees changes made by the remux command.
+type Manager struct {
+	destDir  string
+	registry registry.Store
+	backend  SessionManager
+	git      GitClient
+	logger   *slog.Logger
+}
+
+// New returns a Manager for the dest dir in opts.
+func New(opts Options) (*Manager, error) {
+	dest := opts.DestDir
+	if dest == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dest = filepath.Join(home, ".remux")
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dest dir: %w", err)
+	}
+
+	store := opts.Registry
+	if store == nil {
+		store = registry.FileStore{Dir: dest}
+	}
+	return &Manager{destDir: dest, registry: store, backend: opts.Backend, git: opts.Git, logger: opts.Logger}, nil
+}
+
+// DestDir returns the directory holding the Manager's worktrees.
+func (m *Manager) DestDir() string {
+	return m.destDir
+}
+
+// state loads the current registry.
+func (m *Manager) state() (*spaces.State, error) {
+	st, err := spaces.NewState(m.destDir, m.registry)
+	if err != nil {
+		return nil, err
+	}
+	st.Backend = m.backend
+	st.Git = m.git
+	st.Logger = m.logger
+	return st, nil
+}
+
+// Create creates a worktree for a branch of opts.RepoRoot and registers it as
+// a space, running the space's setup and on_create hooks.
+func (m *Manager) Create(ctx context.Context, opts CreateOptions) (Entry, error) {
+	st, err := m.state()
+	if err != nil {
+		return Entry{}, err
+	}
+	opts.DestDir = m.destDir
+	path, err := st.Create(ctx, opts)
+	if err != nil {
+		return Entry{}, err
+	}
+	return registered(st, filepath.Base(path))
+}
+
+// PlanCreate returns the actions Create would take for opts without taking
+// them, e.g. to ask for confirmation first.
+func (m *Manager) PlanCreate(ctx context.Context, opts CreateOptions) (Plan, error) {
+	st, err := m.state()
+	if err != nil {
+		return nil, err
+	}
+	opts.DestDir = m.destDir
+	return st.PlanCreate(ctx, opts)
+}
+
+// Open starts the named space's session unless it is running, then attaches
+// to it. Set opts.Detached to only start the session.
+func (m *Manager) Open(ctx context.Context, name string, opts OpenOptions) error {
+	st, err := m.state()
+	if err != nil {
+		return err
+	}
+	opts.DestDir = m.destDir
+	opts.Name = name
+	return st.OpenSession(ctx, opts)
+}
+
+// Bind registers an existing checkout as a space that stays where it is,
+// like open --here. Dropping it only unregisters it.
+func (m *Manager) Bind(ctx context.Context, opts BindOptions) (Entry, error) {
+	st, err := m.state()
+	if err != nil {
+		return Entry{}, err
+	}
+	name, err := st.Bind(ctx, opts)
+	if err != nil {
+		return Entry{}, err
+	}
+	return registered(st, name)
+}
+
+// registered returns the entry of a space just registered in st. Another
+// process may have dropped it since, so it can be missing.
+func registered(st *spaces.State, name string) (Entry, error) {
+	entry := st.Registry.Get(name)
+	if entry == nil {
+		return Entry{}, fmt.Errorf("%w: %s", ErrSpaceNotFound, name)
+	}
+	return *entry, nil
+}
+
+// Drop runs the named space's on_drop hooks, removes its worktree, closes its
+// session and unregisters it.
+func (m *Manager) Drop(ctx context.Context, name string, opts DropOptions) error {
+	st, err := m.state()
+	if err != nil {
+		return err
+	}
+	entry := st.Registry.Get(name)
+	if entry == nil {
+		return fmt.Errorf("%w: %s", ErrSpaceNotFound, name)
+	}
+	return st.Drop(ctx, entry.Path, opts)
+}
+
+// PlanDrop returns the actions Drop would take for the named space without
+// taking them.
+func (m *Manager) PlanDrop(ctx context.Context, name string, opts DropOptions) (Plan, error) {
+	st, err := m.state()
+	if err != nil {
+		return nil, err
+	}
+	entry := st.Registry.Get(name)
+	if entry == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSpaceNotFound, name)
+	}
+	return st.PlanDrop(ctx, entry.Path, opts)
+}
+
+// Get returns the named space.
+func (m *Manager) Get(name string) (Entry, error) {
+	st, err := m.state()
+	if err != nil {
+		return Entry{}, err
+	}
+	entry := st.Registry.Get(name)
+	if entry == nil {
+		return Entry{}, fmt.Errorf("%w: %s", ErrSpaceNotFound, name)
+	}
+	return *entry, nil
+}
+
+// List returns all registered spaces.
+func (m *Manager) List() ([]Entry, error) {
+	st, err := m.state()
+	if err != nil {
+		return nil, err
+	}
+	return st.Registry.List(), nil
+}
+
+// Status returns the git status of the named space.
+func (m *Manager) Status(name string) (Status, error) {
+	entry, err := m.Get(name)
+	if err != nil {
+		return Status{}, err
+	}
+	return spaces.GetStatus(m.destDir, entry)
+}
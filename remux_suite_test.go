@@ -0,0 +1,13 @@
+package remux_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRemux(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Remux Suite")
+}
@@ -0,0 +1,128 @@
+package remux_test
+
+import (
+	"context"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux"
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/remuxtest"
+)
+
+var _ = Describe("Manager", func() {
+	const repoRoot = "/src/app"
+
+	var (
+		destDir  string
+		git      *remuxtest.Git
+		sessions *remuxtest.Sessions
+		manager  *remux.Manager
+	)
+
+	BeforeEach(func() {
+		destDir = GinkgoT().TempDir()
+		git = &remuxtest.Git{}
+		sessions = &remuxtest.Sessions{}
+
+		var err error
+		manager, err = remux.New(remux.Options{
+			DestDir:  destDir,
+			Registry: &registry.MemoryStore{},
+			Backend:  sessions,
+			Git:      git,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("manages the lifecycle of a space", func() {
+		ctx := context.Background()
+
+		entry, err := manager.Create(ctx, remux.CreateOptions{RepoRoot: repoRoot, BranchName: "feature"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry.Name).To(Equal("app-feature"))
+		Expect(entry.Path).To(Equal(filepath.Join(destDir, entry.Name)))
+		Expect(git.Branches(repoRoot)).To(Equal([]string{"feature"}))
+
+		// The registry lives in the store, not in the dest dir
+		Expect(filepath.Join(destDir, "spaces.yaml")).NotTo(BeAnExistingFile())
+		list, err := manager.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(ConsistOf(entry))
+
+		Expect(manager.Open(ctx, entry.Name, remux.OpenOptions{Detached: true})).To(Succeed())
+		session, ok := sessions.Session(entry.Name)
+		Expect(ok).To(BeTrue())
+		Expect(session.Workdir).To(Equal(entry.Path))
+		Expect(session.Env).To(HaveKeyWithValue("SPACE_PORT", "11010"))
+		Expect(sessions.Attached()).To(BeEmpty())
+
+		Expect(manager.Open(ctx, entry.Name, remux.OpenOptions{})).To(Succeed())
+		Expect(sessions.Attached()).To(Equal([]string{entry.Name}))
+
+		Expect(manager.Drop(ctx, entry.Name, remux.DropOptions{})).To(Succeed())
+		Expect(sessions.SessionExists(entry.Name)).To(BeFalse())
+		Expect(entry.Path).NotTo(BeADirectory())
+		_, err = manager.Get(entry.Name)
+		Expect(err).To(MatchError(remux.ErrSpaceNotFound))
+	})
+
+	It("stops when the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := manager.Create(ctx, remux.CreateOptions{RepoRoot: repoRoot, BranchName: "feature"})
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(git.Branches(repoRoot)).To(BeEmpty())
+		Expect(manager.List()).To(BeEmpty())
+
+		entry, err := manager.Create(context.Background(), remux.CreateOptions{RepoRoot: repoRoot, BranchName: "feature"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manager.Open(ctx, entry.Name, remux.OpenOptions{Detached: true})).To(MatchError(context.Canceled))
+		Expect(sessions.SessionExists(entry.Name)).To(BeFalse())
+	})
+
+	It("plans without changing anything", func() {
+		ctx := context.Background()
+		plan, err := manager.PlanCreate(ctx, remux.CreateOptions{RepoRoot: repoRoot, BranchName: "feature"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan).To(HaveLen(3))
+		Expect(git.Branches(repoRoot)).To(BeEmpty())
+		Expect(manager.List()).To(BeEmpty())
+
+		_, err = manager.PlanDrop(ctx, "app-feature", remux.DropOptions{})
+		Expect(err).To(MatchError(remux.ErrSpaceNotFound))
+	})
+
+	It("refuses to drop a dirty space", func() {
+		ctx := context.Background()
+		entry, err := manager.Create(ctx, remux.CreateOptions{RepoRoot: repoRoot, BranchName: "wip"})
+		Expect(err).NotTo(HaveOccurred())
+
+		git.SetDirty(entry.Path, true)
+		Expect(manager.Drop(ctx, entry.Name, remux.DropOptions{})).To(MatchError(remux.ErrDirtyWorktree))
+		Expect(manager.Get(entry.Name)).To(Equal(entry))
+	})
+
+	It("refuses existing branches unless reused", func() {
+		ctx := context.Background()
+		git.AddBranch(repoRoot, "main")
+
+		_, err := manager.Create(ctx, remux.CreateOptions{RepoRoot: repoRoot, BranchName: "main"})
+		Expect(err).To(MatchError(remux.ErrBranchExists))
+
+		entry, err := manager.Create(ctx, remux.CreateOptions{RepoRoot: repoRoot, BranchName: "main", ReuseExistingBranch: true})
+		Expect(err).NotTo(HaveOccurred())
+		branch, ok := git.Worktree(entry.Path)
+		Expect(ok).To(BeTrue())
+		Expect(branch).To(Equal("main"))
+	})
+
+	It("reports unknown spaces", func() {
+		Expect(manager.Drop(context.Background(), "missing", remux.DropOptions{})).To(MatchError(remux.ErrSpaceNotFound))
+		_, err := manager.Status("missing")
+		Expect(err).To(MatchError(remux.ErrSpaceNotFound))
+	})
+})
@@ -0,0 +1,352 @@
+package remuxtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/johanhenriksson/remux/git"
+)
+
+// Git is a GitClient that keeps branches and worktrees in memory.
+// Repositories are identified by their root path and need not exist on disk.
+// Worktrees are created as plain directories, so configs and hooks can be
+// used in them. The zero value has no branches. It is safe for concurrent use.
+type Git struct {
+	mu        sync.Mutex
+	branches  map[string][]string // keyed by repo root
+	worktrees map[string]worktree // keyed by path
+	dirty     map[string]bool     // keyed by worktree path
+	stashes   map[string][]string // stash messages keyed by repo root, latest last
+	remote    map[string][]string // remote-tracking branches such as upstream/main, keyed by repo root
+	fetches   map[string][]string // fetched remotes keyed by repo root
+	push      map[string]string   // push remotes keyed by repo root and branch
+	upstream  map[string]string   // upstreams keyed by repo root and branch
+}
+
+// worktree is a worktree recorded by Git.
+type worktree struct {
+	repoRoot string
+	branch   string
+}
+
+// AddBranch records an existing branch of repoRoot.
+func (g *Git) AddBranch(repoRoot, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.addBranch(repoRoot, name)
+}
+
+func (g *Git) addBranch(repoRoot, name string) {
+	if g.branches == nil {
+		g.branches = make(map[string][]string)
+	}
+	if !slices.Contains(g.branches[repoRoot], name) {
+		g.branches[repoRoot] = append(g.branches[repoRoot], name)
+	}
+}
+
+// Branches returns the branches of repoRoot in the order they were created.
+func (g *Git) Branches(repoRoot string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Clone(g.branches[repoRoot])
+}
+
+// Worktree returns the branch checked out in the worktree at path.
+func (g *Git) Worktree(path string) (branch string, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	wt, ok := g.worktrees[path]
+	return wt.branch, ok
+}
+
+// SetDirty marks the worktree at path as having uncommitted changes or not.
+func (g *Git) SetDirty(path string, dirty bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.dirty == nil {
+		g.dirty = make(map[string]bool)
+	}
+	g.dirty[path] = dirty
+}
+
+// CheckBranchName rejects the names `git check-ref-format` commonly rejects.
+func (g *Git) CheckBranchName(ctx context.Context, name string) error {
+	if name == "" || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") ||
+		strings.HasSuffix(name, ".lock") || strings.Contains(name, "..") ||
+		strings.ContainsAny(name, "~^:?*[\\") {
+		return fmt.Errorf("invalid branch name %q", name)
+	}
+	return nil
+}
+
+// BranchExists reports whether repoRoot has the branch.
+func (g *Git) BranchExists(ctx context.Context, repoRoot, name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Contains(g.branches[repoRoot], name)
+}
+
+// AddRemoteBranch records a remote-tracking branch of repoRoot. The first
+// branch added for a remote is its default branch.
+func (g *Git) AddRemoteBranch(repoRoot, remote, branch string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.remote == nil {
+		g.remote = make(map[string][]string)
+	}
+	g.remote[repoRoot] = append(g.remote[repoRoot], remote+"/"+branch)
+}
+
+// Fetches returns the remotes fetched in repoRoot, in order.
+func (g *Git) Fetches(repoRoot string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Clone(g.fetches[repoRoot])
+}
+
+// PushRemote returns the push remote set for a branch of repoRoot, or "".
+func (g *Git) PushRemote(repoRoot, branch string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.push[repoRoot+"\x00"+branch]
+}
+
+// Upstream returns the upstream set for a branch of repoRoot, or "".
+func (g *Git) Upstream(repoRoot, branch string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.upstream[repoRoot+"\x00"+branch]
+}
+
+// CreateBranch records a branch. start must be empty, an existing branch or
+// a recorded remote-tracking branch.
+// Like git, it fails once ctx is done.
+func (g *Git) CreateBranch(ctx context.Context, repoRoot, name, start string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if slices.Contains(g.branches[repoRoot], name) {
+		return fmt.Errorf("%w: %s", git.ErrBranchExists, name)
+	}
+	if start != "" && !slices.Contains(g.branches[repoRoot], start) && !slices.Contains(g.remote[repoRoot], start) {
+		return fmt.Errorf("unknown start point %s", start)
+	}
+	g.addBranch(repoRoot, name)
+	return nil
+}
+
+// DeleteBranch forgets a branch that no worktree has checked out.
+func (g *Git) DeleteBranch(ctx context.Context, repoRoot, name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for path, wt := range g.worktrees {
+		if wt.repoRoot == repoRoot && wt.branch == name {
+			return fmt.Errorf("branch %s is checked out at %s", name, path)
+		}
+	}
+	if !slices.Contains(g.branches[repoRoot], name) {
+		return fmt.Errorf("branch %s not found", name)
+	}
+	g.branches[repoRoot] = slices.DeleteFunc(g.branches[repoRoot], func(b string) bool { return b == name })
+	return nil
+}
+
+// AddWorktree creates the directory of a worktree with branch checked out.
+// Like git, it fails once ctx is done.
+func (g *Git) AddWorktree(ctx context.Context, repoRoot, path, branch string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !slices.Contains(g.branches[repoRoot], branch) {
+		return fmt.Errorf("branch %s not found", branch)
+	}
+	for other, wt := range g.worktrees {
+		if wt.repoRoot == repoRoot && wt.branch == branch {
+			return fmt.Errorf("branch %s is already checked out at %s", branch, other)
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	if g.worktrees == nil {
+		g.worktrees = make(map[string]worktree)
+	}
+	g.worktrees[path] = worktree{repoRoot: repoRoot, branch: branch}
+	return nil
+}
+
+// RemoveWorktree removes a clean worktree and its directory.
+func (g *Git) RemoveWorktree(ctx context.Context, repoRoot, worktreePath string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.worktrees[worktreePath]; !ok {
+		return fmt.Errorf("%s is not a worktree", worktreePath)
+	}
+	if g.dirty[worktreePath] {
+		return errors.New("worktree contains modified or untracked files")
+	}
+	delete(g.worktrees, worktreePath)
+	return os.RemoveAll(worktreePath)
+}
+
+// PruneWorktrees forgets worktrees whose directories no longer exist.
+func (g *Git) PruneWorktrees(ctx context.Context, repoRoot string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for path, wt := range g.worktrees {
+		if _, err := os.Stat(path); wt.repoRoot == repoRoot && os.IsNotExist(err) {
+			delete(g.worktrees, path)
+		}
+	}
+	return nil
+}
+
+// IsWorktree reports whether path is a recorded worktree.
+func (g *Git) IsWorktree(path string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.worktrees[path]
+	return ok
+}
+
+// HasUncommittedChanges reports whether the worktree was marked dirty.
+func (g *Git) HasUncommittedChanges(ctx context.Context, path string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.dirty[path]
+}
+
+// Stashes returns the messages of the stashes of repoRoot, latest last.
+func (g *Git) Stashes(repoRoot string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Clone(g.stashes[repoRoot])
+}
+
+// StashPush stashes the changes of a dirty worktree, or of a repository
+// root marked dirty, and marks it clean.
+func (g *Git) StashPush(ctx context.Context, path, message string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.dirty[path] {
+		return false, nil
+	}
+	if g.stashes == nil {
+		g.stashes = make(map[string][]string)
+	}
+	repo := g.repoOf(path)
+	g.stashes[repo] = append(g.stashes[repo], message)
+	g.dirty[path] = false
+	return true, nil
+}
+
+// StashPop drops the latest stash of the repository and marks path dirty.
+func (g *Git) StashPop(ctx context.Context, path string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	repo := g.repoOf(path)
+	if len(g.stashes[repo]) == 0 {
+		return errors.New("no stash entries found")
+	}
+	g.stashes[repo] = g.stashes[repo][:len(g.stashes[repo])-1]
+	if g.dirty == nil {
+		g.dirty = make(map[string]bool)
+	}
+	g.dirty[path] = true
+	return nil
+}
+
+// repoOf returns the repository root of a recorded worktree, or path itself.
+func (g *Git) repoOf(path string) string {
+	if wt, ok := g.worktrees[path]; ok {
+		return wt.repoRoot
+	}
+	return path
+}
+
+// GetMainRepoPath returns the repository a recorded worktree belongs to.
+func (g *Git) GetMainRepoPath(ctx context.Context, worktreePath string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	wt, ok := g.worktrees[worktreePath]
+	if !ok {
+		return "", fmt.Errorf("%s is not a worktree", worktreePath)
+	}
+	return wt.repoRoot, nil
+}
+
+// Fetch records a fetch of remote. Like git, it fails once ctx is done.
+func (g *Git) Fetch(ctx context.Context, repoRoot, remote string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.fetches == nil {
+		g.fetches = make(map[string][]string)
+	}
+	g.fetches[repoRoot] = append(g.fetches[repoRoot], remote)
+	return nil
+}
+
+// RemoteBranch returns a recorded remote-tracking branch, or the remote's
+// default branch if branch is empty.
+func (g *Git) RemoteBranch(ctx context.Context, repoRoot, remote, branch string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, ref := range g.remote[repoRoot] {
+		name, ok := strings.CutPrefix(ref, remote+"/")
+		if ok && (branch == "" || name == branch) {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("remote branch %s/%s not found", remote, branch)
+}
+
+// SetPushRemote records the push remote of an existing branch.
+func (g *Git) SetPushRemote(ctx context.Context, repoRoot, branch, remote string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !slices.Contains(g.branches[repoRoot], branch) {
+		return fmt.Errorf("branch %s not found", branch)
+	}
+	if g.push == nil {
+		g.push = make(map[string]string)
+	}
+	g.push[repoRoot+"\x00"+branch] = remote
+	return nil
+}
+
+// SetUpstream records the upstream of an existing branch, which must be a
+// recorded remote-tracking branch.
+func (g *Git) SetUpstream(ctx context.Context, repoRoot, branch, upstream string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !slices.Contains(g.branches[repoRoot], branch) {
+		return fmt.Errorf("branch %s not found", branch)
+	}
+	if !slices.Contains(g.remote[repoRoot], upstream) {
+		return fmt.Errorf("remote branch %s not found", upstream)
+	}
+	if g.upstream == nil {
+		g.upstream = make(map[string]string)
+	}
+	g.upstream[repoRoot+"\x00"+branch] = upstream
+	return nil
+}
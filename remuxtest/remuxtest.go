@@ -0,0 +1,124 @@
+// Package remuxtest provides in-memory implementations of the interfaces
+// remux uses to reach git and terminal multiplexers, so code that creates,
+// opens and drops spaces can be tested without a git binary or a tmux server.
+package remuxtest
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/spaces"
+)
+
+var (
+	_ spaces.SessionManager = (*Sessions)(nil)
+	_ spaces.GitClient      = (*Git)(nil)
+)
+
+// Session is a session recorded by Sessions.
+type Session struct {
+	Name    string
+	Workdir string
+	Env     map[string]string
+	Tabs    []config.Tab
+
+	LastActivity time.Time // When the session was started, unless set by SetActivity
+	Attached     bool      // Set by SetActivity
+}
+
+// Sessions is a SessionManager that records sessions instead of starting
+// them. The zero value has no sessions. It is safe for concurrent use.
+type Sessions struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+	attached []string
+}
+
+// Name returns "fake".
+func (s *Sessions) Name() string { return "fake" }
+
+// SessionExists reports whether the named session was started and not killed.
+func (s *Sessions) SessionExists(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.sessions[name]
+	return ok
+}
+
+// NewSession records a session. Returns spaces.ErrSessionExists if it is
+// running, or ctx's error once ctx is done.
+func (s *Sessions) NewSession(ctx context.Context, name, workdir string, env map[string]string, tabs []config.Tab) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[name]; ok {
+		return spaces.ErrSessionExists
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[string]Session)
+	}
+	s.sessions[name] = Session{Name: name, Workdir: workdir, Env: maps.Clone(env), Tabs: slices.Clone(tabs), LastActivity: time.Now()}
+	return nil
+}
+
+// Attach records that the named session was attached to.
+func (s *Sessions) Attach(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[name]; !ok {
+		return spaces.ErrNoSession
+	}
+	s.attached = append(s.attached, name)
+	return nil
+}
+
+// KillSession forgets the named session.
+func (s *Sessions) KillSession(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, name)
+}
+
+// Activity returns when the named session was last used and whether a
+// client is attached to it. Returns spaces.ErrNoSession if it isn't running.
+func (s *Sessions) Activity(name string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[name]
+	if !ok {
+		return time.Time{}, false, spaces.ErrNoSession
+	}
+	return session.LastActivity, session.Attached, nil
+}
+
+// SetActivity sets what Activity returns for the named running session.
+func (s *Sessions) SetActivity(name string, last time.Time, attached bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[name]; ok {
+		session.LastActivity = last
+		session.Attached = attached
+		s.sessions[name] = session
+	}
+}
+
+// Session returns the named running session.
+func (s *Sessions) Session(name string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[name]
+	return session, ok
+}
+
+// Attached returns the names of the sessions attached to, in order.
+func (s *Sessions) Attached() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.attached)
+}
@@ -0,0 +1,111 @@
+// Package screen runs space sessions in GNU screen, as a fallback for hosts
+// where tmux isn't installed.
+package screen
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Available reports whether screen is installed.
+func Available() bool {
+	_, err := exec.LookPath("screen")
+	return err == nil
+}
+
+// run executes a screen command and includes its output in the returned error.
+// screen reports most errors on stdout.
+func run(args ...string) error {
+	out, err := exec.Command("screen", args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("screen: %w: %s", err, msg)
+		}
+		return fmt.Errorf("screen: %w", err)
+	}
+	return nil
+}
+
+// SessionExists checks if a screen session with the given name exists.
+func SessionExists(name string) bool {
+	// screen -ls exits non-zero even when it lists sessions
+	out, _ := exec.Command("screen", "-ls", name).Output()
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// Sessions are listed as <pid>.<name>
+		if _, session, ok := strings.Cut(fields[0], "."); ok && session == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSessionDetached starts a detached session running a shell in workdir.
+// Windows created later inherit env.
+func NewSessionDetached(name, workdir string, env map[string]string) error {
+	cmd := exec.Command("screen", "-dmS", name)
+	cmd.Dir = workdir
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stderr bytes.Buffer
+	cmd.Stdout = &stderr
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("screen: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// NewWindow opens a window titled title in the session. Windows are numbered
+// from 0 in creation order. New windows start in the session's directory.
+func NewWindow(session, title string) error {
+	args := []string{"-S", session, "-X", "screen"}
+	if title != "" {
+		args = append(args, "-t", title)
+	}
+	return run(args...)
+}
+
+// RenameWindow sets the title of the window with the given number.
+func RenameWindow(session string, window int, title string) error {
+	return run("-S", session, "-p", strconv.Itoa(window), "-X", "title", title)
+}
+
+// SendKeys types keys into the window with the given number, followed by Enter.
+func SendKeys(session string, window int, keys string) error {
+	return run("-S", session, "-p", strconv.Itoa(window), "-X", "stuff", escape(keys)+"\n")
+}
+
+// SelectWindow makes the window with the given number the current one.
+func SelectWindow(session string, window int) error {
+	return run("-S", session, "-X", "select", strconv.Itoa(window))
+}
+
+// Attach attaches to a session, detaching it elsewhere if needed.
+func Attach(name string) error {
+	cmd := exec.Command("screen", "-d", "-r", name)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// KillSession kills a session if it exists.
+func KillSession(name string) {
+	_ = run("-S", name, "-X", "quit")
+}
+
+// escape protects the characters screen interprets in command arguments.
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `^`, `\^`, `$`, `\$`)
+	return r.Replace(s)
+}
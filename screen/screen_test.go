@@ -0,0 +1,48 @@
+package screen_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux/screen"
+)
+
+// fakeScreen installs a screen script on PATH that logs its arguments one per
+// line to a file named args in its directory, then runs body.
+func fakeScreen(body string) string {
+	dir := GinkgoT().TempDir()
+	script := "#!/bin/sh\nfor a in \"$@\"; do printf '%s\\n' \"$a\" >> \"$(dirname \"$0\")/args\"; done\n" + body + "\n"
+	Expect(os.WriteFile(filepath.Join(dir, "screen"), []byte(script), 0755)).To(Succeed())
+	GinkgoT().Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+var _ = Describe("Screen", func() {
+	It("finds sessions in screen -ls output", func() {
+		fakeScreen(`printf 'There are screens on:\n\t4242.repo-a\t(Detached)\n\t4243.repo-a.b\t(Attached)\n2 Sockets in /run/screen.\n'; exit 1`)
+
+		Expect(screen.SessionExists("repo-a")).To(BeTrue())
+		Expect(screen.SessionExists("repo-a.b")).To(BeTrue())
+		Expect(screen.SessionExists("repo")).To(BeFalse())
+	})
+
+	It("escapes keys sent to a window", func() {
+		dir := fakeScreen("")
+
+		Expect(screen.SendKeys("repo-a", 1, `echo $HOME ^C \n`)).To(Succeed())
+
+		args, err := os.ReadFile(filepath.Join(dir, "args"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(args)).To(Equal("-S\nrepo-a\n-p\n1\n-X\nstuff\necho \\$HOME \\^C \\\\n\n\n"))
+	})
+
+	It("includes screen's output in errors", func() {
+		fakeScreen(`echo "No screen session found."; exit 1`)
+
+		err := screen.RenameWindow("missing", 0, "editor")
+		Expect(err).To(MatchError(ContainSubstring("No screen session found.")))
+	})
+})
@@ -0,0 +1,116 @@
+package spaces
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ActivationVar is the shell variable in which the cd hook of shell-init
+// keeps the Activation of the space whose env it exported.
+const ActivationVar = "REMUX_ACTIVE_ENV"
+
+// envName matches the variable names a shell accepts.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidEnvName reports whether key is a valid shell variable name. The cd hook
+// only exports variables with valid names.
+func ValidEnvName(key string) bool {
+	return envName.MatchString(key)
+}
+
+// Activation records the env the cd hook exported into a shell for a space,
+// along with the values the variables had before, so leaving the space
+// restores them.
+type Activation struct {
+	Space string             `json:"space"`
+	Saved map[string]*string `json:"saved"` // Previous values, nil if unset
+}
+
+// ParseActivation decodes an Activation from the value of ActivationVar. An
+// empty or malformed value gives an empty Activation.
+func ParseActivation(value string) Activation {
+	var a Activation
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(data, &a) != nil {
+		return Activation{}
+	}
+	return a
+}
+
+// encode returns the value of ActivationVar for a.
+func (a Activation) encode() string {
+	data, _ := json.Marshal(a)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// ActivateScript returns the commands for the given shell that switch its env
+// from the activation prev to the named space's env: variables exported for
+// the previous space get their old values back, and those in env are
+// exported. An empty name only deactivates. lookup returns the shell's
+// current value of a variable. The script is empty when the space is already
+// active. The shell evaluates the script, so variables whose names aren't
+// valid shell names are left out, see ValidEnvName.
+func ActivateScript(shell string, prev Activation, name string, env map[string]string, lookup func(string) (string, bool)) string {
+	if name == prev.Space {
+		return ""
+	}
+
+	var lines []string
+	var unset []string
+	for _, key := range slices.Sorted(maps.Keys(prev.Saved)) {
+		if !ValidEnvName(key) {
+			continue
+		}
+		if value := prev.Saved[key]; value != nil {
+			lines = append(lines, exportLine(shell, key, *value))
+		} else {
+			unset = append(unset, key)
+		}
+	}
+	if name == "" {
+		unset = append(unset, ActivationVar)
+	}
+	if len(unset) > 0 {
+		lines = append(lines, unsetLine(shell, unset))
+	}
+	if name == "" {
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	next := Activation{Space: name, Saved: make(map[string]*string, len(env))}
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		if !ValidEnvName(key) {
+			continue
+		}
+		if saved, ok := prev.Saved[key]; ok {
+			next.Saved[key] = saved
+		} else if value, ok := lookup(key); ok {
+			next.Saved[key] = &value
+		} else {
+			next.Saved[key] = nil
+		}
+		lines = append(lines, exportLine(shell, key, env[key]))
+	}
+	lines = append(lines, exportLine(shell, ActivationVar, next.encode()))
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// exportLine returns the command exporting key=value in the given shell.
+func exportLine(shell, key, value string) string {
+	if shell == "fish" {
+		return "set -gx " + key + " " + fishQuote(value)
+	}
+	return "export " + key + "=" + shellQuote(value)
+}
+
+// unsetLine returns the command unsetting keys in the given shell.
+func unsetLine(shell string, keys []string) string {
+	if shell == "fish" {
+		return "set -e " + strings.Join(keys, " ")
+	}
+	return "unset " + strings.Join(keys, " ")
+}
@@ -0,0 +1,131 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+// AdoptOptions contains the parameters for adopting a tmux session.
+type AdoptOptions struct {
+	Session   string        // Name of the running tmux session to adopt
+	Name      string        // Space name if the session's checkout isn't registered yet (optional, see BindOptions)
+	BasePort  int           // First port that may be allocated to a newly bound space (optional, default: registry.BasePort)
+	PortCount int           // Number of ports from BasePort the space must fit in (optional, default: unlimited)
+	Limits    config.Limits // Space count limits a newly bound space must stay within (optional)
+}
+
+// Adoption describes the changes AdoptSession made.
+type Adoption struct {
+	Name    string    // Space the session belongs to now
+	Renamed bool      // The session was renamed to the space's session name
+	Env     EnvChange // Changes to the session env
+	Tabs    []string  // Names of the config tabs added as windows
+}
+
+// AdoptSession turns a tmux session started by hand into the session of a
+// space. The checkout the session was started in is registered like Bind,
+// unless it is a space already. The session is renamed to the space's session
+// name, its env is updated like ApplyEnv, and named config tabs it has no
+// window for are added; the windows it has are left alone. Returns
+// ErrSessionExists if the space already has another session, and
+// ErrUnsupportedBackend if the space's config selects another backend.
+func (st *State) AdoptSession(ctx context.Context, opts AdoptOptions) (Adoption, error) {
+	if !tmux.SessionExists(opts.Session) {
+		return Adoption{}, fmt.Errorf("%w: %s", ErrNoSession, opts.Session)
+	}
+	dir, err := tmux.SessionPath(opts.Session)
+	if err != nil {
+		return Adoption{}, fmt.Errorf("failed to get the session's directory: %w", err)
+	}
+	top, err := git.Toplevel(dir)
+	if err != nil {
+		return Adoption{}, fmt.Errorf("session %s was started in %s: %w", opts.Session, dir, err)
+	}
+	top = resolvePath(top)
+
+	// Checked before binding, so a conflict doesn't leave a registration behind
+	name := st.registeredAt(top)
+	if name == "" {
+		name = opts.Name
+		if name == "" {
+			name = filepath.Base(top)
+		}
+	}
+	if tmux.SessionName(name) != tmux.SessionName(opts.Session) && tmux.SessionExists(name) {
+		return Adoption{}, fmt.Errorf("%w: %s already has session %s", ErrSessionExists, name, tmux.SessionName(name))
+	}
+
+	name, err = st.Bind(ctx, BindOptions{Path: top, Name: name, BasePort: opts.BasePort, PortCount: opts.PortCount, Limits: opts.Limits})
+	if err != nil {
+		return Adoption{}, err
+	}
+	space, err := st.Space(name)
+	if err != nil {
+		return Adoption{}, err
+	}
+	backend, err := space.Backend()
+	if err != nil {
+		return Adoption{}, err
+	}
+	if backend.Name() != "tmux" {
+		return Adoption{}, fmt.Errorf("%w: adopting a tmux session, %s uses %s", ErrUnsupportedBackend, name, backend.Name())
+	}
+
+	adoption := Adoption{Name: name}
+	if tmux.SessionName(name) != tmux.SessionName(opts.Session) {
+		if err := tmux.RenameSession(opts.Session, name); err != nil {
+			return adoption, fmt.Errorf("failed to rename session: %w", err)
+		}
+		adoption.Renamed = true
+	}
+
+	env := make(map[string]string)
+	if err := space.sessionEnv(ctx, env, nil); err != nil {
+		return adoption, err
+	}
+	if adoption.Env, err = applyEnv(ctx, name, env); err != nil {
+		return adoption, err
+	}
+
+	adoption.Tabs, err = addMissingTabs(ctx, space, name)
+	return adoption, err
+}
+
+// addMissingTabs adds a window for each named config tab the session has no
+// window of that name for, and returns their names.
+func addMissingTabs(ctx context.Context, space *Space, session string) ([]string, error) {
+	tabs, err := space.Tabs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve tabs: %w", err)
+	}
+	windows, err := tmux.WindowNames(session)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for _, tab := range tabs {
+		if tab.Name == "" || slices.Contains(windows, tab.Name) {
+			continue
+		}
+		tab = withStatusReport(tab)
+		window, err := tmux.NewWindow(ctx, session, tab.WorkDir(space.Path), tab.Name, tab.Env)
+		if err != nil {
+			return added, err
+		}
+		if err := autoRename(ctx, session, window, tab); err != nil {
+			return added, err
+		}
+		if err := startTab(ctx, session, window, space.Path, tab); err != nil {
+			return added, err
+		}
+		added = append(added, tab.Name)
+	}
+	return added, nil
+}
@@ -0,0 +1,320 @@
+package spaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/screen"
+	"github.com/johanhenriksson/remux/terminal"
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+// SessionManager hosts the terminal sessions of spaces. tmux is the default; the
+// terminal backends open native terminal emulator tabs instead, for users who
+// don't want to nest a multiplexer inside their terminal.
+type SessionManager interface {
+	// Name returns the backend type, e.g. "tmux".
+	Name() string
+	// SessionExists reports whether the named session is running.
+	SessionExists(name string) bool
+	// NewSession starts a session with one tab per config tab in workdir and
+	// types each tab's command into its shell. Returns ErrSessionExists if the
+	// session is already running. Cancelling ctx stops the setup where the
+	// backend runs commands to perform it.
+	NewSession(ctx context.Context, name, workdir string, env map[string]string, tabs []config.Tab) error
+	// Attach brings the session to the foreground.
+	Attach(name string) error
+	// KillSession closes the session if it is running.
+	KillSession(name string)
+}
+
+// newBackend returns the backend of the given type for a space with the given
+// state dir. An empty type selects tmux, or screen if only screen is installed.
+func newBackend(kind, stateDir string) (SessionManager, error) {
+	switch kind {
+	case "":
+		if !tmux.Available() && screen.Available() {
+			return screenBackend{}, nil
+		}
+		return tmuxBackend{}, nil
+	case "tmux":
+		return tmuxBackend{}, nil
+	case "screen":
+		return screenBackend{}, nil
+	case "zellij":
+		return &zellijBackend{layout: filepath.Join(stateDir, zellijLayoutFile)}, nil
+	case "wezterm":
+		return terminal.WezTerm{}, nil
+	case "kitty":
+		return terminal.Kitty{}, nil
+	}
+	return nil, fmt.Errorf("unsupported backend %q (expected tmux, screen, zellij, wezterm or kitty)", kind)
+}
+
+// Backend returns the session backend selected by the space's config, or the
+// state's backend if one is set.
+func (s *Space) Backend() (SessionManager, error) {
+	if s.backend != nil {
+		return s.backend, nil
+	}
+	return newBackend(s.config.Backend, s.stateDir)
+}
+
+// tmuxBackend runs spaces in tmux sessions.
+type tmuxBackend struct{}
+
+func (tmuxBackend) Name() string { return "tmux" }
+
+func (tmuxBackend) SessionExists(name string) bool { return tmux.SessionExists(name) }
+
+func (tmuxBackend) NewSession(ctx context.Context, name, workdir string, env map[string]string, tabs []config.Tab) error {
+	// Create session detached so we can set up tabs before attaching
+	if err := tmux.NewSessionDetached(ctx, name, workdir, env); err != nil {
+		return err
+	}
+	// Lets ApplyEnv unset variables later removed from the config
+	if err := tmux.SetOption(name, envKeysOption, envKeys(env)); err != nil {
+		return fmt.Errorf("failed to record session environment: %w", err)
+	}
+	if len(tabs) > 0 {
+		if err := setupTabs(ctx, name, workdir, tabs); err != nil {
+			return fmt.Errorf("failed to setup tabs: %w", err)
+		}
+	}
+	return nil
+}
+
+// Attach attaches to the session, or switches to it when already inside tmux.
+func (tmuxBackend) Attach(name string) error {
+	if tmux.InSession() {
+		return tmux.SwitchTo(name)
+	}
+	return tmux.Attach(name)
+}
+
+func (tmuxBackend) KillSession(name string) { tmux.KillSession(name) }
+
+// SetTitle has tmux title the outer terminal while attached to the session.
+func (tmuxBackend) SetTitle(name, title string) error { return tmux.SetTitle(name, title) }
+
+// Activity returns when the session last had client input or pane output and
+// whether a client is attached to it.
+func (tmuxBackend) Activity(name string) (time.Time, bool, error) {
+	sessions, err := tmux.ListSessionActivity()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, s := range sessions {
+		if s.Name == tmux.SessionName(name) {
+			return s.LastActivity, s.Clients > 0, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("%w: %s", ErrNoSession, name)
+}
+
+// reportStatusVar is set in the shells of tabs whose name shows the exit
+// status of the last command, for the hook of remux shell-init to report it.
+const reportStatusVar = "REMUX_REPORT_STATUS"
+
+// setupTabs configures tmux windows based on tab configuration.
+// All windows are created first so their order matches the config, then
+// the tab commands are dispatched concurrently.
+func setupTabs(ctx context.Context, session, workdir string, tabs []config.Tab) error {
+	tabs = slices.Clone(tabs)
+	windows := make([]string, len(tabs))
+	for i := range tabs {
+		tabs[i] = withStatusReport(tabs[i])
+		tab := tabs[i]
+		if i == 0 {
+			// First tab uses the default window (active after session creation)
+			id, err := tmux.ActiveWindow(ctx, session)
+			if err != nil {
+				return err
+			}
+			if tab.Name != "" {
+				if err := tmux.RenameWindow(ctx, session, id, tab.Name); err != nil {
+					return err
+				}
+			}
+			// Its shell is already running, so it is told the tab's dir and env
+			if prelude := tab.Prelude(); prelude != "" {
+				if err := tmux.SendKeys(ctx, session, id, prelude); err != nil {
+					return err
+				}
+			}
+			windows[i] = id
+		} else {
+			// Create new windows for subsequent tabs
+			id, err := tmux.NewWindow(ctx, session, tab.WorkDir(workdir), tab.Name, tab.Env)
+			if err != nil {
+				return err
+			}
+			windows[i] = id
+		}
+		if err := autoRename(ctx, session, windows[i], tab); err != nil {
+			return err
+		}
+		if tab.LogFile != "" {
+			if err := os.MkdirAll(filepath.Dir(tab.LogFile), 0755); err != nil {
+				return err
+			}
+			if err := tmux.PipePane(ctx, session, windows[i], tab.LogFile); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Send commands to each window
+	var wg sync.WaitGroup
+	errs := make([]error, len(tabs))
+	for i, tab := range tabs {
+		if tab.Cmd == "" && len(tab.Panes) == 0 && !tab.Synchronize {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = startTab(ctx, session, windows[i], workdir, tab)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	// Select the first window
+	return tmux.SelectWindow(ctx, session, "{start}")
+}
+
+// withStatusReport returns the tab with reportStatusVar added to its env if
+// its name shows the exit status of the last command.
+func withStatusReport(tab config.Tab) config.Tab {
+	if !tab.ShowsExitStatus() {
+		return tab
+	}
+	tab.Env = maps.Clone(tab.Env)
+	if tab.Env == nil {
+		tab.Env = map[string]string{}
+	}
+	tab.Env[reportStatusVar] = "1"
+	return tab
+}
+
+// autoRename has tmux keep the tab's window named after what runs in it, if
+// the tab asks for it.
+func autoRename(ctx context.Context, session, window string, tab config.Tab) error {
+	format := tab.RenameFormat()
+	if format == "" {
+		return nil
+	}
+	return tmux.AutoRename(ctx, session, window, format)
+}
+
+// startTab splits the tab's window into its panes, if any, and types its
+// command into them.
+func startTab(ctx context.Context, session, window, workdir string, tab config.Tab) error {
+	if len(tab.Panes) > 0 || tab.Synchronize {
+		return setupPanes(ctx, session, window, workdir, tab)
+	}
+	if tab.Cmd == "" {
+		return nil
+	}
+	return tmux.SendKeys(ctx, session, window, tab.Cmd)
+}
+
+// setupPanes splits a window into one pane per tab pane, runs each pane's
+// command followed by the tab command, and turns on synchronize-panes if the
+// tab asks for it. Panes without a direction or size are tiled. Commands are
+// sent before synchronizing so each pane gets its own.
+func setupPanes(ctx context.Context, session, window, workdir string, tab config.Tab) error {
+	var splits []tmux.Split
+	for _, pane := range tab.Panes[min(1, len(tab.Panes)):] {
+		splits = append(splits, tmux.Split{Direction: pane.Direction, Size: pane.Size})
+	}
+	panes, err := tmux.SplitPanes(ctx, session, window, tab.WorkDir(workdir), tab.Env, splits)
+	if err != nil {
+		return err
+	}
+	if len(panes) > 1 && !tab.Arranged() {
+		if err := tmux.SelectLayout(ctx, session, window, "tiled"); err != nil {
+			return err
+		}
+	}
+
+	for i, pane := range panes {
+		var cmds []string
+		if i < len(tab.Panes) && tab.Panes[i].Cmd != "" {
+			cmds = append(cmds, tab.Panes[i].Cmd)
+		}
+		if tab.Cmd != "" {
+			cmds = append(cmds, tab.Cmd)
+		}
+		for _, cmd := range cmds {
+			if err := tmux.SendKeysToPane(ctx, pane, cmd); err != nil {
+				return err
+			}
+		}
+	}
+
+	if tab.Synchronize {
+		return tmux.SynchronizePanes(ctx, session, window)
+	}
+	return nil
+}
+
+// screenBackend runs spaces in GNU screen sessions.
+type screenBackend struct{}
+
+func (screenBackend) Name() string { return "screen" }
+
+func (screenBackend) SessionExists(name string) bool { return screen.SessionExists(name) }
+
+func (screenBackend) NewSession(ctx context.Context, name, workdir string, env map[string]string, tabs []config.Tab) error {
+	if screen.SessionExists(name) {
+		return fmt.Errorf("%w: %s", ErrSessionExists, name)
+	}
+	if err := screen.NewSessionDetached(name, workdir, env); err != nil {
+		return err
+	}
+
+	for i, tab := range tabs {
+		var err error
+		if i == 0 {
+			// The first tab uses the session's initial window
+			if tab.Name != "" {
+				err = screen.RenameWindow(name, 0, tab.Name)
+			}
+		} else {
+			err = screen.NewWindow(name, tab.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to setup tabs: %w", err)
+		}
+	}
+	for i, tab := range tabs {
+		for _, keys := range []string{tab.Prelude(), tab.Cmd} {
+			if keys == "" {
+				continue
+			}
+			if err := screen.SendKeys(name, i, keys); err != nil {
+				return fmt.Errorf("failed to setup tabs: %w", err)
+			}
+		}
+	}
+	if len(tabs) > 1 {
+		return screen.SelectWindow(name, 0)
+	}
+	return nil
+}
+
+func (screenBackend) Attach(name string) error { return screen.Attach(name) }
+
+func (screenBackend) KillSession(name string) { screen.KillSession(name) }
@@ -0,0 +1,124 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/johanhenriksson/remux/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// BatchSpace is a space of a manifest created by CreateBatch.
+type BatchSpace struct {
+	Name     string   `yaml:"name"`               // Name of the space, and of its branch unless the config sets branch_name
+	Base     string   `yaml:"base,omitempty"`     // Branch to start from (optional)
+	Template string   `yaml:"template,omitempty"` // Space template (optional)
+	Tags     []string `yaml:"tags,omitempty"`     // Tags added to the space (optional)
+}
+
+// manifest is the file read by LoadManifest.
+type manifest struct {
+	Spaces []BatchSpace `yaml:"spaces"`
+}
+
+// LoadManifest reads the spaces to create from a YAML file listing them
+// under a spaces key:
+//
+//	spaces:
+//	  - name: agent-1
+//	    base: main
+//	    template: review
+//	    tags: [agents]
+func LoadManifest(path string) ([]BatchSpace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, s := range m.Spaces {
+		if s.Name == "" {
+			return nil, fmt.Errorf("%s: space %d has no name", path, i+1)
+		}
+	}
+	return m.Spaces, nil
+}
+
+// BatchResult is the outcome of creating one space of a batch.
+type BatchResult struct {
+	Spec BatchSpace
+	Name string // Name of the created space
+	Path string // Worktree path, empty if creation failed
+	Port int    // First of the space's ports
+	Err  error  // Why creation failed, nil if it succeeded
+}
+
+// CreateBatch creates a space for each spec, running at most workers creates
+// at once (GOMAXPROCS if workers <= 0). opts holds the settings shared by the
+// batch, such as RepoRoot and SkipSetup; each spec names the space and its
+// branch, see NameBranch, and overrides the base and template. Spec tags are
+// added to the created space.
+//
+// A space that fails to be created is rolled back like Create and doesn't
+// stop the others. Results are in spec order; the error joins the failures.
+// Names used twice in specs fail before anything is created.
+func (st *State) CreateBatch(ctx context.Context, opts CreateOptions, specs []BatchSpace, workers int) ([]BatchResult, error) {
+	entries := make([]registry.Entry, len(specs))
+	seen := make(map[string]bool, len(specs))
+	for i, spec := range specs {
+		name := SpaceName(opts.RepoRoot, spec.Name)
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s is listed twice", ErrInvalidName, name)
+		}
+		seen[name] = true
+		entries[i] = registry.Entry{Name: spec.Name}
+	}
+
+	results := make([]BatchResult, len(specs))
+	err := Parallel(entries, workers, func(i int, _ registry.Entry) error {
+		spec := specs[i]
+		results[i].Spec = spec
+
+		o := opts
+		o.TakeChangesFrom = ""
+		if spec.Base != "" {
+			o.Base = spec.Base
+		}
+		if spec.Template != "" {
+			o.Template = spec.Template
+		}
+		var err error
+		if o.BranchName, o.Name, err = st.NameBranch(o.RepoRoot, o.Template, spec.Name); err != nil {
+			results[i].Err = err
+			return err
+		}
+		path, err := st.Create(ctx, o)
+		if err != nil {
+			results[i].Err = err
+			return err
+		}
+
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		name := filepath.Base(path)
+		if len(spec.Tags) > 0 {
+			_ = st.update(func(reg *registry.Registry) error {
+				for _, tag := range spec.Tags {
+					reg.AddTag(name, tag)
+				}
+				return nil
+			})
+		}
+		results[i].Name = name
+		results[i].Path = path
+		if entry := st.Registry.Get(name); entry != nil {
+			results[i].Port = entry.Port
+		}
+		return nil
+	})
+	return results, err
+}
@@ -0,0 +1,119 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// BindOptions contains the parameters for binding an existing checkout.
+type BindOptions struct {
+	Path      string        // Directory in the checkout to bind; its working tree root is used
+	Name      string        // Space name (optional, default: the checkout's directory name)
+	BasePort  int           // First port that may be allocated to the space (optional, default: registry.BasePort)
+	PortCount int           // Number of ports from BasePort the space must fit in (optional, default: unlimited)
+	Limits    config.Limits // Space count limits the binding must stay within (optional); the disk limit doesn't apply
+}
+
+// Bind registers an existing checkout, one remux didn't create, as a space
+// bound to its current path. It gets a port and sessions with the tabs and
+// env of its config like any other space, but stays where it is: dropping it
+// only unregisters it. Binding a checkout that is already registered returns
+// the name it is registered under. Binding counts towards the space count
+// limits of opts like creating does.
+func (st *State) Bind(ctx context.Context, opts BindOptions) (string, error) {
+	top, err := git.Toplevel(opts.Path)
+	if err != nil {
+		return "", err
+	}
+	top = resolvePath(top)
+	repoRoot, err := git.GetMainRepoPath(ctx, top)
+	if err != nil {
+		return "", fmt.Errorf("failed to find main repository: %w", err)
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(top)
+	}
+	if reason := nameProblem(name); reason != "" || strings.ContainsRune(name, filepath.Separator) {
+		if reason == "" {
+			reason = "contains a path separator"
+		}
+		return "", fmt.Errorf("%w: %q %s", ErrInvalidName, name, reason)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if registered := st.registeredAt(top); registered != "" {
+		return registered, nil
+	}
+	createOpts := CreateOptions{RepoRoot: resolvePath(repoRoot), BasePort: opts.BasePort, PortCount: opts.PortCount, Limits: opts.Limits}
+	err = st.update(func(reg *registry.Registry) error {
+		if entry := reg.Get(name); entry != nil {
+			return fmt.Errorf("%w: %s is registered for %s, pass another name", ErrSpaceExists, name, entry.Path)
+		}
+		if err := checkCountLimits(reg, createOpts); err != nil {
+			return err
+		}
+		if err := st.checkID(name, top, ""); err != nil {
+			return err
+		}
+		port, err := allocatePort(reg, createOpts)
+		if err != nil {
+			return err
+		}
+		reg.Add(name, top, port, resolvePath(repoRoot))
+		entry := reg.Get(name)
+		entry.Owner = st.user()
+		entry.Bound = true
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if space, err := st.Space(name); err == nil {
+		if err := space.CreateDockerNetwork(ctx); err != nil {
+			st.logger().Warn("failed to create docker network", "err", err)
+		}
+		if err := space.CreateCert(ctx); err != nil {
+			st.logger().Warn("failed to create cert", "err", err)
+		}
+		if err := space.RegisterHost(); err != nil {
+			st.logger().Warn("failed to register hostname", "err", err)
+		}
+	}
+	return name, nil
+}
+
+// registeredAt returns the name of the space whose path is the resolved path
+// top, or "" if none is registered there.
+func (st *State) registeredAt(top string) string {
+	for _, e := range st.Registry.List() {
+		if resolvePath(e.Path) == top {
+			return e.Name
+		}
+	}
+	return ""
+}
+
+// BoundAt returns the name of the bound checkout containing dir, or "" if
+// dir is in none.
+func (st *State) BoundAt(dir string) string {
+	dir = resolvePath(dir)
+	for _, e := range st.Registry.List() {
+		if !e.Bound {
+			continue
+		}
+		if _, ok := relativeTo(resolvePath(e.Path), dir); ok {
+			return e.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package spaces
+
+import (
+	"context"
+	"errors"
+
+	"github.com/johanhenriksson/remux/forge"
+	"github.com/johanhenriksson/remux/git"
+)
+
+// BranchURL returns the forge web URL of the space's branch, or of the
+// repository if no branch is checked out. No forge API is called.
+func (s *Space) BranchURL() (string, error) {
+	f, err := forge.Open(s.Path)
+	if err != nil {
+		return "", err
+	}
+	branch, err := git.CurrentBranch(s.Path)
+	if err != nil {
+		return f.RepoURL(), nil
+	}
+	return f.BranchURL(branch), nil
+}
+
+// BrowseURL returns the web URL that best describes the space: the open pull
+// request of its branch, the branch itself once pushed, or the repository.
+func (s *Space) BrowseURL(ctx context.Context) (string, error) {
+	f, err := forge.Open(s.Path)
+	if err != nil {
+		return "", err
+	}
+	branch, err := git.CurrentBranch(s.Path)
+	if err != nil || !git.HasUpstream(s.Path) {
+		return f.RepoURL(), nil
+	}
+
+	pr, err := f.ResolvePR(ctx, branch)
+	if err == nil {
+		return pr.URL, nil
+	}
+	if !errors.Is(err, forge.ErrNotFound) {
+		return "", err
+	}
+	return f.BranchURL(branch), nil
+}
@@ -0,0 +1,37 @@
+package spaces
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// HTTPS certificate files in a space's state dir, see config.Cert.
+const (
+	certFile = "cert.pem"
+	keyFile  = "key.pem"
+)
+
+// CertFile returns the path of the space's HTTPS certificate.
+func (s *Space) CertFile() string {
+	return filepath.Join(s.stateDir, certFile)
+}
+
+// KeyFile returns the path of the key of the space's HTTPS certificate.
+func (s *Space) KeyFile() string {
+	return filepath.Join(s.stateDir, keyFile)
+}
+
+// CertEnv returns the TLS_CERT_FILE, TLS_KEY_FILE and TLS_DOMAIN variables of the space.
+func (s *Space) CertEnv() (map[string]string, error) {
+	return s.config.CertEnv(s.configSpace())
+}
+
+// CreateCert makes the space's HTTPS certificate with mkcert if the config asks for one.
+func (s *Space) CreateCert(ctx context.Context) error {
+	return s.config.CreateCert(ctx, s.configSpace())
+}
+
+// RemoveCert removes the certificate made by CreateCert.
+func (s *Space) RemoveCert() error {
+	return s.config.RemoveCert(s.configSpace())
+}
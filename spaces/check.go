@@ -0,0 +1,146 @@
+package spaces
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/johanhenriksson/remux/git"
+)
+
+// ErrChecksFailed is returned when a space fails its readiness checklist.
+var ErrChecksFailed = errors.New("checks failed")
+
+// CheckResult is the outcome of one check of a space's readiness checklist.
+type CheckResult struct {
+	Name   string // clean, rebased, markers, test or lint
+	Err    error  // Why the check failed, nil if it passed
+	Output string // Output of a failed command, or the lines containing markers
+}
+
+// Passed reports whether the check passed.
+func (r CheckResult) Passed() bool {
+	return r.Err == nil
+}
+
+// Check runs the readiness checklist of the named space, configured by the
+// check section of its config:
+//
+//   - clean: the worktree has no uncommitted changes or untracked files
+//   - rebased: the branch contains its base branch (see BaseBranch)
+//   - markers: no line added since the base branch contains a marker such as TODO
+//   - test, lint: the configured command passes
+//
+// All checks run even if an earlier one fails. The error is only set if the
+// checks couldn't be run; failed checks are reported in the results.
+func (st *State) Check(ctx context.Context, name string) ([]CheckResult, error) {
+	space, err := st.Space(name)
+	if err != nil {
+		return nil, err
+	}
+	base, err := st.BaseBranch(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg := space.config.Check
+
+	var results []CheckResult
+	if !cfg.Skipped("clean") {
+		result := CheckResult{Name: "clean"}
+		if git.HasUncommittedChanges(ctx, space.Path) {
+			result.Err = ErrDirtyWorktree
+		}
+		results = append(results, result)
+	}
+	if !cfg.Skipped("rebased") {
+		result := CheckResult{Name: "rebased"}
+		if !git.IsAncestor(space.Path, base, "HEAD") {
+			result.Err = fmt.Errorf("not rebased on %s", base)
+		}
+		results = append(results, result)
+	}
+	if !cfg.Skipped("markers") {
+		result := CheckResult{Name: "markers"}
+		lines, err := addedMarkers(ctx, space.Path, base, cfg.MarkerWords())
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) > 0 {
+			result.Err = fmt.Errorf("%d added lines contain %s", len(lines), strings.Join(cfg.MarkerWords(), ", "))
+			result.Output = strings.Join(lines, "\n")
+		}
+		results = append(results, result)
+	}
+
+	commands := []struct{ name, command string }{{"test", cfg.Test}, {"lint", cfg.Lint}}
+	for _, c := range commands {
+		if c.command == "" || cfg.Skipped(c.name) {
+			continue
+		}
+		var out bytes.Buffer
+		result := CheckResult{Name: c.name}
+		if err := space.config.RunCheckCommand(ctx, space.configSpace(), c.command, &out); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			result.Err = fmt.Errorf("%s: %w", c.command, err)
+			result.Output = strings.TrimRight(out.String(), "\n")
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// hunkHeader matches the header of a diff hunk, capturing the first line number in the new file.
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)`)
+
+// addedMarkers returns the lines added to the worktree at path since it
+// diverged from base that contain one of the markers as a word, as
+// "file:line: text".
+func addedMarkers(ctx context.Context, path, base string, markers []string) ([]string, error) {
+	quoted := make([]string, len(markers))
+	for i, m := range markers {
+		quoted[i] = regexp.QuoteMeta(m)
+	}
+	pattern, err := regexp.Compile(`\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	if err != nil {
+		return nil, err
+	}
+
+	mergeBase, err := git.MergeBase(ctx, path, base, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var diff bytes.Buffer
+	if err := git.Diff(ctx, path, mergeBase, &diff, "--unified=0", "--no-color", "--no-ext-diff"); err != nil {
+		return nil, fmt.Errorf("failed to diff against %s: %w", base, err)
+	}
+
+	var result []string
+	var file string
+	var line int
+	scanner := bufio.NewScanner(&diff)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+		case strings.HasPrefix(text, "@@ "):
+			if m := hunkHeader.FindStringSubmatch(text); m != nil {
+				line, _ = strconv.Atoi(m[1])
+			}
+		case strings.HasPrefix(text, "+"):
+			if pattern.MatchString(text[1:]) {
+				result = append(result, fmt.Sprintf("%s:%d: %s", file, line, strings.TrimSpace(text[1:])))
+			}
+			line++
+		}
+	}
+	return result, scanner.Err()
+}
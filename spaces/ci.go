@@ -0,0 +1,68 @@
+package spaces
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/johanhenriksson/remux/forge"
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/registry"
+	"gopkg.in/yaml.v3"
+)
+
+const ciCacheFile = "ci.yaml"
+
+// CICacheTTL bounds how long a pending or unknown CI status is trusted.
+// Finished results are cached until the branch moves to another commit.
+var CICacheTTL = time.Minute
+
+// ciCache is the on-disk cache record for a space's CI status.
+type ciCache struct {
+	Commit  string        `yaml:"commit"`
+	Checked time.Time     `yaml:"checked"`
+	State   forge.CIState `yaml:"state"`
+	URL     string        `yaml:"url,omitempty"`
+}
+
+// GetCIStatus returns the forge CI status of the commit checked out in a space.
+// Results are cached in the space's state dir. Branches without an upstream
+// have not been pushed, so their status is unknown without asking the forge.
+func GetCIStatus(ctx context.Context, destDir string, entry registry.Entry) (*forge.CIStatus, error) {
+	head, err := git.Head(entry.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !git.HasUpstream(entry.Path) {
+		return &forge.CIStatus{State: forge.CIUnknown}, nil
+	}
+
+	cachePath := filepath.Join(StateDir(destDir, entry.Name), ciCacheFile)
+	if data, err := os.ReadFile(cachePath); err == nil {
+		var cached ciCache
+		if yaml.Unmarshal(data, &cached) == nil && cached.Commit == head && (cached.State.Done() || time.Since(cached.Checked) < CICacheTTL) {
+			return &forge.CIStatus{State: cached.State, URL: cached.URL}, nil
+		}
+	}
+
+	f, err := forge.Open(entry.Path)
+	if err != nil {
+		return nil, err
+	}
+	status, err := f.CIStatus(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache write failures only cost performance
+	if ReadOnlyCaches {
+		return status, nil
+	}
+	if data, err := yaml.Marshal(ciCache{Commit: head, Checked: time.Now(), State: status.State, URL: status.URL}); err == nil {
+		if os.MkdirAll(filepath.Dir(cachePath), 0755) == nil {
+			_ = os.WriteFile(cachePath, data, 0644)
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,75 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+// conflictWindow is the name of the tmux window ResolveConflicts opens.
+const conflictWindow = "conflicts"
+
+// ConflictError is returned when a rebase of a stack sync stops on
+// conflicts. The rebase is left in progress in the space's worktree.
+type ConflictError struct {
+	Space string
+	Path  string
+	Onto  string   // Branch the space was rebased onto
+	Files []string // Files with unresolved conflicts
+}
+
+func (e *ConflictError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "rebase of %s onto %s stopped on conflicts", e.Space, e.Onto)
+	if len(e.Files) > 0 {
+		b.WriteString(" in:")
+		for _, f := range e.Files {
+			b.WriteString("\n  " + f)
+		}
+	}
+	fmt.Fprintf(&b, "\nresolve them in %s and run stack sync --continue, or stack sync --abort to undo the sync", e.Path)
+	return b.String()
+}
+
+// Is reports whether target is ErrConflict.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ResolveConflicts runs the conflicts command of the named space, see
+// config.Conflicts, in a new window of its session if the session is running
+// in tmux. Otherwise, with foreground set, the command runs attached to the
+// terminal until it exits. Reports whether a window was opened.
+func (st *State) ResolveConflicts(ctx context.Context, name string, foreground bool) (bool, error) {
+	space, err := st.Space(name)
+	if err != nil {
+		return false, err
+	}
+	command, err := space.config.ConflictCommand(space.configSpace())
+	if err != nil {
+		return false, err
+	}
+	if backend, err := space.Backend(); err == nil && backend.Name() == "tmux" && backend.SessionExists(space.Name) {
+		window, err := tmux.NewWindow(ctx, space.Name, space.Path, conflictWindow, nil)
+		if err != nil {
+			return false, fmt.Errorf("failed to open conflicts window: %w", err)
+		}
+		if err := tmux.SendKeys(ctx, space.Name, window, command); err != nil {
+			return true, err
+		}
+		return true, tmux.SelectWindow(ctx, space.Name, window)
+	}
+	if !foreground {
+		return false, nil
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = space.Path
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return false, cmd.Run()
+}
@@ -1,66 +1,474 @@
 package spaces
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/config"
 	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // CreateOptions contains the parameters for creating a new space.
 type CreateOptions struct {
-	RepoRoot            string // Git repository root
-	DestDir             string // Destination directory for worktrees
-	BranchName          string // Name of the branch to create
-	ReuseExistingBranch bool   // If true, reuse existing branch instead of erroring
+	RepoRoot            string        // Git repository root
+	DestDir             string        // Destination directory for worktrees (State.Create uses the state's dest dir)
+	BranchName          string        // Name of the branch to create
+	Name                string        // Name the space is named after instead of BranchName (optional), see SpaceName
+	ReuseExistingBranch bool          // If true, reuse existing branch instead of erroring
+	Timings             *Timings      // Records the duration of each phase (optional)
+	Issue               string        // URL of the issue the space is created for (optional)
+	Base                string        // Branch, tag or commit to start a new branch from (optional, default: the main repository's HEAD)
+	Track               string        // Remote branch such as origin/feature the new branch is fetched from and tracks, instead of starting from Base (optional)
+	Parent              string        // Name of the space this one is stacked on (optional)
+	SkipSetup           bool          // Don't run the setup installers even if enabled in the config
+	Template            string        // Space template whose config lies beneath the repository's (optional), see config.LoadTemplate
+	BasePort            int           // First port that may be allocated to the space (optional, default: registry.BasePort)
+	PortCount           int           // Number of ports from BasePort the space must fit in (optional, default: unlimited)
+	Port                int           // First port of the space, instead of allocating one (optional); may be in use, but not reserved by another space
+	TakeChangesFrom     string        // Checkout whose uncommitted changes are moved into the space (optional)
+	Limits              config.Limits // Space count and disk limits checked before anything is created (optional)
 }
 
 // Create creates a git worktree and registers it as a space.
 // If the branch doesn't exist, it creates a new one.
 // If the branch exists and ReuseExistingBranch is true, it reuses it.
+// If Track is set, the new branch is created at that remote branch once its
+// remote is fetched, and tracks it.
 // Returns the worktree path on success.
-func Create(opts CreateOptions) (string, error) {
-	repoName := filepath.Base(opts.RepoRoot)
-	worktreePath := filepath.Join(opts.DestDir, fmt.Sprintf("%s-%s", repoName, opts.BranchName))
-
-	if _, err := os.Stat(worktreePath); err == nil {
-		return "", fmt.Errorf("worktree directory already exists: %s", worktreePath)
+// If TakeChangesFrom is set, the uncommitted changes of that checkout, including
+// untracked files, are stashed before the branch is created and applied to the
+// new worktree once it is set up. Changes that don't apply cleanly are kept in
+// the stash.
+// If the space would exceed opts.Limits, an error wrapping ErrLimitReached
+// is returned before anything is created.
+// If ctx is cancelled before the space is fully set up, everything created so
+// far is rolled back and ctx.Err() is returned.
+func Create(ctx context.Context, opts CreateOptions) (string, error) {
+	st, err := LoadState(opts.DestDir)
+	if err != nil {
+		return "", err
 	}
+	return st.Create(ctx, opts)
+}
 
-	branchExists := git.BranchExists(opts.RepoRoot, opts.BranchName)
+// Create creates a git worktree and registers it in the state's registry.
+// See Create for details.
+func (st *State) Create(ctx context.Context, opts CreateOptions) (_ string, err error) {
+	ctx, span := telemetry.Start(ctx, "create",
+		attribute.String("remux.repo", opts.RepoRoot),
+		attribute.String("remux.branch", opts.BranchName),
+	)
+	defer func() { telemetry.End(span, err) }()
+	g := st.gitClient()
+	tmpl, err := applyTemplate(&opts)
+	if err != nil {
+		return "", err
+	}
+	st.mu.Lock()
+	worktreePath, branchExists, err := st.checkCreate(ctx, opts)
+	st.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if err := checkDiskLimit(st.DestDir, opts.Limits); err != nil {
+		return "", err
+	}
 	createdBranch := false
 
-	if branchExists && !opts.ReuseExistingBranch {
-		return "", fmt.Errorf("branch %q already exists", opts.BranchName)
+	// Journaled until done, so Recover can roll back if the process is killed
+	op := Operation{Kind: OperationCreate, Name: filepath.Base(worktreePath), Path: worktreePath, RepoRoot: opts.RepoRoot, Branch: opts.BranchName}
+	if err := st.journal(op); err != nil {
+		return "", err
+	}
+	defer st.finish(op.Name)
+
+	stashed := false
+	if opts.TakeChangesFrom != "" {
+		phaseCtx, done := opts.Timings.Track(ctx, "git stash")
+		stashed, err = g.StashPush(phaseCtx, opts.TakeChangesFrom, "remux: changes for "+opts.BranchName)
+		done()
+		if err != nil {
+			return "", fmt.Errorf("failed to stash changes: %w", err)
+		}
+		if stashed {
+			op.StashedFrom = opts.TakeChangesFrom
+			if err := st.journal(op); err != nil {
+				st.restoreStash(ctx, opts, stashed)
+				return "", err
+			}
+		}
 	}
 
 	if !branchExists {
-		if err := git.CreateBranch(opts.RepoRoot, opts.BranchName); err != nil {
+		// Recorded first: the branch may exist once git is killed while making it
+		op.CreatedBranch = true
+		if err := st.journal(op); err != nil {
+			st.restoreStash(ctx, opts, stashed)
+			return "", err
+		}
+
+		remotes := st.remotes(opts, tmpl)
+		if fetch := fetchRemote(opts, remotes); fetch != "" {
+			phaseCtx, done := opts.Timings.Track(ctx, "git fetch")
+			err := g.Fetch(phaseCtx, opts.RepoRoot, fetch)
+			done()
+			if err != nil {
+				st.logger().Warn("failed to fetch, starting from the last fetched state", "remote", fetch, "err", err)
+			}
+		}
+
+		phaseCtx, done := opts.Timings.Track(ctx, "git branch")
+		var start string
+		var err error
+		if opts.Track != "" {
+			remote, branch, _ := strings.Cut(opts.Track, "/")
+			start, err = g.RemoteBranch(phaseCtx, opts.RepoRoot, remote, branch)
+		} else {
+			start = st.startPoint(phaseCtx, opts, remotes)
+		}
+		if err == nil {
+			err = g.CreateBranch(phaseCtx, opts.RepoRoot, opts.BranchName, start)
+		}
+		done()
+		if err != nil {
+			st.restoreStash(ctx, opts, stashed)
 			return "", fmt.Errorf("failed to create branch: %w", err)
 		}
 		createdBranch = true
+
+		if opts.Track != "" {
+			if err := g.SetUpstream(ctx, opts.RepoRoot, opts.BranchName, start); err != nil {
+				st.logger().Warn("failed to set upstream", "upstream", start, "err", err)
+			}
+		} else if remotes.Push != "" {
+			if err := g.SetPushRemote(ctx, opts.RepoRoot, opts.BranchName, remotes.Push); err != nil {
+				st.logger().Warn("failed to set push remote", "remote", remotes.Push, "err", err)
+			}
+		}
 	}
 
-	if err := git.AddWorktree(opts.RepoRoot, worktreePath, opts.BranchName); err != nil {
-		if createdBranch {
-			_ = git.DeleteBranch(opts.RepoRoot, opts.BranchName)
+	phaseCtx, done := opts.Timings.Track(ctx, "worktree add")
+	err = g.AddWorktree(phaseCtx, opts.RepoRoot, worktreePath, opts.BranchName)
+	done()
+	if err != nil {
+		st.rollbackCreate(ctx, opts, worktreePath, createdBranch, stashed)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
 		}
 		return "", fmt.Errorf("failed to create worktree: %w", err)
 	}
 
 	// Register the new space
-	reg, err := registry.Load(opts.DestDir)
+	name := filepath.Base(worktreePath)
+	st.mu.Lock()
+	err = st.update(func(reg *registry.Registry) error {
+		port, err := allocatePort(reg, opts)
+		if err != nil {
+			return err
+		}
+		// Other creates may have registered spaces since checkCreate
+		if err := checkCountLimits(reg, opts); err != nil {
+			return err
+		}
+		if err := st.checkID(name, worktreePath, opts.Template); err != nil {
+			return err
+		}
+		reg.Add(name, worktreePath, port, opts.RepoRoot)
+		entry := reg.Get(name)
+		entry.Owner = st.user()
+		entry.Issue = opts.Issue
+		entry.Parent = opts.Parent
+		entry.Template = opts.Template
+		entry.Base = opts.Base
+		return nil
+	})
+	if err != nil {
+		st.mu.Unlock()
+		st.rollbackCreate(ctx, opts, worktreePath, createdBranch, stashed)
+		return "", err
+	}
+
+	// Run setup and on_create hooks (warn on failure, don't abort)
+	_, done = opts.Timings.Track(ctx, "config load")
+	space, err := st.Space(name)
+	done()
+	st.mu.Unlock()
+	if err == nil && len(space.config.Cache.Copy)+len(space.config.Cache.Link) > 0 {
+		phaseCtx, done = opts.Timings.Track(ctx, "warm cache")
+		space.WarmCache(phaseCtx, opts.RepoRoot)
+		done()
+	}
 	if err == nil {
-		reg.Add(filepath.Base(worktreePath), worktreePath, reg.AllocatePort(), opts.RepoRoot)
-		_ = reg.Save(opts.DestDir)
+		if err := space.CreateDockerNetwork(ctx); err != nil {
+			st.logger().Warn("failed to create docker network", "err", err)
+		}
+		if err := space.WriteComposeOverride(); err != nil {
+			st.logger().Warn("failed to write compose override", "err", err)
+		}
+		if err := space.CreateCert(ctx); err != nil {
+			st.logger().Warn("failed to create cert", "err", err)
+		}
+		if err := space.RegisterHost(); err != nil {
+			st.logger().Warn("failed to register hostname", "err", err)
+		}
+	}
+	if err == nil && space.config.Setup.Auto && !opts.SkipSetup {
+		phaseCtx, done = opts.Timings.Track(ctx, "setup")
+		space.RunSetup(phaseCtx)
+		done()
+	}
+	if err == nil && ctx.Err() == nil && space.hooksInSession() {
+		if err := space.deferCreateHooks(); err != nil {
+			st.logger().Warn("failed to defer on_create hooks to the session", "err", err)
+		}
+	} else if err == nil && ctx.Err() == nil {
+		phaseCtx, done = opts.Timings.Track(ctx, "on_create hooks")
+		space.RunOnCreate(phaseCtx)
+		done()
 	}
 
-	// Run on_create hooks (warn on failure, don't abort)
-	if space, err := Open(worktreePath); err == nil {
-		space.RunOnCreate()
+	// Interrupted during setup: don't leave a half-initialized space behind
+	if ctx.Err() != nil {
+		st.rollbackCreate(ctx, opts, worktreePath, createdBranch, stashed)
+		return "", ctx.Err()
+	}
+
+	if stashed {
+		phaseCtx, done = opts.Timings.Track(ctx, "git stash pop")
+		err := g.StashPop(phaseCtx, worktreePath)
+		done()
+		if err != nil {
+			st.logger().Warn("failed to apply taken changes, they are kept in the stash", "from", opts.TakeChangesFrom, "err", err)
+		}
 	}
 
 	return worktreePath, nil
 }
+
+// checkCreate validates opts against the repository and dest dir. Returns the
+// worktree path of the new space and whether its branch already exists.
+func (st *State) checkCreate(ctx context.Context, opts CreateOptions) (string, bool, error) {
+	g := st.gitClient()
+	if err := validateBranchName(ctx, opts.BranchName, g.CheckBranchName); err != nil {
+		return "", false, err
+	}
+	if opts.Name != "" {
+		if err := validateBranchName(ctx, opts.Name, g.CheckBranchName); err != nil {
+			return "", false, err
+		}
+	}
+
+	if opts.Track != "" {
+		if opts.Base != "" {
+			return "", false, fmt.Errorf("can't both track %s and start from %s", opts.Track, opts.Base)
+		}
+		if remote, branch, ok := strings.Cut(opts.Track, "/"); !ok || remote == "" || branch == "" {
+			return "", false, fmt.Errorf("invalid remote branch %q (expected a remote and branch such as origin/feature)", opts.Track)
+		}
+	}
+
+	worktreePath := filepath.Join(st.DestDir, SpaceName(opts.RepoRoot, opts.spaceName()))
+	if _, err := os.Stat(worktreePath); err == nil {
+		return "", false, fmt.Errorf("%w: worktree directory %s", ErrSpaceExists, worktreePath)
+	}
+
+	branchExists := g.BranchExists(ctx, opts.RepoRoot, opts.BranchName)
+	if branchExists && !opts.ReuseExistingBranch {
+		return "", false, fmt.Errorf("%w: %s", ErrBranchExists, opts.BranchName)
+	}
+	if _, err := allocatePort(st.Registry, opts); err != nil {
+		return "", false, err
+	}
+	if err := checkCountLimits(st.Registry, opts); err != nil {
+		return "", false, err
+	}
+	return worktreePath, branchExists, nil
+}
+
+// spaceName returns the name the space of opts is named after.
+func (opts CreateOptions) spaceName() string {
+	if opts.Name != "" {
+		return opts.Name
+	}
+	return opts.BranchName
+}
+
+// checkID returns an error wrapping ErrSpaceExists if the ID the config of
+// the worktree gives the named space is already the ID of a registered space.
+// Docker networks, databases and the like are often named after the ID, so
+// two spaces sharing one would share those. Each registered space's ID is
+// derived by its own config. Must be called with st.mu held, so concurrent
+// creates can't both take an ID.
+func (st *State) checkID(name, worktreePath, template string) error {
+	cfg, err := st.config(worktreePath, template)
+	if err != nil {
+		return err
+	}
+	id := cfg.SpaceID(name)
+	for _, e := range st.Registry.List() {
+		if e.Name == name {
+			continue
+		}
+		other, err := st.config(e.Path, e.Template)
+		if err != nil {
+			continue
+		}
+		if other.SpaceID(e.Name) == id {
+			return fmt.Errorf("%w: %s would have the ID %s of %s, set id.hash in the config to tell them apart", ErrSpaceExists, name, id, e.Name)
+		}
+	}
+	return nil
+}
+
+// applyTemplate loads the space template named by opts, if any, and uses its
+// base branch unless opts has one.
+func applyTemplate(opts *CreateOptions) (*config.SpaceTemplate, error) {
+	if opts.Template == "" {
+		return nil, nil
+	}
+	tmpl, err := config.LoadTemplate(opts.Template)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Base == "" {
+		opts.Base = tmpl.Base
+	}
+	return tmpl, nil
+}
+
+// repoConfig returns the config of the repository a new space starts from,
+// merged over the config of tmpl if set.
+func repoConfig(repoRoot string, tmpl *config.SpaceTemplate) (*config.Config, error) {
+	cfg, err := config.Load(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if tmpl != nil {
+		cfg = tmpl.Beneath(cfg)
+	}
+	return cfg, nil
+}
+
+// remotes returns the remotes section of the repository's config. A config
+// that fails to load is warned about, as setup and hooks will be skipped.
+func (st *State) remotes(opts CreateOptions, tmpl *config.SpaceTemplate) config.Remotes {
+	cfg, err := repoConfig(opts.RepoRoot, tmpl)
+	if err != nil {
+		st.logger().Warn("using local branches", "err", err)
+		return config.Remotes{}
+	}
+	return cfg.Remotes
+}
+
+// fetchRemote returns the remote fetched before the new branch of opts is
+// created: the remote of the tracked branch, or the base remote if the
+// config asks for it. Returns "" if nothing is fetched.
+func fetchRemote(opts CreateOptions, remotes config.Remotes) string {
+	if opts.Track != "" {
+		remote, _, _ := strings.Cut(opts.Track, "/")
+		return remote
+	}
+	if remotes.Base != "" && remotes.Fetch {
+		return remotes.Base
+	}
+	return ""
+}
+
+// startPoint returns where the new branch of opts starts. With a base remote,
+// that is the remote's branch named by opts.Base, or its default branch;
+// otherwise, or if the remote doesn't have the branch, opts.Base itself.
+func (st *State) startPoint(ctx context.Context, opts CreateOptions, remotes config.Remotes) string {
+	if remotes.Base == "" {
+		return opts.Base
+	}
+	start, err := st.gitClient().RemoteBranch(ctx, opts.RepoRoot, remotes.Base, opts.Base)
+	if err != nil {
+		st.logger().Warn("starting from the local branch", "err", err)
+		return opts.Base
+	}
+	return start
+}
+
+// allocatePort returns the lowest free port range at or after opts.BasePort,
+// within opts.PortCount ports of it if set, or opts.Port if set. A range is
+// free when no space reserves it and no other process listens on its ports,
+// so the ranges of dropped spaces are reused once their processes are gone.
+// An opts.Port whose range doesn't fit in the TCP ports is refused.
+func allocatePort(reg *registry.Registry, opts CreateOptions) (int, error) {
+	if opts.Port != 0 {
+		if last := maxPort - registry.PortRange + 1; opts.Port < 1 || opts.Port > last {
+			return 0, fmt.Errorf("%w: port %d is outside 1-%d", ErrNoFreePorts, opts.Port, last)
+		}
+		if other := reg.ReservedBy(opts.Port); other != nil {
+			return 0, fmt.Errorf("%w: ports %d-%d overlap those of %s", ErrNoFreePorts, opts.Port, opts.Port+registry.PortRange-1, other.Name)
+		}
+		return opts.Port, nil
+	}
+	base := opts.BasePort
+	if base <= 0 {
+		base = registry.BasePort
+	}
+	limit := maxPort + 1
+	if opts.PortCount > 0 {
+		limit = base + opts.PortCount
+	}
+	for port := reg.AllocatePortFrom(base); port+registry.PortRange <= limit; port = reg.AllocatePortFrom(port + registry.PortRange) {
+		if portsFree(port) {
+			return port, nil
+		}
+	}
+	if opts.PortCount <= 0 {
+		return 0, fmt.Errorf("%w: all ports from %d are taken", ErrNoFreePorts, base)
+	}
+	return 0, fmt.Errorf("%w: all of ports %d-%d are taken", ErrNoFreePorts, base, base+opts.PortCount-1)
+}
+
+// rollbackCreate removes everything a partially completed Create left behind:
+// the registry entry, the docker network, the worktree directory, git's
+// worktree record and the branch if Create made it. Stashed changes are moved back to where they were
+// taken from. Cleanup runs even when ctx is already cancelled.
+func (st *State) rollbackCreate(ctx context.Context, opts CreateOptions, worktreePath string, createdBranch, stashed bool) {
+	ctx = context.WithoutCancel(ctx)
+
+	name := filepath.Base(worktreePath)
+	st.mu.Lock()
+	space, _ := st.Space(name)
+	if st.Registry.Get(name) != nil {
+		_ = st.update(func(reg *registry.Registry) error {
+			reg.Remove(name)
+			return nil
+		})
+	}
+	st.mu.Unlock()
+	if space != nil {
+		_ = space.RemoveDockerNetwork(ctx)
+		_ = space.RemoveCert()
+		_ = space.UnregisterHost()
+	}
+
+	// Hooks may have created untracked files, so remove the directory directly
+	// and let git forget the worktree instead of using `git worktree remove`.
+	_ = os.RemoveAll(worktreePath)
+	_ = st.gitClient().PruneWorktrees(ctx, opts.RepoRoot)
+
+	if createdBranch {
+		_ = st.gitClient().DeleteBranch(ctx, opts.RepoRoot, opts.BranchName)
+	}
+	st.restoreStash(ctx, opts, stashed)
+}
+
+// restoreStash applies the changes Create stashed back to the checkout they
+// were taken from, even when ctx is already cancelled.
+func (st *State) restoreStash(ctx context.Context, opts CreateOptions, stashed bool) {
+	if !stashed {
+		return
+	}
+	if err := st.gitClient().StashPop(context.WithoutCancel(ctx), opts.TakeChangesFrom); err != nil {
+		st.logger().Warn("failed to restore taken changes, they are kept in the stash", "path", opts.TakeChangesFrom, "err", err)
+	}
+}
@@ -0,0 +1,35 @@
+package spaces
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// FindSpace returns the dest dir and registry entry of the space whose
+// worktree contains dir. It runs no git commands, so it is cheap enough for
+// shell prompts: a worktree is a directory in its dest dir, which holds the
+// registry file.
+func FindSpace(dir string) (string, registry.Entry, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", registry.Entry{}, err
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", registry.Entry{}, fmt.Errorf("%w: no space contains %s", ErrSpaceNotFound, dir)
+		}
+		if !registry.Exists(parent) {
+			continue
+		}
+		reg, err := registry.Load(parent)
+		if err != nil {
+			return "", registry.Entry{}, fmt.Errorf("failed to load registry: %w", err)
+		}
+		if entry := reg.Get(filepath.Base(d)); entry != nil {
+			return parent, *entry, nil
+		}
+	}
+}
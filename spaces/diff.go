@@ -0,0 +1,89 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/johanhenriksson/remux/git"
+)
+
+// DiffMode selects what Diff shows.
+type DiffMode string
+
+const (
+	DiffCombined DiffMode = ""      // The diffstat followed by the patch
+	DiffFiles    DiffMode = "files" // The names of changed files with their status
+	DiffStat     DiffMode = "stat"  // The diffstat
+	DiffPatch    DiffMode = "patch" // The patch
+)
+
+// DiffOptions contains the parameters for Diff.
+type DiffOptions struct {
+	Mode  DiffMode
+	Fetch bool // Fetch the base branch's upstream first and diff against it
+}
+
+// BaseBranch returns the branch the named space is compared against: the
+// base recorded when it was created, the branch of the space it is stacked
+// on, or otherwise the branch checked out in the main repository.
+func (st *State) BaseBranch(name string) (string, error) {
+	entry := st.Registry.Get(name)
+	if entry == nil {
+		return "", fmt.Errorf("%w: %s", ErrSpaceNotFound, name)
+	}
+	if entry.Base != "" {
+		return entry.Base, nil
+	}
+	if parent := st.Registry.Get(entry.Parent); parent != nil {
+		return git.CurrentBranch(parent.Path)
+	}
+	return git.CurrentBranch(entry.RepoRoot)
+}
+
+// Diff writes the changes of the named space since it diverged from its base
+// branch to w: commits on its branch as well as uncommitted changes to
+// tracked files. Untracked files are not included.
+func (st *State) Diff(ctx context.Context, name string, w io.Writer, opts DiffOptions) error {
+	var args []string
+	switch opts.Mode {
+	case DiffCombined:
+		args = []string{"--stat", "--patch"}
+	case DiffFiles:
+		args = []string{"--name-status"}
+	case DiffStat:
+		args = []string{"--stat"}
+	case DiffPatch:
+		args = []string{"--patch"}
+	default:
+		return fmt.Errorf("unknown diff mode %q", opts.Mode)
+	}
+
+	base, err := st.BaseBranch(name)
+	if err != nil {
+		return err
+	}
+	entry := st.Registry.Get(name)
+	if _, err := os.Stat(entry.Path); err != nil {
+		return fmt.Errorf("failed to access space: %w", err)
+	}
+
+	if opts.Fetch {
+		upstream, remote, err := git.Upstream(entry.RepoRoot, base)
+		if err != nil {
+			st.logger().Warn("not fetching, diffing against the local branch", "err", err)
+		} else {
+			if err := git.Fetch(ctx, entry.RepoRoot, remote); err != nil {
+				return fmt.Errorf("failed to fetch %s: %w", remote, err)
+			}
+			base = upstream
+		}
+	}
+
+	mergeBase, err := git.MergeBase(ctx, entry.Path, base, "HEAD")
+	if err != nil {
+		return err
+	}
+	return git.Diff(ctx, entry.Path, mergeBase, w, args...)
+}
@@ -1,57 +1,251 @@
 package spaces
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
-	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/config"
 	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/telemetry"
 	"github.com/johanhenriksson/remux/tmux"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// Drop removes a git worktree at the given path and unregisters it.
-// Returns an error if the path is not a worktree or has uncommitted changes (unless force is true).
-func Drop(worktreePath string, force bool) error {
-	if !git.IsWorktree(worktreePath) {
-		return fmt.Errorf("not in a git worktree")
-	}
+// DefaultStopGrace is how long stopped processes get to exit before they are killed.
+const DefaultStopGrace = 10 * time.Second
+
+// DropOptions contains the parameters for dropping a space.
+type DropOptions struct {
+	Force bool          // Drop even with uncommitted changes, or when owned by another user
+	Stop  bool          // Stop live processes instead of refusing to drop
+	Grace time.Duration // Time stopped processes get to exit (default DefaultStopGrace)
+}
 
-	if !force && git.HasUncommittedChanges(worktreePath) {
-		return fmt.Errorf("worktree has uncommitted changes, use --force to drop anyway")
+// Drop removes a git worktree at the given path and unregisters it. A
+// checkout bound with Bind is only unregistered, its files are left alone.
+// Returns an error if the path is not a worktree, has uncommitted changes or
+// was created by another user (unless Force is set).
+// Processes listening on the space's ports or running in its tmux panes
+// cause a *LiveProcessesError before the on_drop hooks run, unless Stop is
+// set, in which case those still running after the hooks are terminated.
+func Drop(ctx context.Context, worktreePath string, opts DropOptions) error {
+	st, err := LoadState(filepath.Dir(worktreePath))
+	if err != nil {
+		return err
 	}
+	return st.Drop(ctx, worktreePath, opts)
+}
 
-	mainRepo, err := git.GetMainRepoPath(worktreePath)
+// Drop removes a git worktree at the given path and unregisters it from the state's registry.
+// See Drop for details.
+func (st *State) Drop(ctx context.Context, worktreePath string, opts DropOptions) (err error) {
+	ctx, span := telemetry.Start(ctx, "drop", attribute.String("remux.path", worktreePath))
+	defer func() { telemetry.End(span, err) }()
+	g := st.gitClient()
+	mainRepo, err := st.checkDrop(ctx, worktreePath, opts)
 	if err != nil {
-		return fmt.Errorf("failed to find main repository: %w", err)
+		return err
 	}
 
 	// Run on_drop hooks before removal (abort on failure)
 	// If space isn't registered, skip hooks but continue with removal
-	spaceName := filepath.Base(worktreePath)
-	if space, err := Open(worktreePath); err == nil {
-		if err := space.RunOnDrop(); err != nil {
+	spaceName := st.nameAt(worktreePath)
+	entry := st.Registry.Get(spaceName)
+	bound := entry != nil && entry.Bound
+	var backend SessionManager = tmuxBackend{}
+	if st.Backend != nil {
+		backend = st.Backend
+	}
+	var dropCfg config.Drop
+	space, err := st.Space(spaceName)
+	if err == nil {
+		if b, err := space.Backend(); err == nil {
+			backend = b
+		}
+		dropCfg = space.config.Drop
+
+		// Hooks are often destructive, so a drop that will be refused doesn't run them
+		if !opts.Stop {
+			if err := st.stopLive(space, opts, false); err != nil {
+				return err
+			}
+		}
+
+		if err := space.RunOnDrop(ctx); err != nil {
+			return err
+		}
+
+		// Hooks get the first chance to shut services down
+		if err := st.stopLive(space, opts, true); err != nil {
 			return err
 		}
 	}
 
-	if err := git.RemoveWorktree(mainRepo, worktreePath); err != nil {
-		return fmt.Errorf("failed to remove worktree: %w", err)
+	// From here on the drop is journaled, so Recover completes it if the
+	// process is killed
+	op := Operation{Kind: OperationDrop, Name: spaceName, Path: worktreePath, RepoRoot: mainRepo, Bound: bound}
+	if err := st.journal(op); err != nil {
+		return err
 	}
+	defer st.finish(op.Name)
+
+	if !bound {
+		if err := g.RemoveWorktree(ctx, mainRepo, worktreePath); err != nil {
+			return fmt.Errorf("failed to remove worktree: %w", err)
+		}
 
-	if err := os.RemoveAll(worktreePath); err != nil {
-		return fmt.Errorf("failed to remove directory: %w", err)
+		if err := os.RemoveAll(worktreePath); err != nil {
+			return fmt.Errorf("failed to remove directory: %w", err)
+		}
+	}
+
+	if space != nil {
+		if err := space.RemoveDockerNetwork(ctx); err != nil {
+			st.logger().Warn("failed to remove docker network", "err", err)
+		}
+		if err := space.RemoveCert(); err != nil {
+			st.logger().Warn("failed to remove cert", "err", err)
+		}
+		if err := space.UnregisterHost(); err != nil {
+			st.logger().Warn("failed to unregister hostname", "err", err)
+		}
 	}
 
 	// Unregister the space
-	destDir := filepath.Dir(worktreePath)
-	reg, err := registry.Load(destDir)
-	if err == nil {
+	_ = st.update(func(reg *registry.Registry) error {
 		reg.Remove(spaceName)
-		_ = reg.Save(destDir)
+		return nil
+	})
+
+	if backend.Name() == "tmux" {
+		if err := leaveSession(ctx, spaceName, dropCfg); err != nil {
+			st.logger().Warn("failed to leave session", "err", err)
+		}
 	}
+	backend.KillSession(spaceName)
 
-	tmux.KillSession(spaceName)
+	return nil
+}
 
+// stopLive terminates the processes still using the space if opts.Stop is
+// set, and otherwise returns a *LiveProcessesError listing them. hooksRan
+// tells whether the on_drop hooks have already run.
+func (st *State) stopLive(space *Space, opts DropOptions, hooksRan bool) error {
+	live, err := space.LiveProcesses()
+	if err != nil {
+		return fmt.Errorf("failed to check for live processes: %w", err)
+	}
+	if len(live) == 0 {
+		return nil
+	}
+	if !opts.Stop {
+		return &LiveProcessesError{Processes: live, HooksRan: hooksRan}
+	}
+	for _, p := range live {
+		if p.PID == 0 {
+			st.logger().Warn("can't stop a process that wasn't identified, is lsof installed?", "reason", p.Reason)
+		}
+	}
+	grace := opts.Grace
+	if grace == 0 {
+		grace = DefaultStopGrace
+	}
+	if err := stopProcesses(live, grace); err != nil {
+		return fmt.Errorf("failed to stop live processes: %w", err)
+	}
 	return nil
 }
+
+// checkDrop verifies that the worktree at worktreePath can be dropped and
+// returns the repository it belongs to.
+func (st *State) checkDrop(ctx context.Context, worktreePath string, opts DropOptions) (string, error) {
+	g := st.gitClient()
+	entry := st.Registry.Get(st.nameAt(worktreePath))
+	bound := entry != nil && entry.Bound
+	if !bound && !g.IsWorktree(worktreePath) {
+		return "", fmt.Errorf("%w: %s", ErrNotWorktree, worktreePath)
+	}
+
+	if entry != nil && !opts.Force && !st.owns(entry) {
+		return "", fmt.Errorf("%w: %s was created by %s, use --force to drop anyway", ErrNotOwner, entry.Name, entry.Owner)
+	}
+
+	// Nothing is removed from a bound checkout, so its changes are safe
+	if bound {
+		return entry.RepoRoot, nil
+	}
+
+	if !opts.Force && g.HasUncommittedChanges(ctx, worktreePath) {
+		return "", fmt.Errorf("%w, use --force to drop anyway", ErrDirtyWorktree)
+	}
+
+	mainRepo, err := g.GetMainRepoPath(ctx, worktreePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to find main repository: %w", err)
+	}
+	return mainRepo, nil
+}
+
+// nameAt returns the name of the space at worktreePath: the name a checkout
+// was bound under, or the directory name of a worktree.
+func (st *State) nameAt(worktreePath string) string {
+	path := resolvePath(worktreePath)
+	for _, e := range st.Registry.List() {
+		if e.Bound && resolvePath(e.Path) == path {
+			return e.Name
+		}
+	}
+	return filepath.Base(worktreePath)
+}
+
+// leaveSession moves the current tmux client off the named session before it
+// is killed, as configured by drop.client. Does nothing unless the caller runs
+// inside that session, or if no client is attached to it.
+func leaveSession(ctx context.Context, name string, cfg config.Drop) error {
+	if !tmux.InSession() {
+		return nil
+	}
+	if current, err := tmux.CurrentSession(); err != nil || current != tmux.SessionName(name) {
+		return nil
+	}
+	err := moveClient(ctx, name, cfg)
+	if errors.Is(err, tmux.ErrNoClient) {
+		// No client is attached to the session, so none needs moving
+		return nil
+	}
+	return err
+}
+
+// moveClient moves the current client off the named session as cfg.Client
+// says, see leaveSession.
+func moveClient(ctx context.Context, name string, cfg config.Drop) error {
+	switch cfg.Client {
+	case "", "detach":
+		return tmux.Detach()
+	case "last":
+		if err := tmux.SwitchToLast(); err != nil {
+			// No previous session to go back to
+			return tmux.Detach()
+		}
+		return nil
+	case "home":
+		if cfg.Home == "" || cfg.Home == name {
+			return tmux.Detach()
+		}
+		if !tmux.SessionExists(cfg.Home) {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("failed to get home directory: %w", err)
+			}
+			if err := tmux.NewSessionDetached(ctx, cfg.Home, home, nil); err != nil && !errors.Is(err, ErrSessionExists) {
+				return fmt.Errorf("failed to create home session: %w", err)
+			}
+		}
+		return tmux.SwitchTo(cfg.Home)
+	}
+	return fmt.Errorf("unsupported drop client %q (expected last, home or detach)", cfg.Client)
+}
@@ -0,0 +1,78 @@
+package spaces
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Editor state files in a space's state dir. The VS Code workspace file has a
+// fixed name so its editor state survives space renames.
+const (
+	nvimSessionFile     = "session.vim"
+	vscodeWorkspaceFile = "space.code-workspace"
+)
+
+// NvimSession returns the path of the space's nvim session file.
+func (s *Space) NvimSession() string {
+	return filepath.Join(s.stateDir, nvimSessionFile)
+}
+
+// VSCodeWorkspace returns the path of the space's VS Code workspace file.
+// VS Code keys open editors and layout by workspace file, so opening the space
+// through it restores the editing context.
+func (s *Space) VSCodeWorkspace() string {
+	return filepath.Join(s.stateDir, vscodeWorkspaceFile)
+}
+
+// NvimCommand returns a shell command that starts nvim in the space, resuming
+// its saved session if there is one and saving the session on exit.
+func (s *Space) NvimCommand() string {
+	session := s.NvimSession()
+	save := "autocmd VimLeavePre * execute 'mksession!' fnameescape(" + vimQuote(session) + ")"
+	cmd := "nvim -c " + shellQuote(save)
+	if _, err := os.Stat(session); err == nil {
+		cmd += " -S " + shellQuote(session)
+	}
+	return cmd
+}
+
+// WriteVSCodeWorkspace creates the space's VS Code workspace file, or points
+// an existing one at the current worktree path. Other keys, including settings
+// VS Code added, are preserved.
+func (s *Space) WriteVSCodeWorkspace() error {
+	path := s.VSCodeWorkspace()
+	workspace := map[string]any{
+		"settings": map[string]any{
+			"window.title": s.Name + "${separator}${activeEditorShort}",
+		},
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &workspace); err != nil {
+			return err
+		}
+	}
+
+	folders := []any{map[string]any{"path": s.Path}}
+	if existing, ok := workspace["folders"].([]any); ok && len(existing) == 1 {
+		if folder, ok := existing[0].(map[string]any); ok && folder["path"] == s.Path {
+			return nil
+		}
+	}
+	workspace["folders"] = folders
+
+	data, err := json.MarshalIndent(workspace, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.stateDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// vimQuote quotes s as a vim string literal.
+func vimQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,193 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+// envKeysOption is the tmux session option listing the variables remux set in
+// the session environment, so ApplyEnv can unset those removed from the config.
+const envKeysOption = "@remux-env"
+
+// EnvChange describes the changes ApplyEnv made to a running session.
+type EnvChange struct {
+	Set   []string // Variables added or changed, sorted
+	Unset []string // Variables no longer in the space's env, sorted
+	Panes int      // Idle shells the changes were typed into
+}
+
+// ApplyEnv brings the environment of the named space's running tmux session
+// in line with the space's current env: the SPACE_* variables, shared cache
+// dirs, docker names and config env. The session environment, which new
+// windows and panes start with, is updated, and export and unset commands are
+// typed into idle shells. Panes running other programs keep their env until
+// restarted. Only the tmux backend is supported.
+func (st *State) ApplyEnv(ctx context.Context, name string) (EnvChange, error) {
+	space, err := st.Space(name)
+	if err != nil {
+		return EnvChange{}, err
+	}
+	backend, err := space.Backend()
+	if err != nil {
+		return EnvChange{}, err
+	}
+	if backend.Name() != "tmux" {
+		return EnvChange{}, fmt.Errorf("%w: applying env needs tmux, %s uses %s", ErrUnsupportedBackend, name, backend.Name())
+	}
+	if !backend.SessionExists(name) {
+		return EnvChange{}, fmt.Errorf("%w: %s", ErrNoSession, name)
+	}
+
+	env := make(map[string]string)
+	if err := space.sessionEnv(ctx, env, nil); err != nil {
+		return EnvChange{}, err
+	}
+	return applyEnv(ctx, name, env)
+}
+
+// SessionEnv returns the variables a session of the space starts with, for
+// running commands in the space outside of a session.
+func (s *Space) SessionEnv(ctx context.Context) (map[string]string, error) {
+	env := make(map[string]string)
+	if err := s.sessionEnv(ctx, env, nil); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// sessionEnv adds the variables a session of the space starts with to env:
+// the SPACE_* variables, shared cache dirs, docker names and certificate
+// files, overridden by the config env.
+func (s *Space) sessionEnv(ctx context.Context, env map[string]string, timings *Timings) error {
+	env["SPACE_PORT"] = strconv.Itoa(s.Port)
+	env["SPACE_NVIM_SESSION"] = s.NvimSession()
+	env["SPACE_VSCODE_WORKSPACE"] = s.VSCodeWorkspace()
+	host, err := s.Host()
+	if err != nil {
+		return fmt.Errorf("failed to resolve hostname: %w", err)
+	}
+	env["SPACE_HOST"] = host
+
+	caches, err := s.CacheEnv()
+	if err != nil {
+		return fmt.Errorf("failed to resolve shared caches: %w", err)
+	}
+	maps.Copy(env, caches)
+	docker, err := s.DockerEnv()
+	if err != nil {
+		return fmt.Errorf("failed to resolve docker names: %w", err)
+	}
+	maps.Copy(env, docker)
+	cert, err := s.CertEnv()
+	if err != nil {
+		return fmt.Errorf("failed to resolve cert: %w", err)
+	}
+	maps.Copy(env, cert)
+
+	_, done := timings.Track(ctx, "env resolution")
+	resolved, err := s.ResolveEnv()
+	done()
+	if err != nil {
+		return fmt.Errorf("failed to resolve config env vars: %w", err)
+	}
+	maps.Copy(env, resolved)
+	return nil
+}
+
+// applyEnv updates the tmux session to env, see ApplyEnv.
+func applyEnv(ctx context.Context, session string, env map[string]string) (EnvChange, error) {
+	current, err := tmux.Environment(session)
+	if err != nil {
+		return EnvChange{}, fmt.Errorf("failed to read session environment: %w", err)
+	}
+	previous, err := tmux.ShowOption(session, envKeysOption)
+	if err != nil {
+		return EnvChange{}, fmt.Errorf("failed to read session environment: %w", err)
+	}
+
+	var change EnvChange
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		if value, ok := current[key]; ok && value == env[key] {
+			continue
+		}
+		if err := tmux.SetEnvironment(session, key, env[key]); err != nil {
+			return change, fmt.Errorf("failed to set %s: %w", key, err)
+		}
+		change.Set = append(change.Set, key)
+	}
+	for _, key := range slices.Sorted(slices.Values(strings.Fields(previous))) {
+		if _, ok := env[key]; ok {
+			continue
+		}
+		if err := tmux.UnsetEnvironment(session, key); err != nil {
+			return change, fmt.Errorf("failed to unset %s: %w", key, err)
+		}
+		change.Unset = append(change.Unset, key)
+	}
+	if err := tmux.SetOption(session, envKeysOption, envKeys(env)); err != nil {
+		return change, fmt.Errorf("failed to record session environment: %w", err)
+	}
+	if len(change.Set) == 0 && len(change.Unset) == 0 {
+		return change, nil
+	}
+
+	panes, err := tmux.ListPanes(session)
+	if err != nil {
+		return change, err
+	}
+	for _, pane := range panes {
+		if !shells[pane.CurrentCommand] {
+			continue
+		}
+		command := exportCommand(pane.CurrentCommand, env, change)
+		if err := tmux.SendKeysToPane(ctx, pane.ID, command); err != nil {
+			return change, err
+		}
+		change.Panes++
+	}
+	return change, nil
+}
+
+// envKeys returns the value of envKeysOption for a session started with env.
+func envKeys(env map[string]string) string {
+	return strings.Join(slices.Sorted(maps.Keys(env)), " ")
+}
+
+// exportCommand returns the command making a shell pick up the change. It
+// starts with a space, which keeps it out of the history of most shells.
+func exportCommand(shell string, env map[string]string, change EnvChange) string {
+	var parts []string
+	if shell == "fish" {
+		for _, key := range change.Set {
+			parts = append(parts, "set -gx "+key+" "+fishQuote(env[key]))
+		}
+		if len(change.Unset) > 0 {
+			parts = append(parts, "set -e "+strings.Join(change.Unset, " "))
+		}
+	} else {
+		if len(change.Set) > 0 {
+			var exports []string
+			for _, key := range change.Set {
+				exports = append(exports, key+"="+shellQuote(env[key]))
+			}
+			parts = append(parts, "export "+strings.Join(exports, " "))
+		}
+		if len(change.Unset) > 0 {
+			parts = append(parts, "unset "+strings.Join(change.Unset, " "))
+		}
+	}
+	return " " + strings.Join(parts, "; ")
+}
+
+// fishQuote quotes s as a single fish argument. Unlike sh, fish treats
+// backslashes in single quotes as escapes.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
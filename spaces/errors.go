@@ -0,0 +1,52 @@
+package spaces
+
+import (
+	"errors"
+
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+// Errors returned by space operations. Returned errors wrap these values with
+// details, so match them with errors.Is.
+var (
+	// ErrSpaceNotFound is returned when a space is not registered.
+	ErrSpaceNotFound = registry.ErrNotFound
+	// ErrInvalidName is returned for branch or space names that can't be used.
+	ErrInvalidName = errors.New("invalid name")
+	// ErrSpaceExists is returned when a space's worktree directory already exists.
+	ErrSpaceExists = errors.New("space already exists")
+	// ErrNotWorktree is returned when a path is not a git worktree.
+	ErrNotWorktree = errors.New("not a git worktree")
+	// ErrDirtyWorktree is returned when dropping a worktree with uncommitted changes without force.
+	ErrDirtyWorktree = errors.New("worktree has uncommitted changes")
+	// ErrBranchExists is returned when creating a space for an existing branch without reuse.
+	ErrBranchExists = git.ErrBranchExists
+	// ErrLiveProcesses is returned when dropping a space whose ports or tmux panes are still in use.
+	// The returned error is a *LiveProcessesError listing the processes.
+	ErrLiveProcesses = errors.New("space has live processes")
+	// ErrSessionExists is returned when a tmux session for the space is already running.
+	ErrSessionExists = tmux.ErrSessionExists
+	// ErrNoSession is returned when a space's session is not running.
+	ErrNoSession = errors.New("no running session")
+	// ErrHibernated is returned when hibernating a space that already is.
+	ErrHibernated = errors.New("space is hibernated")
+	// ErrNotHibernated is returned when resuming a space that isn't hibernated.
+	ErrNotHibernated = errors.New("space is not hibernated")
+	// ErrNotOwner is returned when dropping a space another user created without force.
+	ErrNotOwner = errors.New("space belongs to another user")
+	// ErrUnsupportedBackend is returned for operations the space's session backend doesn't support.
+	ErrUnsupportedBackend = errors.New("not supported by the session backend")
+	// ErrNoFreePorts is returned when a new space doesn't fit in its port range.
+	ErrNoFreePorts = errors.New("no free ports")
+	// ErrLimitReached is returned when a new space would exceed the limits of CreateOptions.
+	ErrLimitReached = errors.New("workspace limit reached")
+	// ErrConflict is returned when a rebase of a stack sync stops on conflicts.
+	// The returned error is a *ConflictError unless the sync stopped earlier.
+	ErrConflict = errors.New("rebase stopped on conflicts")
+	// ErrNoSync is returned when continuing or aborting a stack sync that didn't stop.
+	ErrNoSync = errors.New("no stack sync in progress")
+	// ErrReadOnly is returned when changing a registry opened read-only.
+	ErrReadOnly = registry.ErrReadOnly
+)
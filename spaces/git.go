@@ -0,0 +1,37 @@
+package spaces
+
+import (
+	"context"
+
+	"github.com/johanhenriksson/remux/git"
+)
+
+// GitClient is the part of git used to create, open and drop spaces. By
+// default it is git.CLI, which runs the git command; State.Git replaces it,
+// e.g. with the in-memory remuxtest.Git in tests.
+type GitClient interface {
+	CheckBranchName(ctx context.Context, name string) error
+	BranchExists(ctx context.Context, repoRoot, name string) bool
+	CreateBranch(ctx context.Context, repoRoot, name, start string) error
+	DeleteBranch(ctx context.Context, repoRoot, name string) error
+	AddWorktree(ctx context.Context, repoRoot, path, branch string) error
+	RemoveWorktree(ctx context.Context, repoRoot, worktreePath string) error
+	PruneWorktrees(ctx context.Context, repoRoot string) error
+	IsWorktree(path string) bool
+	HasUncommittedChanges(ctx context.Context, path string) bool
+	GetMainRepoPath(ctx context.Context, worktreePath string) (string, error)
+	StashPush(ctx context.Context, path, message string) (bool, error)
+	StashPop(ctx context.Context, path string) error
+	Fetch(ctx context.Context, repoRoot, remote string) error
+	RemoteBranch(ctx context.Context, repoRoot, remote, branch string) (string, error)
+	SetPushRemote(ctx context.Context, repoRoot, branch, remote string) error
+	SetUpstream(ctx context.Context, repoRoot, branch, upstream string) error
+}
+
+// gitClient returns the state's git client.
+func (st *State) gitClient() GitClient {
+	if st.Git != nil {
+		return st.Git
+	}
+	return git.CLI{}
+}
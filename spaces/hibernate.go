@@ -0,0 +1,116 @@
+package spaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// Hibernate frees the resources of the named space while keeping its
+// worktree: it stops the services listed in the services section of its
+// config, kills its session (saving the scrollback like KillSession) and marks
+// it hibernated in the registry. If a service fails to stop, the session is
+// left running and the space isn't marked.
+func (st *State) Hibernate(ctx context.Context, name string) error {
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+	entry := st.Registry.Get(name)
+	if entry.Hibernated {
+		return fmt.Errorf("%w: %s", ErrHibernated, name)
+	}
+
+	if err := space.StopServices(ctx); err != nil {
+		return fmt.Errorf("failed to stop services: %w", err)
+	}
+	if err := st.KillSession(name); err != nil && !errors.Is(err, ErrNoSession) {
+		return err
+	}
+
+	return st.setHibernated(name, true)
+}
+
+// Resume starts the services of a space stopped by Hibernate and clears its
+// hibernated mark. The session is not opened; OpenSession resumes a
+// hibernated space on its own.
+func (st *State) Resume(ctx context.Context, name string) error {
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+	if !st.Registry.Get(name).Hibernated {
+		return fmt.Errorf("%w: %s", ErrNotHibernated, name)
+	}
+	return st.resume(ctx, space)
+}
+
+// resume starts the services of a hibernated space and clears its mark.
+func (st *State) resume(ctx context.Context, space *Space) error {
+	if err := space.StartServices(ctx); err != nil {
+		return fmt.Errorf("failed to start services: %w", err)
+	}
+	return st.setHibernated(space.Name, false)
+}
+
+// setHibernated records whether the named space is hibernated.
+func (st *State) setHibernated(name string, hibernated bool) error {
+	return st.update(func(reg *registry.Registry) error {
+		entry := reg.Get(name)
+		if entry == nil {
+			return fmt.Errorf("%w: %s", ErrSpaceNotFound, name)
+		}
+		entry.Hibernated = hibernated
+		return nil
+	})
+}
+
+// idler is implemented by backends that can tell when a session was last used.
+type idler interface {
+	// Activity returns when the named session last had input or pane output,
+	// and whether a client is attached to it.
+	Activity(name string) (time.Time, bool, error)
+}
+
+// HibernateIdle hibernates the spaces whose session has had no attached
+// client, input or pane output for at least idle, and returns their names.
+// Spaces whose backend can't tell how long a session was idle are skipped. A
+// space that fails to hibernate is logged and doesn't stop the others.
+func (st *State) HibernateIdle(ctx context.Context, idle time.Duration) []string {
+	var hibernated []string
+	for _, entry := range st.Registry.List() {
+		if entry.Hibernated {
+			continue
+		}
+		space, err := st.Space(entry.Name)
+		if err != nil {
+			st.logger().Warn("failed to load space", "space", entry.Name, "err", err)
+			continue
+		}
+		backend, err := space.Backend()
+		if err != nil || !backend.SessionExists(entry.Name) {
+			continue
+		}
+		i, ok := backend.(idler)
+		if !ok {
+			continue
+		}
+		last, attached, err := i.Activity(entry.Name)
+		if err != nil {
+			st.logger().Warn("failed to get session activity", "space", entry.Name, "err", err)
+			continue
+		}
+		if attached || time.Since(last) < idle {
+			continue
+		}
+		if err := st.Hibernate(ctx, entry.Name); err != nil {
+			st.logger().Warn("failed to hibernate idle space", "space", entry.Name, "err", err)
+			continue
+		}
+		hibernated = append(hibernated, entry.Name)
+	}
+	return hibernated
+}
@@ -0,0 +1,17 @@
+package spaces
+
+// Host returns the hostname of the space, see config.Hosts.
+func (s *Space) Host() (string, error) {
+	return s.config.Hostname(s.configSpace())
+}
+
+// RegisterHost points the space's hostname at localhost in the hosts file if
+// the config asks for it.
+func (s *Space) RegisterHost() error {
+	return s.config.RegisterHost(s.configSpace())
+}
+
+// UnregisterHost removes the entry added by RegisterHost.
+func (s *Space) UnregisterHost() error {
+	return s.config.UnregisterHost(s.configSpace())
+}
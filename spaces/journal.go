@@ -0,0 +1,187 @@
+package spaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/johanhenriksson/remux/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// journalDirName is the directory inside the state dir holding a journal file
+// per create or drop in progress.
+const journalDirName = ".journal"
+
+// OperationKind is the kind of a journaled operation.
+type OperationKind string
+
+const (
+	// OperationCreate is a Create. Recover rolls it back.
+	OperationCreate OperationKind = "create"
+	// OperationDrop is a Drop past its checks and hooks. Recover completes it.
+	OperationDrop OperationKind = "drop"
+)
+
+// Operation is the journal of a create or drop in progress. It is kept in the
+// state dir until the operation finishes, so the branch, worktree and registry
+// entry of an operation whose process was killed can be cleaned up by Recover.
+type Operation struct {
+	Kind          OperationKind `yaml:"kind"`
+	Name          string        `yaml:"name"` // Space name
+	Path          string        `yaml:"path"` // Worktree path
+	RepoRoot      string        `yaml:"repo_root"`
+	Branch        string        `yaml:"branch,omitempty"`
+	CreatedBranch bool          `yaml:"created_branch,omitempty"` // The create made the branch
+	StashedFrom   string        `yaml:"stashed_from,omitempty"`   // Checkout whose changes the create stashed
+	Bound         bool          `yaml:"bound,omitempty"`          // The drop only unregisters the space
+	PID           int           `yaml:"pid"`                      // Process running the operation
+	Started       time.Time     `yaml:"started"`
+}
+
+func (op Operation) String() string {
+	return fmt.Sprintf("%s of %s, started %s by process %d", op.Kind, op.Name, op.Started.Format(time.DateTime), op.PID)
+}
+
+// running reports whether the process that started op is still alive.
+func (op Operation) running() bool {
+	return op.PID > 0 && syscall.Kill(op.PID, 0) == nil
+}
+
+// journalPath returns the path of the journal of the operation on the named space.
+func (st *State) journalPath(name string) string {
+	return filepath.Join(st.DestDir, stateDirName, journalDirName, name+".yaml")
+}
+
+// journal records op as in progress, replacing the journal of the previous
+// step of the same operation.
+func (st *State) journal(op Operation) error {
+	if op.PID == 0 {
+		op.PID = os.Getpid()
+	}
+	if op.Started.IsZero() {
+		op.Started = time.Now()
+	}
+	data, err := yaml.Marshal(op)
+	if err != nil {
+		return err
+	}
+	path := st.journalPath(op.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to record operation: %w", err)
+	}
+	// Written in one rename, so a killed process never leaves half a journal
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to record operation: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// finish removes the journal of the operation on the named space.
+func (st *State) finish(name string) {
+	if err := os.Remove(st.journalPath(name)); err != nil && !os.IsNotExist(err) {
+		st.logger().Warn("failed to remove operation journal", "space", name, "err", err)
+	}
+}
+
+// IncompleteOperations returns the journaled operations whose process is no
+// longer running, oldest first.
+func (st *State) IncompleteOperations() ([]Operation, error) {
+	dir := filepath.Dir(st.journalPath(""))
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".yaml") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var op Operation
+		if err := yaml.Unmarshal(data, &op); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		if !op.running() {
+			ops = append(ops, op)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Started.Before(ops[j].Started) })
+	return ops, nil
+}
+
+// Recover cleans up after the incomplete operations: a create is rolled back,
+// removing its registry entry, worktree and the branch if it made it, and
+// putting stashed changes back; a drop is completed, removing the worktree
+// unless the space was bound and unregistering it. The journal of an
+// operation is removed once it is recovered.
+func (st *State) Recover(ctx context.Context, ops []Operation) error {
+	var errs []error
+	for _, op := range ops {
+		var err error
+		switch op.Kind {
+		case OperationCreate:
+			opts := CreateOptions{RepoRoot: op.RepoRoot, BranchName: op.Branch, TakeChangesFrom: op.StashedFrom}
+			st.rollbackCreate(ctx, opts, op.Path, op.CreatedBranch, op.StashedFrom != "")
+		case OperationDrop:
+			err = st.completeDrop(ctx, op)
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Kind)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", op.Name, err))
+			continue
+		}
+		st.finish(op.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// completeDrop finishes the removal steps of a drop that was interrupted.
+func (st *State) completeDrop(ctx context.Context, op Operation) error {
+	// Loaded before the worktree and its config are gone
+	space, spaceErr := st.Space(op.Name)
+	if !op.Bound {
+		if err := os.RemoveAll(op.Path); err != nil {
+			return fmt.Errorf("failed to remove directory: %w", err)
+		}
+		if err := st.gitClient().PruneWorktrees(ctx, op.RepoRoot); err != nil {
+			return fmt.Errorf("failed to prune worktrees: %w", err)
+		}
+	}
+	if spaceErr == nil {
+		if err := space.RemoveDockerNetwork(ctx); err != nil {
+			st.logger().Warn("failed to remove docker network", "err", err)
+		}
+		if err := space.RemoveCert(); err != nil {
+			st.logger().Warn("failed to remove cert", "err", err)
+		}
+		if err := space.UnregisterHost(); err != nil {
+			st.logger().Warn("failed to unregister hostname", "err", err)
+		}
+		if backend, err := space.Backend(); err == nil {
+			backend.KillSession(op.Name)
+		}
+	}
+	if st.Registry.Get(op.Name) == nil {
+		return nil
+	}
+	return st.update(func(reg *registry.Registry) error {
+		reg.Remove(op.Name)
+		return nil
+	})
+}
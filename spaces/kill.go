@@ -0,0 +1,26 @@
+package spaces
+
+import "fmt"
+
+// KillSession closes the named space's session, keeping its worktree. The
+// scrollback is saved first when scrollback.save is enabled; failing to save it
+// is only a warning. Returns ErrNoSession if the session is not running.
+func (st *State) KillSession(name string) error {
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+	backend, err := space.Backend()
+	if err != nil {
+		return err
+	}
+	if !backend.SessionExists(name) {
+		return fmt.Errorf("%w: %s", ErrNoSession, name)
+	}
+
+	if err := space.SaveScrollback(); err != nil {
+		st.logger().Warn("failed to save scrollback", "err", err)
+	}
+	backend.KillSession(name)
+	return nil
+}
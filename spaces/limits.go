@@ -0,0 +1,68 @@
+package spaces
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// limitHint tells how to get below a limit.
+const limitHint = "drop unused workspaces, such as the merged ones shown by list --status, or raise the limit in the user config"
+
+// checkCountLimits returns an error wrapping ErrLimitReached if another space
+// of opts.RepoRoot would exceed the space count limits of opts.
+func checkCountLimits(reg *registry.Registry, opts CreateOptions) error {
+	limits := opts.Limits
+	if limits.Spaces <= 0 && limits.RepoSpaces <= 0 {
+		return nil
+	}
+	entries := reg.List()
+	if limits.Spaces > 0 && len(entries) >= limits.Spaces {
+		return fmt.Errorf("%w: %d of %d workspaces exist (limits.spaces), %s", ErrLimitReached, len(entries), limits.Spaces, limitHint)
+	}
+	if limits.RepoSpaces > 0 {
+		count := 0
+		for _, e := range entries {
+			if e.RepoRoot == opts.RepoRoot {
+				count++
+			}
+		}
+		if count >= limits.RepoSpaces {
+			return fmt.Errorf("%w: %d of %d workspaces of %s exist (limits.repo_spaces), %s", ErrLimitReached, count, limits.RepoSpaces, filepath.Base(opts.RepoRoot), limitHint)
+		}
+	}
+	return nil
+}
+
+// checkDiskLimit returns an error wrapping ErrLimitReached if the files in
+// destDir use at least the disk limit of limits.
+func checkDiskLimit(destDir string, limits config.Limits) error {
+	max, err := limits.DiskBytes()
+	if err != nil || max <= 0 {
+		return err
+	}
+	used := diskUsage(destDir)
+	if used >= max {
+		return fmt.Errorf("%w: workspaces use %s of %s (limits.disk), %s", ErrLimitReached, config.FormatSize(used), config.FormatSize(max), limitHint)
+	}
+	return nil
+}
+
+// diskUsage returns the total size of the regular files under dir. Files
+// that can't be read are skipped, and symlinks aren't followed.
+func diskUsage(dir string) int64 {
+	var total int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,173 @@
+package spaces
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/johanhenriksson/remux/config"
+)
+
+// logsDir is the directory in a space's state dir holding its logs.
+const logsDir = "logs"
+
+// logFollowInterval is how often Logs checks the logs for new output when following.
+const logFollowInterval = 250 * time.Millisecond
+
+// LogDir returns the directory of the space's hook, service and tab logs.
+func (s *Space) LogDir() string {
+	return filepath.Join(s.stateDir, logsDir)
+}
+
+// LogSources returns the sources that have logged in the space, such as
+// "hook", "service" and "tab:server", sorted by name.
+func (s *Space) LogSources() ([]string, error) {
+	files, err := os.ReadDir(s.LogDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var sources []string
+	for _, f := range files {
+		if source := config.LogSource(f.Name()); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	slices.Sort(sources)
+	return sources, nil
+}
+
+// LogOptions selects what Logs writes.
+type LogOptions struct {
+	Source string // Only this source, e.g. "hook" or "tab:server" (optional, default: all)
+	Follow bool   // Keep writing new output, including of sources that start logging, until ctx is done
+}
+
+// Logs writes the space's logs to w. With several sources, each line is
+// prefixed with its source, like "service | ...", and the logs are written
+// one after the other.
+func (s *Space) Logs(ctx context.Context, w io.Writer, opts LogOptions) error {
+	tails := map[string]*logTail{}
+	defer func() {
+		for _, t := range tails {
+			t.close()
+		}
+	}()
+	for {
+		sources, err := s.LogSources()
+		if err != nil {
+			return err
+		}
+		if opts.Source != "" {
+			sources = []string{opts.Source}
+		}
+		prefix := len(sources) > 1 || opts.Source == "" && opts.Follow
+		width := 0
+		for _, source := range sources {
+			width = max(width, len(source))
+		}
+		for _, source := range sources {
+			t := tails[source]
+			if t == nil {
+				t = &logTail{path: config.LogFile(s.LogDir(), source)}
+				tails[source] = t
+			}
+			label := ""
+			if prefix {
+				label = fmt.Sprintf("%-*s | ", width, source)
+			}
+			if err := t.copy(w, label, !opts.Follow); err != nil {
+				return err
+			}
+		}
+		if !opts.Follow {
+			if opts.Source != "" && tails[opts.Source].file == nil {
+				return fmt.Errorf("no %s log in %s", opts.Source, s.Name)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logFollowInterval):
+		}
+	}
+}
+
+// logTail reads a log from where it last left off, reopening it from the
+// start when the log is moved aside and a new one takes its place.
+type logTail struct {
+	path    string
+	file    *os.File
+	partial []byte // Start of a line whose end isn't written yet
+}
+
+// copy writes the complete lines logged since the last call to w, each
+// prefixed with label. With flush, an incomplete last line is written too.
+func (t *logTail) copy(w io.Writer, label string, flush bool) error {
+	info, err := os.Stat(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if t.file != nil {
+		if open, err := t.file.Stat(); err != nil || !os.SameFile(open, info) {
+			// Read what the moved log got before it was replaced
+			if err := t.read(w, label); err != nil {
+				return err
+			}
+			t.close()
+		}
+	}
+	if t.file == nil {
+		if t.file, err = os.Open(t.path); err != nil {
+			return err
+		}
+	}
+	if err := t.read(w, label); err != nil {
+		return err
+	}
+	if flush && len(t.partial) > 0 {
+		_, err := fmt.Fprintf(w, "%s%s\n", label, t.partial)
+		t.partial = nil
+		return err
+	}
+	return nil
+}
+
+// read writes the complete lines available in the open log to w.
+func (t *logTail) read(w io.Writer, label string) error {
+	data, err := io.ReadAll(t.file)
+	if err != nil {
+		return err
+	}
+	data = append(t.partial, data...)
+	end := bytes.LastIndexByte(data, '\n') + 1
+	t.partial = slices.Clone(data[end:])
+	if end == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(string(data[:end]), "\n") {
+		if line != "" {
+			b.WriteString(label + line)
+		}
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func (t *logTail) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
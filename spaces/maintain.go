@@ -0,0 +1,94 @@
+package spaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/johanhenriksson/remux/git"
+)
+
+// DefaultMaintainJobs is how many repositories Maintain works on at once,
+// unless told otherwise. Maintenance is disk-bound, so more rarely helps.
+const DefaultMaintainJobs = 2
+
+// Maintenance reports what Maintain did.
+type Maintenance struct {
+	Repos []string // Repositories whose git maintenance ran, sorted
+	Stale []string // Names of unregistered spaces whose state dir was removed, sorted
+}
+
+// Maintain keeps a dest dir with many worktrees healthy. Git maintenance runs
+// once per repository, since worktrees share its object store, for at most
+// jobs repositories at a time (DefaultMaintainJobs if jobs <= 0) and at low
+// priority; see git.Maintain. Then the state dirs of spaces that are no
+// longer registered, such as their status caches, are removed, unless a
+// journaled operation on the space is in progress. A repository whose
+// maintenance fails doesn't stop the others; the failures are returned joined.
+func (st *State) Maintain(ctx context.Context, jobs int) (Maintenance, error) {
+	if jobs <= 0 {
+		jobs = DefaultMaintainJobs
+	}
+
+	var result Maintenance
+	var staleErr error
+	roots := make(map[string]bool)
+	for _, e := range st.Registry.List() {
+		roots[e.RepoRoot] = true
+	}
+	repos := slices.Sorted(maps.Keys(roots))
+	done := make([]bool, len(repos))
+	err := parallel(repos, jobs, func(i int, repo string) error {
+		if err := git.Maintain(ctx, repo); err != nil {
+			return fmt.Errorf("%s: %w", repo, err)
+		}
+		done[i] = true
+		return nil
+	})
+	for i, repo := range repos {
+		if done[i] {
+			result.Repos = append(result.Repos, repo)
+		}
+	}
+
+	result.Stale, staleErr = st.removeStaleState()
+	if staleErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to remove stale state: %w", staleErr))
+	}
+	return result, err
+}
+
+// removeStaleState removes the state dirs of spaces that aren't registered
+// and have no operation in progress, and returns their names.
+func (st *State) removeStaleState() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(st.DestDir, stateDirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		name := entry.Name()
+		// Dot dirs, such as the journal, aren't spaces
+		if !entry.IsDir() || strings.HasPrefix(name, ".") || st.Registry.Get(name) != nil {
+			continue
+		}
+		// Spaces created since the registry was loaded have a journal
+		if _, err := os.Stat(st.journalPath(name)); err == nil {
+			continue
+		}
+		if err := os.RemoveAll(StateDir(st.DestDir, name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
@@ -0,0 +1,145 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/git"
+)
+
+// maxNameLength keeps worktree directory names (repo name, dash, branch)
+// below common file system limits.
+const maxNameLength = 200
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9._/-]+`)
+	repeatedDashes   = regexp.MustCompile(`-{2,}`)
+	repeatedDots     = regexp.MustCompile(`\.{2,}`)
+	repeatedSlashes  = regexp.MustCompile(`/{2,}`)
+)
+
+// SpaceName returns the space name for a branch of the given repository.
+// Slashes in the branch name are replaced so the worktree is a single directory.
+func SpaceName(repoRoot, branch string) string {
+	return filepath.Base(repoRoot) + "-" + strings.ReplaceAll(branch, "/", "-")
+}
+
+// NameBranch returns the branch a new space of the repository given name
+// gets by the branch_name template of the repository's config, merged over
+// that of the named space template if set, and the part of the branch the
+// name stands for, which the space is named after. See config.NameBranch.
+func (st *State) NameBranch(repoRoot, template, name string) (branch, short string, err error) {
+	var tmpl *config.SpaceTemplate
+	if template != "" {
+		if tmpl, err = config.LoadTemplate(template); err != nil {
+			return "", "", err
+		}
+	}
+	cfg, err := repoConfig(repoRoot, tmpl)
+	if err != nil {
+		return "", "", err
+	}
+	return cfg.NameBranch(repoRoot, name, st.user())
+}
+
+// ValidateBranchName checks that name can be used as a branch name and as
+// part of a worktree directory and tmux session name. The returned error
+// wraps ErrInvalidName and suggests a normalized name when one exists.
+func ValidateBranchName(name string) error {
+	return validateBranchName(context.Background(), name, git.CheckBranchName)
+}
+
+// validateBranchName is ValidateBranchName with git's branch name check
+// supplied by the caller.
+func validateBranchName(ctx context.Context, name string, check func(context.Context, string) error) error {
+	reason := nameProblem(name)
+	if reason == "" && check(ctx, name) != nil {
+		// The check fails when cancelled, which says nothing about the name
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		reason = "not a valid git branch name"
+	}
+	if reason == "" {
+		return nil
+	}
+
+	if suggestion := NormalizeName(name); suggestion != "" && suggestion != name && nameProblem(suggestion) == "" {
+		return fmt.Errorf("%w %q: %s (try %q)", ErrInvalidName, name, reason, suggestion)
+	}
+	return fmt.Errorf("%w %q: %s", ErrInvalidName, name, reason)
+}
+
+// nameProblem returns why name is unusable, or "" if it passes the checks
+// that git doesn't cover.
+func nameProblem(name string) string {
+	switch {
+	case name == "":
+		return "name is empty"
+	case strings.HasPrefix(name, "-"):
+		return "starts with a dash"
+	case len(name) > maxNameLength:
+		return fmt.Sprintf("longer than %d characters", maxNameLength)
+	}
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			return "contains whitespace"
+		case r > unicode.MaxASCII:
+			return "contains non-ASCII characters"
+		case unicode.IsControl(r):
+			return "contains control characters"
+		}
+	}
+	return ""
+}
+
+// maxIssueSlugLength limits the part of an issue branch name taken from its title.
+const maxIssueSlugLength = 50
+
+// IssueBranchName derives a branch name such as "42-fix-login-crash" from an
+// issue number and title.
+func IssueBranchName(number int, title string) string {
+	slug := strings.ToLower(NormalizeName(strings.NewReplacer("/", " ", ".", " ", "_", " ").Replace(title)))
+	if len(slug) > maxIssueSlugLength {
+		slug = slug[:maxIssueSlugLength]
+		if i := strings.LastIndex(slug, "-"); i > 0 {
+			slug = slug[:i]
+		}
+	}
+	if slug == "" {
+		return strconv.Itoa(number)
+	}
+	return fmt.Sprintf("%d-%s", number, slug)
+}
+
+// NormalizeName turns arbitrary input into a name that passes
+// ValidateBranchName where possible, e.g. "My Feature!" becomes "My-Feature".
+func NormalizeName(name string) string {
+	name = invalidNameChars.ReplaceAllString(name, "-")
+	name = repeatedDashes.ReplaceAllString(name, "-")
+	name = repeatedDots.ReplaceAllString(name, ".")
+	name = repeatedSlashes.ReplaceAllString(name, "/")
+
+	// Path components may not start with a dot or end with .lock
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		part = strings.TrimLeft(part, ".-")
+		part = strings.TrimSuffix(part, ".lock")
+		parts[i] = strings.TrimRight(part, ".-")
+	}
+	parts = slices.DeleteFunc(parts, func(p string) bool { return p == "" })
+	name = strings.Join(parts, "/")
+
+	if len(name) > maxNameLength {
+		name = strings.TrimRight(name[:maxNameLength], "./-")
+	}
+	return name
+}
@@ -0,0 +1,54 @@
+package spaces
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// noteFile is the space's markdown note in its state dir.
+const noteFile = "note.md"
+
+// NotePath returns the path of the note kept for the named space. The note
+// lives in the state dir, so it survives dropping and recreating the worktree
+// and follows the space when it is renamed.
+func NotePath(destDir, name string) string {
+	return filepath.Join(StateDir(destDir, name), noteFile)
+}
+
+// NotePath returns the path of the space's note.
+func (s *Space) NotePath() string {
+	return filepath.Join(s.stateDir, noteFile)
+}
+
+// NoteSummary returns the first non-blank line of the named space's note,
+// without markdown heading markers, or "" if it has no note.
+func NoteSummary(destDir, name string) string {
+	f, err := os.Open(NotePath(destDir, name))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if heading := strings.TrimLeft(line, "#"); strings.HasPrefix(heading, " ") {
+			line = strings.TrimSpace(heading)
+		}
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// Note returns the contents of the space's note, or "" if it has none.
+func (s *Space) Note() (string, error) {
+	data, err := os.ReadFile(s.NotePath())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(data), err
+}
@@ -1,31 +1,65 @@
 package spaces
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
+	"time"
 
-	"github.com/johanhenriksson/remux/config"
-	"github.com/johanhenriksson/remux/git"
-	"github.com/johanhenriksson/remux/tmux"
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// sessionLockFile is the per-space lock held while a session is being set up.
+const sessionLockFile = "session.lock"
+
 // OpenSessionOptions contains the parameters for opening a space session.
 type OpenSessionOptions struct {
-	DestDir string            // Worktree directory
-	Name    string            // Name of the space to open
-	EnvVars map[string]string // Session-level environment variables (optional)
+	DestDir  string            // Worktree directory (State.OpenSession uses the state's dest dir)
+	Name     string            // Name of the space to open
+	EnvVars  map[string]string // Session-level environment variables (optional)
+	Fast     bool              // Skip env resolution and on_open hooks when reattaching to a running session
+	ApplyEnv bool              // Update the env of a running session like ApplyEnv, overriding Fast
+	Timings  *Timings          // Records the duration of each phase (optional)
+
+	// Detached sets the session up without attaching to it, for callers
+	// that aren't running in a terminal.
+	Detached bool
+
+	// BeforeAttach is called right before attaching to the session (optional).
+	// Attaching blocks until the client detaches, so this is the last point
+	// at which output is visible to the user.
+	BeforeAttach func()
 }
 
 // OpenSession opens a tmux session in the specified space.
 // If a session with that name already exists, it attaches to it.
-func OpenSession(opts OpenSessionOptions) error {
-	spacePath := filepath.Join(opts.DestDir, opts.Name)
+func OpenSession(ctx context.Context, opts OpenSessionOptions) error {
+	st, err := LoadState(opts.DestDir)
+	if err != nil {
+		return err
+	}
+	return st.OpenSession(ctx, opts)
+}
+
+// OpenSession opens a tmux session in the named space of the state's registry.
+// See OpenSession for details.
+func (st *State) OpenSession(ctx context.Context, opts OpenSessionOptions) (err error) {
+	ctx, span := telemetry.Start(ctx, "open", attribute.String("remux.space", opts.Name))
+	defer func() { telemetry.End(span, err) }()
+	spacePath := filepath.Join(st.DestDir, opts.Name)
+	bound := false
+	if entry := st.Registry.Get(opts.Name); entry != nil {
+		spacePath = entry.Path
+		bound = entry.Bound
+	}
 
 	info, err := os.Stat(spacePath)
 	if os.IsNotExist(err) {
-		return fmt.Errorf("space does not exist: %s", spacePath)
+		return fmt.Errorf("%w: %s", ErrSpaceNotFound, spacePath)
 	}
 	if err != nil {
 		return fmt.Errorf("failed to access space: %w", err)
@@ -34,94 +68,163 @@ func OpenSession(opts OpenSessionOptions) error {
 		return fmt.Errorf("space path is not a directory: %s", spacePath)
 	}
 
-	if !git.IsWorktree(spacePath) {
-		return fmt.Errorf("not a git worktree: %s", spacePath)
+	// Bound checkouts may be a repository's main working tree
+	if !bound && !st.gitClient().IsWorktree(spacePath) {
+		return fmt.Errorf("%w: %s", ErrNotWorktree, spacePath)
 	}
 
 	// Load space with config
-	space, err := Open(spacePath)
+	_, done := opts.Timings.Track(ctx, "config load")
+	space, err := st.Space(opts.Name)
+	done()
 	if err != nil {
 		return err
 	}
 
-	if opts.EnvVars == nil {
-		opts.EnvVars = make(map[string]string)
+	backend, err := space.Backend()
+	if err != nil {
+		return err
 	}
 
-	// todo: maybe no longer required?
-	opts.EnvVars["SPACE_PORT"] = strconv.Itoa(space.Port)
+	// Opening a hibernated space brings its services back first
+	if entry := st.Registry.Get(opts.Name); entry != nil && entry.Hibernated {
+		phaseCtx, done := opts.Timings.Track(ctx, "resume services")
+		err := st.resume(phaseCtx, space)
+		done()
+		if err != nil {
+			return err
+		}
+	}
 
-	// Merge config env vars
-	resolved, err := space.ResolveEnv()
+	// Fast path: reattach without resolving env or running hooks
+	if (opts.Fast || space.FastReattach()) && !opts.ApplyEnv && backend.SessionExists(opts.Name) {
+		st.touch(opts.Name)
+		return st.attach(backend, opts)
+	}
+
+	// Concurrent opens of the same space are serialized until the session is
+	// set up, so hooks and tab setup run once per open and the second caller
+	// finds the finished session
+	unlock, err := registry.LockFile(filepath.Join(StateDir(st.DestDir, opts.Name), sessionLockFile))
+	if err != nil {
+		return fmt.Errorf("failed to lock space: %w", err)
+	}
+	err = st.prepareSession(ctx, space, backend, spacePath, opts)
+	unlock()
 	if err != nil {
-		return fmt.Errorf("failed to resolve config env vars: %w", err)
+		return err
 	}
-	for key, value := range resolved {
-		opts.EnvVars[key] = value
+
+	return st.attach(backend, opts)
+}
+
+// prepareSession runs the on_open hooks and creates the backend session with its
+// tabs unless it is already running. Hooks that run in the session run once it
+// is. Called with the space's session lock held.
+func (st *State) prepareSession(ctx context.Context, space *Space, backend SessionManager, spacePath string, opts OpenSessionOptions) error {
+	if opts.EnvVars == nil {
+		opts.EnvVars = make(map[string]string)
 	}
 
-	// Run on_open hooks
-	if err := space.RunOnOpen(); err != nil {
+	if err := space.WriteVSCodeWorkspace(); err != nil {
+		space.logger.Warn("failed to write VS Code workspace", "err", err)
+	}
+	if err := space.WriteComposeOverride(); err != nil {
+		space.logger.Warn("failed to write compose override", "err", err)
+	}
+	if err := space.sessionEnv(ctx, opts.EnvVars, opts.Timings); err != nil {
 		return err
 	}
 
-	if tmux.SessionExists(opts.Name) {
-		if tmux.InSession() {
-			return tmux.SwitchTo(opts.Name)
+	// Run on_open hooks, unless they run in the session once it is started
+	inSession := space.hooksInSession()
+	if !inSession {
+		phaseCtx, done := opts.Timings.Track(ctx, "on_open hooks")
+		err := space.RunOnOpen(phaseCtx)
+		done()
+		if err != nil {
+			return err
 		}
-		return tmux.Attach(opts.Name)
 	}
 
+	st.touch(opts.Name)
+
+	if backend.SessionExists(opts.Name) {
+		if opts.ApplyEnv {
+			st.applySessionEnv(ctx, backend, opts)
+		}
+	} else if err := st.newSession(ctx, space, backend, spacePath, opts); err != nil {
+		return err
+	}
+
+	if inSession {
+		phaseCtx, done := opts.Timings.Track(ctx, "hooks in session")
+		err := space.runHooksInSession(phaseCtx, opts.Detached)
+		done()
+		return err
+	}
+	return nil
+}
+
+// newSession creates the backend session of the space with its tabs.
+func (st *State) newSession(ctx context.Context, space *Space, backend SessionManager, spacePath string, opts OpenSessionOptions) error {
 	// Get configured tabs
 	tabs, err := space.Tabs()
 	if err != nil {
 		return fmt.Errorf("failed to resolve tabs: %w", err)
 	}
-
-	// Create session detached so we can set up tabs before attaching
-	if err := tmux.NewSessionDetached(opts.Name, spacePath, opts.EnvVars); err != nil {
+	tabs, err = space.restoreScrollback(tabs)
+	if err != nil {
 		return err
 	}
 
-	// Set up tabs if configured
-	if len(tabs) > 0 {
-		if err := setupTabs(opts.Name, spacePath, tabs); err != nil {
-			return fmt.Errorf("failed to setup tabs: %w", err)
-		}
+	phaseCtx, done := opts.Timings.Track(ctx, "session")
+	err = backend.NewSession(phaseCtx, opts.Name, spacePath, opts.EnvVars, tabs)
+	done()
+	if errors.Is(err, ErrSessionExists) {
+		// Created outside of remux since we checked
+		return nil
 	}
-
-	// Attach or switch to session
-	if tmux.InSession() {
-		return tmux.SwitchTo(opts.Name)
+	if err != nil {
+		return err
 	}
-	return tmux.Attach(opts.Name)
+
+	return nil
 }
 
-// setupTabs configures tmux windows based on tab configuration.
-func setupTabs(session, workdir string, tabs []config.Tab) error {
-	for i, tab := range tabs {
-		if i == 0 {
-			// First tab uses the default window (active after session creation)
-			if tab.Name != "" {
-				if err := tmux.RenameWindow(session, "", tab.Name); err != nil {
-					return err
-				}
-			}
-		} else {
-			// Create new windows for subsequent tabs
-			if err := tmux.NewWindow(session, workdir, tab.Name); err != nil {
-				return err
-			}
-		}
+// applySessionEnv updates the env of the running session when reattaching with
+// ApplyEnv. Failures are only logged, since the session is usable either way.
+func (st *State) applySessionEnv(ctx context.Context, backend SessionManager, opts OpenSessionOptions) {
+	if backend.Name() != "tmux" {
+		st.logger().Warn("not applying env, the session backend doesn't support it", "backend", backend.Name())
+		return
+	}
+	if _, err := applyEnv(ctx, opts.Name, opts.EnvVars); err != nil {
+		st.logger().Warn("failed to apply env", "err", err)
+	}
+}
 
-		// Send command to the active window
-		if tab.Cmd != "" {
-			if err := tmux.SendKeys(session, "", tab.Cmd); err != nil {
-				return err
-			}
-		}
+// touch records that the named space was opened now, for list --sort
+// activity. Failing to record it doesn't fail the open.
+func (st *State) touch(name string) {
+	err := st.update(func(reg *registry.Registry) error {
+		reg.Touch(name, time.Now())
+		return nil
+	})
+	if err != nil {
+		st.logger().Warn("failed to record last open", "space", name, "err", err)
 	}
+}
 
-	// Select the first window
-	return tmux.SelectWindow(session, "{start}")
+// attach titles the session and brings it to the foreground, unless the
+// session is opened detached.
+func (st *State) attach(backend SessionManager, opts OpenSessionOptions) error {
+	if opts.Detached {
+		return nil
+	}
+	setTitle(backend, opts.Name, st.Title(opts.Name))
+	if opts.BeforeAttach != nil {
+		opts.BeforeAttach()
+	}
+	return backend.Attach(opts.Name)
 }
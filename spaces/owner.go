@@ -0,0 +1,31 @@
+package spaces
+
+import (
+	"os"
+	"os/user"
+
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// CurrentUser returns the login name of the user running remux, or "" if it
+// can't be determined.
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// user returns the state's user, or the current user.
+func (st *State) user() string {
+	if st.User != "" {
+		return st.User
+	}
+	return CurrentUser()
+}
+
+// owns reports whether the state's user may drop the space without force.
+// Spaces created before owners were recorded belong to everyone.
+func (st *State) owns(entry *registry.Entry) bool {
+	return entry.Owner == "" || entry.Owner == st.user()
+}
@@ -0,0 +1,47 @@
+package spaces
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// Parallel calls fn for each entry using at most workers goroutines.
+// Each space is an independent checkout, so per-space git work can safely
+// run concurrently. A workers value <= 0 uses GOMAXPROCS.
+// Returns the errors of all failed calls joined, each prefixed with the space name.
+func Parallel(entries []registry.Entry, workers int, fn func(i int, e registry.Entry) error) error {
+	return parallel(entries, workers, func(i int, e registry.Entry) error {
+		if err := fn(i, e); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+		return nil
+	})
+}
+
+// parallel calls fn for each item using at most workers goroutines, or
+// GOMAXPROCS if workers <= 0, and returns the errors of all failed calls joined.
+func parallel[T any](items []T, workers int, fn func(i int, item T) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i, item)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,205 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// ActionKind groups the actions of a plan by what they touch.
+type ActionKind string
+
+const (
+	ActionGit      ActionKind = "git"      // A git command
+	ActionHook     ActionKind = "hook"     // A setup installer or config hook
+	ActionRegistry ActionKind = "registry" // A change to the registry of spaces
+	ActionFiles    ActionKind = "files"    // A change to files outside of git
+	ActionProcess  ActionKind = "process"  // Stopping the space's processes
+	ActionSession  ActionKind = "session"  // A call to the session backend
+	ActionDocker   ActionKind = "docker"   // A docker command
+)
+
+// Action is a step Create or Drop would take.
+type Action struct {
+	Kind        ActionKind
+	Description string // e.g. "git -C /src/app branch feature"
+}
+
+// String returns the action's description.
+func (a Action) String() string {
+	return a.Description
+}
+
+// Plan is the ordered list of actions Create or Drop would take.
+type Plan []Action
+
+// String returns the actions as numbered lines.
+func (p Plan) String() string {
+	var b strings.Builder
+	for i, a := range p {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, a.Description)
+	}
+	return b.String()
+}
+
+// add appends an action with a formatted description.
+func (p *Plan) add(kind ActionKind, format string, args ...any) {
+	*p = append(*p, Action{Kind: kind, Description: fmt.Sprintf(format, args...)})
+}
+
+// PlanCreate returns the actions Create would take for opts, without taking
+// them. It fails the same way Create would before changing anything. Remotes,
+// setup and on_create hooks are read from the config in opts.RepoRoot, which
+// the new worktree usually starts from; hook commands are listed unevaluated.
+func (st *State) PlanCreate(ctx context.Context, opts CreateOptions) (Plan, error) {
+	tmpl, err := applyTemplate(&opts)
+	if err != nil {
+		return nil, err
+	}
+	worktreePath, branchExists, err := st.checkCreate(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDiskLimit(st.DestDir, opts.Limits); err != nil {
+		return nil, err
+	}
+	name := filepath.Base(worktreePath)
+
+	var plan Plan
+	takeChanges := opts.TakeChangesFrom != "" && st.gitClient().HasUncommittedChanges(ctx, opts.TakeChangesFrom)
+	if takeChanges {
+		plan.add(ActionGit, "git -C %s stash push --include-untracked", opts.TakeChangesFrom)
+	}
+	cfg, err := repoConfig(opts.RepoRoot, tmpl)
+	if err != nil {
+		return nil, err
+	}
+	if !branchExists {
+		if fetch := fetchRemote(opts, cfg.Remotes); fetch != "" {
+			plan.add(ActionGit, "git -C %s fetch %s", opts.RepoRoot, fetch)
+		}
+		// The tracked branch may only appear once fetched
+		start := opts.Track
+		if start == "" {
+			start = st.startPoint(ctx, opts, cfg.Remotes)
+		}
+		args := opts.BranchName
+		if start != "" {
+			args += " " + start
+		}
+		plan.add(ActionGit, "git -C %s branch %s", opts.RepoRoot, args)
+		if opts.Track != "" {
+			plan.add(ActionGit, "git -C %s branch --set-upstream-to=%s %s", opts.RepoRoot, opts.Track, opts.BranchName)
+		} else if cfg.Remotes.Push != "" {
+			plan.add(ActionGit, "git -C %s config branch.%s.pushRemote %s", opts.RepoRoot, opts.BranchName, cfg.Remotes.Push)
+		}
+	}
+	plan.add(ActionGit, "git -C %s worktree add %s %s", opts.RepoRoot, worktreePath, opts.BranchName)
+
+	port, err := allocatePort(st.Registry, opts)
+	if err != nil {
+		return nil, err
+	}
+	plan.add(ActionRegistry, "register %s with ports %d-%d", name, port, port+registry.PortRange-1)
+
+	for _, path := range cfg.Cache.Copy {
+		if _, err := os.Stat(filepath.Join(opts.RepoRoot, path)); err == nil {
+			plan.add(ActionFiles, "copy %s to %s", filepath.Join(opts.RepoRoot, path), filepath.Join(worktreePath, path))
+		}
+	}
+	for _, path := range cfg.Cache.Link {
+		if _, err := os.Stat(filepath.Join(opts.RepoRoot, path)); err == nil {
+			plan.add(ActionFiles, "link %s to %s", filepath.Join(worktreePath, path), filepath.Join(opts.RepoRoot, path))
+		}
+	}
+	space := config.NewSpace(name, worktreePath, port, opts.RepoRoot)
+	space.Host, _ = cfg.Hostname(space)
+	if network, err := cfg.DockerNetwork(space); err != nil {
+		return nil, err
+	} else if network != "" {
+		plan.add(ActionDocker, "docker network create %s", network)
+	}
+	if override := cfg.ComposeOverride(space); override != "" {
+		plan.add(ActionFiles, "write compose override %s", override)
+	}
+	if domains, err := cfg.CertDomains(space); err != nil {
+		return nil, err
+	} else if len(domains) > 0 {
+		plan.add(ActionFiles, "mkcert %s", strings.Join(domains, " "))
+	}
+	if file := cfg.HostsFile(); file != "" {
+		plan.add(ActionFiles, "register %s in %s", space.Host, file)
+	}
+	if !opts.SkipSetup {
+		for _, inst := range cfg.DetectSetup(opts.RepoRoot) {
+			plan.add(ActionHook, "%s setup: %s", inst.Name, inst.Command)
+		}
+	}
+	for _, hook := range cfg.Hooks.OnCreate {
+		plan.add(ActionHook, "on_create hook: %s", hook)
+	}
+	if takeChanges {
+		plan.add(ActionGit, "git -C %s stash pop", worktreePath)
+	}
+	return plan, nil
+}
+
+// PlanDrop returns the actions Drop would take for the worktree at
+// worktreePath, without taking them. It fails the same way Drop would before
+// running the on_drop hooks. Whether processes are still running is only
+// known once the hooks have run, so stopping them is planned only if
+// opts.Stop is set.
+func (st *State) PlanDrop(ctx context.Context, worktreePath string, opts DropOptions) (Plan, error) {
+	mainRepo, err := st.checkDrop(ctx, worktreePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	name := st.nameAt(worktreePath)
+	entry := st.Registry.Get(name)
+
+	var plan Plan
+	var backend SessionManager = tmuxBackend{}
+	if st.Backend != nil {
+		backend = st.Backend
+	}
+	space, err := st.Space(name)
+	if err == nil {
+		if b, err := space.Backend(); err == nil {
+			backend = b
+		}
+		for _, hook := range space.config.Hooks.OnDrop {
+			plan.add(ActionHook, "on_drop hook: %s", hook)
+		}
+		if opts.Stop {
+			plan.add(ActionProcess, "stop processes using ports %d-%d or the session's panes", space.Port, space.Port+registry.PortRange-1)
+		}
+	}
+
+	if entry == nil || !entry.Bound {
+		plan.add(ActionGit, "git -C %s worktree remove %s", mainRepo, worktreePath)
+		plan.add(ActionFiles, "remove %s", worktreePath)
+	}
+	if space != nil {
+		if network, err := space.config.DockerNetwork(space.configSpace()); err == nil && network != "" {
+			plan.add(ActionDocker, "docker network rm %s", network)
+		}
+		if space.config.Cert.Create {
+			plan.add(ActionFiles, "remove %s and %s", space.CertFile(), space.KeyFile())
+		}
+		if file := space.config.HostsFile(); file != "" {
+			plan.add(ActionFiles, "unregister %s from %s", space.configSpace().Host, file)
+		}
+	}
+	if entry != nil {
+		plan.add(ActionRegistry, "unregister %s", name)
+	}
+	if backend.SessionExists(name) {
+		plan.add(ActionSession, "kill %s session %s", backend.Name(), name)
+	}
+	return plan, nil
+}
@@ -0,0 +1,92 @@
+package spaces
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/johanhenriksson/remux/proc"
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// PortListener is a process listening on one of a space's ports.
+type PortListener struct {
+	Port    int
+	Process proc.Process
+	Cwd     string // Working directory of the process, "" if unknown
+	Foreign bool   // The process runs outside the space's worktree
+}
+
+// SpacePorts lists the processes listening on the ports of a space.
+type SpacePorts struct {
+	Name      string
+	Port      int // First of the space's PortRange ports
+	Listeners []PortListener
+}
+
+// PortUsage returns the processes listening on the ports of every space, in
+// registry order. A listener is foreign when its working directory is known
+// and outside the space's worktree, such as another space's dev server or a
+// system service that took the port.
+func (st *State) PortUsage() ([]SpacePorts, error) {
+	cwds := map[int]string{}
+	var result []SpacePorts
+	for _, e := range st.Registry.List() {
+		listeners, err := proc.ListeningOn(e.Port, e.Port+registry.PortRange-1)
+		if err != nil {
+			return nil, err
+		}
+
+		usage := SpacePorts{Name: e.Name, Port: e.Port}
+		for port := e.Port; port < e.Port+registry.PortRange; port++ {
+			for _, p := range listeners[port] {
+				l := PortListener{Port: port, Process: p}
+				if p.PID != 0 {
+					cwd, ok := cwds[p.PID]
+					if !ok {
+						cwd, _ = proc.Cwd(p.PID)
+						cwds[p.PID] = cwd
+					}
+					l.Cwd = cwd
+					l.Foreign = cwd != "" && !within(cwd, e.Path)
+				}
+				usage.Listeners = append(usage.Listeners, l)
+			}
+		}
+		result = append(result, usage)
+	}
+	return result, nil
+}
+
+// within reports whether path is dir or inside it, resolving symlinks in dir
+// the way working directories are reported.
+func within(path, dir string) bool {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// maxPort is the highest TCP port.
+const maxPort = 65535
+
+// portsFree reports whether the PortRange ports starting at port can be
+// listened on, probing the IPv4 and IPv6 loopback addresses dev servers
+// usually bind. Only ports in use count as taken, so a machine without IPv6
+// still has free ports.
+func portsFree(port int) bool {
+	for p := port; p < port+registry.PortRange; p++ {
+		for _, host := range []string{"127.0.0.1", "::1"} {
+			ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(p)))
+			if err == nil {
+				ln.Close()
+			} else if errors.Is(err, syscall.EADDRINUSE) {
+				return false
+			}
+		}
+	}
+	return true
+}
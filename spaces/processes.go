@@ -0,0 +1,92 @@
+package spaces
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/johanhenriksson/remux/proc"
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+// LiveProcess is a process that keeps a space in use.
+type LiveProcess struct {
+	proc.Process
+	Reason string // Why the process belongs to the space, e.g. "port 11010"
+}
+
+// LiveProcessesError is returned when a space can't be dropped because
+// processes are still using it. It matches ErrLiveProcesses.
+type LiveProcessesError struct {
+	Processes []LiveProcess
+	HooksRan  bool // The on_drop hooks ran before the processes were found
+}
+
+func (e *LiveProcessesError) Error() string {
+	var b strings.Builder
+	b.WriteString(ErrLiveProcesses.Error())
+	if e.HooksRan {
+		b.WriteString(" after the on_drop hooks ran")
+	}
+	b.WriteString(", use --stop to stop them:")
+	for _, p := range e.Processes {
+		if p.PID == 0 {
+			fmt.Fprintf(&b, "\n  ? %s (%s)", p.Command, p.Reason)
+		} else {
+			fmt.Fprintf(&b, "\n  %d %s (%s)", p.PID, p.Command, p.Reason)
+		}
+	}
+	return b.String()
+}
+
+// Is reports whether target is ErrLiveProcesses.
+func (e *LiveProcessesError) Is(target error) bool {
+	return target == ErrLiveProcesses
+}
+
+// LiveProcesses returns the processes listening on the space's allocated
+// ports and the processes running in its tmux panes. Idle pane shells are
+// not included.
+func (s *Space) LiveProcesses() ([]LiveProcess, error) {
+	var result []LiveProcess
+
+	listeners, err := proc.ListeningOn(s.Port, s.Port+registry.PortRange-1)
+	if err != nil {
+		return nil, err
+	}
+	for port := s.Port; port < s.Port+registry.PortRange; port++ {
+		for _, p := range listeners[port] {
+			result = append(result, LiveProcess{Process: p, Reason: fmt.Sprintf("port %d", port)})
+		}
+	}
+
+	if backend, err := s.Backend(); err == nil && backend.Name() == "tmux" && tmux.SessionExists(s.Name) {
+		panes, err := tmux.PanePIDs(s.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tmux panes: %w", err)
+		}
+		children, err := proc.Children(panes...)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range children {
+			result = append(result, LiveProcess{Process: p, Reason: "tmux pane"})
+		}
+	}
+
+	return result, nil
+}
+
+// stopProcesses terminates the given processes, see proc.Terminate.
+// Processes listed with PID 0, because lsof is missing, are skipped, since
+// there is nothing to signal.
+func stopProcesses(live []LiveProcess, grace time.Duration) error {
+	var procs []proc.Process
+	for _, p := range live {
+		if p.PID != 0 {
+			procs = append(procs, p.Process)
+		}
+	}
+	return proc.Terminate(procs, grace)
+}
@@ -0,0 +1,135 @@
+package spaces
+
+import (
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/johanhenriksson/remux/config"
+)
+
+// Route is a hostname the Proxy forwards to the port of a space.
+type Route struct {
+	Host  string
+	Space string
+	Port  int
+}
+
+// Routes returns the routes to the registered spaces: <name>.localhost,
+// <id>.localhost and the space's hostname each lead to its port.
+func (st *State) Routes() []Route {
+	st.mu.Lock()
+	entries := st.Registry.List()
+	st.mu.Unlock()
+
+	var routes []Route
+	for _, e := range entries {
+		id := config.NewSpace(e.Name, e.Path, e.Port, e.RepoRoot).ID
+		hosts := []string{e.Name + ".localhost"}
+		if space, err := st.Space(e.Name); err == nil {
+			id = space.ID()
+			if host, err := space.Host(); err == nil && host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+		hosts = append(hosts, id+".localhost")
+		slices.Sort(hosts)
+		for _, host := range slices.Compact(hosts) {
+			routes = append(routes, Route{Host: strings.ToLower(host), Space: e.Name, Port: e.Port})
+		}
+	}
+	return routes
+}
+
+// Proxy is a reverse proxy forwarding each request to the port of the space
+// its Host header names, so every space is reachable on one shared port.
+// Requests for other hosts get a status page listing the routes.
+type Proxy struct {
+	mu     sync.RWMutex
+	routes []Route
+	byHost map[string]Route
+}
+
+// NewProxy returns a Proxy with no routes.
+func NewProxy() *Proxy {
+	return &Proxy{byHost: map[string]Route{}}
+}
+
+// SetRoutes replaces the proxy's routes.
+func (p *Proxy) SetRoutes(routes []Route) {
+	byHost := make(map[string]Route, len(routes))
+	for _, r := range routes {
+		byHost[r.Host] = r
+	}
+	p.mu.Lock()
+	p.routes = routes
+	p.byHost = byHost
+	p.mu.Unlock()
+}
+
+// ServeHTTP forwards the request to the space its host names.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	p.mu.RLock()
+	route, ok := p.byHost[strings.ToLower(host)]
+	routes := p.routes
+	p.mu.RUnlock()
+
+	if !ok {
+		p.serveStatus(w, r, host, port, routes)
+		return
+	}
+	target := &url.URL{Scheme: "http", Host: net.JoinHostPort("localhost", strconv.Itoa(route.Port))}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			// Keep the space's hostname, which apps use to build their URLs
+			pr.Out.Host = pr.In.Host
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("remux: %s isn't serving on port %d: %v", route.Space, route.Port, err), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+var statusPage = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>remux</title></head>
+<body>
+<h1>remux</h1>
+{{ if .Routes }}<table>
+<tr><th>Host</th><th>Space</th><th>Port</th></tr>
+{{ range .Routes }}<tr><td><a href="http://{{ .Host }}{{ $.Port }}/">{{ .Host }}</a></td><td>{{ .Space }}</td><td>{{ .Port }}</td></tr>
+{{ end }}</table>{{ else }}<p>No tracked spaces</p>{{ end }}
+</body>
+</html>
+`))
+
+// serveStatus writes the status page, listing the routes as links through
+// the proxy's port. It is a 404 except at the root of localhost or an IP
+// address, so a mistyped space name doesn't look like a working page.
+func (p *Proxy) serveStatus(w http.ResponseWriter, r *http.Request, host, port string, routes []Route) {
+	if port != "" {
+		port = ":" + port
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.URL.Path != "/" || (host != "localhost" && net.ParseIP(host) == nil) {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	_ = statusPage.Execute(w, struct {
+		Routes []Route
+		Port   string
+	}{routes, port})
+}
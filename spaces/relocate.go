@@ -0,0 +1,165 @@
+package spaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+// shells are the pane commands that are safe to send a cd to.
+var shells = map[string]bool{"sh": true, "bash": true, "zsh": true, "fish": true, "dash": true, "ksh": true}
+
+// Relocate updates the spaces affected by moving oldPath to newPath. The path
+// may be a single worktree or a directory of worktrees such as the dest dir.
+// If oldPath still exists and newPath doesn't, the directory is moved first.
+//
+// Registry paths are rewritten, git's worktree links are repaired and idle
+// shells in the spaces' tmux panes change to the new location. A worktree
+// that was renamed renames its space and tmux session as well.
+// Returns the relocated entries.
+func (st *State) Relocate(ctx context.Context, oldPath, newPath string) ([]registry.Entry, error) {
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+
+	if exists(oldPath) && !exists(newPath) {
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return nil, fmt.Errorf("failed to move %s: %w", oldPath, err)
+		}
+	}
+	if !exists(newPath) {
+		return nil, fmt.Errorf("%s does not exist", newPath)
+	}
+
+	// The registry moves along with the dest dir
+	if rel, ok := relativeTo(oldPath, st.DestDir); ok {
+		st.DestDir = filepath.Join(newPath, rel)
+		if fs, ok := st.store.(registry.FileStore); ok {
+			fs.Dir = st.DestDir
+			st.store = fs
+		}
+	}
+
+	var names []string
+	for _, e := range st.Registry.List() {
+		if _, ok := relativeTo(oldPath, e.Path); ok {
+			names = append(names, e.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: no spaces under %s", ErrSpaceNotFound, oldPath)
+	}
+
+	var relocated []registry.Entry
+	err := st.Batch(func() error {
+		var errs []error
+		for _, name := range names {
+			entry, err := st.relocate(ctx, name, oldPath, newPath)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			relocated = append(relocated, entry)
+		}
+		return errors.Join(errs...)
+	})
+	return relocated, err
+}
+
+// relocate moves a single registered space from under oldPath to under newPath.
+func (st *State) relocate(ctx context.Context, name, oldPath, newPath string) (registry.Entry, error) {
+	var entry registry.Entry
+	err := st.update(func(reg *registry.Registry) error {
+		e := reg.Get(name)
+		if e == nil {
+			return fmt.Errorf("%w: %s", ErrSpaceNotFound, name)
+		}
+		rel, _ := relativeTo(oldPath, e.Path)
+		path := filepath.Join(newPath, rel)
+
+		// The worktree directory itself was renamed
+		if newName := filepath.Base(path); newName != name {
+			if !reg.Rename(name, newName) {
+				return fmt.Errorf("%w: %s", ErrSpaceExists, newName)
+			}
+			e = reg.Get(newName)
+		}
+		e.Path = path
+		if rel, ok := relativeTo(oldPath, e.RepoRoot); ok {
+			e.RepoRoot = filepath.Join(newPath, rel)
+		}
+		entry = *e
+		return nil
+	})
+	if err != nil {
+		return registry.Entry{}, err
+	}
+
+	if entry.Name != name {
+		if err := os.Rename(StateDir(st.DestDir, name), StateDir(st.DestDir, entry.Name)); err != nil && !os.IsNotExist(err) {
+			return entry, fmt.Errorf("failed to move state: %w", err)
+		}
+		if tmux.SessionExists(name) {
+			if err := tmux.RenameSession(name, entry.Name); err != nil {
+				return entry, fmt.Errorf("failed to rename tmux session: %w", err)
+			}
+		}
+	}
+
+	if err := git.RepairWorktrees(ctx, entry.RepoRoot, entry.Path); err != nil {
+		return entry, fmt.Errorf("failed to repair worktree: %w", err)
+	}
+
+	moveShells(ctx, entry.Name, oldPath, newPath)
+	return entry, nil
+}
+
+// moveShells changes idle shells in the session that are inside the moved
+// directory to its new location. Shells keep their old working directory
+// string until they cd, even though the directory itself has moved.
+func moveShells(ctx context.Context, session, oldPath, newPath string) {
+	if !tmux.SessionExists(session) {
+		return
+	}
+	panes, err := tmux.ListPanes(session)
+	if err != nil {
+		return
+	}
+	for _, pane := range panes {
+		if !shells[pane.CurrentCommand] {
+			continue
+		}
+		// Depending on the platform, tmux reports either path
+		dir := pane.CurrentPath
+		if rel, ok := relativeTo(oldPath, dir); ok {
+			dir = filepath.Join(newPath, rel)
+		} else if _, ok := relativeTo(newPath, dir); !ok {
+			continue
+		}
+		_ = tmux.SendKeysToPane(ctx, pane.ID, "cd "+shellQuote(dir))
+	}
+}
+
+// relativeTo returns path relative to base if path is base or inside it.
+func relativeTo(base, path string) (string, bool) {
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// shellQuote quotes s for use as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
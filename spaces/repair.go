@@ -0,0 +1,137 @@
+package spaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// ProblemKind classifies a broken space.
+type ProblemKind string
+
+const (
+	// ProblemMissing means the worktree directory was deleted. Repair removes the registry entry.
+	ProblemMissing ProblemKind = "missing"
+	// ProblemUnlinked means git lost track of the worktree. Repair relinks it with `git worktree repair`.
+	ProblemUnlinked ProblemKind = "unlinked"
+	// ProblemNotWorktree means the directory exists but is not a git worktree. It can't be repaired automatically.
+	ProblemNotWorktree ProblemKind = "not-worktree"
+	// ProblemRepoMissing means the main repository can't be read. It can't be repaired automatically.
+	ProblemRepoMissing ProblemKind = "repo-missing"
+)
+
+// Problem is an inconsistency between a registry entry, its worktree directory and git.
+type Problem struct {
+	Entry  registry.Entry
+	Kind   ProblemKind
+	Detail string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s (%s)", p.Entry.Name, p.Kind, p.Detail)
+}
+
+// Repairable reports whether Repair can fix the problem.
+func (p Problem) Repairable() bool {
+	return p.Kind == ProblemMissing || p.Kind == ProblemUnlinked
+}
+
+// Diagnose checks every registered space against its directory and git's
+// list of worktrees.
+func (st *State) Diagnose() []Problem {
+	var problems []Problem
+	worktrees := make(map[string][]git.Worktree) // keyed by repo root
+	repoErrs := make(map[string]error)
+
+	for _, e := range st.Registry.List() {
+		if _, err := os.Stat(e.Path); os.IsNotExist(err) {
+			problems = append(problems, Problem{Entry: e, Kind: ProblemMissing, Detail: "worktree directory was deleted"})
+			continue
+		}
+		// Bound checkouts may be a repository's main working tree
+		if !e.Bound && !git.IsWorktree(e.Path) {
+			problems = append(problems, Problem{Entry: e, Kind: ProblemNotWorktree, Detail: "directory has no .git file"})
+			continue
+		}
+
+		list, ok := worktrees[e.RepoRoot]
+		if !ok && repoErrs[e.RepoRoot] == nil {
+			var err error
+			if list, err = git.ListWorktrees(e.RepoRoot); err != nil {
+				repoErrs[e.RepoRoot] = err
+			}
+			worktrees[e.RepoRoot] = list
+		}
+		if err := repoErrs[e.RepoRoot]; err != nil {
+			problems = append(problems, Problem{Entry: e, Kind: ProblemRepoMissing, Detail: fmt.Sprintf("cannot list worktrees of %s: %v", e.RepoRoot, err)})
+			continue
+		}
+
+		wt := findWorktree(list, e.Path)
+		switch {
+		case wt == nil:
+			problems = append(problems, Problem{Entry: e, Kind: ProblemUnlinked, Detail: "git does not list the worktree"})
+		case wt.Prunable:
+			problems = append(problems, Problem{Entry: e, Kind: ProblemUnlinked, Detail: wt.Reason})
+		}
+	}
+	return problems
+}
+
+// Repair fixes the repairable problems: stale registry entries are removed
+// and unlinked worktrees are relinked. Afterwards, git's records of deleted
+// worktrees are pruned in every affected repository.
+func (st *State) Repair(ctx context.Context, problems []Problem) error {
+	return st.Batch(func() error {
+		var errs []error
+		prune := make(map[string]bool)
+
+		for _, p := range problems {
+			switch p.Kind {
+			case ProblemMissing:
+				_ = st.update(func(reg *registry.Registry) error {
+					reg.Remove(p.Entry.Name)
+					return nil
+				})
+				_ = os.RemoveAll(StateDir(st.DestDir, p.Entry.Name))
+				prune[p.Entry.RepoRoot] = true
+			case ProblemUnlinked:
+				if err := git.RepairWorktrees(ctx, p.Entry.RepoRoot, p.Entry.Path); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", p.Entry.Name, err))
+				}
+			}
+		}
+
+		for repoRoot := range prune {
+			if err := git.PruneWorktrees(ctx, repoRoot); err != nil {
+				errs = append(errs, fmt.Errorf("failed to prune worktrees of %s: %w", repoRoot, err))
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// findWorktree returns the worktree at path, comparing resolved paths.
+func findWorktree(list []git.Worktree, path string) *git.Worktree {
+	path = resolvePath(path)
+	for i := range list {
+		if resolvePath(list[i].Path) == path {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// resolvePath cleans path and resolves symlinks if it exists, since git
+// reports real paths.
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,87 @@
+package spaces
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/forge"
+	"github.com/johanhenriksson/remux/git"
+)
+
+// Report returns a markdown summary of the named space: its branch and base
+// branch, linked issue and pull request, the commits and diffstat since the
+// base branch, and its note. The summary is rendered with the report template
+// of the space's config, see config.Report.
+func (st *State) Report(ctx context.Context, name string) (string, error) {
+	space, err := st.Space(name)
+	if err != nil {
+		return "", err
+	}
+	base, err := st.BaseBranch(name)
+	if err != nil {
+		return "", err
+	}
+	branch, err := git.CurrentBranch(space.Path)
+	if err != nil {
+		return "", err
+	}
+	mergeBase, err := git.MergeBase(ctx, space.Path, base, "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	commits, err := git.Log(ctx, space.Path, mergeBase)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, len(commits))
+	for i, c := range commits {
+		lines[i] = fmt.Sprintf("- `%s` %s", c.Hash, c.Subject)
+	}
+
+	var stat bytes.Buffer
+	if err := git.Diff(ctx, space.Path, mergeBase, &stat, "--stat"); err != nil {
+		return "", fmt.Errorf("failed to get diffstat: %w", err)
+	}
+
+	note, err := space.Note()
+	if err != nil {
+		return "", fmt.Errorf("failed to read note: %w", err)
+	}
+
+	return space.config.RenderReport(space.configSpace(), config.ReportData{
+		Branch:      branch,
+		Base:        base,
+		Issue:       st.Registry.Get(name).Issue,
+		PullRequest: space.pullRequestURL(ctx, branch),
+		Commits:     strings.Join(lines, "\n"),
+		Stat:        strings.TrimRight(stat.String(), "\n"),
+		Note:        strings.TrimSpace(note),
+	})
+}
+
+// pullRequestURL returns the URL of the open pull request of the space's
+// branch, or "" if there is none. Forge failures are logged, not returned, so
+// a report can be written offline.
+func (s *Space) pullRequestURL(ctx context.Context, branch string) string {
+	if !git.HasUpstream(s.Path) {
+		return ""
+	}
+	f, err := forge.Open(s.Path)
+	if err != nil {
+		s.logger.Warn("failed to look up pull request", "err", err)
+		return ""
+	}
+	pr, err := f.ResolvePR(ctx, branch)
+	if err != nil {
+		if !errors.Is(err, forge.ErrNotFound) {
+			s.logger.Warn("failed to look up pull request", "err", err)
+		}
+		return ""
+	}
+	return pr.URL
+}
@@ -0,0 +1,178 @@
+package spaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+// ErrUnknownCommand is returned when running a command the space's config
+// doesn't define.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// commandLogDir holds the output of background commands in the state dir.
+const commandLogDir = "commands"
+
+// hooksWindow is the name of the window hooks run in, see runHooksInSession.
+const hooksWindow = "hooks"
+
+// pendingHooksFile marks, in the state dir, a space whose on_create hooks
+// haven't run yet because they run in its session, see deferCreateHooks.
+const pendingHooksFile = "on_create.pending"
+
+// CommandRun tells where a command started by RunCommand went, unless it
+// ran in the foreground.
+type CommandRun struct {
+	Window string // tmux window the command was typed into
+	PID    int    // Process of a background command
+	Log    string // File the output of a background command goes to
+}
+
+// RunCommand runs the named command of a space's config, see config.Command.
+// Commands run in the space's worktree with its env, writing their output
+// to stdout and stderr, unless they ask to run in a tab of the space's tmux
+// session or in the background. Those return once started. Commands run in
+// a window of the session are waited for; if ctx is cancelled first, they
+// keep running.
+func (st *State) RunCommand(ctx context.Context, name, command string, stdout, stderr io.Writer) (*CommandRun, error) {
+	space, err := st.Space(name)
+	if err != nil {
+		return nil, err
+	}
+	cmd, ok := space.config.Command(command)
+	if !ok {
+		names := space.config.CommandNames()
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%w %q, %s defines no commands", ErrUnknownCommand, command, name)
+		}
+		return nil, fmt.Errorf("%w %q, %s defines %s", ErrUnknownCommand, command, name, strings.Join(names, ", "))
+	}
+
+	switch {
+	case cmd.Tab:
+		if err := space.requireTmuxSession(); err != nil {
+			return nil, err
+		}
+		resolved, env, err := space.config.ResolveCommand(space.configSpace(), cmd)
+		if err != nil {
+			return nil, err
+		}
+		window, err := tmux.NewWindow(ctx, name, space.Path, command, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open window: %w", err)
+		}
+		return &CommandRun{Window: window}, tmux.SendKeys(ctx, name, window, resolved)
+
+	case cmd.Session:
+		if err := space.requireTmuxSession(); err != nil {
+			return nil, err
+		}
+		resolved, env, err := space.config.ResolveCommand(space.configSpace(), cmd)
+		if err != nil {
+			return nil, err
+		}
+		run, err := tmux.RunInWindow(ctx, name, space.Path, command, resolved, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open window: %w", err)
+		}
+		status, err := run.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if status != 0 {
+			return nil, fmt.Errorf("%s exited with %d, see its window in session %s", command, status, run.Session)
+		}
+		return &CommandRun{Window: run.Window}, nil
+
+	case cmd.Background:
+		dir := filepath.Join(space.stateDir, commandLogDir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		run := &CommandRun{Log: filepath.Join(dir, command+".log")}
+		output, err := os.Create(run.Log)
+		if err != nil {
+			return nil, err
+		}
+		defer output.Close()
+		if run.PID, err = space.config.StartCommand(space.configSpace(), cmd, output); err != nil {
+			return nil, err
+		}
+		return run, nil
+	}
+	return nil, space.config.RunCommand(ctx, space.configSpace(), cmd, stdout, stderr)
+}
+
+// requireTmuxSession returns an error wrapping ErrNoSession unless the space
+// has a running tmux session.
+func (s *Space) requireTmuxSession() error {
+	backend, err := s.Backend()
+	if err != nil {
+		return err
+	}
+	if backend.Name() != "tmux" || !backend.SessionExists(s.Name) {
+		return fmt.Errorf("%w: %s", ErrNoSession, s.Name)
+	}
+	return nil
+}
+
+// hooksInSession reports whether the space's on_create and on_open hooks run
+// in its session, see config.Hooks.InSession.
+func (s *Space) hooksInSession() bool {
+	if !s.config.Hooks.InSession {
+		return false
+	}
+	backend, err := s.Backend()
+	return err == nil && backend.Name() == "tmux"
+}
+
+// deferCreateHooks marks the space's on_create hooks to run with its on_open
+// hooks once its session is started, see runHooksInSession.
+func (s *Space) deferCreateHooks() error {
+	if err := os.MkdirAll(s.stateDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.stateDir, pendingHooksFile), nil, 0644)
+}
+
+// runHooksInSession runs the space's on_open hooks, preceded by its deferred
+// on_create hooks, in a window of its running session. Unless detached, it
+// waits for them and returns an error if one failed; otherwise they are left
+// running.
+func (s *Space) runHooksInSession(ctx context.Context, detached bool) error {
+	events := []string{"on_open"}
+	pending := filepath.Join(s.stateDir, pendingHooksFile)
+	if _, err := os.Stat(pending); err == nil {
+		events = []string{"on_create", "on_open"}
+	}
+	script, err := s.config.HookScript(s.configSpace(), events...)
+	if err != nil {
+		return err
+	}
+	if script == "" {
+		_ = os.Remove(pending)
+		return nil
+	}
+	run, err := tmux.RunInWindow(ctx, s.Name, s.Path, hooksWindow, script, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start hooks: %w", err)
+	}
+	_ = os.Remove(pending)
+	if detached {
+		return nil
+	}
+	status, err := run.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("hooks failed with exit status %d, see the %s window of session %s", status, hooksWindow, run.Session)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package spaces
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+const (
+	scrollbackDir      = "scrollback"
+	scrollbackRestored = "restored"
+
+	// defaultScrollbackLines is the number of lines captured per pane when
+	// scrollback.lines is not set.
+	defaultScrollbackLines = 2000
+
+	// scrollbackTail is the number of saved lines printed in each tab by the
+	// tail restore mode.
+	scrollbackTail = 50
+)
+
+// ScrollbackDir returns the directory holding the space's saved scrollback.
+func (s *Space) ScrollbackDir() string {
+	return filepath.Join(s.stateDir, scrollbackDir)
+}
+
+// SaveScrollback captures the scrollback of every pane of the space's tmux
+// session, replacing the previous capture. Each pane is saved as
+// <tab>.<pane>.log, with windows numbered in order from 0 so they line up with
+// the configured tabs. Does nothing unless scrollback.save is enabled.
+func (s *Space) SaveScrollback() error {
+	if !s.config.Scrollback.Save {
+		return nil
+	}
+	backend, err := s.Backend()
+	if err != nil {
+		return err
+	}
+	if backend.Name() != "tmux" {
+		return fmt.Errorf("saving scrollback is not supported by the %s backend", backend.Name())
+	}
+
+	panes, err := tmux.ListPanes(s.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list panes: %w", err)
+	}
+	lines := s.config.Scrollback.Lines
+	if lines <= 0 {
+		lines = defaultScrollbackLines
+	}
+
+	var windows []int
+	for _, p := range panes {
+		if !slices.Contains(windows, p.Window) {
+			windows = append(windows, p.Window)
+		}
+	}
+	slices.Sort(windows)
+
+	dir := s.ScrollbackDir()
+	if err := removeLogs(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create scrollback dir: %w", err)
+	}
+
+	count := make(map[int]int)
+	for _, p := range panes {
+		text, err := tmux.CapturePane(p.ID, lines)
+		if err != nil {
+			return fmt.Errorf("failed to capture pane %s: %w", p.ID, err)
+		}
+		if text == "" {
+			continue
+		}
+		tab := slices.Index(windows, p.Window)
+		file := filepath.Join(dir, fmt.Sprintf("%d.%d.log", tab, count[tab]))
+		count[tab]++
+		if err := os.WriteFile(file, []byte(text+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to save scrollback: %w", err)
+		}
+	}
+	return nil
+}
+
+// restoreScrollback returns tabs changed to bring back the scrollback saved by
+// SaveScrollback, as selected by scrollback.restore. The saved files are moved
+// aside so they are restored by a single open.
+func (s *Space) restoreScrollback(tabs []config.Tab) ([]config.Tab, error) {
+	dir := s.ScrollbackDir()
+	logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(logs) == 0 {
+		return tabs, nil
+	}
+
+	mode := s.config.Scrollback.Restore
+	if mode != "" && mode != "tail" && mode != "pager" {
+		return nil, fmt.Errorf("unsupported scrollback restore %q (expected tail or pager)", mode)
+	}
+
+	restored := filepath.Join(dir, scrollbackRestored)
+	if err := os.RemoveAll(restored); err != nil {
+		return nil, fmt.Errorf("failed to clear restored scrollback: %w", err)
+	}
+	if err := os.MkdirAll(restored, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create scrollback dir: %w", err)
+	}
+	files := make([]string, len(logs))
+	for i, log := range logs {
+		files[i] = filepath.Join(restored, filepath.Base(log))
+		if err := os.Rename(log, files[i]); err != nil {
+			return nil, fmt.Errorf("failed to restore scrollback: %w", err)
+		}
+	}
+
+	result := slices.Clone(tabs)
+	if mode == "pager" {
+		quoted := make([]string, len(files))
+		for i, file := range files {
+			quoted[i] = shellQuote(file)
+		}
+		return append(result, config.Tab{Name: "scrollback", Cmd: "less -R +G " + strings.Join(quoted, " ")}), nil
+	}
+
+	// The session starts with one window even without configured tabs
+	if len(result) == 0 {
+		result = []config.Tab{{}}
+	}
+	for i := range result {
+		file := filepath.Join(restored, strconv.Itoa(i)+".0.log")
+		if !exists(file) {
+			continue
+		}
+		cmd := fmt.Sprintf("tail -n %d %s", scrollbackTail, shellQuote(file))
+		if result[i].Cmd != "" {
+			cmd += "; " + result[i].Cmd
+		}
+		result[i].Cmd = cmd
+	}
+	return result, nil
+}
+
+// removeLogs deletes the scrollback files saved directly in dir.
+func removeLogs(dir string) error {
+	logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	for _, log := range logs {
+		if err := os.Remove(log); err != nil {
+			return fmt.Errorf("failed to remove old scrollback: %w", err)
+		}
+	}
+	return nil
+}
@@ -1,14 +1,24 @@
 package spaces
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
 	"path/filepath"
-	"strings"
 
 	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/git"
 	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/tmux"
 )
 
+// stateDirName is the directory inside the dest dir holding per-space state.
+const stateDirName = ".state"
+
+// StateDir returns the directory holding remux-managed state for the named space.
+func StateDir(destDir, name string) string {
+	return filepath.Join(destDir, stateDirName, name)
+}
+
 // Space represents a loaded workspace with config.
 type Space struct {
 	Name     string
@@ -16,63 +26,145 @@ type Space struct {
 	Port     int
 	RepoRoot string
 	config   *config.Config
+	stateDir string
+	backend  SessionManager // Overrides the configured backend if set
+	logger   *slog.Logger
+
+	registered []registry.Entry // The registry when the space was loaded, for the spaces template variable
 }
 
-// ID returns a sanitized identifier for the space (hyphens replaced with underscores).
+// ID returns the identifier of the space, derived from its name as the id
+// config picks.
 func (s *Space) ID() string {
-	return strings.ReplaceAll(s.Name, "-", "_")
+	return s.config.SpaceID(s.Name)
 }
 
 // Open loads a space from the given worktree path.
 // It loads both the registry entry and workspace config.
 func Open(worktreePath string) (*Space, error) {
-	destDir := filepath.Dir(worktreePath)
-	spaceName := filepath.Base(worktreePath)
-
-	reg, err := registry.Load(destDir)
+	st, err := LoadState(filepath.Dir(worktreePath))
 	if err != nil {
-		return nil, fmt.Errorf("failed to load registry: %w", err)
+		return nil, err
 	}
+	return st.Space(filepath.Base(worktreePath))
+}
 
-	entry := reg.Get(spaceName)
-	if entry == nil {
-		return nil, fmt.Errorf("space not found: %s", spaceName)
+// configSpace returns the config.Space context for template evaluation.
+func (s *Space) configSpace() config.Space {
+	space := config.NewSpace(s.Name, s.Path, s.Port, s.RepoRoot)
+	space.ID = s.ID()
+	space.SessionName = s.sessionName()
+	space.NvimSession = s.NvimSession()
+	space.Nvim = s.NvimCommand()
+	space.VSCodeWorkspace = s.VSCodeWorkspace()
+	space.CertFile = s.CertFile()
+	space.KeyFile = s.KeyFile()
+	space.LogDir = s.LogDir()
+	space.URL = func() string {
+		url, _ := s.BranchURL()
+		return url
 	}
-
-	cfg, err := config.Load(worktreePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
+	space.Spaces = func() []config.Space {
+		result := make([]config.Space, 0, len(s.registered))
+		for _, e := range s.registered {
+			other := config.NewSpace(e.Name, e.Path, e.Port, e.RepoRoot)
+			// Spaces of the same repository share its id config
+			other.ID = s.config.SpaceID(e.Name)
+			result = append(result, other)
+		}
+		return result
 	}
+	// The hostname template sees the other fields, so it is evaluated last
+	space.Host, _ = s.config.Hostname(space)
+	return space
+}
 
-	space := &Space{
-		Name:     entry.Name,
-		Path:     entry.Path,
-		Port:     entry.Port,
-		RepoRoot: entry.RepoRoot,
-		config:   cfg,
+// sessionName returns the name of the space's session in its backend.
+func (s *Space) sessionName() string {
+	if backend, err := s.Backend(); err == nil && backend.Name() == "tmux" {
+		return tmux.SessionName(s.Name)
 	}
-
-	return space, nil
+	return s.Name
 }
 
-// configSpace returns the config.Space context for template evaluation.
-func (s *Space) configSpace() config.Space {
-	return config.NewSpace(s.Name, s.Path, s.Port, s.RepoRoot)
+// RunSetup runs the installers for tooling detected in the worktree. Prints warnings on failure.
+func (s *Space) RunSetup(ctx context.Context) {
+	s.config.RunSetup(ctx, s.configSpace())
 }
 
 // RunOnCreate executes on_create hooks. Prints warnings on failure.
-func (s *Space) RunOnCreate() {
-	s.config.RunOnCreate(s.configSpace())
+func (s *Space) RunOnCreate(ctx context.Context) {
+	s.config.RunOnCreate(ctx, s.configSpace())
 }
 
 // RunOnOpen executes on_open hooks. Returns error on failure.
-func (s *Space) RunOnOpen() error {
-	return s.config.RunOnOpen(s.configSpace())
+func (s *Space) RunOnOpen(ctx context.Context) error {
+	return s.config.RunOnOpen(ctx, s.configSpace())
 }
 
 // RunOnDrop executes on_drop hooks. Returns error on failure.
-func (s *Space) RunOnDrop() error {
-	return s.config.RunOnDrop(s.configSpace())
+func (s *Space) RunOnDrop(ctx context.Context) error {
+	return s.config.RunOnDrop(ctx, s.configSpace())
+}
+
+// ExplainHooks evaluates the hooks of event, or of every event if empty, without running them.
+func (s *Space) ExplainHooks(event string) (*config.HookExplanation, error) {
+	return s.config.ExplainHooks(s.configSpace(), event)
+}
+
+// StartServices starts the compose services and systemd units of the space's config.
+func (s *Space) StartServices(ctx context.Context) error {
+	return s.config.StartServices(ctx, s.configSpace())
+}
+
+// StopServices stops the systemd units and compose services of the space's config.
+func (s *Space) StopServices(ctx context.Context) error {
+	return s.config.StopServices(ctx, s.configSpace())
+}
+
+// WarmCache copies and links the configured build caches of the repository at from into the worktree.
+// The caches are kept out of git status, since a linked cache isn't matched by
+// an ignore pattern for directories.
+func (s *Space) WarmCache(ctx context.Context, from string) {
+	for _, path := range s.config.WarmCache(ctx, s.configSpace(), from) {
+		if err := git.ExcludeLocally(s.Path, filepath.FromSlash(path)); err != nil {
+			s.logger.Warn("failed to exclude cache from git", "path", path, "err", err)
+		}
+	}
+}
+
+// CacheEnv returns the env vars pointing tools at the shared cache dirs.
+func (s *Space) CacheEnv() (map[string]string, error) {
+	return s.config.CacheEnv()
+}
+
+// DockerEnv returns the DOCKER_NETWORK, IMAGE_TAG and CONTAINER_PREFIX variables of the space.
+func (s *Space) DockerEnv() (map[string]string, error) {
+	return s.config.DockerEnv(s.configSpace())
+}
+
+// CreateDockerNetwork creates the space's docker network if the config asks for one.
+func (s *Space) CreateDockerNetwork(ctx context.Context) error {
+	return s.config.CreateDockerNetwork(ctx, s.configSpace())
+}
+
+// WriteComposeOverride writes the space's docker.ports to its compose
+// override file, which is kept out of git status so it doesn't block drop.
+func (s *Space) WriteComposeOverride() error {
+	path, err := s.config.WriteComposeOverride(s.configSpace())
+	if err != nil || path == "" {
+		return err
+	}
+	rel, err := filepath.Rel(s.Path, path)
+	if err != nil {
+		return err
+	}
+	return git.ExcludeLocally(s.Path, rel)
+}
+
+// RemoveDockerNetwork removes the network created by CreateDockerNetwork.
+func (s *Space) RemoveDockerNetwork(ctx context.Context) error {
+	return s.config.RemoveDockerNetwork(ctx, s.configSpace())
 }
 
 // ResolveEnv evaluates template expressions in config env vars.
@@ -80,6 +172,11 @@ func (s *Space) ResolveEnv() (map[string]string, error) {
 	return s.config.ResolveEnv(s.configSpace())
 }
 
+// FastReattach reports whether the config skips hooks when reattaching to a running session.
+func (s *Space) FastReattach() bool {
+	return s.config.FastReattach
+}
+
 // Tabs returns the resolved tab configurations for this space.
 func (s *Space) Tabs() ([]config.Tab, error) {
 	return s.config.ResolveTabs(s.configSpace())
@@ -1,21 +1,40 @@
 package spaces_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/forge"
+	"github.com/johanhenriksson/remux/git"
 	"github.com/johanhenriksson/remux/registry"
+	"github.com/johanhenriksson/remux/remuxtest"
 	"github.com/johanhenriksson/remux/spaces"
 	"github.com/johanhenriksson/remux/tmux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestSpaces(t *testing.T) {
@@ -61,7 +80,7 @@ var _ = Describe("Create", func() {
 			BranchName: "feature-test",
 		}
 
-		worktreePath, err := spaces.Create(opts)
+		worktreePath, err := spaces.Create(context.Background(), opts)
 
 		Expect(err).NotTo(HaveOccurred())
 		expectedPath := filepath.Join(destDir, filepath.Base(testRepoDir)+"-feature-test")
@@ -91,10 +110,65 @@ var _ = Describe("Create", func() {
 			BranchName: "existing-branch",
 		}
 
-		_, err := spaces.Create(opts)
+		_, err := spaces.Create(context.Background(), opts)
 
 		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(ContainSubstring("already exists"))
+		Expect(err).To(MatchError(spaces.ErrBranchExists))
+	})
+
+	It("rejects invalid branch names before creating anything", func() {
+		_, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "bad name",
+		})
+		Expect(err).To(MatchError(spaces.ErrInvalidName))
+
+		Expect(exec.Command("git", "-C", testRepoDir, "show-ref", "--verify", "--quiet", "refs/heads/bad name").Run()).NotTo(Succeed())
+		entries, _ := os.ReadDir(destDir)
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("records the issue link", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "42-fix-crash",
+			Issue:      "https://github.com/o/r/issues/42",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		reg, err := registry.Load(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reg.Get(filepath.Base(worktreePath)).Issue).To(Equal("https://github.com/o/r/issues/42"))
+	})
+
+	It("resolves the branch url from the origin remote", func() {
+		runGitCmd(testRepoDir, "remote", "add", "origin", "git@github.com:o/r.git")
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "feat/login",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		space, err := spaces.Open(worktreePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(space.BranchURL()).To(Equal("https://github.com/o/r/tree/feat/login"))
+
+		// Unpushed branches browse to the repository
+		Expect(space.BrowseURL(context.Background())).To(Equal("https://github.com/o/r"))
+	})
+
+	It("creates a single directory for branches with slashes", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "feat/login",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(worktreePath).To(Equal(filepath.Join(destDir, filepath.Base(testRepoDir)+"-feat-login")))
+		Expect(git.BranchExists(context.Background(), testRepoDir, "feat/login")).To(BeTrue())
 	})
 
 	It("returns an error when worktree directory already exists", func() {
@@ -102,33 +176,2037 @@ var _ = Describe("Create", func() {
 		err := os.MkdirAll(worktreePath, 0755)
 		Expect(err).NotTo(HaveOccurred())
 
-		opts := spaces.CreateOptions{
-			RepoRoot:   testRepoDir,
-			DestDir:    destDir,
-			BranchName: "blocked-branch",
+		opts := spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "blocked-branch",
+		}
+
+		_, err = spaces.Create(context.Background(), opts)
+
+		Expect(err).To(HaveOccurred())
+		Expect(err).To(MatchError(spaces.ErrSpaceExists))
+	})
+
+	It("rolls back when cancelled during on_create hooks", func() {
+		cfg := "hooks:\n  on_create:\n    - sleep 10\n"
+		Expect(os.WriteFile(filepath.Join(testRepoDir, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		runGitCmd(testRepoDir, "add", ".remux.yaml")
+		runGitCmd(testRepoDir, "commit", "-m", "Add config")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		_, err := spaces.Create(ctx, spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "cancelled",
+		})
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+
+		_, err = os.Stat(filepath.Join(destDir, filepath.Base(testRepoDir)+"-cancelled"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		gitCmd := exec.Command("git", "-C", testRepoDir, "show-ref", "--verify", "--quiet", "refs/heads/cancelled")
+		Expect(gitCmd.Run()).To(HaveOccurred())
+
+		reg, err := registry.Load(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reg.List()).To(BeEmpty())
+	})
+
+	It("warms the configured caches before setup", func() {
+		cfg := "cache:\n  copy: [node_modules]\n  link: [vendor]\nhooks:\n  on_create:\n    - test -f node_modules/dep.js\n    - touch warmed\n"
+		Expect(os.WriteFile(filepath.Join(testRepoDir, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(testRepoDir, ".gitignore"), []byte("node_modules\nvendor/\n"), 0644)).To(Succeed())
+		runGitCmd(testRepoDir, "add", ".remux.yaml", ".gitignore")
+		runGitCmd(testRepoDir, "commit", "-m", "Add config")
+		Expect(os.MkdirAll(filepath.Join(testRepoDir, "node_modules"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(testRepoDir, "node_modules", "dep.js"), nil, 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(testRepoDir, "vendor"), 0755)).To(Succeed())
+
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "warm",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(worktreePath, "warmed")).To(BeARegularFile())
+
+		// The vendor/ pattern doesn't match the linked cache, which is excluded instead
+		status, err := exec.Command("git", "-C", worktreePath, "status", "--porcelain").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(status)).To(Equal("?? warmed\n"))
+	})
+
+	It("registers the space's hostname until it is dropped", func() {
+		hosts := filepath.Join(destDir, "hosts")
+		Expect(os.WriteFile(hosts, []byte("127.0.0.1\tlocalhost\n"), 0644)).To(Succeed())
+		cfg := "hosts:\n  register: true\n  file: " + hosts + "\n"
+		Expect(os.WriteFile(filepath.Join(testRepoDir, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		runGitCmd(testRepoDir, "add", ".remux.yaml")
+		runGitCmd(testRepoDir, "commit", "-m", "Add config")
+
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "web",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		name := filepath.Base(worktreePath)
+		Expect(os.ReadFile(hosts)).To(BeEquivalentTo("127.0.0.1\tlocalhost\n127.0.0.1\t" + name + ".test\t# remux:" + name + "\n"))
+
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		space, err := st.Space(name)
+		Expect(err).NotTo(HaveOccurred())
+		env, err := space.SessionEnv(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(HaveKeyWithValue("SPACE_HOST", name+".test"))
+
+		Expect(spaces.Drop(context.Background(), worktreePath, spaces.DropOptions{Force: true})).To(Succeed())
+		Expect(os.ReadFile(hosts)).To(BeEquivalentTo("127.0.0.1\tlocalhost\n"))
+	})
+
+	It("moves uncommitted changes into the new worktree", func() {
+		Expect(os.WriteFile(filepath.Join(testRepoDir, "README.md"), []byte("# Changed"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(testRepoDir, "new.txt"), []byte("new"), 0644)).To(Succeed())
+
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:        testRepoDir,
+			DestDir:         destDir,
+			BranchName:      "taken",
+			TakeChangesFrom: testRepoDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(filepath.Join(worktreePath, "README.md")).To(BeARegularFile())
+		content, err := os.ReadFile(filepath.Join(worktreePath, "README.md"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("# Changed"))
+		Expect(filepath.Join(worktreePath, "new.txt")).To(BeARegularFile())
+
+		content, err = os.ReadFile(filepath.Join(testRepoDir, "README.md"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("# Test"))
+		Expect(filepath.Join(testRepoDir, "new.txt")).NotTo(BeAnExistingFile())
+
+		out, err := exec.Command("git", "-C", testRepoDir, "stash", "list").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(BeEmpty())
+	})
+
+	It("branches off the base whatever the main checkout is on", func() {
+		runGitCmd(testRepoDir, "branch", "-M", "main")
+		runGitCmd(testRepoDir, "checkout", "-q", "-b", "wip")
+		Expect(os.WriteFile(filepath.Join(testRepoDir, "wip.txt"), []byte("wip"), 0644)).To(Succeed())
+		runGitCmd(testRepoDir, "add", "wip.txt")
+		runGitCmd(testRepoDir, "commit", "-m", "add wip")
+
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "cleanup",
+			Base:       "main",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(worktreePath, "README.md")).To(BeAnExistingFile())
+		Expect(filepath.Join(worktreePath, "wip.txt")).NotTo(BeAnExistingFile())
+
+		reg, err := registry.Load(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reg.Get(filepath.Base(worktreePath)).Base).To(Equal("main"))
+	})
+
+	It("returns an error when not in a git repository", func() {
+		nonGitDir, err := os.MkdirTemp("", "non-git-*")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(nonGitDir)
+
+		opts := spaces.CreateOptions{
+			RepoRoot:   nonGitDir,
+			DestDir:    destDir,
+			BranchName: "test-branch",
+		}
+
+		_, err = spaces.Create(context.Background(), opts)
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("failed to create branch"))
+	})
+})
+
+// failingWorktreeGit is an in-memory git whose worktrees can't be added.
+type failingWorktreeGit struct {
+	*remuxtest.Git
+}
+
+func (failingWorktreeGit) AddWorktree(ctx context.Context, repoRoot, path, branch string) error {
+	return fmt.Errorf("disk full")
+}
+
+var _ = Describe("Create with fakes", func() {
+	It("keeps the spaces other states registered since loading", func() {
+		dest := GinkgoT().TempDir()
+		fake := &remuxtest.Git{}
+		first, err := spaces.NewState(dest, registry.FileStore{Dir: dest})
+		Expect(err).NotTo(HaveOccurred())
+		first.Git = fake
+		second, err := spaces.NewState(dest, registry.FileStore{Dir: dest})
+		Expect(err).NotTo(HaveOccurred())
+		second.Git = fake
+
+		_, err = first.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "one"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = second.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "two"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second.Hibernate(context.Background(), "app-one")).To(Succeed())
+
+		reg, err := registry.Load(dest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reg.Get("app-one")).NotTo(BeNil())
+		Expect(reg.Get("app-one").Hibernated).To(BeTrue())
+		Expect(reg.Get("app-two")).NotTo(BeNil())
+		Expect(reg.Get("app-two").Port).NotTo(Equal(reg.Get("app-one").Port))
+	})
+
+	It("keeps every space created concurrently by separate states", func() {
+		dest := GinkgoT().TempDir()
+		fake := &remuxtest.Git{}
+		states := make([]*spaces.State, 6)
+		for i := range states {
+			st, err := spaces.NewState(dest, registry.FileStore{Dir: dest})
+			Expect(err).NotTo(HaveOccurred())
+			st.Git = fake
+			states[i] = st
+		}
+
+		var wg sync.WaitGroup
+		for i, st := range states {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				_, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: fmt.Sprintf("w%d", i)})
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		reg, err := registry.Load(dest)
+		Expect(err).NotTo(HaveOccurred())
+		ports := make(map[int]bool)
+		for i := range states {
+			entry := reg.Get(fmt.Sprintf("app-w%d", i))
+			Expect(entry).NotTo(BeNil())
+			ports[entry.Port] = true
+		}
+		Expect(reg.List()).To(HaveLen(len(states)))
+		Expect(ports).To(HaveLen(len(states)))
+	})
+
+	It("rolls back the branch when the worktree can't be added", func() {
+		fake := &remuxtest.Git{}
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = failingWorktreeGit{fake}
+
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "feature"})
+		Expect(err).To(MatchError(ContainSubstring("disk full")))
+		Expect(fake.Branches("/src/app")).To(BeEmpty())
+		Expect(st.Registry.List()).To(BeEmpty())
+	})
+
+	It("gives taken changes back when the worktree can't be added", func() {
+		fake := &remuxtest.Git{}
+		fake.SetDirty("/src/app", true)
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = failingWorktreeGit{fake}
+
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "feature", TakeChangesFrom: "/src/app"})
+		Expect(err).To(MatchError(ContainSubstring("disk full")))
+		Expect(fake.HasUncommittedChanges(context.Background(), "/src/app")).To(BeTrue())
+		Expect(fake.Stashes("/src/app")).To(BeEmpty())
+	})
+
+	It("rolls back creates and completes drops whose process was killed", func() {
+		fake := &remuxtest.Git{}
+		destDir := GinkgoT().TempDir()
+		st, err := spaces.NewState(destDir, &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+
+		created, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "created"})
+		Expect(err).NotTo(HaveOccurred())
+		dropped, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "dropped"})
+		Expect(err).NotTo(HaveOccurred())
+		ops, err := st.IncompleteOperations()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ops).To(BeEmpty())
+
+		// Journals as left behind by a create killed before it finished, a drop
+		// killed while removing the worktree, and a create still running
+		journal := filepath.Join(destDir, ".state", ".journal")
+		Expect(os.MkdirAll(journal, 0755)).To(Succeed())
+		journals := map[string]string{
+			"app-created": "kind: create\nname: app-created\npath: " + created + "\nrepo_root: /src/app\nbranch: created\ncreated_branch: true\npid: 0\n",
+			"app-dropped": "kind: drop\nname: app-dropped\npath: " + dropped + "\nrepo_root: /src/app\npid: 0\n",
+			"app-running": "kind: create\nname: app-running\npath: /none\nrepo_root: /src/app\npid: " + strconv.Itoa(os.Getpid()) + "\n",
+		}
+		for name, content := range journals {
+			Expect(os.WriteFile(filepath.Join(journal, name+".yaml"), []byte(content), 0644)).To(Succeed())
+		}
+
+		ops, err = st.IncompleteOperations()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ops).To(HaveLen(2))
+		Expect(st.Recover(context.Background(), ops)).To(Succeed())
+
+		Expect(st.Registry.List()).To(BeEmpty())
+		Expect(created).NotTo(BeADirectory())
+		Expect(dropped).NotTo(BeADirectory())
+		Expect(fake.Branches("/src/app")).To(Equal([]string{"dropped"}))
+		Expect(filepath.Join(journal, "app-created.yaml")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(journal, "app-running.yaml")).To(BeAnExistingFile())
+	})
+
+	It("refuses a space whose ID is taken by another space", func() {
+		fake := &remuxtest.Git{}
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "foo-bar"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "foo_bar"})
+		Expect(err).To(MatchError(spaces.ErrSpaceExists))
+		Expect(err).To(MatchError(ContainSubstring("ID app_foo_bar of app-foo-bar")))
+		Expect(st.Registry.List()).To(HaveLen(1))
+		Expect(fake.Branches("/src/app")).To(Equal([]string{"foo-bar"}))
+	})
+
+	It("allocates ports from the base port and uses the default backend", func() {
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = &remuxtest.Git{}
+		st.DefaultBackend = "zellij"
+
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "ports", BasePort: 20000})
+		Expect(err).NotTo(HaveOccurred())
+		name := filepath.Base(path)
+		Expect(st.Registry.Get(name).Port).To(Equal(20000))
+
+		space, err := st.Space(name)
+		Expect(err).NotTo(HaveOccurred())
+		backend, err := space.Backend()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backend.Name()).To(Equal("zellij"))
+	})
+
+	It("starts branches from the base remote and pushes them to the push remote", func() {
+		repoRoot := GinkgoT().TempDir()
+		cfg := "remotes:\n  base: upstream\n  push: origin\n  fetch: true\n"
+		Expect(os.WriteFile(filepath.Join(repoRoot, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		fake := &remuxtest.Git{}
+		fake.AddBranch(repoRoot, "local")
+		fake.AddRemoteBranch(repoRoot, "upstream", "main")
+		fake.AddRemoteBranch(repoRoot, "upstream", "dev")
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+
+		describe := func(base string) []string {
+			plan, err := st.PlanCreate(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "fork", Base: base})
+			Expect(err).NotTo(HaveOccurred())
+			var git []string
+			for _, action := range plan {
+				if action.Kind == spaces.ActionGit {
+					git = append(git, strings.TrimPrefix(action.Description, "git -C "+repoRoot+" "))
+				}
+			}
+			return git
+		}
+		Expect(describe("")).To(Equal([]string{
+			"fetch upstream",
+			"branch fork upstream/main",
+			"config branch.fork.pushRemote origin",
+			"worktree add " + filepath.Join(st.DestDir, spaces.SpaceName(repoRoot, "fork")) + " fork",
+		}))
+		Expect(describe("dev")).To(ContainElement("branch fork upstream/dev"))
+		Expect(describe("local")).To(ContainElement("branch fork local"))
+
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "fork"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.Fetches(repoRoot)).To(Equal([]string{"upstream"}))
+		Expect(fake.PushRemote(repoRoot, "fork")).To(Equal("origin"))
+	})
+
+	It("checks out a tracked remote branch", func() {
+		repoRoot := GinkgoT().TempDir()
+		cfg := "remotes:\n  push: fork\n"
+		Expect(os.WriteFile(filepath.Join(repoRoot, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		fake := &remuxtest.Git{}
+		fake.AddBranch(repoRoot, "main")
+		fake.AddRemoteBranch(repoRoot, "origin", "main")
+		fake.AddRemoteBranch(repoRoot, "origin", "alice/fix")
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+
+		opts := spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "fix", Track: "origin/alice/fix"}
+		plan, err := st.PlanCreate(context.Background(), opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.String()).To(ContainSubstring("git -C " + repoRoot + " fetch origin\n"))
+		Expect(plan.String()).To(ContainSubstring("git -C " + repoRoot + " branch fix origin/alice/fix\n"))
+		Expect(plan.String()).To(ContainSubstring("branch --set-upstream-to=origin/alice/fix fix"))
+
+		_, err = st.Create(context.Background(), opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.Fetches(repoRoot)).To(Equal([]string{"origin"}))
+		Expect(fake.Upstream(repoRoot, "fix")).To(Equal("origin/alice/fix"))
+		Expect(fake.PushRemote(repoRoot, "fix")).To(BeEmpty())
+
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "gone", Track: "origin/gone"})
+		Expect(err).To(MatchError(ContainSubstring("remote branch origin/gone not found")))
+		Expect(fake.Branches(repoRoot)).NotTo(ContainElement("gone"))
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "bad", Track: "origin"})
+		Expect(err).To(MatchError(ContainSubstring("invalid remote branch")))
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "both", Track: "origin/main", Base: "main"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("records the owner and keeps other users from dropping the space", func() {
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = &remuxtest.Git{}
+		st.Backend = &remuxtest.Sessions{}
+		st.User = "alice"
+
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "mine"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Registry.Get(filepath.Base(path)).Owner).To(Equal("alice"))
+
+		st.User = "bob"
+		Expect(st.Drop(context.Background(), path, spaces.DropOptions{})).To(MatchError(spaces.ErrNotOwner))
+		Expect(st.Drop(context.Background(), path, spaces.DropOptions{Force: true})).To(Succeed())
+		Expect(st.Registry.List()).To(BeEmpty())
+	})
+
+	It("allocates ports within the user's port range", func() {
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		fake := &remuxtest.Git{}
+		st.Git = fake
+
+		opts := spaces.CreateOptions{RepoRoot: "/src/app", BasePort: 20000, PortCount: 20}
+		for _, branch := range []string{"one", "two"} {
+			opts.BranchName = branch
+			_, err := st.Create(context.Background(), opts)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		opts.BranchName = "three"
+		_, err = st.Create(context.Background(), opts)
+		Expect(err).To(MatchError(spaces.ErrNoFreePorts))
+		Expect(fake.Branches("/src/app")).NotTo(ContainElement("three"))
+	})
+
+	It("reuses the port range of a dropped space", func() {
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = &remuxtest.Git{}
+
+		var paths []string
+		for _, branch := range []string{"first", "second"} {
+			path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: branch, BasePort: 40000})
+			Expect(err).NotTo(HaveOccurred())
+			paths = append(paths, path)
+		}
+		Expect(st.Drop(context.Background(), paths[0], spaces.DropOptions{Force: true})).To(Succeed())
+
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "third", BasePort: 40000})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Registry.Get(filepath.Base(path)).Port).To(Equal(40000))
+		Expect(st.Registry.Get(filepath.Base(paths[1])).Port).To(Equal(40010))
+	})
+
+	It("skips port ranges other processes listen on, unless the port is forced", func() {
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = &remuxtest.Git{}
+
+		// Another process listens inside the first range
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer ln.Close()
+		busy := ln.Addr().(*net.TCPAddr).Port
+		base := busy - 3
+
+		for _, portCount := range []int{0, 100} {
+			opts := spaces.CreateOptions{RepoRoot: "/src/app", BranchName: fmt.Sprintf("free-%d", portCount), BasePort: base, PortCount: portCount}
+			path, err := st.Create(context.Background(), opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(st.Registry.Get(filepath.Base(path)).Port).To(BeNumerically(">", busy))
+			Expect(st.Drop(context.Background(), path, spaces.DropOptions{Force: true})).To(Succeed())
+		}
+
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "forced", Port: base})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Registry.Get(filepath.Base(path)).Port).To(Equal(base))
+
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "overlap", Port: base + 5})
+		Expect(err).To(MatchError(ContainSubstring("overlap those of app-forced")))
+		Expect(err).To(MatchError(spaces.ErrNoFreePorts))
+
+		for _, port := range []int{-5, 65535 - registry.PortRange + 2, 70000} {
+			_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: fmt.Sprintf("bad-%d", port), Port: port})
+			Expect(err).To(MatchError(spaces.ErrNoFreePorts))
+			Expect(err).To(MatchError(ContainSubstring("outside 1-")))
+		}
+		Expect(st.Registry.List()).To(HaveLen(1))
+	})
+
+	It("refuses to create spaces beyond the configured limits", func() {
+		destDir := GinkgoT().TempDir()
+		st, err := spaces.NewState(destDir, &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		fake := &remuxtest.Git{}
+		st.Git = fake
+
+		opts := spaces.CreateOptions{RepoRoot: "/src/app", Limits: config.Limits{Spaces: 3, RepoSpaces: 2}}
+		for _, branch := range []string{"one", "two"} {
+			opts.BranchName = branch
+			_, err := st.Create(context.Background(), opts)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		opts.BranchName = "three"
+		_, err = st.Create(context.Background(), opts)
+		Expect(err).To(MatchError(spaces.ErrLimitReached))
+		Expect(err).To(MatchError(ContainSubstring("limits.repo_spaces")))
+		Expect(fake.Branches("/src/app")).NotTo(ContainElement("three"))
+
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/api", BranchName: "one", Limits: opts.Limits})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/web", BranchName: "one", Limits: opts.Limits})
+		Expect(err).To(MatchError(ContainSubstring("limits.spaces")))
+
+		Expect(os.WriteFile(filepath.Join(destDir, "big"), make([]byte, 2048), 0644)).To(Succeed())
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/web", BranchName: "one", Limits: config.Limits{Disk: "2K"}})
+		Expect(err).To(MatchError(spaces.ErrLimitReached))
+		Expect(err).To(MatchError(ContainSubstring("of 2K (limits.disk)")))
+	})
+
+	It("opens a session with the configured tabs", func() {
+		destDir := GinkgoT().TempDir()
+		store := &registry.MemoryStore{}
+		fake := &remuxtest.Git{}
+		sessions := &remuxtest.Sessions{}
+		st, err := spaces.NewState(destDir, store)
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "tabs"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(path, ".remux.yaml"), []byte("tabs:\n  - name: editor\n    cmd: nvim\n"), 0644)).To(Succeed())
+
+		// A new state, since configs are cached per state
+		st, err = spaces.NewState(destDir, store)
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+		st.Backend = sessions
+
+		name := filepath.Base(path)
+		Expect(st.OpenSession(context.Background(), spaces.OpenSessionOptions{Name: name})).To(Succeed())
+		session, ok := sessions.Session(name)
+		Expect(ok).To(BeTrue())
+		Expect(session.Tabs).To(HaveLen(1))
+		Expect(session.Tabs[0].Name).To(Equal("editor"))
+		Expect(session.Env).To(HaveKeyWithValue("DOCKER_NETWORK", "app_tabs"))
+		Expect(sessions.Attached()).To(Equal([]string{name}))
+	})
+})
+
+var _ = Describe("CreateBatch", func() {
+	It("creates the spaces of a manifest concurrently", func() {
+		manifest := filepath.Join(GinkgoT().TempDir(), "spaces.yaml")
+		Expect(os.WriteFile(manifest, []byte(""+
+			"spaces:\n"+
+			"  - name: agent-1\n"+
+			"    tags: [agents]\n"+
+			"  - name: agent-2\n"+
+			"    base: develop\n"+
+			"  - name: taken\n"+
+			"  - name: agent-3\n"), 0644)).To(Succeed())
+		specs, err := spaces.LoadManifest(manifest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(specs).To(HaveLen(4))
+
+		fake := &remuxtest.Git{}
+		fake.AddBranch("/src/app", "develop")
+		fake.AddBranch("/src/app", "taken")
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+
+		results, err := st.CreateBatch(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app"}, specs, 2)
+		Expect(err).To(MatchError(spaces.ErrBranchExists))
+		Expect(results).To(HaveLen(4))
+		Expect(results[2].Err).To(MatchError(spaces.ErrBranchExists))
+
+		var ports []int
+		for _, i := range []int{0, 1, 3} {
+			Expect(results[i].Err).NotTo(HaveOccurred())
+			Expect(results[i].Name).To(Equal("app-" + specs[i].Name))
+			ports = append(ports, results[i].Port)
+		}
+		Expect(ports).To(ConsistOf(11010, 11020, 11030))
+		Expect(st.Registry.Get("app-agent-1").Tags).To(Equal([]string{"agents"}))
+		Expect(st.Registry.Get("app-agent-2").Base).To(Equal("develop"))
+		Expect(st.Registry.List()).To(HaveLen(3))
+	})
+
+	It("names the branches by the config's branch_name", func() {
+		repo := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(repo, ".remux.yaml"), []byte("branch_name: \"{{ user }}/{{ name }}\"\n"), 0644)).To(Succeed())
+		fake := &remuxtest.Git{}
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+		st.User = "alice"
+
+		specs := []spaces.BatchSpace{{Name: "fix-login"}, {Name: "alice/search"}}
+		results, err := st.CreateBatch(context.Background(), spaces.CreateOptions{RepoRoot: repo}, specs, 0)
+		Expect(err).NotTo(HaveOccurred())
+		base := filepath.Base(repo)
+		Expect(results[0].Name).To(Equal(base + "-fix-login"))
+		Expect(results[1].Name).To(Equal(base + "-search"))
+		branch, _ := fake.Worktree(results[0].Path)
+		Expect(branch).To(Equal("alice/fix-login"))
+		branch, _ = fake.Worktree(results[1].Path)
+		Expect(branch).To(Equal("alice/search"))
+	})
+
+	It("rejects names listed twice", func() {
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = &remuxtest.Git{}
+
+		specs := []spaces.BatchSpace{{Name: "feat/x"}, {Name: "feat-x"}}
+		_, err = st.CreateBatch(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app"}, specs, 0)
+		Expect(err).To(MatchError(spaces.ErrInvalidName))
+		Expect(st.Registry.List()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Hibernate", func() {
+	var (
+		destDir  string
+		store    *registry.MemoryStore
+		fake     *remuxtest.Git
+		sessions *remuxtest.Sessions
+		st       *spaces.State
+		name     string
+		calls    string
+	)
+
+	BeforeEach(func() {
+		destDir = GinkgoT().TempDir()
+		store = &registry.MemoryStore{}
+		fake = &remuxtest.Git{}
+		sessions = &remuxtest.Sessions{}
+		var err error
+		st, err = spaces.NewState(destDir, store)
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "sleepy"})
+		Expect(err).NotTo(HaveOccurred())
+		name = filepath.Base(path)
+
+		// A compose command logging its arguments instead of running containers
+		bin := GinkgoT().TempDir()
+		calls = filepath.Join(bin, "calls")
+		compose := filepath.Join(bin, "compose")
+		Expect(os.WriteFile(compose, []byte("#!/bin/sh\necho \"$*\" >> "+calls+"\n"), 0755)).To(Succeed())
+		cfg := "services:\n  compose: [compose.yaml]\n  compose_command: " + compose + "\n"
+		Expect(os.WriteFile(filepath.Join(path, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+
+		// A new state, since configs are cached per state
+		st, err = spaces.NewState(destDir, store)
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+		st.Backend = sessions
+		Expect(st.OpenSession(context.Background(), spaces.OpenSessionOptions{Name: name, Detached: true})).To(Succeed())
+	})
+
+	readCalls := func() string {
+		out, err := os.ReadFile(calls)
+		Expect(err).NotTo(HaveOccurred())
+		return string(out)
+	}
+
+	It("stops services and the session and resumes them", func() {
+		Expect(st.Hibernate(context.Background(), name)).To(Succeed())
+		Expect(readCalls()).To(Equal("-f compose.yaml down\n"))
+		Expect(sessions.SessionExists(name)).To(BeFalse())
+		Expect(st.Registry.Get(name).Hibernated).To(BeTrue())
+		Expect(st.Hibernate(context.Background(), name)).To(MatchError(spaces.ErrHibernated))
+
+		Expect(st.Resume(context.Background(), name)).To(Succeed())
+		Expect(readCalls()).To(Equal("-f compose.yaml down\n-f compose.yaml up -d\n"))
+		Expect(st.Registry.Get(name).Hibernated).To(BeFalse())
+		Expect(st.Resume(context.Background(), name)).To(MatchError(spaces.ErrNotHibernated))
+	})
+
+	It("resumes when opened", func() {
+		Expect(st.Hibernate(context.Background(), name)).To(Succeed())
+		Expect(st.OpenSession(context.Background(), spaces.OpenSessionOptions{Name: name, Detached: true})).To(Succeed())
+		Expect(readCalls()).To(HaveSuffix("-f compose.yaml up -d\n"))
+		Expect(sessions.SessionExists(name)).To(BeTrue())
+		Expect(st.Registry.Get(name).Hibernated).To(BeFalse())
+	})
+
+	It("hibernates sessions idle for long enough", func() {
+		Expect(st.HibernateIdle(context.Background(), time.Hour)).To(BeEmpty())
+
+		sessions.SetActivity(name, time.Now().Add(-2*time.Hour), true)
+		Expect(st.HibernateIdle(context.Background(), time.Hour)).To(BeEmpty())
+
+		sessions.SetActivity(name, time.Now().Add(-2*time.Hour), false)
+		Expect(st.HibernateIdle(context.Background(), time.Hour)).To(Equal([]string{name}))
+		Expect(readCalls()).To(Equal("-f compose.yaml down\n"))
+		Expect(sessions.SessionExists(name)).To(BeFalse())
+		Expect(st.Registry.Get(name).Hibernated).To(BeTrue())
+		Expect(st.HibernateIdle(context.Background(), time.Hour)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Plans", func() {
+	var (
+		repoRoot string
+		destDir  string
+		store    *registry.MemoryStore
+		fake     *remuxtest.Git
+		sessions *remuxtest.Sessions
+		st       *spaces.State
+	)
+
+	BeforeEach(func() {
+		repoRoot = filepath.Join(GinkgoT().TempDir(), "app")
+		Expect(os.Mkdir(repoRoot, 0755)).To(Succeed())
+		cfg := "hooks:\n  on_create:\n    - make db\n  on_drop:\n    - make clean\n"
+		Expect(os.WriteFile(filepath.Join(repoRoot, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+
+		destDir = GinkgoT().TempDir()
+		fake = &remuxtest.Git{}
+		sessions = &remuxtest.Sessions{}
+		store = &registry.MemoryStore{}
+		var err error
+		st, err = spaces.NewState(destDir, store)
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+		st.Backend = sessions
+	})
+
+	It("lists the actions of Create without taking them", func() {
+		plan, err := st.PlanCreate(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "feature", Base: "main"})
+		Expect(err).NotTo(HaveOccurred())
+
+		path := filepath.Join(destDir, "app-feature")
+		Expect(plan).To(Equal(spaces.Plan{
+			{Kind: spaces.ActionGit, Description: "git -C " + repoRoot + " branch feature main"},
+			{Kind: spaces.ActionGit, Description: "git -C " + repoRoot + " worktree add " + path + " feature"},
+			{Kind: spaces.ActionRegistry, Description: "register app-feature with ports 11010-11019"},
+			{Kind: spaces.ActionHook, Description: "on_create hook: make db"},
+		}))
+		Expect(fake.Branches(repoRoot)).To(BeEmpty())
+		Expect(path).NotTo(BeADirectory())
+		Expect(st.Registry.List()).To(BeEmpty())
+	})
+
+	It("plans moving uncommitted changes", func() {
+		fake.SetDirty(repoRoot, true)
+		plan, err := st.PlanCreate(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "feature", TakeChangesFrom: repoRoot})
+		Expect(err).NotTo(HaveOccurred())
+
+		path := filepath.Join(destDir, "app-feature")
+		Expect(plan[0]).To(Equal(spaces.Action{Kind: spaces.ActionGit, Description: "git -C " + repoRoot + " stash push --include-untracked"}))
+		Expect(plan[len(plan)-1]).To(Equal(spaces.Action{Kind: spaces.ActionGit, Description: "git -C " + path + " stash pop"}))
+		Expect(fake.Stashes(repoRoot)).To(BeEmpty())
+	})
+
+	It("fails like Create", func() {
+		fake.AddBranch(repoRoot, "feature")
+		_, err := st.PlanCreate(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "feature"})
+		Expect(err).To(MatchError(spaces.ErrBranchExists))
+
+		plan, err := st.PlanCreate(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "feature", ReuseExistingBranch: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan[0].Kind).To(Equal(spaces.ActionGit))
+		Expect(plan[0].Description).To(ContainSubstring("worktree add"))
+	})
+
+	It("lists the actions of Drop without taking them", func() {
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "feature"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(path, ".remux.yaml"), []byte("hooks:\n  on_drop:\n    - make clean\n"), 0644)).To(Succeed())
+
+		// A new state, since configs are cached per state
+		st, err = spaces.NewState(destDir, store)
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = fake
+		st.Backend = sessions
+		Expect(st.OpenSession(context.Background(), spaces.OpenSessionOptions{Name: "app-feature", Detached: true})).To(Succeed())
+
+		plan, err := st.PlanDrop(context.Background(), path, spaces.DropOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.String()).To(Equal("" +
+			"1. on_drop hook: make clean\n" +
+			"2. git -C " + repoRoot + " worktree remove " + path + "\n" +
+			"3. remove " + path + "\n" +
+			"4. unregister app-feature\n" +
+			"5. kill fake session app-feature\n"))
+		Expect(path).To(BeADirectory())
+		Expect(st.Registry.Get("app-feature")).NotTo(BeNil())
+
+		fake.SetDirty(path, true)
+		_, err = st.PlanDrop(context.Background(), path, spaces.DropOptions{})
+		Expect(err).To(MatchError(spaces.ErrDirtyWorktree))
+	})
+
+	It("starts from a space template", func() {
+		configHome := GinkgoT().TempDir()
+		GinkgoT().Setenv("XDG_CONFIG_HOME", configHome)
+		templates := filepath.Join(configHome, "remux", "templates")
+		Expect(os.MkdirAll(templates, 0755)).To(Succeed())
+		tmpl := "base: develop\nenv:\n  ROLE: review\nhooks:\n  on_create:\n    - review-setup\n"
+		Expect(os.WriteFile(filepath.Join(templates, "review.yaml"), []byte(tmpl), 0644)).To(Succeed())
+
+		fake.AddBranch(repoRoot, "develop")
+
+		// The repository's on_create hooks replace the template's
+		plan, err := st.PlanCreate(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "feature", Template: "review"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan[0].Description).To(Equal("git -C " + repoRoot + " branch feature develop"))
+		Expect(plan[len(plan)-1].Description).To(Equal("on_create hook: make db"))
+
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "feature", Template: "review"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Registry.Get("app-feature").Template).To(Equal("review"))
+
+		space, err := st.Space(filepath.Base(path))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(space.ResolveEnv()).To(HaveKeyWithValue("ROLE", "review"))
+		env, err := space.SessionEnv(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(HaveKeyWithValue("ROLE", "review"))
+		Expect(env).To(HaveKeyWithValue("SPACE_PORT", strconv.Itoa(space.Port)))
+
+		// Spaces can reference each other's ports
+		tmpl = "env:\n  AUTH_PORT: '{{ spaces[\"app-feature\"].Port }}'\n"
+		Expect(os.WriteFile(filepath.Join(templates, "web.yaml"), []byte(tmpl), 0644)).To(Succeed())
+		other, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "web", Template: "web"})
+		Expect(err).NotTo(HaveOccurred())
+		space, err = st.Space(filepath.Base(other))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(space.ResolveEnv()).To(HaveKeyWithValue("AUTH_PORT", strconv.Itoa(st.Registry.Get("app-feature").Port)))
+
+		_, err = st.PlanCreate(context.Background(), spaces.CreateOptions{RepoRoot: repoRoot, BranchName: "other", Template: "missing"})
+		Expect(err).To(MatchError(config.ErrTemplateNotFound))
+	})
+})
+
+var _ = Describe("Names", func() {
+	DescribeTable("ValidateBranchName accepts",
+		func(name string) {
+			Expect(spaces.ValidateBranchName(name)).To(Succeed())
+		},
+		Entry("simple names", "feature"),
+		Entry("slashes", "feat/login"),
+		Entry("dots and underscores", "v1.2_fix"),
+	)
+
+	DescribeTable("ValidateBranchName rejects",
+		func(name, reason string) {
+			err := spaces.ValidateBranchName(name)
+			Expect(err).To(MatchError(spaces.ErrInvalidName))
+			Expect(err.Error()).To(ContainSubstring(reason))
+		},
+		Entry("empty names", "", "empty"),
+		Entry("leading dashes", "-rf", "starts with a dash"),
+		Entry("whitespace", "my feature", "whitespace"),
+		Entry("unicode", "fünf", "non-ASCII"),
+		Entry("git ref rules", "a..b", "git branch name"),
+		Entry("lock suffixes", "topic.lock", "git branch name"),
+	)
+
+	It("suggests a normalized name", func() {
+		err := spaces.ValidateBranchName("my feature")
+		Expect(err).To(MatchError(ContainSubstring(`try "my-feature"`)))
+	})
+
+	DescribeTable("NormalizeName",
+		func(input, expected string) {
+			Expect(spaces.NormalizeName(input)).To(Equal(expected))
+		},
+		Entry("replaces whitespace", "My Feature", "My-Feature"),
+		Entry("drops punctuation", "fix: crash!", "fix-crash"),
+		Entry("strips leading dashes", "--force", "force"),
+		Entry("collapses dots", "a..b", "a.b"),
+		Entry("cleans path components", "/.hidden//x.lock", "hidden/x"),
+		Entry("replaces unicode", "fünf", "f-nf"),
+	)
+
+	DescribeTable("IssueBranchName",
+		func(number int, title, expected string) {
+			Expect(spaces.IssueBranchName(number, title)).To(Equal(expected))
+		},
+		Entry("slugifies the title", 42, "Fix login crash", "42-fix-login-crash"),
+		Entry("drops punctuation", 7, "Crash in v1.2: auth/session", "7-crash-in-v1-2-auth-session"),
+		Entry("falls back to the number", 9, "🚀", "9"),
+		Entry("truncates long titles at a word", 1, "one two three four five six seven eight nine ten eleven", "1-one-two-three-four-five-six-seven-eight-nine-ten"),
+	)
+
+	It("flattens slashes in space names", func() {
+		Expect(spaces.SpaceName("/src/app", "feat/login")).To(Equal("app-feat-login"))
+	})
+})
+
+var _ = Describe("ActivateScript", func() {
+	shellEnv := map[string]string{"PORT": "3000"}
+	lookup := func(key string) (string, bool) {
+		value, ok := shellEnv[key]
+		return value, ok
+	}
+	env := map[string]string{"PORT": "11020", "GREETING": "it's"}
+
+	// activation returns the Activation a script records in the shell
+	activation := func(script string) spaces.Activation {
+		for _, line := range strings.Split(script, "\n") {
+			for _, prefix := range []string{"export " + spaces.ActivationVar + "=", "set -gx " + spaces.ActivationVar + " "} {
+				if value, ok := strings.CutPrefix(line, prefix); ok {
+					return spaces.ParseActivation(strings.Trim(value, "'"))
+				}
+			}
+		}
+		return spaces.Activation{}
+	}
+
+	It("exports the env and records the values it replaces", func() {
+		script := spaces.ActivateScript("bash", spaces.Activation{}, "app-a", env, lookup)
+		Expect(script).To(HavePrefix("export GREETING='it'\\''s'\nexport PORT='11020'\nexport REMUX_ACTIVE_ENV="))
+
+		active := activation(script)
+		Expect(active.Space).To(Equal("app-a"))
+		Expect(active.Saved).To(HaveKeyWithValue("GREETING", BeNil()))
+		Expect(active.Saved).To(HaveKey("PORT"))
+		Expect(*active.Saved["PORT"]).To(Equal("3000"))
+	})
+
+	It("restores the replaced values on leaving", func() {
+		active := activation(spaces.ActivateScript("bash", spaces.Activation{}, "app-a", env, lookup))
+		script := spaces.ActivateScript("bash", active, "", nil, lookup)
+		Expect(script).To(Equal("export PORT='3000'\nunset GREETING REMUX_ACTIVE_ENV\n"))
+	})
+
+	It("keeps the original values when switching spaces", func() {
+		active := activation(spaces.ActivateScript("bash", spaces.Activation{}, "app-a", env, lookup))
+		// The shell now has the env of app-a
+		script := spaces.ActivateScript("fish", active, "app-b", map[string]string{"PORT": "11030"}, func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		})
+		Expect(script).To(HavePrefix("set -gx PORT '3000'\nset -e GREETING\nset -gx PORT '11030'\n"))
+		next := activation(script)
+		Expect(next.Space).To(Equal("app-b"))
+		Expect(next.Saved).To(HaveLen(1))
+		Expect(*next.Saved["PORT"]).To(Equal("3000"))
+	})
+
+	It("does nothing when the space is already active", func() {
+		Expect(spaces.ActivateScript("zsh", spaces.Activation{Space: "app-a"}, "app-a", env, lookup)).To(BeEmpty())
+		Expect(spaces.ActivateScript("zsh", spaces.Activation{}, "", nil, lookup)).To(BeEmpty())
+	})
+
+	It("leaves out variables whose names aren't valid shell names", func() {
+		bad := map[string]string{"NODE-ENV": "dev", "X;touch pwned": "1", "_OK1": "yes"}
+		script := spaces.ActivateScript("bash", spaces.Activation{}, "app-a", bad, lookup)
+		Expect(script).To(HavePrefix("export _OK1='yes'\nexport REMUX_ACTIVE_ENV="))
+		Expect(script).NotTo(ContainSubstring("NODE-ENV"))
+		Expect(script).NotTo(ContainSubstring("pwned"))
+
+		// Nor restores them from a tampered activation
+		active := spaces.Activation{Space: "app-a", Saved: map[string]*string{"X;touch pwned": nil, "PORT": nil}}
+		Expect(spaces.ActivateScript("zsh", active, "", nil, lookup)).To(Equal("unset PORT REMUX_ACTIVE_ENV\n"))
+		Expect(spaces.ValidEnvName("NODE_ENV")).To(BeTrue())
+		Expect(spaces.ValidEnvName("1PORT")).To(BeFalse())
+	})
+
+	It("ignores malformed activations", func() {
+		Expect(spaces.ParseActivation("not base64!")).To(Equal(spaces.Activation{}))
+	})
+})
+
+var _ = Describe("State", func() {
+	var (
+		testRepoDir string
+		destDir     string
+	)
+
+	BeforeEach(func() {
+		var err error
+		testRepoDir, err = os.MkdirTemp("", "test-repo-*")
+		Expect(err).NotTo(HaveOccurred())
+		destDir, err = os.MkdirTemp("", "test-dest-*")
+		Expect(err).NotTo(HaveOccurred())
+
+		runGitCmd(testRepoDir, "init")
+		runGitCmd(testRepoDir, "config", "user.email", "test@test.com")
+		runGitCmd(testRepoDir, "config", "user.name", "Test User")
+		Expect(os.WriteFile(filepath.Join(testRepoDir, "README.md"), []byte("# Test"), 0644)).To(Succeed())
+		runGitCmd(testRepoDir, "add", ".")
+		runGitCmd(testRepoDir, "commit", "-m", "Initial commit")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(testRepoDir)
+		os.RemoveAll(destDir)
+	})
+
+	It("shares one registry across operations", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		first, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "one"})
+		Expect(err).NotTo(HaveOccurred())
+		second, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "two"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(st.Registry.Get(filepath.Base(first)).Port).To(Equal(registry.BasePort))
+		Expect(st.Registry.Get(filepath.Base(second)).Port).To(Equal(registry.BasePort + registry.PortRange))
+
+		// Persisted as well
+		reg, err := registry.Load(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reg.List()).To(HaveLen(2))
+
+		Expect(st.Drop(context.Background(), first, spaces.DropOptions{})).To(Succeed())
+		Expect(st.Registry.Get(filepath.Base(first))).To(BeNil())
+	})
+
+	It("finds no problems in healthy spaces", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "healthy"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(st.Diagnose()).To(BeEmpty())
+	})
+
+	It("removes spaces whose directory was deleted", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "deleted"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.RemoveAll(path)).To(Succeed())
+
+		problems := st.Diagnose()
+		Expect(problems).To(HaveLen(1))
+		Expect(problems[0].Kind).To(Equal(spaces.ProblemMissing))
+
+		Expect(st.Repair(context.Background(), problems)).To(Succeed())
+		Expect(st.Registry.Get(filepath.Base(path))).To(BeNil())
+
+		reg, err := registry.Load(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reg.List()).To(BeEmpty())
+
+		out, err := exec.Command("git", "-C", testRepoDir, "worktree", "list").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).NotTo(ContainSubstring(filepath.Base(path)))
+	})
+
+	It("relinks worktrees git lost track of", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "unlinked"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Point git's record of the worktree somewhere else
+		gitdir := filepath.Join(testRepoDir, ".git", "worktrees", filepath.Base(path), "gitdir")
+		Expect(os.WriteFile(gitdir, []byte("/nonexistent/.git\n"), 0644)).To(Succeed())
+
+		problems := st.Diagnose()
+		Expect(problems).To(HaveLen(1))
+		Expect(problems[0].Kind).To(Equal(spaces.ProblemUnlinked))
+
+		Expect(st.Repair(context.Background(), problems)).To(Succeed())
+		Expect(st.Diagnose()).To(BeEmpty())
+		Expect(st.Registry.Get(filepath.Base(path))).NotTo(BeNil())
+	})
+
+	It("relocates a moved dest dir", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "moved"})
+		Expect(err).NotTo(HaveOccurred())
+		name := filepath.Base(path)
+
+		newDest := destDir + "-moved"
+		defer os.RemoveAll(newDest)
+
+		relocated, err := st.Relocate(context.Background(), destDir, newDest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relocated).To(HaveLen(1))
+		Expect(st.DestDir).To(Equal(newDest))
+		Expect(destDir).NotTo(BeADirectory())
+
+		reg, err := registry.Load(newDest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reg.Get(name).Path).To(Equal(filepath.Join(newDest, name)))
+		Expect(st.Diagnose()).To(BeEmpty())
+	})
+
+	It("renames a space when its worktree is renamed", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "before"})
+		Expect(err).NotTo(HaveOccurred())
+
+		newPath := filepath.Join(destDir, "after")
+		_, err = st.Relocate(context.Background(), path, newPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(st.Registry.Get(filepath.Base(path))).To(BeNil())
+		Expect(st.Registry.Get("after").Path).To(Equal(newPath))
+		Expect(st.Diagnose()).To(BeEmpty())
+	})
+
+	It("refuses to drop a space whose port is in use", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "busy"})
+		Expect(err).NotTo(HaveOccurred())
+
+		port := st.Registry.Get(filepath.Base(path)).Port
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			Skip("port already in use")
+		}
+		defer l.Close()
+
+		// The hooks of a refused drop don't run
+		marker := filepath.Join(destDir, "dropped")
+		cfg := fmt.Sprintf("hooks:\n  on_drop:\n    - touch %s\n", marker)
+		Expect(os.WriteFile(filepath.Join(path, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		st, err = spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = st.Drop(context.Background(), path, spaces.DropOptions{Force: true})
+		Expect(err).To(MatchError(spaces.ErrLiveProcesses))
+		Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("port %d", port)))
+		Expect(err.Error()).NotTo(ContainSubstring("on_drop"))
+		Expect(path).To(BeADirectory())
+		Expect(marker).NotTo(BeAnExistingFile())
+	})
+
+	It("reports listeners on a space's ports as foreign when outside its worktree", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "ports"})
+		Expect(err).NotTo(HaveOccurred())
+
+		port := st.Registry.Get(filepath.Base(path)).Port
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			Skip("port already in use")
+		}
+		defer l.Close()
+
+		usage, err := st.PortUsage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usage).To(HaveLen(1))
+		Expect(usage[0].Port).To(Equal(port))
+		Expect(usage[0].Listeners).To(HaveLen(1))
+
+		// The test process runs in the package dir, not the worktree
+		listener := usage[0].Listeners[0]
+		Expect(listener.Port).To(Equal(port))
+		if listener.Process.PID == 0 {
+			Skip("lsof not available")
+		}
+		Expect(listener.Process.PID).To(Equal(os.Getpid()))
+		Expect(listener.Foreign).To(BeTrue())
+	})
+
+	It("reports listeners running inside the worktree as the space's own", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		wd, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		port := l.Addr().(*net.TCPAddr).Port
+		st.Registry.Add("own", wd, port, testRepoDir)
+
+		usage, err := st.PortUsage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usage).To(HaveLen(1))
+		Expect(usage[0].Listeners).To(HaveLen(1))
+		Expect(usage[0].Listeners[0].Foreign).To(BeFalse())
+	})
+
+	It("persists batched mutations once the batch completes", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Registered by another process after the state was loaded
+		Expect(registry.Update(destDir, func(reg *registry.Registry) error {
+			reg.Add("other", "/elsewhere", registry.BasePort, testRepoDir)
+			return nil
+		})).To(Succeed())
+
+		err = st.Batch(func() error {
+			_, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "batched"})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Not yet written
+			reg, err := registry.Load(destDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reg.List()).To(HaveLen(1))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		reg, err := registry.Load(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reg.List()).To(HaveLen(2))
+		Expect(reg.Get("other")).NotTo(BeNil())
+	})
+
+	It("records phase timings", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		timings := &spaces.Timings{}
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "timed", Timings: timings})
+		Expect(err).NotTo(HaveOccurred())
+
+		var names []string
+		for _, p := range timings.Phases() {
+			names = append(names, p.Name)
+		}
+		Expect(names).To(Equal([]string{"git branch", "worktree add", "config load", "on_create hooks"}))
+
+		var buf strings.Builder
+		timings.Write(&buf)
+		Expect(buf.String()).To(ContainSubstring("worktree add"))
+		Expect(buf.String()).To(ContainSubstring("total"))
+	})
+
+	It("traces the phases of create and the git commands they run", func() {
+		recorder := tracetest.NewSpanRecorder()
+		DeferCleanup(otel.SetTracerProvider, otel.GetTracerProvider())
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "traced"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "traced"})
+		Expect(err).To(MatchError(spaces.ErrSpaceExists))
+
+		spans := make(map[string][]sdktrace.ReadOnlySpan)
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = append(spans[span.Name()], span)
+		}
+		Expect(spans["create"]).To(HaveLen(2))
+		created, failed := spans["create"][0], spans["create"][1]
+		Expect(created.Status().Code).To(Equal(codes.Unset))
+		Expect(failed.Status().Code).To(Equal(codes.Error))
+
+		Expect(spans["worktree add"]).To(HaveLen(1))
+		phase := spans["worktree add"][0]
+		Expect(phase.Parent().SpanID()).To(Equal(created.SpanContext().SpanID()))
+		Expect(spans["git worktree"]).To(HaveLen(1))
+		Expect(spans["git worktree"][0].Parent().SpanID()).To(Equal(phase.SpanContext().SpanID()))
+	})
+
+	It("returns an error for an unregistered space", func() {
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = st.Space("missing")
+		Expect(err).To(MatchError(spaces.ErrSpaceNotFound))
+	})
+})
+
+var _ = Describe("Parallel", func() {
+	entries := []registry.Entry{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+
+	It("calls fn once per entry", func() {
+		seen := make([]string, len(entries))
+		err := spaces.Parallel(entries, 2, func(i int, e registry.Entry) error {
+			seen[i] = e.Name
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(seen).To(Equal([]string{"a", "b", "c", "d", "e"}))
+	})
+
+	It("bounds the number of concurrent calls", func() {
+		var running, peak atomic.Int32
+		err := spaces.Parallel(entries, 2, func(i int, e registry.Entry) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(peak.Load()).To(BeNumerically("<=", 2))
+	})
+
+	It("aggregates errors from all failed calls", func() {
+		err := spaces.Parallel(entries, 0, func(i int, e registry.Entry) error {
+			if e.Name == "b" || e.Name == "d" {
+				return fmt.Errorf("boom")
+			}
+			return nil
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("b: boom"))
+		Expect(err.Error()).To(ContainSubstring("d: boom"))
+	})
+})
+
+var _ = Describe("GetStatus", func() {
+	var (
+		testRepoDir  string
+		destDir      string
+		worktreePath string
+		entry        registry.Entry
+		originalTTL  time.Duration
+	)
+
+	BeforeEach(func() {
+		var err error
+		originalTTL = spaces.StatusCacheTTL
+
+		testRepoDir, err = os.MkdirTemp("", "test-repo-*")
+		Expect(err).NotTo(HaveOccurred())
+		destDir, err = os.MkdirTemp("", "test-dest-*")
+		Expect(err).NotTo(HaveOccurred())
+
+		runGitCmd(testRepoDir, "init")
+		runGitCmd(testRepoDir, "config", "user.email", "test@test.com")
+		runGitCmd(testRepoDir, "config", "user.name", "Test User")
+		Expect(os.WriteFile(filepath.Join(testRepoDir, "README.md"), []byte("# Test"), 0644)).To(Succeed())
+		runGitCmd(testRepoDir, "add", ".")
+		runGitCmd(testRepoDir, "commit", "-m", "Initial commit")
+
+		worktreePath, err = spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "status-test",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		reg, err := registry.Load(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		entry = *reg.Get(filepath.Base(worktreePath))
+	})
+
+	AfterEach(func() {
+		spaces.StatusCacheTTL = originalTTL
+		os.RemoveAll(testRepoDir)
+		os.RemoveAll(destDir)
+	})
+
+	It("reports a clean, unmerged space", func() {
+		status, err := spaces.GetStatus(destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(spaces.Status{}))
+	})
+
+	It("reports merged once the branch is contained in the main checkout", func() {
+		runGitCmd(worktreePath, "commit", "--allow-empty", "-m", "work")
+		runGitCmd(testRepoDir, "merge", "--ff-only", "status-test")
+		runGitCmd(testRepoDir, "commit", "--allow-empty", "-m", "after merge")
+
+		status, err := spaces.GetStatus(destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Merged).To(BeTrue())
+	})
+
+	It("serves cached results until the TTL expires", func() {
+		_, err := spaces.GetStatus(destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(spaces.StateDir(destDir, entry.Name), "status.yaml")).To(BeAnExistingFile())
+
+		Expect(os.WriteFile(filepath.Join(worktreePath, "untracked.txt"), []byte("x"), 0644)).To(Succeed())
+
+		status, err := spaces.GetStatus(destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Dirty).To(BeFalse())
+
+		spaces.StatusCacheTTL = 0
+		status, err = spaces.GetStatus(destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Dirty).To(BeTrue())
+	})
+
+	It("invalidates the cache when the index changes", func() {
+		_, err := spaces.GetStatus(destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Ensure the index mtime differs on filesystems with coarse timestamps
+		time.Sleep(10 * time.Millisecond)
+		Expect(os.WriteFile(filepath.Join(worktreePath, "staged.txt"), []byte("x"), 0644)).To(Succeed())
+		runGitCmd(worktreePath, "add", "staged.txt")
+
+		status, err := spaces.GetStatus(destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Dirty).To(BeTrue())
+	})
+
+	It("returns an error when the worktree is missing", func() {
+		Expect(os.RemoveAll(worktreePath)).To(Succeed())
+		_, err := spaces.GetStatus(destDir, entry)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("summarizes the status as a string", func() {
+		Expect(spaces.Status{}.String()).To(Equal("clean"))
+		Expect(spaces.Status{Dirty: true, Ahead: 2, Behind: 1, Merged: true}.String()).To(Equal("dirty +2 -1 merged"))
+	})
+})
+
+var _ = Describe("Maintain", func() {
+	It("maintains each repository once and removes stale state", func() {
+		repo := GinkgoT().TempDir()
+		runGitCmd(repo, "init")
+		runGitCmd(repo, "config", "user.email", "test@test.com")
+		runGitCmd(repo, "config", "user.name", "Test User")
+		runGitCmd(repo, "commit", "--allow-empty", "-m", "Initial commit")
+
+		destDir := GinkgoT().TempDir()
+		st, err := spaces.NewState(destDir, &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Registry.Add("app-a", filepath.Join(destDir, "app-a"), registry.BasePort, repo)
+		st.Registry.Add("app-b", filepath.Join(destDir, "app-b"), registry.BasePort+registry.PortRange, repo)
+		st.Registry.Add("gone-a", filepath.Join(destDir, "gone-a"), registry.BasePort+2*registry.PortRange, filepath.Join(destDir, "missing-repo"))
+
+		for _, name := range []string{"app-a", "dropped", "creating"} {
+			Expect(os.MkdirAll(spaces.StateDir(destDir, name), 0755)).To(Succeed())
+		}
+		journal := filepath.Join(destDir, ".state", ".journal")
+		Expect(os.MkdirAll(journal, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(journal, "creating.yaml"), []byte("kind: create\nname: creating\n"), 0644)).To(Succeed())
+
+		result, err := st.Maintain(context.Background(), 0)
+		Expect(err).To(MatchError(ContainSubstring("missing-repo")))
+		Expect(result.Repos).To(Equal([]string{repo}))
+		Expect(result.Stale).To(Equal([]string{"dropped"}))
+		Expect(spaces.StateDir(destDir, "dropped")).NotTo(BeADirectory())
+		Expect(spaces.StateDir(destDir, "app-a")).To(BeADirectory())
+		Expect(spaces.StateDir(destDir, "creating")).To(BeADirectory())
+		Expect(journal).To(BeADirectory())
+	})
+})
+
+var _ = Describe("GetCIStatus", func() {
+	var (
+		testRepoDir  string
+		destDir      string
+		worktreePath string
+		entry        registry.Entry
+	)
+
+	// fakeGH installs a gh script on PATH that runs the given shell body.
+	fakeGH := func(body string) {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "gh"), []byte("#!/bin/sh\n"+body+"\n"), 0755)).To(Succeed())
+		GinkgoT().Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+
+	BeforeEach(func() {
+		testRepoDir = GinkgoT().TempDir()
+		destDir = GinkgoT().TempDir()
+
+		runGitCmd(testRepoDir, "init")
+		runGitCmd(testRepoDir, "config", "user.email", "test@test.com")
+		runGitCmd(testRepoDir, "config", "user.name", "Test User")
+		runGitCmd(testRepoDir, "remote", "add", "origin", "git@github.com:o/r.git")
+		runGitCmd(testRepoDir, "commit", "--allow-empty", "-m", "Initial commit")
+
+		var err error
+		worktreePath, err = spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    destDir,
+			BranchName: "ci-test",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		reg, err := registry.Load(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		entry = *reg.Get(filepath.Base(worktreePath))
+	})
+
+	// push fakes a pushed branch by pointing an upstream ref at HEAD.
+	push := func() {
+		runGitCmd(worktreePath, "update-ref", "refs/remotes/origin/ci-test", "HEAD")
+		runGitCmd(worktreePath, "branch", "--set-upstream-to", "origin/ci-test")
+	}
+
+	It("reports unknown for branches that were never pushed", func() {
+		fakeGH("exit 1")
+
+		status, err := spaces.GetCIStatus(context.Background(), destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.State).To(Equal(forge.CIUnknown))
+	})
+
+	It("caches finished results until the branch moves", func() {
+		push()
+		fakeGH(`echo '{"check_runs":[{"status":"completed","conclusion":"failure","html_url":"https://ci/1"}]}'`)
+
+		status, err := spaces.GetCIStatus(context.Background(), destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(&forge.CIStatus{State: forge.CIFailure, URL: "https://ci/1"}))
+
+		fakeGH(`echo '{"check_runs":[{"status":"completed","conclusion":"success"}]}'`)
+		status, err = spaces.GetCIStatus(context.Background(), destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.State).To(Equal(forge.CIFailure))
+
+		runGitCmd(worktreePath, "commit", "--allow-empty", "-m", "fix")
+		status, err = spaces.GetCIStatus(context.Background(), destDir, entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.State).To(Equal(forge.CISuccess))
+	})
+})
+
+var _ = Describe("Stack", func() {
+	var (
+		testRepoDir string
+		st          *spaces.State
+		bottom      string
+	)
+
+	BeforeEach(func() {
+		testRepoDir = GinkgoT().TempDir()
+		runGitCmd(testRepoDir, "init")
+		runGitCmd(testRepoDir, "config", "user.email", "test@test.com")
+		runGitCmd(testRepoDir, "config", "user.name", "Test User")
+		runGitCmd(testRepoDir, "commit", "--allow-empty", "-m", "Initial commit")
+
+		var err error
+		st, err = spaces.LoadState(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		bottom, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "part-1"})
+		Expect(err).NotTo(HaveOccurred())
+		runGitCmd(bottom, "commit", "--allow-empty", "-m", "part 1")
+	})
+
+	// stack creates a space for branch on top of the space at parentPath.
+	stack := func(parentPath, branch string) string {
+		parentBranch, err := git.CurrentBranch(parentPath)
+		Expect(err).NotTo(HaveOccurred())
+		path, err := st.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			BranchName: branch,
+			Base:       parentBranch,
+			Parent:     filepath.Base(parentPath),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return path
+	}
+
+	It("starts the branch from the parent's branch", func() {
+		middle := stack(bottom, "part-2")
+		Expect(st.Registry.Get(filepath.Base(middle)).Parent).To(Equal(filepath.Base(bottom)))
+
+		bottomHead, _ := git.Head(bottom)
+		middleHead, _ := git.Head(middle)
+		Expect(middleHead).To(Equal(bottomHead))
+	})
+
+	It("rebases the whole chain from the bottom up", func() {
+		middle := stack(bottom, "part-2")
+		runGitCmd(middle, "commit", "--allow-empty", "-m", "part 2")
+		top := stack(middle, "part-3")
+		runGitCmd(top, "commit", "--allow-empty", "-m", "part 3")
+
+		Expect(os.WriteFile(filepath.Join(bottom, "fix.txt"), []byte("fix"), 0644)).To(Succeed())
+		runGitCmd(bottom, "add", "fix.txt")
+		runGitCmd(bottom, "commit", "-m", "review fix")
+
+		synced, err := st.SyncStack(context.Background(), filepath.Base(top))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(synced).To(Equal([]string{filepath.Base(middle), filepath.Base(top)}))
+
+		bottomHead, _ := git.Head(bottom)
+		Expect(git.IsAncestor(top, bottomHead, "HEAD")).To(BeTrue())
+		Expect(filepath.Join(top, "fix.txt")).To(BeAnExistingFile())
+	})
+
+	It("refuses to sync with uncommitted changes", func() {
+		middle := stack(bottom, "part-2")
+		Expect(os.WriteFile(filepath.Join(middle, "wip.txt"), []byte("wip"), 0644)).To(Succeed())
+
+		_, err := st.SyncStack(context.Background(), filepath.Base(bottom))
+		Expect(err).To(MatchError(spaces.ErrDirtyWorktree))
+	})
+
+	Context("when a rebase stops on conflicts", func() {
+		var middle, top string
+
+		BeforeEach(func() {
+			middle = stack(bottom, "part-2")
+			Expect(os.WriteFile(filepath.Join(middle, "shared.txt"), []byte("part 2\n"), 0644)).To(Succeed())
+			runGitCmd(middle, "add", "shared.txt")
+			runGitCmd(middle, "commit", "-m", "part 2")
+			top = stack(middle, "part-3")
+			runGitCmd(top, "commit", "--allow-empty", "-m", "part 3")
+
+			Expect(os.WriteFile(filepath.Join(bottom, "shared.txt"), []byte("review fix\n"), 0644)).To(Succeed())
+			runGitCmd(bottom, "add", "shared.txt")
+			runGitCmd(bottom, "commit", "-m", "review fix")
+
+			_, err := st.SyncStack(context.Background(), filepath.Base(top))
+			var conflict *spaces.ConflictError
+			Expect(errors.As(err, &conflict)).To(BeTrue())
+			Expect(conflict.Space).To(Equal(filepath.Base(middle)))
+			Expect(conflict.Files).To(Equal([]string{"shared.txt"}))
+			Expect(git.RebaseInProgress(middle)).To(BeTrue())
+		})
+
+		It("refuses to start another sync", func() {
+			_, err := st.SyncStack(context.Background(), filepath.Base(bottom))
+			Expect(err).To(MatchError(spaces.ErrConflict))
+			Expect(err).To(MatchError(ContainSubstring("--continue")))
+		})
+
+		It("continues once the conflicts are resolved", func() {
+			_, err := st.ContinueSync(context.Background(), filepath.Base(top))
+			Expect(err).To(MatchError(spaces.ErrConflict))
+
+			Expect(os.WriteFile(filepath.Join(middle, "shared.txt"), []byte("both\n"), 0644)).To(Succeed())
+			runGitCmd(middle, "add", "shared.txt")
+			synced, err := st.ContinueSync(context.Background(), filepath.Base(top))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(synced).To(Equal([]string{filepath.Base(middle), filepath.Base(top)}))
+
+			bottomHead, _ := git.Head(bottom)
+			Expect(git.IsAncestor(top, bottomHead, "HEAD")).To(BeTrue())
+			Expect(os.ReadFile(filepath.Join(top, "shared.txt"))).To(BeEquivalentTo("both\n"))
+			_, err = st.ContinueSync(context.Background(), filepath.Base(top))
+			Expect(err).To(MatchError(spaces.ErrNoSync))
+		})
+
+		It("aborts, putting the branches back", func() {
+			restored, err := st.AbortSync(context.Background(), filepath.Base(bottom))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(BeEmpty())
+			Expect(git.RebaseInProgress(middle)).To(BeFalse())
+			Expect(git.CurrentBranch(middle)).To(Equal("part-2"))
+			bottomHead, _ := git.Head(bottom)
+			Expect(git.IsAncestor(middle, bottomHead, "HEAD")).To(BeFalse())
+
+			_, err = st.AbortSync(context.Background(), filepath.Base(bottom))
+			Expect(err).To(MatchError(spaces.ErrNoSync))
+		})
+	})
+})
+
+var _ = Describe("Diff", func() {
+	var (
+		testRepoDir string
+		st          *spaces.State
+		path        string
+	)
+
+	BeforeEach(func() {
+		testRepoDir = GinkgoT().TempDir()
+		runGitCmd(testRepoDir, "init", "-b", "main")
+		runGitCmd(testRepoDir, "config", "user.email", "test@test.com")
+		runGitCmd(testRepoDir, "config", "user.name", "Test User")
+		Expect(os.WriteFile(filepath.Join(testRepoDir, "a.txt"), []byte("a\n"), 0644)).To(Succeed())
+		runGitCmd(testRepoDir, "add", "a.txt")
+		runGitCmd(testRepoDir, "commit", "-m", "Initial commit")
+
+		var err error
+		st, err = spaces.LoadState(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		path, err = st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "feature"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.WriteFile(filepath.Join(path, "b.txt"), []byte("b\n"), 0644)).To(Succeed())
+		runGitCmd(path, "add", "b.txt")
+		runGitCmd(path, "commit", "-m", "add b")
+		Expect(os.WriteFile(filepath.Join(path, "a.txt"), []byte("a\nchanged\n"), 0644)).To(Succeed())
+
+		// Later commits on the base branch are not part of the space's changes
+		Expect(os.WriteFile(filepath.Join(testRepoDir, "c.txt"), []byte("c\n"), 0644)).To(Succeed())
+		runGitCmd(testRepoDir, "add", "c.txt")
+		runGitCmd(testRepoDir, "commit", "-m", "add c")
+	})
+
+	It("lists committed and uncommitted changes since the base branch", func() {
+		base, err := st.BaseBranch(filepath.Base(path))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(base).To(Equal("main"))
+
+		var out bytes.Buffer
+		Expect(st.Diff(context.Background(), filepath.Base(path), &out, spaces.DiffOptions{Mode: spaces.DiffFiles})).To(Succeed())
+		Expect(out.String()).To(Equal("M\ta.txt\nA\tb.txt\n"))
+	})
+
+	It("shows the diffstat and patch", func() {
+		var out bytes.Buffer
+		Expect(st.Diff(context.Background(), filepath.Base(path), &out, spaces.DiffOptions{Fetch: true})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("2 files changed, 2 insertions(+)"))
+		Expect(out.String()).To(ContainSubstring("+changed"))
+		Expect(out.String()).NotTo(ContainSubstring("c.txt"))
+	})
+
+	It("uses the recorded base branch", func() {
+		runGitCmd(testRepoDir, "branch", "release", "HEAD~1")
+		other, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: testRepoDir, BranchName: "hotfix", Base: "release"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.BaseBranch(filepath.Base(other))).To(Equal("release"))
+
+		var out bytes.Buffer
+		Expect(st.Diff(context.Background(), filepath.Base(other), &out, spaces.DiffOptions{Mode: spaces.DiffStat})).To(Succeed())
+		Expect(out.String()).To(BeEmpty())
+	})
+
+	It("finds the space containing a directory", func() {
+		sub := filepath.Join(path, "pkg", "api")
+		Expect(os.MkdirAll(sub, 0755)).To(Succeed())
+
+		dest, entry, err := spaces.FindSpace(sub)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dest).To(Equal(st.DestDir))
+		Expect(entry.Name).To(Equal(filepath.Base(path)))
+
+		_, _, err = spaces.FindSpace(testRepoDir)
+		Expect(err).To(MatchError(spaces.ErrSpaceNotFound))
+	})
+
+	It("runs the readiness checklist", func() {
+		cfg := "check:\n  test: echo ok\n  lint: echo lint broke; exit 1\n"
+		Expect(os.WriteFile(filepath.Join(path, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "a.txt"), []byte("a\nchanged\n// TODO: handle errors\n"), 0644)).To(Succeed())
+
+		// A new state, since configs are cached per state
+		st, err := spaces.LoadState(st.DestDir)
+		Expect(err).NotTo(HaveOccurred())
+		results, err := st.Check(context.Background(), filepath.Base(path))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(5))
+		Expect(results[0].Err).To(MatchError(spaces.ErrDirtyWorktree))
+		Expect(results[1].Err).To(MatchError("not rebased on main"))
+		Expect(results[2].Output).To(Equal("a.txt:3: // TODO: handle errors"))
+		Expect(results[3].Name).To(Equal("test"))
+		Expect(results[3].Passed()).To(BeTrue())
+		Expect(results[4].Name).To(Equal("lint"))
+		Expect(results[4].Output).To(Equal("lint broke"))
+	})
+
+	It("passes once the branch is clean and rebased", func() {
+		runGitCmd(path, "checkout", "a.txt")
+		runGitCmd(path, "rebase", "main")
+
+		results, err := st.Check(context.Background(), filepath.Base(path))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(3))
+		for _, r := range results {
+			Expect(r.Err).NotTo(HaveOccurred(), r.Name)
 		}
+	})
 
-		_, err = spaces.Create(opts)
+	It("runs the test command and records its result", func() {
+		name := filepath.Base(path)
+		cfg := "env:\n  MODE: test\ncheck:\n  test: exit 3\ncommands:\n  test: echo $MODE; test -f a.txt\n"
+		Expect(os.WriteFile(filepath.Join(path, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		st, err := spaces.LoadState(st.DestDir)
+		Expect(err).NotTo(HaveOccurred())
 
-		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(ContainSubstring("worktree directory already exists"))
+		last, err := spaces.LastTestResult(st.DestDir, name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(last).To(BeNil())
+
+		var out bytes.Buffer
+		result, err := st.RunTests(context.Background(), name, &out, &out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.String()).To(Equal("test\n"))
+		Expect(result.Passed()).To(BeTrue())
+
+		Expect(os.Remove(filepath.Join(path, "a.txt"))).To(Succeed())
+		result, err = st.RunTests(context.Background(), name, &out, &out)
+		Expect(err).To(MatchError(spaces.ErrTestsFailed))
+		Expect(result.ExitCode).To(Equal(1))
+
+		last, err = spaces.LastTestResult(st.DestDir, name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(last.String()).To(Equal("tests:fail"))
+		Expect(last.Command).To(Equal("echo $MODE; test -f a.txt"))
+		Expect(last.Commit).NotTo(BeEmpty())
 	})
 
-	It("returns an error when not in a git repository", func() {
-		nonGitDir, err := os.MkdirTemp("", "non-git-*")
+	It("runs named commands in the foreground and in the background", func() {
+		name := filepath.Base(path)
+		cfg := "env:\n  MODE: dev\ncommands:\n  greet:\n    run: echo $MODE {{ space.Name }}\n    env:\n      MODE: seed\n  serve:\n    run: echo started\n    background: true\n"
+		Expect(os.WriteFile(filepath.Join(path, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		st, err := spaces.LoadState(st.DestDir)
 		Expect(err).NotTo(HaveOccurred())
-		defer os.RemoveAll(nonGitDir)
 
-		opts := spaces.CreateOptions{
-			RepoRoot:   nonGitDir,
-			DestDir:    destDir,
-			BranchName: "test-branch",
+		var out bytes.Buffer
+		run, err := st.RunCommand(context.Background(), name, "greet", &out, &out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run).To(BeNil())
+		Expect(out.String()).To(Equal("seed " + name + "\n"))
+
+		run, err = st.RunCommand(context.Background(), name, "serve", &out, &out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run.PID).NotTo(BeZero())
+		Expect(run.Log).To(Equal(filepath.Join(spaces.StateDir(st.DestDir, name), "commands", "serve.log")))
+		Eventually(func() (string, error) {
+			data, err := os.ReadFile(run.Log)
+			return string(data), err
+		}).Should(HavePrefix("started\n"))
+
+		_, err = st.RunCommand(context.Background(), name, "deploy", &out, &out)
+		Expect(err).To(MatchError(spaces.ErrUnknownCommand))
+		Expect(err).To(MatchError(ContainSubstring("defines greet, serve")))
+	})
+
+	It("summarizes the space as markdown", func() {
+		name := filepath.Base(path)
+		space, err := st.Space(name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Dir(space.NotePath()), 0755)).To(Succeed())
+		Expect(os.WriteFile(space.NotePath(), []byte("Needs a test for b\n"), 0644)).To(Succeed())
+
+		report, err := st.Report(context.Background(), name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(HavePrefix("## feature\n\nBase: `main`\n"))
+		Expect(report).To(MatchRegexp("- `[0-9a-f]+` add b\n"))
+		Expect(report).To(ContainSubstring("2 files changed, 2 insertions(+)"))
+		Expect(report).To(HaveSuffix("### Notes\n\nNeeds a test for b\n"))
+	})
+})
+
+var _ = Describe("Proxy", func() {
+	It("routes each space's hostnames to its port", func() {
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = &remuxtest.Git{}
+		st.Backend = &remuxtest.Sessions{}
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "web"})
+		Expect(err).NotTo(HaveOccurred())
+		port := st.Registry.Get("app-web").Port
+
+		Expect(filepath.Base(path)).To(Equal("app-web"))
+		Expect(st.Routes()).To(ConsistOf(
+			spaces.Route{Host: "app-web.localhost", Space: "app-web", Port: port},
+			spaces.Route{Host: "app_web.localhost", Space: "app-web", Port: port},
+			spaces.Route{Host: "app-web.test", Space: "app-web", Port: port},
+		))
+	})
+
+	It("forwards requests by host and lists the routes elsewhere", func() {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", r.Host, r.URL.Path)
+		}))
+		defer backend.Close()
+		_, backendPort, err := net.SplitHostPort(backend.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		port, err := strconv.Atoi(backendPort)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy := spaces.NewProxy()
+		proxy.SetRoutes([]spaces.Route{{Host: "app-web.localhost", Space: "app-web", Port: port}})
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		get := func(host, path string) (int, string) {
+			req, err := http.NewRequest("GET", server.URL+path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.Host = host
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return resp.StatusCode, string(body)
 		}
 
-		_, err = spaces.Create(opts)
+		code, body := get("app-web.localhost:8080", "/login")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("app-web.localhost:8080 /login"))
 
-		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(ContainSubstring("failed to create branch"))
+		code, body = get("localhost:8080", "/")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(ContainSubstring(`<a href="http://app-web.localhost:8080/">app-web.localhost</a>`))
+
+		code, _ = get("typo.localhost:8080", "/")
+		Expect(code).To(Equal(http.StatusNotFound))
+
+		proxy.SetRoutes(nil)
+		code, _ = get("app-web.localhost:8080", "/login")
+		Expect(code).To(Equal(http.StatusNotFound))
+	})
+
+	It("reports spaces that aren't serving", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		port := ln.Addr().(*net.TCPAddr).Port
+		Expect(ln.Close()).To(Succeed())
+
+		proxy := spaces.NewProxy()
+		proxy.SetRoutes([]spaces.Route{{Host: "app-web.localhost", Space: "app-web", Port: port}})
+		req := httptest.NewRequest("GET", "http://app-web.localhost/", nil)
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusBadGateway))
+		Expect(rec.Body.String()).To(ContainSubstring("app-web isn't serving on port " + strconv.Itoa(port)))
+	})
+})
+
+var _ = Describe("Logs", func() {
+	var space *spaces.Space
+
+	BeforeEach(func() {
+		st, err := spaces.NewState(GinkgoT().TempDir(), &registry.MemoryStore{})
+		Expect(err).NotTo(HaveOccurred())
+		st.Git = &remuxtest.Git{}
+		path, err := st.Create(context.Background(), spaces.CreateOptions{RepoRoot: "/src/app", BranchName: "web"})
+		Expect(err).NotTo(HaveOccurred())
+		space, err = st.Space(filepath.Base(path))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(space.LogDir(), 0755)).To(Succeed())
+	})
+
+	It("prefixes the lines of each source when showing several", func() {
+		Expect(os.WriteFile(filepath.Join(space.LogDir(), "hook.log"), []byte("installed\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(space.LogDir(), "tab-server.log"), []byte("listening\nready"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(space.LogDir(), "notes.txt"), []byte("ignored\n"), 0644)).To(Succeed())
+		Expect(space.LogSources()).To(Equal([]string{"hook", "tab:server"}))
+
+		var out bytes.Buffer
+		Expect(space.Logs(context.Background(), &out, spaces.LogOptions{})).To(Succeed())
+		Expect(out.String()).To(Equal("" +
+			"hook       | installed\n" +
+			"tab:server | listening\n" +
+			"tab:server | ready\n"))
+
+		out.Reset()
+		Expect(space.Logs(context.Background(), &out, spaces.LogOptions{Source: "tab:server"})).To(Succeed())
+		Expect(out.String()).To(Equal("listening\nready\n"))
+
+		Expect(space.Logs(context.Background(), &out, spaces.LogOptions{Source: "service"})).To(MatchError(ContainSubstring("no service log")))
+	})
+
+	It("follows new output and new sources until cancelled", func() {
+		hook := filepath.Join(space.LogDir(), "hook.log")
+		Expect(os.WriteFile(hook, []byte("first\n"), 0644)).To(Succeed())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		out := gbytes.NewBuffer()
+		done := make(chan error)
+		go func() { done <- space.Logs(ctx, out, spaces.LogOptions{Follow: true}) }()
+
+		Eventually(out.Contents).Should(BeEquivalentTo("hook | first\n"))
+		f, err := os.OpenFile(hook, os.O_WRONLY|os.O_APPEND, 0644)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.WriteString("second\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(space.LogDir(), "service.log"), []byte("up\n"), 0644)).To(Succeed())
+
+		Eventually(out.Contents).Should(BeEquivalentTo("hook | first\nhook    | second\nservice | up\n"))
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+})
+
+var _ = Describe("Editor state", func() {
+	var space *spaces.Space
+
+	BeforeEach(func() {
+		testRepoDir := GinkgoT().TempDir()
+		runGitCmd(testRepoDir, "init")
+		runGitCmd(testRepoDir, "config", "user.email", "test@test.com")
+		runGitCmd(testRepoDir, "config", "user.name", "Test User")
+		runGitCmd(testRepoDir, "commit", "--allow-empty", "-m", "Initial commit")
+
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   testRepoDir,
+			DestDir:    GinkgoT().TempDir(),
+			BranchName: "editor",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		space, err = spaces.Open(worktreePath)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("keeps the nvim session in the state dir", func() {
+		Expect(filepath.Base(space.NvimSession())).To(Equal("session.vim"))
+		Expect(space.NvimSession()).To(ContainSubstring(".state"))
+	})
+
+	It("resumes the nvim session once it exists", func() {
+		Expect(space.NvimCommand()).NotTo(ContainSubstring(" -S "))
+		Expect(space.NvimCommand()).To(ContainSubstring("mksession!"))
+
+		Expect(os.MkdirAll(filepath.Dir(space.NvimSession()), 0755)).To(Succeed())
+		Expect(os.WriteFile(space.NvimSession(), nil, 0644)).To(Succeed())
+		Expect(space.NvimCommand()).To(HaveSuffix(" -S '" + space.NvimSession() + "'"))
+	})
+
+	It("writes a VS Code workspace for the worktree and keeps added settings", func() {
+		Expect(space.WriteVSCodeWorkspace()).To(Succeed())
+		data, err := os.ReadFile(space.VSCodeWorkspace())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"path": "` + space.Path + `"`))
+
+		edited := strings.Replace(string(data), `"settings": {`, `"settings": {"editor.fontSize": 14,`, 1)
+		Expect(os.WriteFile(space.VSCodeWorkspace(), []byte(edited), 0644)).To(Succeed())
+		space.Path = filepath.Join(filepath.Dir(space.Path), "moved")
+		Expect(space.WriteVSCodeWorkspace()).To(Succeed())
+
+		data, err = os.ReadFile(space.VSCodeWorkspace())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"path": "` + space.Path + `"`))
+		Expect(string(data)).To(ContainSubstring("editor.fontSize"))
+	})
+
+	It("summarizes the note by its first line", func() {
+		destDir := filepath.Dir(space.Path)
+		Expect(space.NotePath()).To(Equal(spaces.NotePath(destDir, space.Name)))
+		Expect(spaces.NoteSummary(destDir, space.Name)).To(BeEmpty())
+
+		Expect(os.MkdirAll(filepath.Dir(space.NotePath()), 0755)).To(Succeed())
+		Expect(os.WriteFile(space.NotePath(), []byte("\n# Fix the login race\n\n- retry once\n"), 0644)).To(Succeed())
+		Expect(spaces.NoteSummary(destDir, space.Name)).To(Equal("Fix the login race"))
+
+		Expect(os.WriteFile(space.NotePath(), []byte("#123 needs review\n"), 0644)).To(Succeed())
+		Expect(spaces.NoteSummary(destDir, space.Name)).To(Equal("#123 needs review"))
 	})
 })
 
@@ -174,10 +2252,10 @@ var _ = Describe("Open", func() {
 			Name:    "non-existent",
 		}
 
-		err := spaces.OpenSession(opts)
+		err := spaces.OpenSession(context.Background(), opts)
 
 		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(ContainSubstring("space does not exist"))
+		Expect(err).To(MatchError(spaces.ErrSpaceNotFound))
 	})
 
 	It("returns an error for non-worktree directory", func() {
@@ -190,10 +2268,10 @@ var _ = Describe("Open", func() {
 			Name:    "regular-dir",
 		}
 
-		err = spaces.OpenSession(opts)
+		err = spaces.OpenSession(context.Background(), opts)
 
 		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(ContainSubstring("not a git worktree"))
+		Expect(err).To(MatchError(spaces.ErrNotWorktree))
 	})
 
 	It("returns an error when path is a file, not a directory", func() {
@@ -206,11 +2284,63 @@ var _ = Describe("Open", func() {
 			Name:    "file-not-dir",
 		}
 
-		err = spaces.OpenSession(opts)
+		err = spaces.OpenSession(context.Background(), opts)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("not a directory"))
 	})
+
+	It("binds an existing checkout and opens it in place", func() {
+		Expect(os.WriteFile(filepath.Join(mainRepoDir, ".remux.yaml"), []byte("tabs:\n  - name: shell\n"), 0644)).To(Succeed())
+		subDir := filepath.Join(mainRepoDir, "sub")
+		Expect(os.Mkdir(subDir, 0755)).To(Succeed())
+
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		sessions := &remuxtest.Sessions{}
+		st.Backend = sessions
+
+		name, err := st.Bind(context.Background(), spaces.BindOptions{Path: subDir})
+		Expect(err).NotTo(HaveOccurred())
+		root, _ := filepath.EvalSymlinks(mainRepoDir)
+		Expect(name).To(Equal(filepath.Base(root)))
+		Expect(st.BoundAt(subDir)).To(Equal(name))
+
+		entry := st.Registry.Get(name)
+		Expect(entry.Path).To(Equal(root))
+		Expect(entry.RepoRoot).To(Equal(root))
+		Expect(entry.Bound).To(BeTrue())
+		Expect(entry.Port).To(BeNumerically(">=", registry.BasePort))
+
+		// Binding again returns the existing space
+		again, err := st.Bind(context.Background(), spaces.BindOptions{Path: mainRepoDir, Name: "other"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(name))
+
+		Expect(st.OpenSession(context.Background(), spaces.OpenSessionOptions{Name: name, Detached: true})).To(Succeed())
+		session, ok := sessions.Session(name)
+		Expect(ok).To(BeTrue())
+		Expect(session.Workdir).To(Equal(root))
+		Expect(session.Tabs).To(Equal([]config.Tab{{Name: "shell"}}))
+
+		// Dropping only unregisters the checkout
+		Expect(st.Drop(context.Background(), root, spaces.DropOptions{})).To(Succeed())
+		Expect(st.Registry.Get(name)).To(BeNil())
+		Expect(filepath.Join(root, "README.md")).To(BeAnExistingFile())
+		Expect(sessions.SessionExists(name)).To(BeFalse())
+	})
+
+	It("refuses to bind under a name that is taken", func() {
+		Expect(registry.Update(destDir, func(reg *registry.Registry) error {
+			reg.Add("taken", worktreeDir, registry.BasePort, mainRepoDir)
+			return nil
+		})).To(Succeed())
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = st.Bind(context.Background(), spaces.BindOptions{Path: mainRepoDir, Name: "taken"})
+		Expect(err).To(MatchError(spaces.ErrSpaceExists))
+	})
 })
 
 func runGitCmd(repoDir string, args ...string) {
@@ -325,6 +2455,27 @@ var _ = Describe("Open Integration", func() {
 		os.RemoveAll(destDir)
 	})
 
+	It("drops a space from its session quietly when no client is attached", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{RepoRoot: mainRepoDir, DestDir: destDir, BranchName: "no-client"})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		var logs bytes.Buffer
+		st.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+		Expect(st.OpenSession(context.Background(), spaces.OpenSessionOptions{Name: spaceName, Detached: true})).To(Succeed())
+
+		// Drop from a shell of the session, which has no client
+		out, err := exec.Command("tmux", "display-message", "-p", "-t", spaceName, "#{socket_path},#{pid},#{session_id}").Output()
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoT().Setenv("TMUX", strings.ReplaceAll(strings.TrimSpace(string(out)), "$", ""))
+
+		Expect(st.Drop(context.Background(), worktreePath, spaces.DropOptions{Stop: true, Grace: time.Second})).To(Succeed())
+		Expect(logs.String()).NotTo(ContainSubstring("leave session"))
+		Expect(tmux.SessionExists(spaceName)).To(BeFalse())
+	})
+
 	It("sets SPACE_PORT in tmux session environment", func() {
 		// Create a space (allocates port)
 		createOpts := spaces.CreateOptions{
@@ -332,7 +2483,7 @@ var _ = Describe("Open Integration", func() {
 			DestDir:    destDir,
 			BranchName: "port-test",
 		}
-		worktreePath, err := spaces.Create(createOpts)
+		worktreePath, err := spaces.Create(context.Background(), createOpts)
 		Expect(err).NotTo(HaveOccurred())
 		spaceName = filepath.Base(worktreePath)
 
@@ -348,11 +2499,294 @@ var _ = Describe("Open Integration", func() {
 			DestDir: destDir,
 			Name:    spaceName,
 		}
-		_ = spaces.OpenSession(openOpts) // Ignore attach error
+		_ = spaces.OpenSession(context.Background(), openOpts) // Ignore attach error
 
 		// Verify SPACE_PORT is accessible in the shell
 		value, err := getEnvFromShell(spaceName, "SPACE_PORT")
 		Expect(err).NotTo(HaveOccurred())
 		Expect(value).To(Equal(strconv.Itoa(registry.BasePort)))
 	})
+
+	It("applies config env changes to a running session", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   mainRepoDir,
+			DestDir:    destDir,
+			BranchName: "env-apply",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+		cfgPath := filepath.Join(worktreePath, ".remux.yaml")
+		Expect(os.WriteFile(cfgPath, []byte("env:\n  APP_MODE: one\n  OLD_VAR: x\n"), 0644)).To(Succeed())
+
+		_ = spaces.OpenSession(context.Background(), spaces.OpenSessionOptions{DestDir: destDir, Name: spaceName})
+		value, err := getEnvFromShell(spaceName, "APP_MODE")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("one"))
+
+		Expect(os.WriteFile(cfgPath, []byte("env:\n  APP_MODE: \"two's\"\n"), 0644)).To(Succeed())
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		change, err := st.ApplyEnv(context.Background(), spaceName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(change.Set).To(Equal([]string{"APP_MODE"}))
+		Expect(change.Unset).To(Equal([]string{"OLD_VAR"}))
+		Expect(change.Panes).To(Equal(1))
+
+		env, err := tmux.Environment(spaceName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(HaveKeyWithValue("APP_MODE", "two's"))
+		Expect(env).NotTo(HaveKey("OLD_VAR"))
+		value, err = getEnvFromShell(spaceName, "APP_MODE")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("two's"))
+
+		change, err = st.ApplyEnv(context.Background(), spaceName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(change).To(Equal(spaces.EnvChange{}))
+
+		// Reopening with ApplyEnv picks up later changes too
+		Expect(os.WriteFile(cfgPath, []byte("env:\n  APP_MODE: three\n"), 0644)).To(Succeed())
+		st, err = spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		_ = st.OpenSession(context.Background(), spaces.OpenSessionOptions{Name: spaceName, ApplyEnv: true, Detached: true})
+		env, err = tmux.Environment(spaceName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(HaveKeyWithValue("APP_MODE", "three"))
+	})
+
+	It("adopts a session started by hand", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   mainRepoDir,
+			DestDir:    destDir,
+			BranchName: "adopted",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+		cfg := "env:\n  APP_MODE: adopted\ntabs:\n  - name: editor\n  - name: server\n    cmd: echo serving\n"
+		Expect(os.WriteFile(filepath.Join(worktreePath, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+
+		const manual = "remux-manual-session"
+		Expect(exec.Command("tmux", "new-session", "-d", "-s", manual, "-c", worktreePath, "-n", "editor").Run()).To(Succeed())
+		DeferCleanup(func() { tmux.KillSession(manual) })
+
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		adoption, err := st.AdoptSession(context.Background(), spaces.AdoptOptions{Session: manual})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adoption.Name).To(Equal(spaceName))
+		Expect(adoption.Renamed).To(BeTrue())
+		Expect(adoption.Env.Set).To(ContainElement("APP_MODE"))
+		Expect(adoption.Tabs).To(Equal([]string{"server"}))
+
+		Expect(tmux.SessionExists(manual)).To(BeFalse())
+		windows, err := tmux.WindowNames(spaceName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(windows).To(Equal([]string{"editor", "server"}))
+		value, err := getEnvFromShell(spaceName, "APP_MODE")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("adopted"))
+
+		// Adopting it again changes nothing
+		adoption, err = st.AdoptSession(context.Background(), spaces.AdoptOptions{Session: spaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adoption).To(Equal(spaces.Adoption{Name: spaceName}))
+	})
+
+	It("sets the session up once when opened concurrently", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   mainRepoDir,
+			DestDir:    destDir,
+			BranchName: "concurrent",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+
+		cfg := "tabs:\n  - name: one\n  - name: two\n"
+		Expect(os.WriteFile(filepath.Join(worktreePath, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+
+		// Both calls fail to attach (not in a terminal), but neither may lose
+		// the race to create the session
+		errs := make(chan error, 2)
+		for range 2 {
+			go func() {
+				errs <- spaces.OpenSession(context.Background(), spaces.OpenSessionOptions{DestDir: destDir, Name: spaceName})
+			}()
+		}
+		for range 2 {
+			Expect(<-errs).NotTo(MatchError(spaces.ErrSessionExists))
+		}
+
+		out, err := exec.Command("tmux", "list-windows", "-t", tmux.SessionName(spaceName), "-F", "#{window_name}").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Fields(string(out))).To(Equal([]string{"one", "two"}))
+	})
+
+	It("splits synchronized tabs into panes", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   mainRepoDir,
+			DestDir:    destDir,
+			BranchName: "panes",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+
+		cfg := "tabs:\n  - name: services\n    synchronize: true\n    panes: [\"echo one\", \"echo two\", \"echo three\"]\n"
+		Expect(os.WriteFile(filepath.Join(worktreePath, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+
+		_ = spaces.OpenSession(context.Background(), spaces.OpenSessionOptions{DestDir: destDir, Name: spaceName})
+
+		panes, err := tmux.ListPanes(spaceName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(panes).To(HaveLen(3))
+		out, err := exec.Command("tmux", "show-window-options", "-v", "-t", tmux.SessionName(spaceName)+":services", "synchronize-panes").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(string(out))).To(Equal("on"))
+	})
+
+	It("splits panes in the given direction and size", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   mainRepoDir,
+			DestDir:    destDir,
+			BranchName: "pane-layout",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+
+		cfg := "tabs:\n  - name: dev\n    panes:\n      - echo editor\n      - {cmd: echo logs, direction: right, size: 20}\n"
+		Expect(os.WriteFile(filepath.Join(worktreePath, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+
+		_ = spaces.OpenSession(context.Background(), spaces.OpenSessionOptions{DestDir: destDir, Name: spaceName})
+
+		out, err := exec.Command("tmux", "list-panes", "-t", tmux.SessionName(spaceName)+":dev", "-F", "#{pane_left} #{pane_width}").Output()
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(HavePrefix("0 "))
+		Expect(strings.Fields(lines[1])[1]).To(Equal("20"))
+	})
+
+	It("runs hooks and commands in a window of the session", func() {
+		cfg := "hooks:\n  in_session: true\n  on_create:\n    - echo created > created.txt\n  on_open:\n    - echo $SPACE_PORT > open.txt\n" +
+			"commands:\n  mode:\n    run: echo $MODE > mode.txt\n    env: {MODE: seed}\n    session: true\n  fail:\n    run: exit 2\n    session: true\n"
+		Expect(os.WriteFile(filepath.Join(mainRepoDir, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+		runGitCmd(mainRepoDir, "add", ".")
+		runGitCmd(mainRepoDir, "commit", "-m", "Add config")
+
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   mainRepoDir,
+			DestDir:    destDir,
+			BranchName: "session-hooks",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+		Expect(filepath.Join(worktreePath, "created.txt")).NotTo(BeAnExistingFile())
+
+		Expect(spaces.OpenSession(context.Background(), spaces.OpenSessionOptions{DestDir: destDir, Name: spaceName, Detached: true})).To(Succeed())
+		Eventually(func() (string, error) {
+			data, err := os.ReadFile(filepath.Join(worktreePath, "open.txt"))
+			return string(data), err
+		}).Should(Equal(fmt.Sprintf("%d\n", registry.BasePort)))
+		Expect(filepath.Join(worktreePath, "created.txt")).To(BeAnExistingFile())
+		Expect(filepath.Join(spaces.StateDir(destDir, spaceName), "on_create.pending")).NotTo(BeAnExistingFile())
+
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		run, err := st.RunCommand(context.Background(), spaceName, "mode", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run.Window).To(HavePrefix("@"))
+		Expect(os.ReadFile(filepath.Join(worktreePath, "mode.txt"))).To(BeEquivalentTo("seed\n"))
+		_, err = st.RunCommand(context.Background(), spaceName, "fail", nil, nil)
+		Expect(err).To(MatchError(ContainSubstring("fail exited with 2")))
+	})
+
+	It("starts tabs in their dir with their env", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   mainRepoDir,
+			DestDir:    destDir,
+			BranchName: "tab-dirs",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+		for _, dir := range []string{"frontend", "backend"} {
+			Expect(os.Mkdir(filepath.Join(worktreePath, dir), 0755)).To(Succeed())
+		}
+
+		cfg := "tabs:\n" +
+			"  - {name: ui, dir: frontend, env: {PORT: \"{{ space.Port }}\"}, cmd: \"echo $PORT > port.txt\"}\n" +
+			"  - {name: api, dir: backend/, env: {PORT: \"4000\"}, cmd: \"echo $PORT > port.txt\"}\n"
+		Expect(os.WriteFile(filepath.Join(worktreePath, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+
+		_ = spaces.OpenSession(context.Background(), spaces.OpenSessionOptions{DestDir: destDir, Name: spaceName})
+
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		port := strconv.Itoa(st.Registry.Get(spaceName).Port)
+		Eventually(func() (string, error) {
+			data, err := os.ReadFile(filepath.Join(worktreePath, "frontend", "port.txt"))
+			return strings.TrimSpace(string(data)), err
+		}, 5*time.Second, 100*time.Millisecond).Should(Equal(port))
+		Eventually(func() (string, error) {
+			data, err := os.ReadFile(filepath.Join(worktreePath, "backend", "port.txt"))
+			return strings.TrimSpace(string(data)), err
+		}, 5*time.Second, 100*time.Millisecond).Should(Equal("4000"))
+	})
+
+	It("keeps renamed tabs named after what runs in them", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   mainRepoDir,
+			DestDir:    destDir,
+			BranchName: "tab-rename",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+
+		cfg := "tabs:\n  - {name: shell}\n  - {name: tests, rename: status, cmd: \"echo $REMUX_REPORT_STATUS > report.txt\"}\n"
+		Expect(os.WriteFile(filepath.Join(worktreePath, ".remux.yaml"), []byte(cfg), 0644)).To(Succeed())
+
+		_ = spaces.OpenSession(context.Background(), spaces.OpenSessionOptions{DestDir: destDir, Name: spaceName})
+
+		out, err := exec.Command("tmux", "show-window-options", "-v", "-t", tmux.SessionName(spaceName)+":{end}", "automatic-rename").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(string(out))).To(Equal("on"))
+		Eventually(func() (string, error) {
+			data, err := os.ReadFile(filepath.Join(worktreePath, "report.txt"))
+			return strings.TrimSpace(string(data)), err
+		}, 5*time.Second, 100*time.Millisecond).Should(Equal("1"))
+
+		// Adoption still finds the tab under its config name
+		names, err := tmux.WindowNames(spaceName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(Equal([]string{"shell", "tests"}))
+	})
+
+	It("saves scrollback on kill and prints its tail on the next open", func() {
+		worktreePath, err := spaces.Create(context.Background(), spaces.CreateOptions{
+			RepoRoot:   mainRepoDir,
+			DestDir:    destDir,
+			BranchName: "scrollback",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		spaceName = filepath.Base(worktreePath)
+		Expect(os.WriteFile(filepath.Join(worktreePath, ".remux.yaml"), []byte("scrollback:\n  save: true\n"), 0644)).To(Succeed())
+
+		_ = spaces.OpenSession(context.Background(), spaces.OpenSessionOptions{DestDir: destDir, Name: spaceName})
+		port, err := getEnvFromShell(spaceName, "SPACE_PORT")
+		Expect(err).NotTo(HaveOccurred())
+
+		st, err := spaces.LoadState(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.KillSession(spaceName)).To(Succeed())
+		Expect(tmux.SessionExists(spaceName)).To(BeFalse())
+		Expect(st.KillSession(spaceName)).To(MatchError(spaces.ErrNoSession))
+
+		saved := filepath.Join(spaces.StateDir(destDir, spaceName), "scrollback", "0.0.log")
+		Expect(os.ReadFile(saved)).To(ContainSubstring(port))
+
+		_ = spaces.OpenSession(context.Background(), spaces.OpenSessionOptions{DestDir: destDir, Name: spaceName})
+		Expect(saved).NotTo(BeAnExistingFile())
+		Eventually(func() string {
+			out, _ := exec.Command("tmux", "capture-pane", "-t", tmux.SessionName(spaceName), "-p").Output()
+			return string(out)
+		}, 5*time.Second, 100*time.Millisecond).Should(ContainSubstring("__MARKER_"))
+	})
 })
@@ -0,0 +1,303 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// StackRoot returns the name of the bottom space of the stack the named space
+// belongs to, following parent links until a space without a registered parent.
+func (st *State) StackRoot(name string) (string, error) {
+	if st.Registry.Get(name) == nil {
+		return "", fmt.Errorf("%w: %s", ErrSpaceNotFound, name)
+	}
+
+	seen := map[string]bool{name: true}
+	for {
+		parent := st.Registry.Get(name).Parent
+		if parent == "" || st.Registry.Get(parent) == nil {
+			return name, nil
+		}
+		if seen[parent] {
+			return "", fmt.Errorf("stack of %s has a cycle at %s", name, parent)
+		}
+		seen[parent] = true
+		name = parent
+	}
+}
+
+// Stack returns the spaces stacked on top of the named space, parents before
+// their children. The named space itself is not included.
+func (st *State) Stack(name string) []registry.Entry {
+	var result []registry.Entry
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		for _, child := range st.Registry.Children(queue[0]) {
+			if !seen[child.Name] {
+				seen[child.Name] = true
+				result = append(result, child)
+				queue = append(queue, child.Name)
+			}
+		}
+		queue = queue[1:]
+	}
+	return result
+}
+
+// syncFile is the file in the state dir of a stack's bottom space that
+// records a sync of the stack stopped on conflicts.
+const syncFile = "sync.yaml"
+
+// stackSync is the state of a stack sync stopped on conflicts, kept until
+// the sync is continued or aborted.
+type stackSync struct {
+	Stopped string            `yaml:"stopped"`          // Space whose rebase stopped
+	Onto    string            `yaml:"onto"`             // Branch it was rebased onto
+	Synced  []string          `yaml:"synced,omitempty"` // Spaces rebased before it, bottom first
+	Orig    map[string]string `yaml:"orig"`             // Commit each space's branch was at before the sync
+	Heads   map[string]string `yaml:"heads,omitempty"`  // Commit each synced space's branch was rebased to
+}
+
+// SyncStack rebases every space in the stack of the named space onto its
+// parent's branch, starting from the bottom of the stack so each rebase sees
+// its parent's updated branch. The bottom space itself is left alone.
+// Returns the names of the rebased spaces. A space whose parent was rebased
+// replays only its own commits onto the parent's new branch, so conflicts
+// resolved in the parent don't come back in it.
+//
+// All worktrees are checked for uncommitted changes before anything is
+// rebased. A rebase that stops on conflicts is left in progress and stops the
+// sync with a *ConflictError. Once the conflicts are resolved, ContinueSync
+// picks the sync up where it stopped; AbortSync undoes it instead.
+func (st *State) SyncStack(ctx context.Context, name string) ([]string, error) {
+	root, err := st.StackRoot(name)
+	if err != nil {
+		return nil, err
+	}
+	if sync, err := st.loadSync(root); err != nil {
+		return nil, err
+	} else if sync != nil {
+		return nil, fmt.Errorf("%w: the sync of the stack of %s stopped in %s, run stack sync --continue or --abort", ErrConflict, root, sync.Stopped)
+	}
+	stack := st.Stack(root)
+	if err := checkClean(ctx, stack); err != nil {
+		return nil, err
+	}
+	return st.syncStack(ctx, root, stack, &stackSync{})
+}
+
+// ContinueSync continues the sync of the stack of the named space that
+// stopped on conflicts: the stopped rebase is continued, unless it was
+// already finished or skipped with git, and the spaces above it are rebased.
+// Returns the names of the rebased spaces, including the one that stopped.
+func (st *State) ContinueSync(ctx context.Context, name string) ([]string, error) {
+	root, sync, err := st.stoppedSync(name)
+	if err != nil {
+		return nil, err
+	}
+	e := st.Registry.Get(sync.Stopped)
+	if e == nil {
+		return nil, fmt.Errorf("%w: %s, run stack sync --abort", ErrSpaceNotFound, sync.Stopped)
+	}
+	if git.RebaseInProgress(e.Path) {
+		if files, _ := git.ConflictedFiles(ctx, e.Path); len(files) > 0 {
+			return nil, &ConflictError{Space: e.Name, Path: e.Path, Onto: sync.Onto, Files: files}
+		}
+		if err := git.RebaseContinue(ctx, e.Path); err != nil {
+			if git.RebaseInProgress(e.Path) {
+				// A later commit of the branch conflicts too
+				return nil, st.conflictError(ctx, *e, sync.Onto)
+			}
+			return nil, fmt.Errorf("failed to continue the rebase of %s: %w", e.Name, err)
+		}
+	}
+	synced := []string{e.Name}
+	sync.synced(*e)
+
+	done := map[string]bool{}
+	for _, name := range sync.Synced {
+		done[name] = true
+	}
+	var pending []registry.Entry
+	for _, s := range st.Stack(root) {
+		if !done[s.Name] {
+			pending = append(pending, s)
+		}
+	}
+	if err := checkClean(ctx, pending); err != nil {
+		return synced, err
+	}
+	more, err := st.syncStack(ctx, root, pending, sync)
+	return append(synced, more...), err
+}
+
+// AbortSync undoes the sync of the stack of the named space that stopped on
+// conflicts: the stopped rebase is aborted and the branches rebased before it
+// are reset to where they were before the sync. A branch that got new commits
+// since is left alone with a warning. Returns the names of the reset spaces.
+func (st *State) AbortSync(ctx context.Context, name string) ([]string, error) {
+	root, sync, err := st.stoppedSync(name)
+	if err != nil {
+		return nil, err
+	}
+	if e := st.Registry.Get(sync.Stopped); e != nil && git.RebaseInProgress(e.Path) {
+		if err := git.RebaseAbort(ctx, e.Path); err != nil {
+			return nil, fmt.Errorf("failed to abort the rebase of %s: %w", e.Name, err)
+		}
+	}
+	var restored []string
+	for _, name := range sync.Synced {
+		e := st.Registry.Get(name)
+		if e == nil {
+			continue
+		}
+		if head, _ := git.Head(e.Path); head != sync.Heads[name] {
+			st.logger().Warn("not resetting a branch that changed since the sync", "space", name, "orig", sync.Orig[name])
+			continue
+		}
+		// Left recorded on failure, so the abort can be run again
+		if err := git.ResetKeep(ctx, e.Path, sync.Orig[name]); err != nil {
+			return restored, fmt.Errorf("failed to reset %s: %w", name, err)
+		}
+		restored = append(restored, name)
+	}
+	st.removeSync(root)
+	return restored, nil
+}
+
+// syncStack rebases the spaces of pending onto their parents' branches in
+// order, recording the sync in the state dir of root if a rebase stops.
+func (st *State) syncStack(ctx context.Context, root string, pending []registry.Entry, sync *stackSync) ([]string, error) {
+	var synced []string
+	for _, e := range pending {
+		parent := st.Registry.Get(e.Parent)
+		branch, err := git.CurrentBranch(parent.Path)
+		if err != nil {
+			st.removeSync(root)
+			return synced, err
+		}
+		if _, ok := sync.Orig[e.Name]; !ok {
+			if sync.Orig == nil {
+				sync.Orig = map[string]string{}
+			}
+			sync.Orig[e.Name], _ = git.Head(e.Path)
+		}
+		rebase := func() error { return git.Rebase(ctx, e.Path, branch) }
+		if since, ok := sync.Orig[e.Parent]; ok && sync.Heads[e.Parent] != "" {
+			// Replay only the space's own commits, not its parent's from
+			// before the sync, whose conflicts were resolved there already
+			rebase = func() error { return git.RebaseOnto(ctx, e.Path, branch, since) }
+		}
+		if err := rebase(); err != nil {
+			if !git.RebaseInProgress(e.Path) {
+				st.removeSync(root)
+				if ctx.Err() != nil {
+					return synced, ctx.Err()
+				}
+				return synced, fmt.Errorf("failed to rebase %s onto %s: %w", e.Name, branch, err)
+			}
+			sync.Stopped, sync.Onto = e.Name, branch
+			if err := st.saveSync(root, sync); err != nil {
+				return synced, err
+			}
+			if ctx.Err() != nil {
+				return synced, ctx.Err()
+			}
+			return synced, st.conflictError(ctx, e, branch)
+		}
+		synced = append(synced, e.Name)
+		sync.synced(e)
+	}
+	st.removeSync(root)
+	return synced, nil
+}
+
+// synced records that the branch of the space was rebased.
+func (s *stackSync) synced(e registry.Entry) {
+	if s.Heads == nil {
+		s.Heads = map[string]string{}
+	}
+	s.Synced = append(s.Synced, e.Name)
+	s.Heads[e.Name], _ = git.Head(e.Path)
+}
+
+// checkClean returns an error wrapping ErrDirtyWorktree if any of the spaces
+// has uncommitted changes.
+func checkClean(ctx context.Context, entries []registry.Entry) error {
+	for _, e := range entries {
+		if git.HasUncommittedChanges(ctx, e.Path) {
+			return fmt.Errorf("%w: %s", ErrDirtyWorktree, e.Name)
+		}
+	}
+	return nil
+}
+
+// conflictError returns the *ConflictError of the rebase of the space that
+// stopped on conflicts.
+func (st *State) conflictError(ctx context.Context, e registry.Entry, onto string) error {
+	files, _ := git.ConflictedFiles(ctx, e.Path)
+	return &ConflictError{Space: e.Name, Path: e.Path, Onto: onto, Files: files}
+}
+
+// stoppedSync returns the bottom space of the stack of the named space and
+// the sync of the stack that stopped on conflicts. Returns an error wrapping
+// ErrNoSync if none did.
+func (st *State) stoppedSync(name string) (string, *stackSync, error) {
+	root, err := st.StackRoot(name)
+	if err != nil {
+		return "", nil, err
+	}
+	sync, err := st.loadSync(root)
+	if err != nil {
+		return "", nil, err
+	}
+	if sync == nil {
+		return "", nil, fmt.Errorf("%w in the stack of %s", ErrNoSync, root)
+	}
+	return root, sync, nil
+}
+
+func (st *State) syncPath(root string) string {
+	return filepath.Join(StateDir(st.DestDir, root), syncFile)
+}
+
+// loadSync returns the sync of the stack of root that stopped on conflicts,
+// or nil if there is none.
+func (st *State) loadSync(root string) (*stackSync, error) {
+	data, err := os.ReadFile(st.syncPath(root))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var sync stackSync
+	if err := yaml.Unmarshal(data, &sync); err != nil {
+		return nil, fmt.Errorf("%s: %w", st.syncPath(root), err)
+	}
+	return &sync, nil
+}
+
+func (st *State) saveSync(root string, sync *stackSync) error {
+	data, err := yaml.Marshal(sync)
+	if err != nil {
+		return err
+	}
+	path := st.syncPath(root)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to record sync: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (st *State) removeSync(root string) {
+	if err := os.Remove(st.syncPath(root)); err != nil && !os.IsNotExist(err) {
+		st.logger().Warn("failed to remove sync state", "space", root, "err", err)
+	}
+}
@@ -0,0 +1,205 @@
+package spaces
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/registry"
+)
+
+// State is the loaded registry of a dest dir. A single State is shared by all
+// space operations within one command invocation, so the registry is read once
+// for lookups. Changes are made under the store's lock to a freshly loaded
+// copy, see update, so changes other processes saved in the meantime are kept.
+type State struct {
+	DestDir  string
+	Registry *registry.Registry
+
+	// Backend hosts the sessions of every space, overriding the backend
+	// selected by their configs (optional).
+	Backend SessionManager
+
+	// DefaultBackend is the backend type of spaces whose config selects none,
+	// e.g. "zellij" (optional, default tmux).
+	DefaultBackend string
+
+	// User is recorded as the owner of created spaces, and Drop refuses to
+	// drop spaces owned by someone else (optional, default the OS user).
+	User string
+
+	// Git runs the git operations of create, open and drop (optional,
+	// default git.CLI).
+	Git GitClient
+
+	// Logger receives warnings about steps that fail without failing the
+	// operation, such as saving scrollback (optional, default slog.Default()).
+	Logger *slog.Logger
+
+	store   registry.Store
+	configs map[string]*config.Config // keyed by worktree path
+
+	// mu serializes the registry and config accesses of concurrent Create
+	// calls, see CreateBatch. Other operations don't take it.
+	mu sync.Mutex
+
+	batching int  // nesting depth of Batch calls, which hold the store's lock
+	dirty    bool // an update was deferred by Batch
+}
+
+// LoadState loads the registry for the given dest dir.
+func LoadState(destDir string) (*State, error) {
+	return NewState(destDir, registry.FileStore{Dir: destDir})
+}
+
+// NewState loads the registry of the spaces in destDir from store.
+func NewState(destDir string, store registry.Store) (*State, error) {
+	reg, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+	return &State{
+		DestDir:  destDir,
+		Registry: reg,
+		store:    store,
+		configs:  make(map[string]*config.Config),
+	}, nil
+}
+
+// update applies fn to the registry and saves it while holding the store's
+// lock. The registry is reloaded under the lock first, so the changes other
+// processes saved since it was loaded are kept rather than overwritten by a
+// stale copy. Nothing is saved if fn fails, so fn should check everything it
+// can fail on before changing the registry. Inside Batch, which already holds
+// the lock, the save is deferred until the batch completes.
+func (st *State) update(fn func(*registry.Registry) error) error {
+	if st.batching > 0 {
+		if err := fn(st.Registry); err != nil {
+			return err
+		}
+		st.dirty = true
+		return nil
+	}
+
+	unlock, err := st.store.Lock()
+	if err != nil {
+		return fmt.Errorf("failed to lock registry: %w", err)
+	}
+	defer unlock()
+	if err := st.reload(); err != nil {
+		return err
+	}
+	if err := fn(st.Registry); err != nil {
+		return err
+	}
+	return st.store.Save(st.Registry)
+}
+
+// reload replaces the registry with the stored one.
+func (st *State) reload() error {
+	reg, err := st.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+	st.Registry = reg
+	return nil
+}
+
+// Batch runs fn holding the store's lock, with the registry reloaded first
+// and the changes of fn saved once it returns. Other processes changing the
+// registry wait for the batch to complete. The registry is saved even if fn
+// fails, since operations that completed before the failure must stay
+// recorded.
+func (st *State) Batch(fn func() error) error {
+	if st.batching > 0 {
+		return fn()
+	}
+
+	unlock, err := st.store.Lock()
+	if err != nil {
+		return fmt.Errorf("failed to lock registry: %w", err)
+	}
+	defer unlock()
+	if err := st.reload(); err != nil {
+		return err
+	}
+
+	st.batching++
+	err = fn()
+	st.batching--
+
+	if st.dirty {
+		st.dirty = false
+		if saveErr := st.store.Save(st.Registry); saveErr != nil {
+			return errors.Join(err, saveErr)
+		}
+	}
+	return err
+}
+
+// Space returns the named space with its workspace config.
+// Configs are loaded at most once per State.
+func (st *State) Space(name string) (*Space, error) {
+	entry := st.Registry.Get(name)
+	if entry == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSpaceNotFound, name)
+	}
+
+	cfg, err := st.config(entry.Path, entry.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Space{
+		Name:     entry.Name,
+		Path:     entry.Path,
+		Port:     entry.Port,
+		RepoRoot: entry.RepoRoot,
+		config:   cfg,
+		stateDir: StateDir(st.DestDir, entry.Name),
+		backend:  st.Backend,
+		logger:   st.logger(),
+
+		// A copy, since concurrent creates of a batch add to the registry
+		registered: slices.Clone(st.Registry.List()),
+	}, nil
+}
+
+// logger returns the state's logger.
+func (st *State) logger() *slog.Logger {
+	if st.Logger != nil {
+		return st.Logger
+	}
+	return slog.Default()
+}
+
+// config returns the cached workspace config for the given worktree path,
+// merged over the named space template if there is one. A template that can
+// no longer be loaded is left out with a warning, so the space still opens.
+func (st *State) config(worktreePath, template string) (*config.Config, error) {
+	if cfg, ok := st.configs[worktreePath]; ok {
+		return cfg, nil
+	}
+	cfg, err := config.Load(worktreePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if template != "" {
+		tmpl, err := config.LoadTemplate(template)
+		if err != nil {
+			st.logger().Warn("ignoring space template", "template", template, "err", err)
+		} else {
+			cfg = tmpl.Beneath(cfg)
+		}
+	}
+	if cfg.Backend == "" && st.DefaultBackend != "" {
+		withBackend := *cfg
+		withBackend.Backend = st.DefaultBackend
+		cfg = &withBackend
+	}
+	st.configs[worktreePath] = cfg
+	return cfg, nil
+}
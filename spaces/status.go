@@ -0,0 +1,129 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/registry"
+	"gopkg.in/yaml.v3"
+)
+
+const statusCacheFile = "status.yaml"
+
+// StatusCacheTTL bounds how long a cached status is trusted when the worktree's
+// index and HEAD log are unchanged. Unstaged edits and upstream fetches don't
+// touch either file, so they become visible once the TTL expires.
+var StatusCacheTTL = 30 * time.Second
+
+// ReadOnlyCaches keeps GetStatus and GetCIStatus from writing their caches to
+// the state dirs, for inspecting dest dirs that must be left as they are.
+// Cached results are still used.
+var ReadOnlyCaches bool
+
+// Status summarizes the git state of a space.
+type Status struct {
+	Dirty  bool `yaml:"dirty" json:"dirty"`
+	Ahead  int  `yaml:"ahead" json:"ahead"`
+	Behind int  `yaml:"behind" json:"behind"`
+	Merged bool `yaml:"merged" json:"merged"` // Branch has commits that are all contained in the main checkout's HEAD
+}
+
+// String returns a compact summary such as "dirty +2 -1".
+func (s Status) String() string {
+	parts := []string{"clean"}
+	if s.Dirty {
+		parts[0] = "dirty"
+	}
+	if s.Ahead > 0 {
+		parts = append(parts, fmt.Sprintf("+%d", s.Ahead))
+	}
+	if s.Behind > 0 {
+		parts = append(parts, fmt.Sprintf("-%d", s.Behind))
+	}
+	if s.Merged {
+		parts = append(parts, "merged")
+	}
+	return strings.Join(parts, " ")
+}
+
+// statusCache is the on-disk cache record for a space's status.
+type statusCache struct {
+	Key     string    `yaml:"key"`
+	Checked time.Time `yaml:"checked"`
+	Status  Status    `yaml:"status"`
+}
+
+// GetStatus returns the git status of a space. Results are cached in the space's
+// state dir and reused while the worktree's index and HEAD log are unchanged.
+func GetStatus(destDir string, entry registry.Entry) (Status, error) {
+	if _, err := os.Stat(entry.Path); err != nil {
+		return Status{}, fmt.Errorf("failed to access space: %w", err)
+	}
+
+	cachePath := filepath.Join(StateDir(destDir, entry.Name), statusCacheFile)
+	if key := statusCacheKey(entry.Path); key != "" {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var cached statusCache
+			if yaml.Unmarshal(data, &cached) == nil && cached.Key == key && time.Since(cached.Checked) < StatusCacheTTL {
+				return cached.Status, nil
+			}
+		}
+	}
+
+	status := computeStatus(entry)
+
+	// git status may refresh the index, so the key is taken afterwards.
+	// Cache write failures only cost performance.
+	if key := statusCacheKey(entry.Path); key != "" && !ReadOnlyCaches {
+		if data, err := yaml.Marshal(statusCache{Key: key, Checked: time.Now(), Status: status}); err == nil {
+			if os.MkdirAll(filepath.Dir(cachePath), 0755) == nil {
+				_ = os.WriteFile(cachePath, data, 0644)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// computeStatus runs the git commands needed to determine a space's status.
+func computeStatus(entry registry.Entry) Status {
+	var status Status
+	status.Dirty = git.HasUncommittedChanges(context.Background(), entry.Path)
+
+	// No upstream is not an error, just nothing to compare against
+	status.Ahead, status.Behind, _ = git.AheadBehind(entry.Path)
+
+	head, err := git.Head(entry.Path)
+	if err != nil {
+		return status
+	}
+	if base, err := git.Head(entry.RepoRoot); err == nil && head != base {
+		status.Merged = git.IsAncestor(entry.Path, head, base)
+	}
+	return status
+}
+
+// statusCacheKey derives a cache key from the modification times of the
+// worktree's index and HEAD reflog. Returns an empty key if the git dir
+// can't be found, which disables caching.
+func statusCacheKey(path string) string {
+	gitDir, err := git.GitDir(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", modTime(filepath.Join(gitDir, "index")), modTime(filepath.Join(gitDir, "logs", "HEAD")))
+}
+
+// modTime returns the modification time of a file in nanoseconds, or 0 if it doesn't exist.
+func modTime(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().UnixNano()
+}
@@ -0,0 +1,139 @@
+package spaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/git"
+	"github.com/johanhenriksson/remux/tmux"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrTestsFailed is returned when the test command of a space fails.
+var ErrTestsFailed = errors.New("tests failed")
+
+// ErrNoTestCommand is returned when testing a space whose config sets no
+// test command.
+var ErrNoTestCommand = errors.New("no test command, set commands.test in .remux.yaml")
+
+// testFile holds the result of the space's last test run in its state dir.
+const testFile = "test.yaml"
+
+// testWindow is the name of the tmux window tests run in, see TestInWindow.
+const testWindow = "test"
+
+// TestResult is the outcome of the last run of a space's test command.
+type TestResult struct {
+	Command  string        `yaml:"command" json:"command"`
+	Commit   string        `yaml:"commit,omitempty" json:"commit,omitempty"` // HEAD of the worktree when the run started
+	ExitCode int           `yaml:"exit_code" json:"exit_code"`
+	Started  time.Time     `yaml:"started" json:"started"`
+	Duration time.Duration `yaml:"duration" json:"duration"` // Nanoseconds in JSON
+}
+
+// Passed reports whether the test command exited successfully.
+func (r TestResult) Passed() bool {
+	return r.ExitCode == 0
+}
+
+// String returns a compact summary such as "tests:pass".
+func (r TestResult) String() string {
+	if r.Passed() {
+		return "tests:pass"
+	}
+	return "tests:fail"
+}
+
+// RunTests runs the test command of the named space, see config.Command, in
+// its worktree with its env, writing the command's output to stdout and
+// stderr. The result is recorded in the space's state dir, and returned
+// along with ErrTestsFailed if the command failed.
+func (st *State) RunTests(ctx context.Context, name string, stdout, stderr io.Writer) (*TestResult, error) {
+	space, err := st.Space(name)
+	if err != nil {
+		return nil, err
+	}
+	command, ok := space.config.Command(config.TestCommand)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoTestCommand, name)
+	}
+
+	result := &TestResult{Command: command.Run, Started: time.Now()}
+	result.Commit, _ = git.Head(space.Path)
+	err = space.config.RunCommand(ctx, space.configSpace(), command, stdout, stderr)
+	result.Duration = time.Since(result.Started).Round(time.Millisecond)
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr) && ctx.Err() == nil:
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		// Interrupted runs and commands that didn't start tell nothing about the tests
+		return nil, err
+	}
+	if err := space.saveTestResult(result); err != nil {
+		st.logger().Warn("failed to record test result", "space", name, "err", err)
+	}
+	if !result.Passed() {
+		return result, fmt.Errorf("%w: %s exited with %d", ErrTestsFailed, command.Run, result.ExitCode)
+	}
+	return result, nil
+}
+
+// TestInWindow types command, which should run the tests of the named space
+// and record their result, such as `remux test NAME`, into a new window of
+// the space's tmux session.
+func (st *State) TestInWindow(ctx context.Context, name, command string) error {
+	space, err := st.Space(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := space.config.Command(config.TestCommand); !ok {
+		return fmt.Errorf("%w: %s", ErrNoTestCommand, name)
+	}
+	if err := space.requireTmuxSession(); err != nil {
+		return err
+	}
+	window, err := tmux.NewWindow(ctx, name, space.Path, testWindow, nil)
+	if err != nil {
+		return fmt.Errorf("failed to open test window: %w", err)
+	}
+	return tmux.SendKeys(ctx, name, window, command)
+}
+
+// LastTestResult returns the result of the named space's last test run, or
+// nil if its tests never ran.
+func LastTestResult(destDir, name string) (*TestResult, error) {
+	data, err := os.ReadFile(filepath.Join(StateDir(destDir, name), testFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var result TestResult
+	if err := yaml.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to read test result: %w", err)
+	}
+	return &result, nil
+}
+
+// saveTestResult records the result of a test run in the space's state dir.
+func (s *Space) saveTestResult(result *TestResult) error {
+	data, err := yaml.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.stateDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.stateDir, testFile), data, 0644)
+}
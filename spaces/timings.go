@@ -0,0 +1,61 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/johanhenriksson/remux/telemetry"
+)
+
+// Phase is a named, timed step of a space operation.
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Timings records how long each phase of create/open took.
+// A nil *Timings is valid and records nothing.
+type Timings struct {
+	mu     sync.Mutex
+	phases []Phase
+}
+
+// Track starts timing a phase and a trace span of it, also when t is nil.
+// Work done in the phase should use the returned context, so its spans are
+// children of the phase's. Call the returned function when the phase completes.
+func (t *Timings) Track(ctx context.Context, name string) (context.Context, func()) {
+	ctx, span := telemetry.Start(ctx, name)
+	start := time.Now()
+	return ctx, func() {
+		span.End()
+		if t == nil {
+			return
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.phases = append(t.phases, Phase{Name: name, Duration: time.Since(start)})
+	}
+}
+
+// Phases returns the recorded phases in completion order.
+func (t *Timings) Phases() []Phase {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Phase(nil), t.phases...)
+}
+
+// Write prints a table of the recorded phases and their total.
+func (t *Timings) Write(w io.Writer) {
+	var total time.Duration
+	for _, p := range t.Phases() {
+		fmt.Fprintf(w, "%-16s %8s\n", p.Name, p.Duration.Round(time.Millisecond))
+		total += p.Duration
+	}
+	fmt.Fprintf(w, "%-16s %8s\n", "total", total.Round(time.Millisecond))
+}
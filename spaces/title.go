@@ -0,0 +1,40 @@
+package spaces
+
+import (
+	"os"
+
+	"github.com/johanhenriksson/remux/terminal"
+)
+
+// titler is implemented by backends that can title the windows of a session.
+type titler interface {
+	SetTitle(name, title string) error
+}
+
+// Title returns the terminal title of the named space: its name followed by
+// its git status, e.g. "repo-feature (dirty +2)".
+func (st *State) Title(name string) string {
+	entry := st.Registry.Get(name)
+	if entry == nil {
+		return name
+	}
+	status, err := GetStatus(st.DestDir, *entry)
+	if err != nil {
+		return name
+	}
+	return name + " (" + status.String() + ")"
+}
+
+// setTitle titles the session's windows so window switchers and taskbars show
+// which space they belong to. Backends that can't title their windows get an
+// OSC title written to the outer terminal before attaching. Titles are
+// cosmetic, so failures are ignored.
+func setTitle(backend SessionManager, name, title string) {
+	if t, ok := backend.(titler); ok {
+		_ = t.SetTitle(name, title)
+		return
+	}
+	if terminal.IsTerminal(os.Stdout) {
+		_ = terminal.WriteTitle(os.Stdout, title)
+	}
+}
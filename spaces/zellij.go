@@ -0,0 +1,72 @@
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/terminal"
+	"github.com/johanhenriksson/remux/zellij"
+)
+
+// zellijLayoutFile is the generated Zellij layout in a space's state dir.
+const zellijLayoutFile = "layout.kdl"
+
+// ZellijLayout returns the path of the space's generated Zellij layout.
+func (s *Space) ZellijLayout() string {
+	return filepath.Join(s.stateDir, zellijLayoutFile)
+}
+
+// WriteZellijLayout generates a Zellij layout from the space's tabs and
+// writes it to ZellijLayout.
+func (s *Space) WriteZellijLayout() error {
+	tabs, err := s.Tabs()
+	if err != nil {
+		return fmt.Errorf("failed to resolve tabs: %w", err)
+	}
+	return writeZellijLayout(s.ZellijLayout(), s.Path, tabs)
+}
+
+func writeZellijLayout(path, workdir string, tabs []config.Tab) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(zellij.Layout(workdir, terminal.Shell(), tabs)), 0644)
+}
+
+// zellijBackend runs spaces in Zellij sessions. Zellij can't create a session
+// without attaching to it, so NewSession writes the layout and Attach starts
+// the session from it.
+type zellijBackend struct {
+	layout  string            // Layout file path
+	env     map[string]string // Env of the session created by NewSession
+	pending bool              // NewSession was called and Attach must start the session
+}
+
+func (*zellijBackend) Name() string { return "zellij" }
+
+func (*zellijBackend) SessionExists(name string) bool { return zellij.SessionExists(name) }
+
+func (b *zellijBackend) NewSession(ctx context.Context, name, workdir string, env map[string]string, tabs []config.Tab) error {
+	if zellij.SessionExists(name) {
+		return fmt.Errorf("%w: %s", ErrSessionExists, name)
+	}
+	if err := writeZellijLayout(b.layout, workdir, tabs); err != nil {
+		return fmt.Errorf("failed to write zellij layout: %w", err)
+	}
+	b.env = env
+	b.pending = true
+	return nil
+}
+
+func (b *zellijBackend) Attach(name string) error {
+	if b.pending {
+		b.pending = false
+		return zellij.NewSession(name, b.layout, b.env)
+	}
+	return zellij.Attach(name)
+}
+
+func (*zellijBackend) KillSession(name string) { zellij.KillSession(name) }
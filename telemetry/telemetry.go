@@ -0,0 +1,75 @@
+// Package telemetry traces space operations over OTLP, so the time spent in
+// git, tmux and hooks can be analyzed across many runs of remux.
+//
+// Tracing is off unless OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set. The exporter is configured by the
+// standard OTEL_EXPORTER_OTLP_* variables, e.g. OTEL_EXPORTER_OTLP_HEADERS.
+// Spans started while tracing is off cost next to nothing.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/johanhenriksson/remux"
+
+// Enabled reports whether the environment asks for traces to be exported.
+func Enabled() bool {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup exports the spans of the process over OTLP/HTTP if Enabled. The
+// returned function flushes the spans not yet exported and must be called
+// before exiting; it does nothing if tracing is off.
+func Setup(ctx context.Context, version string) (func(context.Context) error, error) {
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("remux"),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span that is a child of the span in ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks span as failed if err is set and ends it. Cancellations are
+// recorded as errors too, so interrupted runs stand out.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		status := err.Error()
+		if errors.Is(err, context.Canceled) {
+			status = "canceled"
+		}
+		span.SetStatus(codes.Error, status)
+	}
+	span.End()
+}
@@ -0,0 +1,68 @@
+package terminal
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrNoClipboard is returned when neither a clipboard tool nor a terminal to
+// send an OSC 52 sequence to is available.
+var ErrNoClipboard = errors.New("no clipboard available")
+
+// clipboardTools lists the clipboard commands tried in order, with the
+// environment variable that must be set for each to be usable.
+var clipboardTools = []struct {
+	Env  string
+	Args []string
+}{
+	{"", []string{"pbcopy"}},
+	{"WAYLAND_DISPLAY", []string{"wl-copy"}},
+	{"DISPLAY", []string{"xclip", "-selection", "clipboard"}},
+	{"DISPLAY", []string{"xsel", "--clipboard", "--input"}},
+}
+
+// OSC52 returns the escape sequence that sets the system clipboard to text.
+// Inside tmux the sequence is wrapped for passthrough so it reaches the outer
+// terminal.
+func OSC52(text string) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x07"
+	if os.Getenv("TMUX") != "" {
+		return "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return seq
+}
+
+// Copy puts text on the system clipboard. Local sessions use pbcopy, wl-copy,
+// xclip or xsel; over ssh, or when none of them is installed, an OSC 52
+// sequence is written to the terminal so the clipboard of the machine the
+// user sits at is set.
+func Copy(text string) error {
+	remote := os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != ""
+	if !remote {
+		for _, tool := range clipboardTools {
+			if tool.Env != "" && os.Getenv(tool.Env) == "" {
+				continue
+			}
+			if _, err := exec.LookPath(tool.Args[0]); err != nil {
+				continue
+			}
+			cmd := exec.Command(tool.Args[0], tool.Args[1:]...)
+			cmd.Stdin = strings.NewReader(text)
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("%s: %w", tool.Args[0], err)
+			}
+			return nil
+		}
+	}
+
+	if !IsTerminal(os.Stdout) {
+		return ErrNoClipboard
+	}
+	_, err := fmt.Fprint(os.Stdout, OSC52(text))
+	return err
+}
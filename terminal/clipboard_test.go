@@ -0,0 +1,49 @@
+package terminal_test
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux/terminal"
+)
+
+var _ = Describe("Clipboard", func() {
+	BeforeEach(func() {
+		GinkgoT().Setenv("TMUX", "")
+		GinkgoT().Setenv("SSH_TTY", "")
+		GinkgoT().Setenv("SSH_CONNECTION", "")
+	})
+
+	It("encodes text as an OSC 52 sequence", func() {
+		encoded := base64.StdEncoding.EncodeToString([]byte("/work/repo-a"))
+		Expect(terminal.OSC52("/work/repo-a")).To(Equal("\x1b]52;c;" + encoded + "\x07"))
+	})
+
+	It("wraps the sequence for tmux passthrough", func() {
+		GinkgoT().Setenv("TMUX", "/tmp/tmux-1000/default,1,0")
+		encoded := base64.StdEncoding.EncodeToString([]byte("11010"))
+		Expect(terminal.OSC52("11010")).To(Equal("\x1bPtmux;\x1b\x1b]52;c;" + encoded + "\x07\x1b\\"))
+	})
+
+	It("copies with a local clipboard tool", func() {
+		dir := GinkgoT().TempDir()
+		script := "#!/bin/sh\necho \"$@\" > \"${0%/*}/args\"\nwhile IFS= read -r line || [ -n \"$line\" ]; do printf '%s' \"$line\" > \"${0%/*}/out\"; done\n"
+		Expect(os.WriteFile(filepath.Join(dir, "xclip"), []byte(script), 0755)).To(Succeed())
+		GinkgoT().Setenv("PATH", dir)
+		GinkgoT().Setenv("WAYLAND_DISPLAY", "")
+		GinkgoT().Setenv("DISPLAY", ":0")
+
+		Expect(terminal.Copy("/work/repo-a")).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(dir, "out"))).To(BeEquivalentTo("/work/repo-a"))
+		Expect(os.ReadFile(filepath.Join(dir, "args"))).To(BeEquivalentTo("-selection clipboard\n"))
+	})
+
+	It("fails without a clipboard tool or terminal", func() {
+		GinkgoT().Setenv("PATH", GinkgoT().TempDir())
+		Expect(terminal.Copy("x")).To(MatchError(terminal.ErrNoClipboard))
+	})
+})
@@ -0,0 +1,135 @@
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/johanhenriksson/remux/config"
+)
+
+// kittySessionVar is the user variable marking the kitty windows of a space.
+const kittySessionVar = "remux_session"
+
+// Kitty runs each space in its own kitty OS window with one tab per config
+// tab. Requires remote control to be enabled (allow_remote_control).
+type Kitty struct{}
+
+// kittyOSWindow is an entry of `kitty @ ls`.
+type kittyOSWindow struct {
+	Tabs []struct {
+		Windows []struct {
+			ID       int               `json:"id"`
+			UserVars map[string]string `json:"user_vars"`
+		} `json:"windows"`
+	} `json:"tabs"`
+}
+
+// Name returns "kitty".
+func (Kitty) Name() string { return "kitty" }
+
+// windows returns the ids of the kitty windows of the named space.
+func (Kitty) windows(name string) ([]int, error) {
+	out, err := run("", "kitty", "@", "ls")
+	if err != nil {
+		return nil, err
+	}
+	var osWindows []kittyOSWindow
+	if err := json.Unmarshal([]byte(out), &osWindows); err != nil {
+		return nil, fmt.Errorf("failed to parse kitty windows: %w", err)
+	}
+	var ids []int
+	for _, osw := range osWindows {
+		for _, tab := range osw.Tabs {
+			for _, w := range tab.Windows {
+				if w.UserVars[kittySessionVar] == name {
+					ids = append(ids, w.ID)
+				}
+			}
+		}
+	}
+	return ids, nil
+}
+
+// SessionExists reports whether any kitty window belongs to the space.
+func (k Kitty) SessionExists(name string) bool {
+	ids, err := k.windows(name)
+	return err == nil && len(ids) > 0
+}
+
+// NewSession launches an OS window for the first tab and the remaining tabs into it.
+func (k Kitty) NewSession(ctx context.Context, name, workdir string, env map[string]string, tabs []config.Tab) error {
+	if k.SessionExists(name) {
+		return fmt.Errorf("%w: %s", ErrSessionExists, name)
+	}
+	if len(tabs) == 0 {
+		tabs = []config.Tab{{}}
+	}
+
+	common := []string{"--var", kittySessionVar + "=" + name}
+	for _, pair := range envPairs(env) {
+		common = append(common, "--env", pair)
+	}
+
+	windows := make([]string, len(tabs))
+	for i, tab := range tabs {
+		args := []string{"@", "launch"}
+		if i == 0 {
+			args = append(args, "--type", "os-window", "--os-window-title", name)
+		} else {
+			args = append(args, "--type", "tab", "--match", "window_id:"+windows[0])
+		}
+		if tab.Name != "" {
+			args = append(args, "--tab-title", tab.Name)
+		}
+		args = append(append(args, "--cwd", tab.WorkDir(workdir)), common...)
+		for _, pair := range envPairs(tab.Env) {
+			args = append(args, "--env", pair)
+		}
+		id, err := runContext(ctx, "", "kitty", append(args, Shell())...)
+		if err != nil {
+			return err
+		}
+		windows[i] = id
+	}
+
+	// Text from stdin is sent verbatim, unlike arguments which kitty unescapes
+	for i, tab := range tabs {
+		if tab.Cmd != "" {
+			if _, err := runContext(ctx, tab.Cmd+"\r", "kitty", "@", "send-text", "--match", "id:"+windows[i], "--stdin"); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := runContext(ctx, "", "kitty", "@", "focus-window", "--match", "id:"+windows[0])
+	return err
+}
+
+// Attach focuses the first kitty window of the space.
+func (k Kitty) Attach(name string) error {
+	ids, err := k.windows(name)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("no kitty window for %s", name)
+	}
+	_, err = run("", "kitty", "@", "focus-window", "--match", "id:"+strconv.Itoa(ids[0]))
+	return err
+}
+
+// SetTitle sets the title of every kitty window of the space.
+func (Kitty) SetTitle(name, title string) error {
+	_, err := run("", "kitty", "@", "set-window-title", "--match", "var:"+kittySessionVar+"="+name, title)
+	return err
+}
+
+// KillSession closes every kitty window of the space.
+func (k Kitty) KillSession(name string) {
+	ids, _ := k.windows(name)
+	for _, id := range ids {
+		_, _ = run("", "kitty", "@", "close-window", "--match", "id:"+strconv.Itoa(id))
+	}
+}
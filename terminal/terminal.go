@@ -0,0 +1,84 @@
+// Package terminal opens space sessions as native terminal emulator windows
+// and tabs, driven through the WezTerm CLI or kitty remote control, and talks
+// to the user's terminal through escape sequences and the clipboard.
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/johanhenriksson/remux/tmux"
+)
+
+// ErrSessionExists is returned when creating a session whose name is already
+// taken. It is the tmux error, so callers match sessions of every backend
+// with one value.
+var ErrSessionExists = tmux.ErrSessionExists
+
+// run executes a terminal CLI with stdin as input and returns its stdout.
+// The CLI's error message is included in the returned error.
+func run(stdin string, name string, args ...string) (string, error) {
+	return runContext(context.Background(), stdin, name, args...)
+}
+
+// runContext is run with a context that kills the CLI when cancelled.
+func runContext(ctx context.Context, stdin string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s %s: %w: %s", name, args[0], err, msg)
+		}
+		return "", fmt.Errorf("%s %s: %w", name, args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Shell returns the user's login shell, falling back to sh.
+func Shell() string {
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh
+	}
+	return "sh"
+}
+
+// WriteTitle sets the title of the terminal w is connected to with an OSC 0
+// escape sequence. Control characters are dropped from title so it can't end
+// the sequence early.
+func WriteTitle(w io.Writer, title string) error {
+	title = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, title)
+	_, err := fmt.Fprintf(w, "\x1b]0;%s\x07", title)
+	return err
+}
+
+// IsTerminal reports whether f is connected to a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// envPairs returns env as sorted KEY=VALUE pairs.
+func envPairs(env map[string]string) []string {
+	pairs := make([]string, 0, len(env))
+	for k, v := range env {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
@@ -0,0 +1,118 @@
+package terminal_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/terminal"
+)
+
+// fakeCLI installs a script named name on PATH that logs its arguments and
+// stdin to a file named log in its directory, then runs body.
+func fakeCLI(name, body string) string {
+	dir := GinkgoT().TempDir()
+	script := "#!/bin/sh\n" +
+		`log="$(dirname "$0")/log"` + "\n" +
+		`echo "$@" >> "$log"` + "\n" +
+		`case "$*" in *--stdin*) cat >> "$log"; echo >> "$log";; esac` + "\n" +
+		body + "\n"
+	Expect(os.WriteFile(filepath.Join(dir, name), []byte(script), 0755)).To(Succeed())
+	GinkgoT().Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	GinkgoT().Setenv("SHELL", "/bin/sh")
+	return dir
+}
+
+// calls returns the logged invocations of a fake CLI.
+func calls(dir string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, "log"))
+	Expect(err).NotTo(HaveOccurred())
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+var _ = Describe("WezTerm", func() {
+	It("finds sessions by workspace", func() {
+		fakeCLI("wezterm", `echo '[{"window_id":1,"tab_id":1,"pane_id":5,"workspace":"repo-a"}]'`)
+
+		Expect(terminal.WezTerm{}.SessionExists("repo-a")).To(BeTrue())
+		Expect(terminal.WezTerm{}.SessionExists("repo-b")).To(BeFalse())
+	})
+
+	It("spawns one tab per config tab in a new workspace", func() {
+		dir := fakeCLI("wezterm", `case "$2" in list) echo '[]';; spawn) echo 7;; esac`)
+
+		tabs := []config.Tab{{Name: "editor", Cmd: "nvim ."}, {Name: "shell"}}
+		err := terminal.WezTerm{}.NewSession(context.Background(), "repo-a", "/work", map[string]string{"PORT": "11010"}, tabs)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(calls(dir)).To(Equal([]string{
+			"cli list --format json",
+			"cli spawn --new-window --workspace repo-a --cwd /work -- env PORT=11010 /bin/sh",
+			"cli spawn --pane-id 7 --cwd /work -- env PORT=11010 /bin/sh",
+			"cli set-tab-title --pane-id 7 editor",
+			"cli send-text --pane-id 7 --no-paste nvim .",
+			"",
+			"cli set-tab-title --pane-id 7 shell",
+			"cli activate-pane --pane-id 7",
+		}))
+	})
+
+	It("refuses to start a running session", func() {
+		fakeCLI("wezterm", `echo '[{"pane_id":5,"workspace":"repo-a"}]'`)
+
+		err := terminal.WezTerm{}.NewSession(context.Background(), "repo-a", "/work", nil, nil)
+		Expect(err).To(MatchError(terminal.ErrSessionExists))
+	})
+})
+
+var _ = Describe("Kitty", func() {
+	const ls = `[{"tabs":[{"windows":[{"id":3,"user_vars":{"remux_session":"repo-a"}},{"id":4,"user_vars":{}}]}]}]`
+
+	It("finds sessions by user variable", func() {
+		fakeCLI("kitty", `echo '`+ls+`'`)
+
+		Expect(terminal.Kitty{}.SessionExists("repo-a")).To(BeTrue())
+		Expect(terminal.Kitty{}.SessionExists("repo-b")).To(BeFalse())
+	})
+
+	It("launches tabs into a new OS window and sends commands verbatim", func() {
+		dir := fakeCLI("kitty", `case "$2" in ls) echo '[]';; launch) echo 9;; esac`)
+
+		tabs := []config.Tab{{Name: "editor", Cmd: `echo "a\nb"`}, {Name: "shell"}}
+		err := terminal.Kitty{}.NewSession(context.Background(), "repo-a", "/work", nil, tabs)
+		Expect(err).NotTo(HaveOccurred())
+
+		log := calls(dir)
+		Expect(log[1]).To(Equal("@ launch --type os-window --os-window-title repo-a --tab-title editor --cwd /work --var remux_session=repo-a /bin/sh"))
+		Expect(log[2]).To(Equal("@ launch --type tab --match window_id:9 --tab-title shell --cwd /work --var remux_session=repo-a /bin/sh"))
+		Expect(log[3]).To(Equal("@ send-text --match id:9 --stdin"))
+		Expect(log[4]).To(Equal(`echo "a\nb"` + "\r"))
+	})
+
+	It("closes every window of the session", func() {
+		dir := fakeCLI("kitty", `echo '`+ls+`'`)
+
+		terminal.Kitty{}.KillSession("repo-a")
+		Expect(calls(dir)).To(Equal([]string{"@ ls", "@ close-window --match id:3"}))
+	})
+
+	It("titles the windows of the session", func() {
+		dir := fakeCLI("kitty", "")
+
+		Expect(terminal.Kitty{}.SetTitle("repo-a", "repo-a (clean)")).To(Succeed())
+		Expect(calls(dir)).To(Equal([]string{"@ set-window-title --match var:remux_session=repo-a repo-a (clean)"}))
+	})
+})
+
+var _ = Describe("WriteTitle", func() {
+	It("writes an OSC title sequence without control characters", func() {
+		var buf strings.Builder
+		Expect(terminal.WriteTitle(&buf, "repo-a\x07\x1b (dirty)")).To(Succeed())
+		Expect(buf.String()).To(Equal("\x1b]0;repo-a (dirty)\x07"))
+	})
+})
@@ -0,0 +1,129 @@
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/johanhenriksson/remux/config"
+)
+
+// WezTerm runs each space in its own WezTerm workspace, named after the space,
+// with one tab per config tab.
+type WezTerm struct{}
+
+// weztermPane is an entry of `wezterm cli list --format json`.
+type weztermPane struct {
+	WindowID  int    `json:"window_id"`
+	TabID     int    `json:"tab_id"`
+	PaneID    int    `json:"pane_id"`
+	Workspace string `json:"workspace"`
+}
+
+// Name returns "wezterm".
+func (WezTerm) Name() string { return "wezterm" }
+
+// panes returns the panes of the named workspace.
+func (WezTerm) panes(name string) ([]weztermPane, error) {
+	out, err := run("", "wezterm", "cli", "list", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	var all []weztermPane
+	if err := json.Unmarshal([]byte(out), &all); err != nil {
+		return nil, fmt.Errorf("failed to parse wezterm panes: %w", err)
+	}
+	var result []weztermPane
+	for _, p := range all {
+		if p.Workspace == name {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// SessionExists reports whether the space's workspace has any panes.
+func (w WezTerm) SessionExists(name string) bool {
+	panes, err := w.panes(name)
+	return err == nil && len(panes) > 0
+}
+
+// NewSession opens a window in a new workspace and spawns the remaining tabs into it.
+func (w WezTerm) NewSession(ctx context.Context, name, workdir string, env map[string]string, tabs []config.Tab) error {
+	if w.SessionExists(name) {
+		return fmt.Errorf("%w: %s", ErrSessionExists, name)
+	}
+	if len(tabs) == 0 {
+		tabs = []config.Tab{{}}
+	}
+
+	panes := make([]string, len(tabs))
+	for i, tab := range tabs {
+		args := []string{"cli", "spawn"}
+		if i == 0 {
+			args = append(args, "--new-window", "--workspace", name)
+		} else {
+			args = append(args, "--pane-id", panes[0])
+		}
+		// Panes inherit the mux server's environment, so the space and tab env
+		// are set by starting the shell through env
+		args = append(args, "--cwd", tab.WorkDir(workdir), "--", "env")
+		args = append(append(args, envPairs(env)...), envPairs(tab.Env)...)
+		pane, err := runContext(ctx, "", "wezterm", append(args, Shell())...)
+		if err != nil {
+			return err
+		}
+		panes[i] = pane
+	}
+
+	for i, tab := range tabs {
+		if tab.Name != "" {
+			if _, err := runContext(ctx, "", "wezterm", "cli", "set-tab-title", "--pane-id", panes[i], tab.Name); err != nil {
+				return err
+			}
+		}
+		if tab.Cmd != "" {
+			if _, err := runContext(ctx, "", "wezterm", "cli", "send-text", "--pane-id", panes[i], "--no-paste", tab.Cmd+"\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := runContext(ctx, "", "wezterm", "cli", "activate-pane", "--pane-id", panes[0])
+	return err
+}
+
+// Attach activates the first pane of the space's workspace.
+func (w WezTerm) Attach(name string) error {
+	panes, err := w.panes(name)
+	if err != nil {
+		return err
+	}
+	if len(panes) == 0 {
+		return fmt.Errorf("no wezterm workspace %s", name)
+	}
+	_, err = run("", "wezterm", "cli", "activate-pane", "--pane-id", strconv.Itoa(panes[0].PaneID))
+	return err
+}
+
+// SetTitle sets the title of the window hosting the space's workspace.
+func (w WezTerm) SetTitle(name, title string) error {
+	panes, err := w.panes(name)
+	if err != nil {
+		return err
+	}
+	if len(panes) == 0 {
+		return fmt.Errorf("no wezterm workspace %s", name)
+	}
+	_, err = run("", "wezterm", "cli", "set-window-title", "--pane-id", strconv.Itoa(panes[0].PaneID), title)
+	return err
+}
+
+// KillSession kills every pane of the space's workspace.
+func (w WezTerm) KillSession(name string) {
+	panes, _ := w.panes(name)
+	for _, p := range panes {
+		_, _ = run("", "wezterm", "cli", "kill-pane", "--pane-id", strconv.Itoa(p.PaneID))
+	}
+}
@@ -0,0 +1,313 @@
+package tmux
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Event is a tmux control-mode notification, such as "sessions-changed"
+// or "session-renamed". Args holds the space-separated notification arguments.
+type Event struct {
+	Name string
+	Args []string
+}
+
+// reply is the output block of a single control-mode command.
+type reply struct {
+	output string
+	err    error
+}
+
+// Control is a persistent tmux control-mode client (tmux -C). Commands sent
+// through it reuse one connection instead of spawning a tmux process per call,
+// and session lifecycle notifications are delivered on Events.
+type Control struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	mu      sync.Mutex // serializes commands so replies arrive in order
+	replies chan reply
+	events  chan Event
+	done    chan struct{}
+}
+
+// StartControl attaches a control-mode client to the given session.
+// The session must already exist.
+func StartControl(session string) (*Control, error) {
+	cmd := exec.Command("tmux", "-C", "attach-session", "-t", sanitizeName(session))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &Control{
+		cmd:     cmd,
+		stdin:   stdin,
+		replies: make(chan reply),
+		events:  make(chan Event, 64),
+		done:    make(chan struct{}),
+	}
+	go c.read(stdout)
+	return c, nil
+}
+
+// Events returns the channel of lifecycle notifications.
+// The channel is closed when the control client exits.
+func (c *Control) Events() <-chan Event {
+	return c.events
+}
+
+// Run executes a tmux command over the control connection and returns its output.
+func (c *Control) Run(args ...string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	if _, err := fmt.Fprintln(c.stdin, strings.Join(quoted, " ")); err != nil {
+		return "", err
+	}
+
+	select {
+	case r := <-c.replies:
+		return r.output, r.err
+	case <-c.done:
+		return "", errors.New("tmux control client exited")
+	}
+}
+
+// Close detaches the control client and waits for it to exit.
+func (c *Control) Close() error {
+	c.stdin.Close()
+	return c.cmd.Wait()
+}
+
+// read parses control-mode output, routing command output blocks to Run and
+// notifications to Events. Pane output notifications are dropped.
+func (c *Control) read(stdout io.Reader) {
+	defer close(c.events)
+	defer close(c.done)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var (
+		inBlock bool
+		ours    bool
+		lines   []string
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if inBlock {
+			switch {
+			case strings.HasPrefix(line, "%end "), strings.HasPrefix(line, "%error "):
+				inBlock = false
+				if !ours {
+					continue
+				}
+				r := reply{output: strings.Join(lines, "\n")}
+				if strings.HasPrefix(line, "%error ") {
+					r.err = errors.New(r.output)
+				}
+				c.replies <- r
+			default:
+				lines = append(lines, line)
+			}
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(line, "%begin "); ok {
+			// Flags are 1 for commands sent by this client
+			fields := strings.Fields(rest)
+			inBlock = true
+			ours = len(fields) == 3 && fields[2] == "1"
+			lines = nil
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(line, "%"); ok {
+			fields := strings.Fields(name)
+			if len(fields) == 0 || fields[0] == "output" || fields[0] == "extended-output" {
+				continue
+			}
+			select {
+			case c.events <- Event{Name: fields[0], Args: fields[1:]}:
+			default:
+				// Drop events nobody is consuming rather than stalling replies
+			}
+		}
+	}
+}
+
+// quoteArg quotes an argument for the tmux command parser.
+func quoteArg(arg string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+// Runner runs tmux commands on behalf of this process, see UseControl.
+// Control and Remote are runners.
+type Runner interface {
+	Run(args ...string) (string, error)
+}
+
+// control, when set, routes commands through a persistent control-mode client.
+// It is read by every command, from any goroutine.
+var control atomic.Pointer[Runner]
+
+// UseControl routes all non-interactive tmux commands, except those acting on
+// the calling process's own client, through r. Passing nil restores spawning
+// a tmux process per command.
+func UseControl(r Runner) {
+	if r == nil {
+		control.Store(nil)
+		return
+	}
+	control.Store(&r)
+}
+
+// controlRunner returns the runner set by UseControl, or nil.
+func controlRunner() Runner {
+	if r := control.Load(); r != nil {
+		return *r
+	}
+	return nil
+}
+
+// errNoDaemon is returned by Remote.Run when nothing serves its socket, so
+// the command is run by a tmux process instead.
+var errNoDaemon = errors.New("no remux daemon is running")
+
+// remoteRequest is a command sent by a Remote.
+type remoteRequest struct {
+	Args []string `json:"args"`
+}
+
+// remoteReply is the result of a remoteRequest.
+type remoteReply struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Serve runs the commands of Remote clients connecting to ln over c, until ln
+// is closed. Each connection sends one JSON request per command and reads its
+// JSON reply.
+func (c *Control) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go c.serveConn(conn)
+	}
+}
+
+// serveConn answers the requests of one Remote.
+func (c *Control) serveConn(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req remoteRequest
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		var reply remoteReply
+		if len(req.Args) == 0 {
+			reply.Error = "no command"
+		} else if out, err := c.Run(req.Args...); err != nil {
+			reply.Error = err.Error()
+		} else {
+			reply.Output = out
+		}
+		if err := enc.Encode(reply); err != nil {
+			return
+		}
+	}
+}
+
+// Remote runs tmux commands over the control client of another process,
+// which serves it on a unix socket with Control.Serve. It connects on the
+// first command; if nothing serves the socket, commands are run by a tmux
+// process instead.
+type Remote struct {
+	path string
+	mu   sync.Mutex // serializes commands so replies arrive in order
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+	down bool // Connecting failed or the connection broke
+}
+
+// NewRemote returns a Remote for the socket at path.
+func NewRemote(path string) *Remote {
+	return &Remote{path: path}
+}
+
+// Run executes a tmux command over the remote control client and returns its output.
+func (r *Remote) Run(args ...string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.down {
+		return "", errNoDaemon
+	}
+	if r.conn == nil {
+		conn, err := net.Dial("unix", r.path)
+		if err != nil {
+			r.down = true
+			return "", errNoDaemon
+		}
+		r.conn = conn
+		r.enc = json.NewEncoder(conn)
+		r.dec = json.NewDecoder(conn)
+	}
+
+	// The command may have run once it is sent, so a broken connection is an
+	// error rather than a reason to run it again
+	var reply remoteReply
+	err := r.enc.Encode(remoteRequest{Args: args})
+	if err == nil {
+		err = r.dec.Decode(&reply)
+	}
+	if err != nil {
+		r.conn.Close()
+		r.down = true
+		return "", fmt.Errorf("lost the remux daemon connection: %w", err)
+	}
+	if reply.Error != "" {
+		return reply.Output, errors.New(reply.Error)
+	}
+	return reply.Output, nil
+}
+
+// Close closes the connection, if one was made.
+func (r *Remote) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.down = true
+	if r.conn == nil {
+		return nil
+	}
+	return r.conn.Close()
+}
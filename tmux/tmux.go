@@ -1,16 +1,109 @@
 package tmux
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/johanhenriksson/remux/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// ErrSessionExists is returned when creating a session whose name is already taken.
+var ErrSessionExists = errors.New("tmux session already exists")
+
+// ErrNoClient is returned by commands acting on the current client, such as
+// Detach, when there is none: in a shell with TMUX set whose session has no
+// client attached.
+var ErrNoClient = errors.New("no current tmux client")
+
+// Available reports whether tmux is installed.
+func Available() bool {
+	_, err := exec.LookPath("tmux")
+	return err == nil
+}
+
+// Version returns the installed tmux version, e.g. "3.3a".
+func Version() (string, error) {
+	out, err := exec.Command("tmux", "-V").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "tmux "), nil
+}
+
 // run executes a tmux command without interactive I/O.
 func run(args ...string) error {
-	cmd := exec.Command("tmux", args...)
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return runContext(context.Background(), args...)
+}
+
+// runContext is run with a context, see command.
+func runContext(ctx context.Context, args ...string) (err error) {
+	log().Debug("running tmux", "args", args)
+	_, span := telemetry.Start(ctx, "tmux "+args[0], attribute.StringSlice("tmux.args", args))
+	defer func() { telemetry.End(span, err) }()
+	_, stderr, err := command(ctx, args...)
+	return commandError(err, stderr)
+}
+
+// command executes a tmux command without interactive I/O, through the
+// control client if one is in use, and returns its stdout and tmux's error
+// message. Cancelling ctx kills the tmux client; in control mode the command
+// is skipped once ctx is done.
+func command(ctx context.Context, args ...string) (stdout, stderr string, err error) {
+	if c := controlRunner(); c != nil {
+		if err := ctx.Err(); err != nil {
+			return "", "", err
+		}
+		out, err := c.Run(args...)
+		switch {
+		case errors.Is(err, errNoDaemon):
+			// Run by a tmux process below
+		case err != nil:
+			return out, err.Error(), errors.New("tmux command failed")
+		default:
+			return out, "", nil
+		}
+	}
+	return execCommand(ctx, args...)
+}
+
+// execCommand is command run by a tmux process, never through the control
+// client. It is used for commands acting on the calling process's client,
+// which only a tmux process started by it can find.
+func execCommand(ctx context.Context, args ...string) (stdout, stderr string, err error) {
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.CommandContext(ctx, "tmux", args...)
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err = cmd.Run()
+	return outBuf.String(), errBuf.String(), err
+}
+
+// commandError returns the error of a tmux command that failed with err and
+// printed stderr: ErrSessionExists or ErrNoClient for the failures callers
+// handle, otherwise err with tmux's message.
+func commandError(err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	msg := strings.TrimSpace(stderr)
+	if name, ok := strings.CutPrefix(msg, "duplicate session: "); ok {
+		return fmt.Errorf("%w: %s", ErrSessionExists, name)
+	}
+	if strings.Contains(msg, "no current client") {
+		return ErrNoClient
+	}
+	if msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
 }
 
 // runInteractive executes a tmux command with full I/O (for attaching).
@@ -47,10 +140,17 @@ func NewSession(name, workdir string, env map[string]string) error {
 }
 
 // NewSessionDetached creates a new tmux session without attaching.
-func NewSessionDetached(name, workdir string, env map[string]string) error {
+// Returns ErrSessionExists if a session with that name is already running.
+// tmux checks this atomically, so concurrent callers can't both succeed.
+func NewSessionDetached(ctx context.Context, name, workdir string, env map[string]string) (err error) {
 	args := []string{"new-session", "-d", "-s", sanitizeName(name), "-c", workdir}
+	// The env may hold secrets, so it is left out of the log and the trace
+	log().Debug("running tmux", "args", args)
+	_, span := telemetry.Start(ctx, "tmux new-session", attribute.StringSlice("tmux.args", args))
+	defer func() { telemetry.End(span, err) }()
 	args = append(args, envArgs(env)...)
-	return run(args...)
+	_, stderr, err := command(ctx, args...)
+	return commandError(err, stderr)
 }
 
 func envArgs(env map[string]string) []string {
@@ -67,8 +167,44 @@ func KillSession(name string) {
 }
 
 // SwitchTo switches to an existing tmux session (from within tmux).
+// Returns ErrNoClient if there is no current client.
 func SwitchTo(name string) error {
-	return run("switch-client", "-t", sanitizeName(name))
+	_, err := clientOutput("switch-client", "-t", sanitizeName(name))
+	return err
+}
+
+// SwitchToLast switches the current client to the session it was attached to before.
+// Returns ErrNoClient if there is no current client.
+func SwitchToLast() error {
+	_, err := clientOutput("switch-client", "-l")
+	return err
+}
+
+// Detach detaches the current client.
+// Returns ErrNoClient if there is no current client.
+func Detach() error {
+	_, err := clientOutput("detach-client")
+	return err
+}
+
+// clientOutput is output for commands acting on the current client, which
+// are run by a tmux process rather than through the control client, since
+// the control client is a client of its own.
+func clientOutput(args ...string) (_ string, err error) {
+	log().Debug("running tmux", "args", args)
+	_, span := telemetry.Start(context.Background(), "tmux "+args[0], attribute.StringSlice("tmux.args", args))
+	defer func() { telemetry.End(span, err) }()
+	out, stderr, err := execCommand(context.Background(), args...)
+	if err != nil {
+		return "", commandError(err, stderr)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// CurrentSession returns the name of the session the calling process runs in.
+// Only meaningful when InSession is true.
+func CurrentSession() (string, error) {
+	return clientOutput("display-message", "-p", "#{session_name}")
 }
 
 // InSession returns true if currently running inside a tmux session.
@@ -81,42 +217,449 @@ func SessionName(name string) string {
 	return sanitizeName(name)
 }
 
-// NewWindow creates a new window in the given session.
-func NewWindow(session, workdir, name string) error {
-	args := []string{"new-window", "-t", sanitizeName(session), "-c", workdir}
+// output executes a tmux command and returns its trimmed stdout.
+func output(args ...string) (string, error) {
+	return outputContext(context.Background(), args...)
+}
+
+// outputContext is output with a context, see command.
+func outputContext(ctx context.Context, args ...string) (_ string, err error) {
+	_, span := telemetry.Start(ctx, "tmux "+args[0], attribute.StringSlice("tmux.args", args))
+	defer func() { telemetry.End(span, err) }()
+	out, stderr, err := command(ctx, args...)
+	if err != nil {
+		return "", commandError(err, stderr)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// NewWindow creates a new window in the given session and returns its window ID.
+// The ID (e.g. "@3") can be used as the window target of other functions.
+// The window's shell gets env on top of the session environment.
+func NewWindow(ctx context.Context, session, workdir, name string, env map[string]string) (string, error) {
+	args := []string{"new-window", "-t", sanitizeName(session), "-c", workdir, "-P", "-F", "#{window_id}"}
+	if name != "" {
+		args = append(args, "-n", name)
+	}
+	args = append(args, envArgs(env)...)
+	return outputContext(ctx, args...)
+}
+
+// exitStatusPrefix prefixes the session option a command started by
+// RunInWindow records its exit status in, followed by its wait-for channel.
+const exitStatusPrefix = "@remux_exit_"
+
+// runInWindowScript runs the command in $1, records its exit status in the
+// session option $4 of session $2 and signals the wait-for channel $3. A
+// window whose command failed is kept open until Enter is pressed, so the
+// error can be read.
+const runInWindowScript = `sh -c "$1"
+status=$?
+tmux set-option -t "$2" "$4" "$status"
+tmux wait-for -S "$3"
+if [ "$status" -ne 0 ]; then
+	printf '\nExited with %d, press Enter to close ' "$status"
+	read -r _
+fi`
+
+// WindowRun is a command started by RunInWindow.
+type WindowRun struct {
+	Session string
+	Window  string // Window ID
+	channel string // wait-for channel signalled once the command exited
+}
+
+// RunInWindow runs a shell command in a new window of the session that isn't
+// selected, so it keeps running when the caller exits. The command gets env
+// on top of the session environment. The window closes once the command
+// succeeded. See WindowRun.Wait.
+func RunInWindow(ctx context.Context, session, workdir, name, command string, env map[string]string) (*WindowRun, error) {
+	r := &WindowRun{
+		Session: sanitizeName(session),
+		channel: fmt.Sprintf("remux-%d-%d", os.Getpid(), time.Now().UnixNano()),
+	}
+	args := []string{"new-window", "-d", "-t", r.Session, "-c", workdir, "-P", "-F", "#{window_id}"}
 	if name != "" {
 		args = append(args, "-n", name)
 	}
-	return run(args...)
+	args = append(args, envArgs(env)...)
+	// Several arguments are run without a shell, so the command isn't quoted
+	args = append(args, "sh", "-c", runInWindowScript, "remux", command, r.Session, r.channel, exitStatusPrefix+r.channel)
+	window, err := outputContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	r.Window = window
+	return r, nil
+}
+
+// Wait blocks until the command exited, and returns its exit status.
+// Cancelling ctx stops the waiting but not the command.
+func (r *WindowRun) Wait(ctx context.Context) (int, error) {
+	// Not through the control client, which wait-for would block
+	if err := exec.CommandContext(ctx, "tmux", "wait-for", r.channel).Run(); err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, err
+	}
+	option := exitStatusPrefix + r.channel
+	out, err := output("show-options", "-q", "-v", "-t", r.Session, option)
+	if err != nil {
+		return 0, err
+	}
+	_ = run("set-option", "-u", "-t", r.Session, option)
+	status, err := strconv.Atoi(out)
+	if err != nil {
+		return 0, fmt.Errorf("no exit status of window %s", r.Window)
+	}
+	return status, nil
+}
+
+// ActiveWindow returns the window ID of the active window in the given session.
+func ActiveWindow(ctx context.Context, session string) (string, error) {
+	return outputContext(ctx, "display-message", "-p", "-t", sanitizeName(session), "#{window_id}")
 }
 
 // SendKeys sends keys to a window in the given session.
 // If window is empty, the active window is targeted.
-func SendKeys(session, window, keys string) error {
+func SendKeys(ctx context.Context, session, window, keys string) error {
 	target := sanitizeName(session)
 	if window != "" {
 		target += ":" + window
 	}
-	return run("send-keys", "-t", target, keys, "Enter")
+	return runContext(ctx, "send-keys", "-t", target, keys, "Enter")
 }
 
 // RenameWindow renames a window in the given session.
 // If target is empty, the active window is renamed.
-func RenameWindow(session, target, newName string) error {
+func RenameWindow(ctx context.Context, session, target, newName string) error {
 	t := sanitizeName(session)
 	if target != "" {
 		t += ":" + target
 	}
-	return run("rename-window", "-t", t, newName)
+	return runContext(ctx, "rename-window", "-t", t, newName)
+}
+
+// Split describes where SplitPane puts a new pane.
+type Split struct {
+	Direction string // right, left, below or above the pane split (default: below)
+	Size      string // Columns or lines, or a percentage such as 30%, of the new pane (default: half)
+}
+
+// args returns the split-window flags placing the new pane.
+func (s Split) args() []string {
+	var args []string
+	switch s.Direction {
+	case "right":
+		args = append(args, "-h")
+	case "left":
+		args = append(args, "-h", "-b")
+	case "above":
+		args = append(args, "-v", "-b")
+	default:
+		args = append(args, "-v")
+	}
+	if s.Size != "" {
+		args = append(args, "-l", s.Size)
+	}
+	return args
+}
+
+// SplitPane splits a pane by ID, starting a shell in workdir with env on top
+// of the session environment, and returns the new pane's ID. The active pane
+// is left unchanged.
+func SplitPane(ctx context.Context, pane, workdir string, env map[string]string, split Split) (string, error) {
+	args := []string{"split-window", "-d", "-t", pane, "-c", workdir, "-P", "-F", "#{pane_id}"}
+	args = append(args, split.args()...)
+	return outputContext(ctx, append(args, envArgs(env)...)...)
+}
+
+// SplitPanes splits a window of the given session into one more pane per
+// split, each split off the pane made before it, and returns the IDs of the
+// window's panes in order, starting with the pane it had. That pane stays
+// active.
+func SplitPanes(ctx context.Context, session, window, workdir string, env map[string]string, splits []Split) ([]string, error) {
+	first, err := outputContext(ctx, "display-message", "-p", "-t", sanitizeName(session)+":"+window, "#{pane_id}")
+	if err != nil {
+		return nil, err
+	}
+	panes := []string{first}
+	for _, split := range splits {
+		id, err := SplitPane(ctx, panes[len(panes)-1], workdir, env, split)
+		if err != nil {
+			return panes, err
+		}
+		panes = append(panes, id)
+	}
+	return panes, nil
+}
+
+// SelectLayout arranges the panes of a window with a preset layout, e.g. "tiled".
+func SelectLayout(ctx context.Context, session, window, layout string) error {
+	return runContext(ctx, "select-layout", "-t", sanitizeName(session)+":"+window, layout)
+}
+
+// SynchronizePanes makes input typed into one pane of a window go to all of its panes.
+func SynchronizePanes(ctx context.Context, session, window string) error {
+	return runContext(ctx, "set-window-option", "-t", sanitizeName(session)+":"+window, "synchronize-panes", "on")
+}
+
+// nameOption is the window option keeping the name of a window that is
+// renamed automatically, see AutoRename.
+const nameOption = "@remux_name"
+
+// AutoRename has tmux keep renaming a window to the expansion of a format,
+// e.g. "#{pane_current_command}", as commands start and exit in it. The
+// window's current name is kept for WindowNames.
+func AutoRename(ctx context.Context, session, window, format string) error {
+	target := sanitizeName(session) + ":" + window
+	if err := runContext(ctx, "set-option", "-w", "-F", "-t", target, nameOption, "#{window_name}"); err != nil {
+		return err
+	}
+	if err := runContext(ctx, "set-window-option", "-t", target, "automatic-rename-format", format); err != nil {
+		return err
+	}
+	return runContext(ctx, "set-window-option", "-t", target, "automatic-rename", "on")
+}
+
+// SetTitle makes tmux set the outer terminal's title to title while a client
+// is attached to the session. The active window's name is appended, so the
+// title follows automatic-rename as commands start and exit.
+func SetTitle(session, title string) error {
+	target := sanitizeName(session)
+	if err := run("set-option", "-t", target, "set-titles", "on"); err != nil {
+		return err
+	}
+	// The title string is a tmux format, so literal #s must be doubled
+	format := strings.ReplaceAll(title, "#", "##") + " - #W"
+	return run("set-option", "-t", target, "set-titles-string", format)
+}
+
+// SetOption sets a session option, such as a user option named @name.
+func SetOption(session, name, value string) error {
+	return run("set-option", "-t", sanitizeName(session), name, value)
+}
+
+// ShowOption returns the value of a session option, or "" if it isn't set.
+func ShowOption(session, name string) (string, error) {
+	return output("show-options", "-q", "-v", "-t", sanitizeName(session), name)
+}
+
+// Environment returns the session environment, which tmux gives to new
+// windows and panes. Variables marked for removal are left out.
+func Environment(session string) (map[string]string, error) {
+	out, err := output("show-environment", "-t", sanitizeName(session))
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			env[key] = value
+		}
+	}
+	return env, nil
+}
+
+// SetEnvironment sets a variable in the session environment. Running
+// processes keep their env; new windows and panes get the value.
+func SetEnvironment(session, key, value string) error {
+	return run("set-environment", "-t", sanitizeName(session), key, value)
+}
+
+// UnsetEnvironment removes a variable from the session environment.
+func UnsetEnvironment(session, key string) error {
+	return run("set-environment", "-u", "-t", sanitizeName(session), key)
 }
 
 // SelectWindow selects a window in the given session.
 // If window is empty, the active window is targeted.
-func SelectWindow(session, window string) error {
+func SelectWindow(ctx context.Context, session, window string) error {
 	target := sanitizeName(session)
 	if window != "" {
 		target += ":" + window
 	}
-	return run("select-window", "-t", target)
+	return runContext(ctx, "select-window", "-t", target)
 }
 
+// ListSessions returns the names of all running tmux sessions.
+// Returns an empty list if no tmux server is running.
+func ListSessions() ([]string, error) {
+	out, stderr, err := command(context.Background(), "list-sessions", "-F", "#{session_name}")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// tmux exits non-zero when no server is running
+			return nil, nil
+		}
+		return nil, commandError(err, stderr)
+	}
+
+	var sessions []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			sessions = append(sessions, line)
+		}
+	}
+	return sessions, nil
+}
+
+// SessionActivity describes how recently a tmux session was used.
+type SessionActivity struct {
+	Name         string
+	Clients      int       // Number of attached clients
+	LastActivity time.Time // Last input from a client or output of a pane
+}
+
+// ListSessionActivity returns the activity of all running tmux sessions.
+// Returns an empty list if no tmux server is running.
+func ListSessionActivity() ([]SessionActivity, error) {
+	sessions, err := ListSessions()
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	out, err := output("list-sessions", "-F", "#{session_name} #{session_attached} #{session_activity}")
+	if err != nil {
+		return nil, err
+	}
+	// session_activity only covers client input, pane output moves window_activity
+	windows, err := output("list-windows", "-a", "-F", "#{session_name} #{window_activity}")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []SessionActivity
+	index := make(map[string]int)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		clients, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected client count %q", fields[1])
+		}
+		activity, err := parseUnixTime(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		index[fields[0]] = len(result)
+		result = append(result, SessionActivity{Name: fields[0], Clients: clients, LastActivity: activity})
+	}
+	for _, line := range strings.Split(windows, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		i, ok := index[fields[0]]
+		if !ok {
+			continue
+		}
+		activity, err := parseUnixTime(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		if activity.After(result[i].LastActivity) {
+			result[i].LastActivity = activity
+		}
+	}
+	return result, nil
+}
+
+// parseUnixTime parses a time printed by a tmux format in seconds since the epoch.
+func parseUnixTime(field string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected activity time %q", field)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// PanePIDs returns the PIDs of the processes started in each pane of the
+// session, usually the pane shells.
+func PanePIDs(session string) ([]int, error) {
+	out, err := output("list-panes", "-s", "-t", sanitizeName(session), "-F", "#{pane_pid}")
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(out) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected pane pid %q", field)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// Pane describes a pane of a tmux session.
+type Pane struct {
+	ID             string // e.g. "%3", usable as a target
+	Window         int    // Index of the window holding the pane
+	CurrentCommand string // Foreground command, e.g. "zsh" or "vim"
+	CurrentPath    string // Working directory of the foreground process
+}
+
+// ListPanes returns all panes in all windows of the session.
+func ListPanes(session string) ([]Pane, error) {
+	// tmux may print tabs as underscores, so fields are separated by spaces
+	// with the path, which can contain them, last
+	out, err := output("list-panes", "-s", "-t", sanitizeName(session), "-F", "#{pane_id} #{window_index} #{pane_current_command} #{pane_current_path}")
+	if err != nil {
+		return nil, err
+	}
+
+	var panes []Pane
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		window, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected window index %q", fields[1])
+		}
+		panes = append(panes, Pane{ID: fields[0], Window: window, CurrentCommand: fields[2], CurrentPath: fields[3]})
+	}
+	return panes, nil
+}
+
+// SessionPath returns the working directory the session was started in.
+func SessionPath(session string) (string, error) {
+	return output("display-message", "-p", "-t", sanitizeName(session), "#{session_path}")
+}
+
+// WindowNames returns the names of the session's windows in order. Windows
+// renamed automatically are listed by the name they had before.
+func WindowNames(session string) ([]string, error) {
+	out, err := output("list-windows", "-t", sanitizeName(session), "-F", "#{?"+nameOption+",#{"+nameOption+"},#{window_name}}")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// CapturePane returns up to lines lines of a pane's scrollback and visible
+// content as plain text, with wrapped lines joined.
+func CapturePane(pane string, lines int) (string, error) {
+	return output("capture-pane", "-p", "-J", "-t", pane, "-S", strconv.Itoa(-lines))
+}
+
+// PipePane appends the output of the active pane of a window to file.
+func PipePane(ctx context.Context, session, window, file string) error {
+	quoted := "'" + strings.ReplaceAll(file, "'", `'\''`) + "'"
+	return runContext(ctx, "pipe-pane", "-o", "-t", sanitizeName(session)+":"+window, "cat >> "+quoted)
+}
+
+// SendKeysToPane sends keys followed by Enter to a pane by ID.
+func SendKeysToPane(ctx context.Context, pane, keys string) error {
+	return runContext(ctx, "send-keys", "-t", pane, keys, "Enter")
+}
+
+// RenameSession renames a tmux session.
+func RenameSession(oldName, newName string) error {
+	return run("rename-session", "-t", sanitizeName(oldName), sanitizeName(newName))
+}
@@ -1,9 +1,12 @@
 package tmux_test
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -125,12 +128,30 @@ var _ = Describe("Tmux", func() {
 				workdir, err := os.Getwd()
 				Expect(err).NotTo(HaveOccurred())
 
-				err = tmux.NewSessionDetached(testSession, workdir, nil)
+				err = tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(tmux.SessionExists(testSession)).To(BeTrue())
 			})
 
+			It("returns ErrSessionExists when the session is already running", func() {
+				workdir, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)).To(Succeed())
+
+				err = tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)
+				Expect(err).To(MatchError(tmux.ErrSessionExists))
+			})
+
+			It("does not create a session once the context is cancelled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				Expect(tmux.NewSessionDetached(ctx, testSession, GinkgoT().TempDir(), nil)).NotTo(Succeed())
+				Expect(tmux.SessionExists(testSession)).To(BeFalse())
+			})
+
 			It("creates a session with environment variables accessible to the shell", func() {
 				workdir, err := os.Getwd()
 				Expect(err).NotTo(HaveOccurred())
@@ -138,7 +159,7 @@ var _ = Describe("Tmux", func() {
 				env := map[string]string{
 					"TEST_VAR": "test_value",
 				}
-				err = tmux.NewSessionDetached(testSession, workdir, env)
+				err = tmux.NewSessionDetached(context.Background(), testSession, workdir, env)
 				Expect(err).NotTo(HaveOccurred())
 
 				value, err := getEnvFromShell(testSession, "TEST_VAR")
@@ -154,7 +175,7 @@ var _ = Describe("Tmux", func() {
 					"VAR_ONE": "value1",
 					"VAR_TWO": "value2",
 				}
-				err = tmux.NewSessionDetached(testSession, workdir, env)
+				err = tmux.NewSessionDetached(context.Background(), testSession, workdir, env)
 				Expect(err).NotTo(HaveOccurred())
 
 				val1, err := getEnvFromShell(testSession, "VAR_ONE")
@@ -176,19 +197,214 @@ var _ = Describe("Tmux", func() {
 				workdir, err := os.Getwd()
 				Expect(err).NotTo(HaveOccurred())
 
-				err = tmux.NewSessionDetached(testSession, workdir, nil)
+				err = tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(tmux.SessionExists(testSession)).To(BeTrue())
 			})
 		})
 
+		Describe("ListSessions", func() {
+			It("includes a running session", func() {
+				workdir, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+
+				err = tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				sessions, err := tmux.ListSessions()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sessions).To(ContainElement(testSession))
+			})
+		})
+
+		Describe("ListSessionActivity", func() {
+			It("reports a detached session as recently active", func() {
+				workdir, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)).To(Succeed())
+
+				sessions, err := tmux.ListSessionActivity()
+				Expect(err).NotTo(HaveOccurred())
+				var found *tmux.SessionActivity
+				for i := range sessions {
+					if sessions[i].Name == testSession {
+						found = &sessions[i]
+					}
+				}
+				Expect(found).NotTo(BeNil())
+				Expect(found.Clients).To(BeZero())
+				Expect(found.LastActivity).To(BeTemporally("~", time.Now(), time.Minute))
+			})
+		})
+
+		Describe("NewWindow", func() {
+			It("returns a window ID usable as a target", func() {
+				workdir, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+
+				err = tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				first, err := tmux.ActiveWindow(context.Background(), testSession)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(first).To(HavePrefix("@"))
+
+				id, err := tmux.NewWindow(context.Background(), testSession, workdir, "second", nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(id).To(HavePrefix("@"))
+				Expect(id).NotTo(Equal(first))
+
+				Expect(tmux.RenameWindow(context.Background(), testSession, id, "renamed")).To(Succeed())
+				out, err := exec.Command("tmux", "list-windows", "-t", testSession, "-F", "#{window_name}").Output()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(out)).To(ContainSubstring("renamed"))
+			})
+		})
+
+		Describe("RunInWindow", func() {
+			It("waits for the command and returns its exit status", func() {
+				workdir, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tmux.NewSessionDetached(context.Background(), testSession, workdir, map[string]string{"HOOK_STATUS": "3"})).To(Succeed())
+				first, err := tmux.ActiveWindow(context.Background(), testSession)
+				Expect(err).NotTo(HaveOccurred())
+
+				run, err := tmux.RunInWindow(context.Background(), testSession, workdir, "hooks", "true", nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(run.Wait(context.Background())).To(Equal(0))
+
+				// The session env is inherited, and failed windows stay open
+				run, err = tmux.RunInWindow(context.Background(), testSession, workdir, "hooks", `echo "it's failing"; exit $(($HOOK_STATUS + $EXTRA))`, map[string]string{"EXTRA": "1"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(run.Wait(context.Background())).To(Equal(4))
+				Expect(tmux.WindowNames(testSession)).To(ContainElement("hooks"))
+
+				// The window isn't selected
+				active, err := tmux.ActiveWindow(context.Background(), testSession)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(active).To(Equal(first))
+			})
+		})
+
+		Describe("Control", func() {
+			const otherSession = "automo-test-other"
+
+			AfterEach(func() {
+				tmux.UseControl(nil)
+				tmux.KillSession(otherSession)
+			})
+
+			It("runs commands and reports session events over one connection", func() {
+				workdir, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)).To(Succeed())
+
+				ctl, err := tmux.StartControl(testSession)
+				Expect(err).NotTo(HaveOccurred())
+				defer ctl.Close()
+
+				out, err := ctl.Run("display-message", "-p", `quoted "$value"; #{session_name}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(out).To(Equal(`quoted "$value"; ` + testSession))
+
+				_, err = ctl.Run("has-session", "-t", "non-existent-session-12345")
+				Expect(err).To(HaveOccurred())
+
+				tmux.UseControl(ctl)
+				Expect(tmux.NewSessionDetached(context.Background(), otherSession, workdir, nil)).To(Succeed())
+				Expect(tmux.SessionExists(otherSession)).To(BeTrue())
+				Expect(tmux.NewSessionDetached(context.Background(), otherSession, workdir, nil)).To(MatchError(tmux.ErrSessionExists))
+				Expect(tmux.SetOption("non-existent-session-12345", "@remux_test", "1")).To(MatchError(ContainSubstring("non-existent-session-12345")))
+				sessions, err := tmux.ListSessions()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sessions).To(ContainElement(otherSession))
+
+				Eventually(ctl.Events()).Should(Receive(HaveField("Name", "sessions-changed")))
+			})
+
+			It("serves its commands to other processes", func() {
+				workdir, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)).To(Succeed())
+
+				ctl, err := tmux.StartControl(testSession)
+				Expect(err).NotTo(HaveOccurred())
+				defer ctl.Close()
+				socket := filepath.Join(GinkgoT().TempDir(), "daemon.sock")
+				ln, err := net.Listen("unix", socket)
+				Expect(err).NotTo(HaveOccurred())
+				defer ln.Close()
+				go func() { _ = ctl.Serve(ln) }()
+
+				remote := tmux.NewRemote(socket)
+				defer remote.Close()
+				out, err := remote.Run("display-message", "-p", "-t", testSession, "#{session_name}")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(out).To(Equal(testSession))
+
+				tmux.UseControl(remote)
+				Expect(tmux.NewSessionDetached(context.Background(), otherSession, workdir, nil)).To(Succeed())
+				Expect(tmux.NewSessionDetached(context.Background(), otherSession, workdir, nil)).To(MatchError(tmux.ErrSessionExists))
+				Expect(tmux.SetOption("non-existent-session-12345", "@remux_test", "1")).To(MatchError(ContainSubstring("non-existent-session-12345")))
+				Eventually(ctl.Events()).Should(Receive(HaveField("Name", "sessions-changed")))
+			})
+
+			It("runs commands by a tmux process when no daemon serves the socket", func() {
+				tmux.UseControl(tmux.NewRemote(filepath.Join(GinkgoT().TempDir(), "daemon.sock")))
+				Expect(tmux.NewSessionDetached(context.Background(), otherSession, GinkgoT().TempDir(), nil)).To(Succeed())
+				Expect(tmux.SessionExists(otherSession)).To(BeTrue())
+			})
+		})
+
+		Describe("Detach", func() {
+			It("reports ErrNoClient without printing when no client is attached", func() {
+				workdir, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)).To(Succeed())
+
+				// TMUX as seen by a shell of the session, which has no client
+				out, err := exec.Command("tmux", "display-message", "-p", "-t", testSession, "#{socket_path},#{pid},#{session_id}").Output()
+				Expect(err).NotTo(HaveOccurred())
+				GinkgoT().Setenv("TMUX", strings.ReplaceAll(strings.TrimSpace(string(out)), "$", ""))
+
+				stderr, err := os.CreateTemp(GinkgoT().TempDir(), "stderr")
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(func(original *os.File) { os.Stderr = original }, os.Stderr)
+				os.Stderr = stderr
+
+				Expect(tmux.CurrentSession()).To(Equal(testSession))
+				Expect(tmux.Detach()).To(MatchError(tmux.ErrNoClient))
+				Expect(tmux.SwitchToLast()).To(MatchError(tmux.ErrNoClient))
+				written, err := os.ReadFile(stderr.Name())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(written)).To(BeEmpty())
+			})
+		})
+
+		Describe("errors", func() {
+			It("returns tmux's message instead of printing it", func() {
+				Expect(tmux.NewSessionDetached(context.Background(), testSession, GinkgoT().TempDir(), nil)).To(Succeed())
+				stderr, err := os.CreateTemp(GinkgoT().TempDir(), "stderr")
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(func(original *os.File) { os.Stderr = original }, os.Stderr)
+				os.Stderr = stderr
+
+				err = tmux.SetOption("non-existent-session-12345", "@remux_test", "1")
+				Expect(err).To(MatchError(ContainSubstring("non-existent-session-12345")))
+				Expect(tmux.SessionExists("non-existent-session-12345")).To(BeFalse())
+				written, err := os.ReadFile(stderr.Name())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(written)).To(BeEmpty())
+			})
+		})
+
 		Describe("KillSession", func() {
 			It("kills an existing session", func() {
 				workdir, err := os.Getwd()
 				Expect(err).NotTo(HaveOccurred())
 
-				err = tmux.NewSessionDetached(testSession, workdir, nil)
+				err = tmux.NewSessionDetached(context.Background(), testSession, workdir, nil)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(tmux.SessionExists(testSession)).To(BeTrue())
 
@@ -0,0 +1,119 @@
+// Package zellij runs space sessions in Zellij, configured through generated
+// KDL layout files.
+package zellij
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/johanhenriksson/remux/config"
+)
+
+// SessionExists reports whether a live Zellij session with the given name is
+// running. Exited sessions kept for resurrection don't count.
+func SessionExists(name string) bool {
+	out, err := exec.Command("zellij", "list-sessions", "--no-formatting").Output()
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == name && !strings.Contains(line, "EXITED") {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSession starts a session from a layout file and attaches to it. The
+// session inherits env. An exited session of the same name is deleted first,
+// since it would be resurrected with its old layout instead.
+func NewSession(name, layout string, env map[string]string) error {
+	_ = exec.Command("zellij", "delete-session", name).Run()
+
+	cmd := exec.Command("zellij", "--session", name, "--new-session-with-layout", layout)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Attach attaches to a running session.
+func Attach(name string) error {
+	cmd := exec.Command("zellij", "attach", name)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// KillSession kills a session and deletes it so it can't be resurrected.
+func KillSession(name string) {
+	_ = exec.Command("zellij", "delete-session", "--force", name).Run()
+}
+
+// Layout returns a KDL layout with one tab per config tab, starting in the
+// tab's dir or workdir, with Zellij's default tab and status bars. Tab commands run in
+// shell, which stays open once the command exits. The first tab is focused.
+func Layout(workdir, shell string, tabs []config.Tab) string {
+	if len(tabs) == 0 {
+		tabs = []config.Tab{{}}
+	}
+
+	var b strings.Builder
+	b.WriteString("layout {\n")
+	b.WriteString("    default_tab_template {\n")
+	b.WriteString("        pane size=1 borderless=true {\n")
+	b.WriteString("            plugin location=\"zellij:tab-bar\"\n")
+	b.WriteString("        }\n")
+	b.WriteString("        children\n")
+	b.WriteString("        pane size=2 borderless=true {\n")
+	b.WriteString("            plugin location=\"zellij:status-bar\"\n")
+	b.WriteString("        }\n")
+	b.WriteString("    }\n")
+
+	for i, tab := range tabs {
+		b.WriteString("    tab")
+		if tab.Name != "" {
+			fmt.Fprintf(&b, " name=%s", quote(tab.Name))
+		}
+		fmt.Fprintf(&b, " cwd=%s", quote(tab.WorkDir(workdir)))
+		if i == 0 {
+			b.WriteString(" focus=true")
+		}
+		b.WriteString(" {\n")
+		// Zellij panes can't be given env, so the shell exports it
+		var commands []string
+		if exports := tab.Exports(); exports != "" {
+			commands = append(commands, exports)
+		}
+		if tab.Cmd != "" {
+			commands = append(commands, tab.Cmd)
+		}
+		if len(commands) == 0 {
+			b.WriteString("        pane\n")
+		} else {
+			fmt.Fprintf(&b, "        pane command=%s {\n", quote(shell))
+			fmt.Fprintf(&b, "            args \"-c\" %s\n", quote(strings.Join(commands, "; ")+"; exec "+shell))
+			b.WriteString("        }\n")
+		}
+		b.WriteString("    }\n")
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// quote returns s as a KDL string.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
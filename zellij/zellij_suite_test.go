@@ -0,0 +1,13 @@
+package zellij_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestZellij(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Zellij Suite")
+}
@@ -0,0 +1,71 @@
+package zellij_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/johanhenriksson/remux/config"
+	"github.com/johanhenriksson/remux/zellij"
+)
+
+var _ = Describe("Zellij", func() {
+	Describe("Layout", func() {
+		It("creates one tab per config tab", func() {
+			layout := zellij.Layout("/work", "/bin/zsh", []config.Tab{
+				{Name: "editor", Cmd: "nvim ."},
+				{Name: "shell"},
+			})
+
+			Expect(layout).To(ContainSubstring(`plugin location="zellij:tab-bar"`))
+			Expect(layout).To(ContainSubstring(`    tab name="editor" cwd="/work" focus=true {
+        pane command="/bin/zsh" {
+            args "-c" "nvim .; exec /bin/zsh"
+        }
+    }
+    tab name="shell" cwd="/work" {
+        pane
+    }
+`))
+		})
+
+		It("starts tabs in their dir with their env", func() {
+			layout := zellij.Layout("/work", "sh", []config.Tab{
+				{Name: "ui", Dir: "/work/frontend", Env: map[string]string{"PORT": "3000"}},
+			})
+			Expect(layout).To(ContainSubstring(`    tab name="ui" cwd="/work/frontend" focus=true {
+        pane command="sh" {
+            args "-c" "export PORT='3000'; exec sh"
+        }
+    }`))
+		})
+
+		It("falls back to a single shell tab", func() {
+			layout := zellij.Layout("/work", "sh", nil)
+			Expect(layout).To(ContainSubstring(`    tab cwd="/work" focus=true {
+        pane
+    }`))
+		})
+
+		It("escapes KDL strings", func() {
+			layout := zellij.Layout(`/my "work"`, "sh", []config.Tab{{Cmd: `echo a\b`}})
+			Expect(layout).To(ContainSubstring(`cwd="/my \"work\""`))
+			Expect(layout).To(ContainSubstring(`"echo a\\b; exec sh"`))
+		})
+	})
+
+	Describe("SessionExists", func() {
+		It("ignores exited sessions", func() {
+			dir := GinkgoT().TempDir()
+			script := "#!/bin/sh\necho 'repo-a [Created 2m ago]'\necho 'repo-b [Created 1h ago] (EXITED - attach to resurrect)'\n"
+			Expect(os.WriteFile(filepath.Join(dir, "zellij"), []byte(script), 0755)).To(Succeed())
+			GinkgoT().Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+			Expect(zellij.SessionExists("repo-a")).To(BeTrue())
+			Expect(zellij.SessionExists("repo-b")).To(BeFalse())
+			Expect(zellij.SessionExists("repo")).To(BeFalse())
+		})
+	})
+})